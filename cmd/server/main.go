@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"time"
@@ -17,13 +19,28 @@ import (
 	"github.com/qiangxue/go-rest-api/internal/account"
 	"github.com/qiangxue/go-rest-api/internal/album"
 	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/batch"
+	"github.com/qiangxue/go-rest-api/internal/certificate"
 	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/dnsrecord"
 	"github.com/qiangxue/go-rest-api/internal/domain"
+	"github.com/qiangxue/go-rest-api/internal/domaincheck"
+	"github.com/qiangxue/go-rest-api/internal/domainconfig"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/eventstream"
 	"github.com/qiangxue/go-rest-api/internal/healthcheck"
+	"github.com/qiangxue/go-rest-api/internal/i18n"
+	"github.com/qiangxue/go-rest-api/internal/idempotency"
+	"github.com/qiangxue/go-rest-api/internal/plan"
+	"github.com/qiangxue/go-rest-api/internal/webhook"
 	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/codec"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
 )
 
 // Version indicates the current version of the application.
@@ -31,6 +48,9 @@ var Version = "1.0.0"
 
 var flagConfig = flag.String("config", "./config/local.yml", "path to the config file")
 
+// idempotencyCleanupInterval is the interval between the deletions of expired idempotency keys.
+const idempotencyCleanupInterval = time.Hour
+
 func main() {
 	flag.Parse()
 	// create root logger tagged with server version
@@ -57,12 +77,76 @@ func main() {
 		}
 	}()
 
+	dbc := dbcontext.New(db)
+
+	// sign pagination cursors
+	if err := setCursorKey(logger, cfg); err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// order and renew certificates of verified domains in the background
+	certificates, err := buildCertificateService(logger, dbc, cfg)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	if certificates != nil {
+		go certificate.RunRenewal(ctx, certificates, time.Duration(cfg.CertificateCheckInterval)*time.Minute, logger)
+	}
+
+	// check the health of verified domains in the background
+	checks := domaincheck.NewService(domaincheck.NewRepository(dbc, logger),
+		domaincheck.Checker{CNAME: cfg.HealthCheckCNAME, IPs: cfg.HealthCheckIPs},
+		cfg.HealthCheckConcurrency, time.Duration(cfg.HealthCheckJitter)*time.Second, logger,
+	)
+	go domaincheck.RunChecks(ctx, checks, time.Duration(cfg.HealthCheckInterval)*time.Minute, logger)
+
+	// delete the expired responses of idempotent requests in the background
+	idempotencyKeys := idempotency.NewRepository(dbc, logger)
+	go idempotency.RunCleanup(ctx, idempotencyKeys, idempotencyCleanupInterval, logger)
+
+	// deliver the events of entity changes to webhooks in the background
+	webhookRepo, err := buildWebhookRepository(ctx, logger, dbc, cfg)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	webhookNetworks, err := webhook.ParseNetworks(cfg.WebhookAllowedNetworks)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+	webhooks := webhook.NewService(webhookRepo,
+		webhook.NewSender(time.Duration(cfg.WebhookTimeout)*time.Second, webhookNetworks),
+		event.NewPublisher(dbc, logger), buildNotifier(logger, cfg),
+		dbc.Transactional, cfg.WebhookMaxAttempts, cfg.WebhookFailureLimit, logger,
+	)
+	go webhook.RunDispatcher(ctx, webhooks, time.Duration(cfg.WebhookDispatchInterval)*time.Second, logger)
+
+	// stream the events saved by every server instance to the clients of the event stream
+	streams := eventstream.NewService(eventstream.NewRepository(dbc, logger),
+		time.Duration(cfg.EventStreamHeartbeat)*time.Second, cfg.EventStreamMaxConnections, logger,
+	)
+	go eventstream.Listen(ctx, cfg.DSN, streams, logger)
+
+	// validate requests against the API specification if configured
+	validator, err := buildValidator(cfg, certificates != nil)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(-1)
+	}
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(logger, dbc, cfg, certificates, checks, webhooks, streams, idempotencyKeys, validator),
 	}
+	// end the event streams on shutdown, as the server waits for all requests to complete
+	hs.RegisterOnShutdown(streams.Close)
 
 	// start the HTTP server with graceful shutdown
 	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
@@ -74,45 +158,213 @@ func main() {
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+// The certificate endpoints are only registered if certificates is not nil,
+// and requests are only validated against the API specification if validator is not nil.
+func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config, certificates certificate.Service, checks domaincheck.Service, webhooks webhook.Service, streams eventstream.Service, idempotencyKeys idempotency.Repository, validator *openapi.Validator) http.Handler {
 	router := routing.New()
 
+	codec.Register()
 	router.Use(
 		accesslog.Handler(logger),
+		i18n.Handler(),
 		errors.Handler(logger),
-		content.TypeNegotiator(content.JSON),
+		content.TypeNegotiator(content.JSON, codec.CSV, codec.NDJSON, codec.MsgPack),
+		pagination.Handler(true),
 		cors.Handler(cors.AllowAll),
 	)
+	if validator != nil {
+		router.Use(validator.Handler())
+	}
 
 	healthcheck.RegisterHandlers(router, Version)
+	openapi.RegisterHandlers(router, buildDocument(certificates != nil))
+	if certificates != nil {
+		certificate.RegisterChallengeHandlers(router, certificates)
+	}
 
 	rg := router.Group("/v1")
 
-	authHandler := auth.Handler(cfg.JWTSigningKey)
+	// authenticated POST requests can be retried safely with an Idempotency-Key header
+	authHandler := chainHandlers(
+		auth.Handler(cfg.JWTSigningKey),
+		idempotency.Handler(idempotencyKeys, time.Duration(cfg.IdempotencyKeyTTL)*time.Hour, logger),
+	)
+
+	// entity changes are published to the event outbox in the transactions making them
+	events := event.NewPublisher(db, logger)
 
 	album.RegisterHandlers(rg.Group(""),
-		album.NewService(album.NewRepository(db, logger), logger),
+		album.NewService(album.NewRepository(db, logger), events, db.Transactional, logger),
 		authHandler, logger,
 	)
 
 	account.RegisterHandlers(rg.Group(""),
-		account.NewService(account.NewRepository(db, logger), logger),
+		account.NewService(account.NewRepository(db, logger), events, db.Transactional, logger),
 		authHandler, logger,
 	)
 
+	plans := plan.NewService(plan.NewRepository(db, logger), logger)
+	plan.RegisterHandlers(rg.Group(""), plans, authHandler, logger)
+
 	domain.RegisterHandlers(rg.Group(""),
-		domain.NewService(domain.NewRepository(db, logger), logger),
+		domain.NewService(domain.NewRepository(db, logger), plans, events, db.Transactional, logger),
+		authHandler, logger,
+	)
+
+	domainconfig.RegisterHandlers(rg.Group(""),
+		domainconfig.NewService(domainconfig.NewRepository(db, logger), logger),
+		authHandler, logger,
+	)
+
+	dnsrecord.RegisterHandlers(rg.Group(""),
+		dnsrecord.NewService(dnsrecord.NewRepository(db, logger), buildDNSProvider(logger, cfg), db.Transactional, logger),
 		authHandler, logger,
 	)
 
+	if certificates != nil {
+		certificate.RegisterHandlers(rg.Group(""), certificates, logger)
+	}
+
+	domaincheck.RegisterHandlers(rg.Group(""), checks, logger)
+
+	webhook.RegisterHandlers(rg.Group(""), webhooks, authHandler, logger)
+
+	eventstream.RegisterHandlers(rg.Group(""), streams, authHandler, logger)
+
 	auth.RegisterHandlers(rg.Group(""),
 		auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, logger),
 		logger,
 	)
 
+	// the operations of a batch are dispatched through the router with the authorization of the batch
+	batch.RegisterHandlers(rg.Group(""),
+		batch.NewService(router, db.Transactional, logger),
+		authHandler, logger,
+	)
+
 	return router
 }
 
+// buildDocument builds the OpenAPI document describing the routes registered by buildHandler.
+// The certificate routes are only described if withCertificates is true.
+func buildDocument(withCertificates bool) *openapi.Document {
+	doc := openapi.NewDocument("Go RESTful API", Version, errors.ErrorResponse{})
+	doc.AddErrorBody(errors.MediaTypeProblem, errors.Problem{})
+	doc.Add("", "meta", healthcheck.Routes)
+	doc.Add("", "meta", openapi.Routes)
+	doc.Add("/v1", "albums", album.Routes)
+	doc.Add("/v1", "accounts", account.Routes)
+	doc.Add("/v1", "plans", plan.Routes)
+	doc.Add("/v1", "domains", domain.Routes)
+	doc.Add("/v1", "domain configs", domainconfig.Routes)
+	doc.Add("/v1", "dns records", dnsrecord.Routes)
+	if withCertificates {
+		doc.Add("", "certificates", certificate.ChallengeRoutes)
+		doc.Add("/v1", "certificates", certificate.Routes)
+	}
+	doc.Add("/v1", "domain checks", domaincheck.Routes)
+	doc.Add("/v1", "webhooks", webhook.Routes)
+	doc.Add("/v1", "events", eventstream.Routes)
+	doc.Add("/v1", "auth", auth.Routes)
+	doc.Add("/v1", "batch", batch.Routes)
+	return doc
+}
+
+// buildValidator creates the validator of requests against the configured OpenAPI document, or against
+// the generated one if none is configured. It returns nil if requests are not validated.
+func buildValidator(cfg *config.Config, withCertificates bool) (*openapi.Validator, error) {
+	if !cfg.ValidateRequests {
+		return nil, nil
+	}
+	if cfg.OpenAPIFile == "" {
+		return buildDocument(withCertificates).Validator()
+	}
+	data, err := ioutil.ReadFile(cfg.OpenAPIFile)
+	if err != nil {
+		return nil, err
+	}
+	return openapi.NewValidator(data)
+}
+
+// chainHandlers returns a handler that calls the given handlers in order until one of them fails.
+func chainHandlers(handlers ...routing.Handler) routing.Handler {
+	return func(c *routing.Context) error {
+		for _, handler := range handlers {
+			if err := handler(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// buildWebhookRepository creates the webhook repository encrypting webhook secrets with the configured key.
+// It encrypts the secrets of the webhooks saved before secrets were encrypted.
+func buildWebhookRepository(ctx context.Context, logger log.Logger, db *dbcontext.DB, cfg *config.Config) (webhook.Repository, error) {
+	box, err := secretbox.NewFromString(cfg.WebhookEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	repo := webhook.NewRepository(db, box, logger)
+	count, err := repo.EncryptSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		logger.Infof("encrypted the secrets of %v webhooks", count)
+	}
+	return repo, nil
+}
+
+// buildCertificateService creates the service that orders domain certificates from the configured ACME server.
+// It returns nil if no ACME server is configured.
+func buildCertificateService(logger log.Logger, db *dbcontext.DB, cfg *config.Config) (certificate.Service, error) {
+	if cfg.ACMEDirectoryURL == "" {
+		return nil, nil
+	}
+	box, err := secretbox.NewFromString(cfg.CertificateEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	repo := certificate.NewRepository(db, logger)
+	issuer := certificate.NewACMEIssuer(cfg.ACMEDirectoryURL, cfg.ACMEEmail, nil, repo, box, logger)
+	renewBefore := time.Duration(cfg.CertificateRenewBefore) * 24 * time.Hour
+	return certificate.NewService(repo, issuer, box, renewBefore, logger), nil
+}
+
+// buildDNSProvider creates the provider pushing the changes of managed DNS zones to the configured DNS server.
+// Zones are only kept in memory if no DNS server is configured.
+func buildDNSProvider(logger log.Logger, cfg *config.Config) dnsrecord.DNSProvider {
+	if cfg.DNSUpdateServer == "" {
+		logger.Info("no DNS update server configured, managed DNS zones are kept in memory")
+		return dnsrecord.NewMemoryProvider()
+	}
+	timeout := time.Duration(cfg.DNSUpdateTimeout) * time.Second
+	return dnsrecord.NewRFC2136Provider(cfg.DNSUpdateServer, cfg.DNSUpdateKeyName, cfg.DNSUpdateKeySecret, cfg.DNSUpdateKeyAlgorithm, timeout)
+}
+
+// buildNotifier creates the notifier emailing the owners of webhooks through the configured SMTP server.
+// Notifications are only logged if no SMTP server is configured.
+func buildNotifier(logger log.Logger, cfg *config.Config) webhook.Notifier {
+	if cfg.SMTPServer == "" {
+		logger.Info("no SMTP server configured, webhook notifications are only logged")
+		return webhook.NewLogNotifier(logger)
+	}
+	return webhook.NewSMTPNotifier(cfg.SMTPServer, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+}
+
+// setCursorKey sets the key signing pagination cursors to the configured one, or to a random key if none is configured.
+func setCursorKey(logger log.Logger, cfg *config.Config) error {
+	if cfg.CursorSigningKey != "" {
+		pagination.CursorKey = []byte(cfg.CursorSigningKey)
+		return nil
+	}
+	logger.Info("no cursor signing key configured, cursors expire when the server restarts")
+	pagination.CursorKey = make([]byte, 32)
+	_, err := rand.Read(pagination.CursorKey)
+	return err
+}
+
 // logDBQuery returns a logging function that can be used to log SQL queries.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
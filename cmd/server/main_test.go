@@ -2,11 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/qiangxue/go-rest-api/pkg/log"
-	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/certificate"
+	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/domaincheck"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/eventstream"
+	"github.com/qiangxue/go-rest-api/internal/idempotency"
+	"github.com/qiangxue/go-rest-api/internal/webhook"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v4"
 )
 
 func Test_logDBQuery(t *testing.T) {
@@ -38,3 +53,104 @@ func Test_logDBExec(t *testing.T) {
 		assert.Equal(t, "DB execution error: test", entries.All()[0].Message)
 	}
 }
+
+func Test_buildDocument(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := dbcontext.New(nil)
+	certificates := certificate.NewService(certificate.NewRepository(db, logger), nil, nil, 0, logger)
+	checks := domaincheck.NewService(domaincheck.NewRepository(db, logger), domaincheck.Checker{}, 1, 0, logger)
+	webhooks := webhook.NewService(webhook.NewRepository(db, nil, logger), webhook.NewSender(time.Second, nil), &event.Recorder{}, webhook.NewLogNotifier(logger), db.Transactional, 1, 1, logger)
+	streams := eventstream.NewService(eventstream.NewRepository(db, logger), time.Second, 1, logger)
+
+	for _, withCertificates := range []bool{true, false} {
+		var service certificate.Service
+		if withCertificates {
+			service = certificates
+		}
+		router := buildHandler(logger, db, &config.Config{}, service, checks, webhooks, streams, idempotency.NewRepository(db, logger), nil).(*routing.Router)
+		doc := buildDocument(withCertificates)
+
+		// every registered route must be documented, and every documented route registered
+		registered := map[[2]string]bool{}
+		for _, route := range router.Routes() {
+			registered[[2]string{route.Method(), route.Path()}] = true
+			assert.True(t, doc.Has(route.Method(), route.Path()), "undocumented route %v %v", route.Method(), route.Path())
+		}
+		for _, op := range doc.Operations() {
+			assert.True(t, registered[op], "unregistered route %v %v", op[0], op[1])
+		}
+	}
+
+	// the document is served as JSON
+	router := buildHandler(logger, db, &config.Config{}, nil, checks, webhooks, streams, idempotency.NewRepository(db, logger), nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	var spec map[string]interface{}
+	if assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &spec)) {
+		assert.Equal(t, "3.1.0", spec["openapi"])
+		assert.Contains(t, spec["paths"], "/v1/albums/{id}")
+	}
+}
+
+func Test_buildValidator(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := dbcontext.New(nil)
+	checks := domaincheck.NewService(domaincheck.NewRepository(db, logger), domaincheck.Checker{}, 1, 0, logger)
+	webhooks := webhook.NewService(webhook.NewRepository(db, nil, logger), webhook.NewSender(time.Second, nil), &event.Recorder{}, webhook.NewLogNotifier(logger), db.Transactional, 1, 1, logger)
+	streams := eventstream.NewService(eventstream.NewRepository(db, logger), time.Second, 1, logger)
+
+	validator, err := buildValidator(&config.Config{}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, validator)
+	_, err = buildValidator(&config.Config{ValidateRequests: true, OpenAPIFile: "missing.json"}, false)
+	assert.NotNil(t, err)
+
+	validator, err = buildValidator(&config.Config{ValidateRequests: true}, false)
+	assert.Nil(t, err)
+	router := buildHandler(logger, db, &config.Config{}, nil, checks, webhooks, streams, idempotency.NewRepository(db, logger), validator)
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/login", strings.NewReader(`{"username":1,"password":"pass","remember":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{
+		"status": 400,
+		"code": "invalid_request",
+		"message": "There is some problem with the data you submitted.",
+		"details": [
+			{"in": "body", "pointer": "/remember", "error": "is not allowed"},
+			{"in": "body", "pointer": "/username", "error": "must be of type string"}
+		]
+	}`, res.Body.String())
+}
+
+func Test_buildHandler_contentNegotiation(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := dbcontext.New(nil)
+	checks := domaincheck.NewService(domaincheck.NewRepository(db, logger), domaincheck.Checker{}, 1, 0, logger)
+	webhooks := webhook.NewService(webhook.NewRepository(db, nil, logger), webhook.NewSender(time.Second, nil), &event.Recorder{}, webhook.NewLogNotifier(logger), db.Transactional, 1, 1, logger)
+	streams := eventstream.NewService(eventstream.NewRepository(db, logger), time.Second, 1, logger)
+	router := buildHandler(logger, db, &config.Config{}, nil, checks, webhooks, streams, idempotency.NewRepository(db, logger), nil)
+	msgpackBody, _ := msgpack.Marshal("OK " + Version)
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/json", `"OK ` + Version + `"` + "\n"},
+		{"text/csv", "text/csv; charset=utf-8", "value\nOK " + Version + "\n"},
+		{"application/x-ndjson", "application/x-ndjson", `"OK ` + Version + `"` + "\n"},
+		{"application/msgpack", "application/msgpack", string(msgpackBody)},
+	}
+	for _, tc := range tests {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthcheck", nil)
+		req.Header.Set("Accept", tc.accept)
+		router.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, tc.contentType, res.Header().Get("Content-Type"), tc.accept)
+		assert.Equal(t, tc.body, res.Body.String(), tc.accept)
+	}
+}
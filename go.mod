@@ -9,11 +9,14 @@ require (
 	github.com/go-ozzo/ozzo-validation/v4 v4.1.0
 	github.com/google/uuid v1.1.1
 	github.com/lib/pq v1.2.0
+	github.com/miekg/dns v1.1.31
 	github.com/qiangxue/go-env v1.0.0
 	github.com/stretchr/testify v1.4.0
+	github.com/vmihailenco/msgpack/v4 v4.3.12
 	go.uber.org/atomic v1.5.1 // indirect
 	go.uber.org/multierr v1.4.0 // indirect
 	go.uber.org/zap v1.13.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/lint v0.0.0-20200130185559-910be7a94367 // indirect
 	gopkg.in/yaml.v2 v2.2.2
 )
@@ -1,13 +1,21 @@
 package account
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
 	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/codec"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/export"
+	"github.com/qiangxue/go-rest-api/pkg/fieldset"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
@@ -23,38 +31,152 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 	r.Post("/accounts", res.create)
 	r.Put("/accounts/<id>", res.update)
 	r.Delete("/accounts/<id>", res.delete)
+	r.Get("/accounts:export", res.export)
 }
 
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/accounts/<id>", Summary: "Get an account", Params: openapi.Params(openapi.FieldsetParams, []openapi.Parameter{openapi.IfNoneMatchParam}),
+		Response: Account{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/accounts", Summary: "List accounts", Params: openapi.Params(openapi.PageParams, openapi.CursorParams, openapi.QueryParams, openapi.FieldsetParams),
+		Response: openapi.OneOf(openapi.Page(Account{}), openapi.CursorPage(Account{})), Errors: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/accounts", Summary: "Create an account", Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+		Request: CreateAccountRequest{}, Status: http.StatusCreated, Response: Account{}},
+	{Method: "PUT", Path: "/accounts/<id>", Summary: "Update an account", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: UpdateAccountRequest{}, Response: Account{}, Errors: []int{http.StatusPreconditionFailed}},
+	{Method: "DELETE", Path: "/accounts/<id>", Summary: "Delete an account", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Response: Account{}, Errors: []int{http.StatusBadRequest, http.StatusPreconditionFailed}},
+	{Method: "GET", Path: "/accounts:export", Summary: "Export accounts", Auth: true,
+		Params: openapi.Params(openapi.QueryParams, []openapi.Parameter{
+			openapi.QueryParam("format", "The export format, csv or ndjson. Defaults to the format accepted by the client."),
+		}),
+		Response: "", ResponseType: codec.NDJSON + "," + codec.CSV, Errors: []int{http.StatusBadRequest}},
+}
+
+// includeDomains is the relation that embeds the domains of the accounts.
+const includeDomains = "domains"
+
+// fieldSchema declares the fields of accounts that can be selected and the relations that can be embedded.
+var fieldSchema = fieldset.NewSchema(entity.Account{}, includeDomains)
+
 type resource struct {
 	service Service
 	logger  log.Logger
 }
 
 func (r resource) get(c *routing.Context) error {
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	accountId, err := strconv.Atoi(c.Param("id"))
 	account, err := r.service.Get(c.Request.Context(), accountId, c.Param("email"), c.Param("firebase_id"))
 	if err != nil {
 		return err
 	}
-
-	return c.Write(account)
+	if etag.NotModified(c.Response, c.Request, account.Version) {
+		return nil
+	}
+	if selection.IsEmpty() {
+		return c.Write(account)
+	}
+	items, err := r.render(c.Request.Context(), selection, []Account{account})
+	if err != nil {
+		return err
+	}
+	return c.Write(items[0])
 }
 
+// query writes a page of accounts, filtered and sorted as requested with the filter and sort query parameters.
+// Pages are in cursor mode if the cursor query parameter is present, and are numbered otherwise.
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	q, err := query.NewFromRequest(c.Request, querySchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pagination.IsCursorRequest(c.Request) {
+		return r.queryCursor(c, q, selection)
+	}
+	count, err := r.service.Count(ctx, q)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	accounts, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	accounts, err := r.service.Query(ctx, q, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = accounts
+	if !selection.IsEmpty() {
+		if pages.Items, err = r.render(ctx, selection, accounts); err != nil {
+			return err
+		}
+	}
+	return c.Write(pages)
+}
+
+// queryCursor writes a page of accounts in cursor mode. The total count is only included if requested.
+func (r resource) queryCursor(c *routing.Context, q query.Query, selection fieldset.Selection) error {
+	ctx := c.Request.Context()
+	pages, err := pagination.NewCursorFromRequest(c.Request, q)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pages.IncludeTotal {
+		count, err := r.service.Count(ctx, q)
+		if err != nil {
+			return err
+		}
+		pages.TotalCount = &count
+	}
+	accounts, err := r.service.Query(ctx, pages.Query(), 0, pages.Limit())
+	if err != nil {
+		return err
+	}
+	if err := pages.SetItems(accounts); err != nil {
+		return err
+	}
+	if !selection.IsEmpty() {
+		if pages.Items, err = r.render(ctx, selection, pages.Items.([]Account)); err != nil {
+			return err
+		}
+	}
 	return c.Write(pages)
 }
 
+// render returns the accounts with the fields and relations selected by the request.
+// The domains of all accounts are loaded with a single query if they are included.
+func (r resource) render(ctx context.Context, selection fieldset.Selection, accounts []Account) ([]fieldset.Resource, error) {
+	var domains map[int][]entity.Domain
+	if selection.Includes(includeDomains) {
+		ids := make([]int, len(accounts))
+		for i, account := range accounts {
+			ids[i] = account.ID
+		}
+		var err error
+		if domains, err = r.service.QueryDomains(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+	items := make([]fieldset.Resource, len(accounts))
+	for i, account := range accounts {
+		item, err := selection.Render(account)
+		if err != nil {
+			return nil, err
+		}
+		if domains != nil {
+			item[includeDomains] = domains[account.ID]
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
 func (r resource) create(c *routing.Context) error {
 	var input CreateAccountRequest
 	if err := c.Read(&input); err != nil {
@@ -66,10 +188,15 @@ func (r resource) create(c *routing.Context) error {
 		return err
 	}
 
+	etag.Set(c.Response, account.Version)
 	return c.WriteWithStatus(account, http.StatusCreated)
 }
 
 func (r resource) update(c *routing.Context) error {
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	var input UpdateAccountRequest
 	if err := c.Read(&input); err != nil {
 		r.logger.With(c.Request.Context()).Info(err)
@@ -77,21 +204,62 @@ func (r resource) update(c *routing.Context) error {
 	}
 
 	accountId, err := strconv.Atoi(c.Param("id"))
-	account, err := r.service.Update(c.Request.Context(), accountId, c.Param("email"), c.Param("firebase_id"), input)
+	account, err := r.service.Update(c.Request.Context(), accountId, c.Param("email"), c.Param("firebase_id"), version, input)
 	if err != nil {
 		return err
 	}
 
+	etag.Set(c.Response, account.Version)
 	return c.Write(account)
 }
 
 func (r resource) delete(c *routing.Context) error {
-
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	accountId, err := strconv.Atoi(c.Param("id"))
-	account, err := r.service.Delete(c.Request.Context(), accountId, c.Param("email"), c.Param("firebase_id"))
+	account, err := r.service.Delete(c.Request.Context(), accountId, c.Param("email"), c.Param("firebase_id"), version)
 	if err != nil {
 		return err
 	}
 
 	return c.Write(account)
 }
+
+// export streams the accounts matching the filter query parameters as NDJSON or CSV, in the order of the sort
+// query parameter. The accounts are read from a database cursor one at a time, and the export stops when
+// the client disconnects.
+func (r resource) export(c *routing.Context) error {
+	ctx := c.Request.Context()
+	format, err := export.FormatFromRequest(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	q, err := query.NewFromRequest(c.Request, querySchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+
+	w, err := export.NewWriter(ctx, c.Response, format, csvHeader)
+	if err != nil {
+		return err
+	}
+	err = r.service.Export(ctx, q, func(account Account) error {
+		return w.Write(account)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	// the error is responded as long as nothing has been sent, e.g. if the database cannot be queried
+	if err != nil && ctx.Err() == nil && !w.Started() {
+		return err
+	}
+	// once the export has started, the status code can no longer be changed, so errors are only logged
+	if err != nil && ctx.Err() != nil {
+		r.logger.With(ctx).Infof("account export canceled after %v accounts: %v", w.Count(), err)
+	} else if err != nil {
+		r.logger.With(ctx).Errorf("failed to export accounts after %v accounts: %v", w.Count(), err)
+	}
+	return nil
+}
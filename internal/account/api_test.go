@@ -7,6 +7,7 @@ import (
 
 	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 )
@@ -14,29 +15,69 @@ import (
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
 	repo := &mockRepository{items: []entity.Account{
-		{"123", "person@example.com", "xyz", time.Now(), time.Now()},
+		{ID: 123, Email: "person@example.com", FirebaseId: "xyz", PlanID: entity.DefaultPlan, Version: 1, CreatedAt: now, UpdatedAt: now},
+	}, domains: []entity.Domain{
+		{ID: 1, AccountId: 123, Domain: "example.com", Health: entity.HealthUnknown, Version: 1},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	RegisterHandlers(router.Group(""), NewService(repo, &event.Recorder{}, test.MockTransactional, logger), auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
+	ifNoneMatch := http.Header{"If-None-Match": {`"1"`}}
+	acceptCSV := auth.MockAuthHeader()
+	acceptCSV.Set("Accept", "text/csv")
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
 
 	tests := []test.APITestCase{
 		{"get all", "GET", "/accounts", "", nil, http.StatusOK, `*"total_count":1*`},
-		{"get 123", "GET", "/accounts/123", "", nil, http.StatusOK, `*{"id":"123","email":"person@example.com","firebase_id":"xyz"}*`},
+		{"get cursor", "GET", "/accounts?cursor=", "", nil, http.StatusOK, `*{"per_page":100,"items":[{"id":123*`},
+		{"get invalid cursor", "GET", "/accounts?cursor=abc", "", nil, http.StatusBadRequest, `*the cursor is invalid or expired*`},
+		{"get filtered", "GET", "/accounts?filter[email][contains]=example&sort=-created_at", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get filter error", "GET", "/accounts?filter[id][contains]=1", "", nil, http.StatusBadRequest, `*unsupported operator \"contains\" for the filter field \"id\"*`},
+		{"get 123", "GET", "/accounts/123", "", nil, http.StatusOK, `*{"id":123,"email":"person@example.com","firebase_id":"xyz","plan_id":"free","version":1,"created_at":"2020-01-02T03:04:05Z","updated_at":"2020-01-02T03:04:05Z"}*`},
+		{"get fields", "GET", "/accounts/123?fields=id,email", "", nil, http.StatusOK, `{"id":123,"email":"person@example.com"}`},
+		{"get include", "GET", "/accounts/123?fields=id&include=domains", "", nil, http.StatusOK, `{"id":123,"domains":[{"id":1,"account_id":123,"domain":"example.com","verified_at":null,"health":"unknown","labels":null,"version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}]}`},
+		{"get all fields", "GET", "/accounts?fields=email", "", nil, http.StatusOK, `*"items":[{"email":"person@example.com"}]*`},
+		{"get all include", "GET", "/accounts?fields=id&include=domains", "", nil, http.StatusOK, `*"items":[{"domains":[{"id":1,"account_id":123,*`},
+		{"get cursor fields", "GET", "/accounts?cursor=&fields=email", "", nil, http.StatusOK, `*"items":[{"email":"person@example.com"}]*`},
+		{"get fields error", "GET", "/accounts/123?fields=id,name", "", nil, http.StatusBadRequest, `*unknown field \"name\"*`},
+		{"get include error", "GET", "/accounts?include=albums", "", nil, http.StatusBadRequest, `*unknown relation \"albums\", must be one of: domains*`},
+		{"get not modified", "GET", "/accounts/123", "", ifNoneMatch, http.StatusNotModified, ""},
 		{"get unknown", "GET", "/accounts/1234", "", nil, http.StatusNotFound, ""},
-		{"create ok", "POST", "/accounts", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
+		{"export ndjson", "GET", "/accounts:export", "", header, http.StatusOK, `{"id":123,"email":"person@example.com","firebase_id":"xyz","plan_id":"free","version":1,"created_at":"2020-01-02T03:04:05Z","updated_at":"2020-01-02T03:04:05Z"}` + "\n"},
+		{"export csv", "GET", "/accounts:export?filter[email][contains]=example", "", acceptCSV, http.StatusOK, "id,email,firebase_id,plan_id,version,created_at,updated_at\n123,person@example.com,xyz,free,1,*"},
+		{"export filter error", "GET", "/accounts:export?filter[id][contains]=1", "", header, http.StatusBadRequest, ""},
+		{"export format error", "GET", "/accounts:export?format=xml", "", header, http.StatusBadRequest, ""},
+		{"export auth error", "GET", "/accounts:export", "", nil, http.StatusUnauthorized, ""},
+		{"create ok", "POST", "/accounts", `{"email":"test@example.com"}`, header, http.StatusCreated, "*test@example.com*"},
 		{"create ok count", "GET", "/accounts", "", nil, http.StatusOK, `*"total_count":2*`},
-		{"create auth error", "POST", "/accounts", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
-		{"create input error", "POST", "/accounts", `"name":"test"}`, header, http.StatusBadRequest, ""},
-		{"update ok", "PUT", "/accounts/123", `{"name":"accountxyz"}`, header, http.StatusOK, "*accountxyz*"},
-		{"update verify", "GET", "/accounts/123", "", nil, http.StatusOK, `*accountxyz*`},
-		{"update auth error", "PUT", "/accounts/123", `{"name":"accountxyz"}`, nil, http.StatusUnauthorized, ""},
-		{"update input error", "PUT", "/accounts/123", `"name":"accountxyz"}`, header, http.StatusBadRequest, ""},
-		{"delete ok", "DELETE", "/accounts/123", ``, header, http.StatusOK, "*accountxyz*"},
+		{"get cursor by creation", "GET", "/accounts?cursor=&sort=created_at&per_page=1", "", nil, http.StatusOK, `*"next_cursor":"*`},
+		{"get cursor by update", "GET", "/accounts?cursor=&sort=-updated_at&per_page=1", "", nil, http.StatusOK, `*"next_cursor":"*`},
+		{"get created at", "GET", "/accounts/123?fields=created_at", "", nil, http.StatusOK, `{"created_at":"2020-01-02T03:04:05Z"}`},
+		{"create auth error", "POST", "/accounts", `{"email":"test@example.com"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/accounts", `"email":"test@example.com"}`, header, http.StatusBadRequest, ""},
+		{"update conflict", "PUT", "/accounts/123", `{"name":"xyz@example.com"}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update ok", "PUT", "/accounts/123", `{"name":"xyz@example.com"}`, ifMatch(`"1"`), http.StatusOK, `*"email":"xyz@example.com","firebase_id":"xyz","plan_id":"free","version":2*`},
+		{"update verify", "GET", "/accounts/123", "", ifNoneMatch, http.StatusOK, `*xyz@example.com*`},
+		{"update auth error", "PUT", "/accounts/123", `{"name":"xyz@example.com"}`, nil, http.StatusUnauthorized, ""},
+		{"update input error", "PUT", "/accounts/123", `"name":"xyz@example.com"}`, header, http.StatusBadRequest, ""},
+		{"delete conflict", "DELETE", "/accounts/123", ``, ifMatch(`"1"`), http.StatusPreconditionFailed, ""},
+		{"delete if-match error", "DELETE", "/accounts/123", ``, ifMatch(`"1", "2"`), http.StatusBadRequest, ""},
+		{"delete ok", "DELETE", "/accounts/123", ``, header, http.StatusOK, "*xyz@example.com*"},
 		{"delete verify", "DELETE", "/accounts/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/accounts/123", ``, nil, http.StatusUnauthorized, ""},
 	}
 	for _, tc := range tests {
 		test.Endpoint(t, router, tc)
 	}
+
+	// an export failing before anything is sent responds with the error
+	router = test.MockRouter(logger)
+	RegisterHandlers(router.Group(""), NewService(failingRepository{repo}, &event.Recorder{}, test.MockTransactional, logger), auth.MockAuthHandler, logger)
+	test.Endpoint(t, router, test.APITestCase{"export error", "GET", "/accounts:export", "", header, http.StatusInternalServerError, `*"code":"internal_error"*`})
+	test.Endpoint(t, router, test.APITestCase{"export csv error", "GET", "/accounts:export", "", acceptCSV, http.StatusInternalServerError, ""})
 }
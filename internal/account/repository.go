@@ -7,22 +7,39 @@ import (
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // Repository encapsulates the logic to access accounts from the data source.
 type Repository interface {
 	// Get returns the account with the specified account ID.
 	Get(ctx context.Context, id int, email string, firebaseId string) (entity.Account, error)
-	// Count returns the number of accounts.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of accounts with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Account, error)
+	// Count returns the number of accounts matching the query.
+	Count(ctx context.Context, q query.Query) (int, error)
+	// Query returns the list of accounts matching the query with the given offset and limit.
+	Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Account, error)
+	// Each calls f for every account matching the query in the order of the query, reading one account at a time.
+	// It stops at the first error returned by f.
+	Each(ctx context.Context, q query.Query, f func(entity.Account) error) error
 	// Create saves a new account in the storage.
 	Create(ctx context.Context, account entity.Account) error
-	// Update updates the account with given ID in the storage.
+	// Update updates the account with given ID in the storage and increments its version.
+	// It returns dbcontext.ErrConflict if the stored account is not at the version of the given account.
 	Update(ctx context.Context, account entity.Account) error
-	// Delete removes the account with given ID from the storage.
-	Delete(ctx context.Context, id int, email string, firebaseId string) error
+	// Delete removes the account with given ID at the given version from the storage.
+	// It returns dbcontext.ErrConflict if the stored account is not at that version.
+	Delete(ctx context.Context, id int, email string, firebaseId string, version int) error
+	// QueryDomains returns the domains of the accounts with the specified IDs, ordered by ID.
+	QueryDomains(ctx context.Context, accountIDs []int) ([]entity.Domain, error)
+}
+
+// querySchema declares the fields by which accounts can be filtered and sorted.
+var querySchema = query.Schema{
+	"id":         {Type: query.Int, Operators: query.OrderedOperators, Sortable: true},
+	"email":      {Type: query.String, Operators: query.StringOperators, Sortable: true},
+	"plan_id":    {Type: query.String, Operators: []string{query.Eq, query.Ne, query.In}, Sortable: true},
+	"created_at": {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
+	"updated_at": {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
 }
 
 // repository persists accounts in database
@@ -49,35 +66,84 @@ func (r repository) Create(ctx context.Context, account entity.Account) error {
 	return r.db.With(ctx).Model(&account).Insert()
 }
 
-// Update saves the changes to an account in the database.
+// Update saves the changes to an account in the database if the account has not been changed since it was read.
 func (r repository) Update(ctx context.Context, account entity.Account) error {
-	return r.db.With(ctx).Model(&account).Update()
+	return r.db.UpdateVersion(ctx, "account", dbx.Params{
+		"email":       account.Email,
+		"firebase_id": account.FirebaseId,
+		"plan_id":     account.PlanID,
+		"updated_at":  account.UpdatedAt,
+	}, dbx.HashExp{"id": account.ID}, account.Version)
 }
 
-// Delete deletes an account with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, id int, email string, firebaseId string) error {
+// Delete deletes an account with the specified ID and version from the database.
+func (r repository) Delete(ctx context.Context, id int, email string, firebaseId string, version int) error {
 	account, err := r.Get(ctx, id, email, firebaseId)
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&account).Delete()
+	return r.db.DeleteVersion(ctx, "account", dbx.HashExp{"id": account.ID}, version)
 }
 
-// Count returns the number of the account records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Count returns the number of the account records matching the query in the database.
+func (r repository) Count(ctx context.Context, q query.Query) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("account").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("account").Where(q.Expression()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the account records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Account, error) {
+// Query retrieves the account records matching the query with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Account, error) {
 	var accounts []entity.Account
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(q.Expression()).
+		OrderBy(q.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&accounts)
 	return accounts, err
 }
+
+// Each reads the account records matching the query one at a time from a database cursor and calls f for each of them.
+// The query is canceled if the context is done.
+func (r repository) Each(ctx context.Context, q query.Query, f func(entity.Account) error) error {
+	rows, err := r.db.With(ctx).
+		Select().
+		From("account").
+		Where(q.Expression()).
+		OrderBy(q.OrderBy()...).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var account entity.Account
+		if err := rows.ScanStruct(&account); err != nil {
+			return err
+		}
+		if err := f(account); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// QueryDomains retrieves the domain records of the accounts with the specified IDs from the database in one query.
+func (r repository) QueryDomains(ctx context.Context, accountIDs []int) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	if len(accountIDs) == 0 {
+		return domains, nil
+	}
+	ids := make([]interface{}, len(accountIDs))
+	for i, id := range accountIDs {
+		ids[i] = id
+	}
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.In("account_id", ids...)).
+		OrderBy("id").
+		All(&domains)
+	return domains, err
+}
@@ -8,7 +8,9 @@ import (
 
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,49 +23,77 @@ func TestRepository(t *testing.T) {
 	ctx := context.Background()
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, query.Query{})
 	assert.Nil(t, err)
 
 	// create
 	err = repo.Create(ctx, entity.Account{
-		ID:         "test1",
 		Email:      "account1",
 		FirebaseId: "xyz",
+		PlanID:     entity.DefaultPlan,
+		Version:    1,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count2-count)
 
 	// get
-	account, err := repo.Get(ctx, "test1")
+	account, err := repo.Get(ctx, 0, "account1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "xyz", account.FirebaseId)
+	id := account.ID
+	account, err = repo.Get(ctx, id, "", "")
 	assert.Nil(t, err)
 	assert.Equal(t, "account1", account.Email)
-	_, err = repo.Get(ctx, "test0")
+	_, err = repo.Get(ctx, 0, "account0", "none")
 	assert.Equal(t, sql.ErrNoRows, err)
 
 	// update
-	err = repo.Update(ctx, entity.Account{
-		ID:        "test1",
-		Email:     "account1 updated",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
+	account.Email = "account1 updated"
+	account.UpdatedAt = time.Now()
+	err = repo.Update(ctx, account)
 	assert.Nil(t, err)
-	account, _ = repo.Get(ctx, "test1")
+	err = repo.Update(ctx, account)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	account, _ = repo.Get(ctx, id, "", "")
 	assert.Equal(t, "account1 updated", account.Email)
+	assert.Equal(t, 2, account.Version)
 
 	// query
-	accounts, err := repo.Query(ctx, 0, count2)
+	accounts, err := repo.Query(ctx, query.Query{}, 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(accounts))
+	q := query.Query{Conditions: []query.Condition{{Field: "email", Column: "email", Operator: query.Prefix, Value: "account1"}}}
+	count, err = repo.Count(ctx, q)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// each
+	var emails []string
+	err = repo.Each(ctx, q, func(account entity.Account) error {
+		emails = append(emails, account.Email)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"account1 updated"}, emails)
+
+	// query domains
+	domains, err := repo.QueryDomains(ctx, []int{id})
+	assert.Nil(t, err)
+	assert.Empty(t, domains)
+	domains, err = repo.QueryDomains(ctx, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, domains)
 
 	// delete
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, id, "", "", 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	err = repo.Delete(ctx, id, "", "", 2)
 	assert.Nil(t, err)
-	_, err = repo.Get(ctx, "test1")
+	_, err = repo.Get(ctx, id, "", "")
 	assert.Equal(t, sql.ErrNoRows, err)
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, id, "", "", 2)
 	assert.Equal(t, sql.ErrNoRows, err)
 }
@@ -2,21 +2,29 @@ package account
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // Service encapsulates usecase logic for Accounts.
 type Service interface {
 	Get(ctx context.Context, id int, email string, firebaseId string) (Account, error)
-	Query(ctx context.Context, offset, limit int) ([]Account, error)
-	Count(ctx context.Context) (int, error)
+	Query(ctx context.Context, q query.Query, offset, limit int) ([]Account, error)
+	Count(ctx context.Context, q query.Query) (int, error)
+	// Export calls f for every account matching the query without loading all of them into memory.
+	Export(ctx context.Context, q query.Query, f func(Account) error) error
 	Create(ctx context.Context, input CreateAccountRequest) (Account, error)
-	Update(ctx context.Context, id int, email string, firebaseId string, input UpdateAccountRequest) (Account, error)
-	Delete(ctx context.Context, id int, email string, firebaseId string) (Account, error)
+	Update(ctx context.Context, id int, email string, firebaseId string, version int, input UpdateAccountRequest) (Account, error)
+	Delete(ctx context.Context, id int, email string, firebaseId string, version int) (Account, error)
+	// QueryDomains returns the domains of the accounts with the specified IDs, grouped by account ID.
+	QueryDomains(ctx context.Context, accountIDs []int) (map[int][]entity.Domain, error)
 }
 
 // Account represents the data about an Account.
@@ -24,6 +32,22 @@ type Account struct {
 	entity.Account
 }
 
+// csvHeader is the header row of exported CSV files.
+var csvHeader = []string{"id", "email", "firebase_id", "plan_id", "version", "created_at", "updated_at"}
+
+// CSVRecord returns the columns of the account in the order of csvHeader.
+func (a Account) CSVRecord() []string {
+	return []string{
+		strconv.Itoa(a.ID),
+		a.Email,
+		a.FirebaseId,
+		a.PlanID,
+		strconv.Itoa(a.Version),
+		a.CreatedAt.Format(time.RFC3339),
+		a.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
 // CreateAccountRequest represents an Account creation request.
 type CreateAccountRequest struct {
 	Email      string `json:"email"`
@@ -32,9 +56,14 @@ type CreateAccountRequest struct {
 
 // Validate validates the CreateAccountRequest fields.
 func (m CreateAccountRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the CreateAccountRequest fields.
+func (m *CreateAccountRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Email, validation.Required, validation.Length(0, 128)),
-	)
+	}
 }
 
 // UpdateAccountRequest represents an Account update request.
@@ -44,19 +73,27 @@ type UpdateAccountRequest struct {
 
 // Validate validates the CreateAccountRequest fields.
 func (m UpdateAccountRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the UpdateAccountRequest fields.
+func (m *UpdateAccountRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
-	)
+	}
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	events        event.Publisher
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
 }
 
 // NewService creates a new Account service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// Every change of an Account publishes an event in the transaction of the change.
+func NewService(repo Repository, events event.Publisher, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, events, transactional, logger}
 }
 
 // Get returns the Account with the specified the Account ID.
@@ -74,57 +111,90 @@ func (s service) Create(ctx context.Context, req CreateAccountRequest) (Account,
 		return Account{}, err
 	}
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.Account{
-		Email:      req.Email,
-		FirebaseId: req.FirebaseId,
-		CreatedAt:  now,
-		UpdatedAt:  now,
+	var account Account
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		err := s.repo.Create(ctx, entity.Account{
+			Email:      req.Email,
+			FirebaseId: req.FirebaseId,
+			PlanID:     entity.DefaultPlan,
+			Version:    1,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		if err != nil {
+			return err
+		}
+		if account, err = s.Get(ctx, 0, req.Email, ""); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.AccountCreated, account.ID, strconv.Itoa(account.ID), account)
 	})
 	if err != nil {
 		return Account{}, err
 	}
-	return s.Get(ctx, 0, req.Email, "")
+	return account, nil
 }
 
 // Update updates the Account with the specified ID.
-func (s service) Update(ctx context.Context, id int, email string, firebaseId string, req UpdateAccountRequest) (Account, error) {
+// If version is not 0, the Account is only updated if it is at that version.
+func (s service) Update(ctx context.Context, id int, email string, firebaseId string, version int, req UpdateAccountRequest) (Account, error) {
 	if err := req.Validate(); err != nil {
 		return Account{}, err
 	}
 
-	Account, err := s.Get(ctx, id, email, firebaseId)
+	account, err := s.Get(ctx, id, email, firebaseId)
 	if err != nil {
-		return Account, err
+		return account, err
 	}
-	Account.Email = req.Name
-	Account.UpdatedAt = time.Now()
-
-	if err := s.repo.Update(ctx, Account.Account); err != nil {
-		return Account, err
+	if err := dbcontext.CheckVersion(account.Version, version); err != nil {
+		return account, err
+	}
+	account.Email = req.Name
+	account.UpdatedAt = time.Now()
+
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, account.Account); err != nil {
+			return err
+		}
+		account.Version++
+		return s.events.Publish(ctx, event.AccountUpdated, account.ID, strconv.Itoa(account.ID), account)
+	})
+	if err != nil {
+		return Account{}, err
 	}
-	return Account, nil
+	return account, nil
 }
 
 // Delete deletes the Account with the specified ID.
-func (s service) Delete(ctx context.Context, id int, email string, firebaseId string) (Account, error) {
+// If version is not 0, the Account is only deleted if it is at that version.
+func (s service) Delete(ctx context.Context, id int, email string, firebaseId string, version int) (Account, error) {
 	account, err := s.Get(ctx, id, email, firebaseId)
 	if err != nil {
 		return Account{}, err
 	}
-	if err = s.repo.Delete(ctx, id, email, firebaseId); err != nil {
+	if err := dbcontext.CheckVersion(account.Version, version); err != nil {
+		return Account{}, err
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id, email, firebaseId, account.Version); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.AccountDeleted, account.ID, strconv.Itoa(account.ID), account)
+	})
+	if err != nil {
 		return Account{}, err
 	}
 	return account, nil
 }
 
-// Count returns the number of Accounts.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of Accounts matching the query.
+func (s service) Count(ctx context.Context, q query.Query) (int, error) {
+	return s.repo.Count(ctx, q)
 }
 
-// Query returns the Accounts with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Account, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the Accounts matching the query with the specified offset and limit.
+func (s service) Query(ctx context.Context, q query.Query, offset, limit int) ([]Account, error) {
+	items, err := s.repo.Query(ctx, q, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -134,3 +204,27 @@ func (s service) Query(ctx context.Context, offset, limit int) ([]Account, error
 	}
 	return result, nil
 }
+
+// Export calls f for every Account matching the query in the order of the query.
+func (s service) Export(ctx context.Context, q query.Query, f func(Account) error) error {
+	return s.repo.Each(ctx, q, func(account entity.Account) error {
+		return f(Account{account})
+	})
+}
+
+// QueryDomains returns the domains of the accounts with the specified IDs, grouped by account ID.
+// Accounts without domains are mapped to an empty list.
+func (s service) QueryDomains(ctx context.Context, accountIDs []int) (map[int][]entity.Domain, error) {
+	domains, err := s.repo.QueryDomains(ctx, accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int][]entity.Domain, len(accountIDs))
+	for _, id := range accountIDs {
+		result[id] = []entity.Domain{}
+	}
+	for _, domain := range domains {
+		result[domain.AccountId] = append(result[domain.AccountId], domain)
+	}
+	return result, nil
+}
@@ -7,7 +7,11 @@ import (
 	"testing"
 
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,9 +23,9 @@ func TestCreateAccountRequest_Validate(t *testing.T) {
 		model     CreateAccountRequest
 		wantError bool
 	}{
-		{"success", CreateAccountRequest{Name: "test"}, false},
-		{"required", CreateAccountRequest{Name: ""}, true},
-		{"too long", CreateAccountRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
+		{"success", CreateAccountRequest{Email: "test@example.com"}, false},
+		{"required", CreateAccountRequest{Email: ""}, true},
+		{"too long", CreateAccountRequest{Email: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -51,105 +55,176 @@ func TestUpdateAccountRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	events := &event.Recorder{}
+	s := NewService(&mockRepository{}, events, test.MockTransactional, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, query.Query{})
 	assert.Equal(t, 0, count)
 
 	// successful creation
-	account, err := s.Create(ctx, CreateAccountRequest{Name: "test"})
+	account, err := s.Create(ctx, CreateAccountRequest{Email: "test@example.com"})
 	assert.Nil(t, err)
 	assert.NotEmpty(t, account.ID)
 	id := account.ID
-	assert.Equal(t, "test", account.Email)
+	assert.Equal(t, "test@example.com", account.Email)
+	assert.Equal(t, entity.DefaultPlan, account.PlanID)
 	assert.NotEmpty(t, account.CreatedAt)
 	assert.NotEmpty(t, account.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
-	_, err = s.Create(ctx, CreateAccountRequest{Name: ""})
+	_, err = s.Create(ctx, CreateAccountRequest{Email: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
-	_, err = s.Create(ctx, CreateAccountRequest{Name: "error"})
+	_, err = s.Create(ctx, CreateAccountRequest{Email: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
-	_, _ = s.Create(ctx, CreateAccountRequest{Name: "test2"})
+	_, _ = s.Create(ctx, CreateAccountRequest{Email: "test2@example.com"})
 
 	// update
-	account, err = s.Update(ctx, id, UpdateAccountRequest{Name: "test updated"})
+	assert.Equal(t, 1, account.Version)
+	account, err = s.Update(ctx, id, "", "", 0, UpdateAccountRequest{Name: "updated@example.com"})
 	assert.Nil(t, err)
-	assert.Equal(t, "test updated", account.Email)
-	_, err = s.Update(ctx, "none", UpdateAccountRequest{Name: "test updated"})
+	assert.Equal(t, "updated@example.com", account.Email)
+	assert.Equal(t, 2, account.Version)
+	_, err = s.Update(ctx, 0, "none", "", 0, UpdateAccountRequest{Name: "updated@example.com"})
 	assert.NotNil(t, err)
 
+	// update of a stale version
+	_, err = s.Update(ctx, id, "", "", 1, UpdateAccountRequest{Name: "stale@example.com"})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateAccountRequest{Name: ""})
+	_, err = s.Update(ctx, id, "", "", 2, UpdateAccountRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 2, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateAccountRequest{Name: "error"})
+	_, err = s.Update(ctx, id, "", "", 2, UpdateAccountRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 2, count)
 
 	// get
-	_, err = s.Get(ctx, "none")
+	_, err = s.Get(ctx, 0, "none", "")
 	assert.NotNil(t, err)
-	account, err = s.Get(ctx, id)
+	account, err = s.Get(ctx, id, "", "")
 	assert.Nil(t, err)
-	assert.Equal(t, "test updated", account.Email)
+	assert.Equal(t, "updated@example.com", account.Email)
 	assert.Equal(t, id, account.ID)
+	account, err = s.Get(ctx, 0, "test2@example.com", "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, account.ID)
 
 	// query
-	accounts, _ := s.Query(ctx, 0, 0)
+	accounts, _ := s.Query(ctx, query.Query{}, 0, 0)
 	assert.Equal(t, 2, len(accounts))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, 0, "none", "", 0)
 	assert.NotNil(t, err)
-	account, err = s.Delete(ctx, id)
+	_, err = s.Delete(ctx, id, "", "", 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	account, err = s.Delete(ctx, id, "", "", 2)
 	assert.Nil(t, err)
 	assert.Equal(t, id, account.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
+
+	// events
+	assert.Equal(t, []string{event.AccountCreated, event.AccountCreated, event.AccountUpdated, event.AccountDeleted}, events.Types())
+	if assert.NotNil(t, events.Events[3].AccountID) {
+		assert.Equal(t, id, *events.Events[3].AccountID)
+	}
+}
+
+func Test_service_Export(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{items: []entity.Account{{ID: 1, Email: "a@example.com"}, {ID: 2, Email: "b@example.com"}}}, &event.Recorder{}, test.MockTransactional, logger)
+
+	var emails []string
+	err := s.Export(context.Background(), query.Query{}, func(account Account) error {
+		emails = append(emails, account.Email)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, emails)
+
+	err = s.Export(context.Background(), query.Query{}, func(account Account) error {
+		return errCRUD
+	})
+	assert.Equal(t, errCRUD, err)
+}
+
+func Test_service_QueryDomains(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{domains: []entity.Domain{
+		{ID: 1, AccountId: 1, Domain: "a.example.com"},
+		{ID: 2, AccountId: 2, Domain: "b.example.com"},
+		{ID: 3, AccountId: 1, Domain: "c.example.com"},
+	}}, &event.Recorder{}, test.MockTransactional, logger)
+
+	domains, err := s.QueryDomains(context.Background(), []int{1, 3})
+	assert.Nil(t, err)
+	assert.Len(t, domains, 2)
+	assert.Equal(t, []entity.Domain{{ID: 1, AccountId: 1, Domain: "a.example.com"}, {ID: 3, AccountId: 1, Domain: "c.example.com"}}, domains[1])
+	assert.Equal(t, []entity.Domain{}, domains[3])
+
+	_, err = s.QueryDomains(context.Background(), []int{0})
+	assert.Equal(t, errCRUD, err)
 }
 
 type mockRepository struct {
-	items []entity.Account
+	items   []entity.Account
+	domains []entity.Domain
 }
 
-func (m mockRepository) Get(ctx context.Context, id string) (entity.Account, error) {
+func (m mockRepository) Get(ctx context.Context, id int, email string, firebaseId string) (entity.Account, error) {
 	for _, item := range m.items {
-		if item.ID == id {
+		if item.ID == id || email != "" && item.Email == email || firebaseId != "" && item.FirebaseId == firebaseId {
 			return item, nil
 		}
 	}
 	return entity.Account{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
+func (m mockRepository) Count(ctx context.Context, q query.Query) (int, error) {
 	return len(m.items), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Account, error) {
+func (m mockRepository) Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Account, error) {
 	return m.items, nil
 }
 
+func (m mockRepository) Each(ctx context.Context, q query.Query, f func(entity.Account) error) error {
+	for _, item := range m.items {
+		if err := f(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockRepository) Create(ctx context.Context, account entity.Account) error {
 	if account.Email == "error" {
 		return errCRUD
 	}
+	account.ID = len(m.items) + 1
+	for _, item := range m.items {
+		if item.ID >= account.ID {
+			account.ID = item.ID + 1
+		}
+	}
 	m.items = append(m.items, account)
 	return nil
 }
@@ -160,16 +235,27 @@ func (m *mockRepository) Update(ctx context.Context, account entity.Account) err
 	}
 	for i, item := range m.items {
 		if item.ID == account.ID {
+			if item.Version != account.Version {
+				return dbcontext.ErrConflict
+			}
+			account.Version++
 			m.items[i] = account
-			break
+			return nil
 		}
 	}
-	return nil
+	return dbcontext.ErrConflict
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id string) error {
+func (m *mockRepository) Delete(ctx context.Context, id int, email string, firebaseId string, version int) error {
+	account, err := m.Get(ctx, id, email, firebaseId)
+	if err != nil {
+		return err
+	}
 	for i, item := range m.items {
-		if item.ID == id {
+		if item.ID == account.ID {
+			if item.Version != version {
+				return dbcontext.ErrConflict
+			}
 			m.items[i] = m.items[len(m.items)-1]
 			m.items = m.items[:len(m.items)-1]
 			break
@@ -177,3 +263,27 @@ func (m *mockRepository) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+func (m mockRepository) QueryDomains(ctx context.Context, accountIDs []int) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	for _, domain := range m.domains {
+		for _, id := range accountIDs {
+			if id == 0 {
+				return nil, errCRUD
+			}
+			if domain.AccountId == id {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	return domains, nil
+}
+
+// failingRepository is a repository that cannot be queried for exports.
+type failingRepository struct {
+	*mockRepository
+}
+
+func (m failingRepository) Each(ctx context.Context, q query.Query, f func(entity.Account) error) error {
+	return errCRUD
+}
@@ -2,9 +2,14 @@ package album
 
 import (
 	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/fieldset"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"net/http"
 )
 
@@ -23,35 +28,125 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 	r.Delete("/albums/<id>", res.delete)
 }
 
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/albums/<id>", Summary: "Get an album", Params: openapi.Params(openapi.FieldsetParams, []openapi.Parameter{openapi.IfNoneMatchParam}),
+		Response: Album{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/albums", Summary: "List albums", Params: openapi.Params(openapi.PageParams, openapi.CursorParams, openapi.QueryParams, openapi.FieldsetParams),
+		Response: openapi.OneOf(openapi.Page(Album{}), openapi.CursorPage(Album{})), Errors: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/albums", Summary: "Create an album", Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+		Request: CreateAlbumRequest{}, Status: http.StatusCreated, Response: Album{}},
+	{Method: "PUT", Path: "/albums/<id>", Summary: "Update an album", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: UpdateAlbumRequest{}, Response: Album{}, Errors: []int{http.StatusPreconditionFailed}},
+	{Method: "DELETE", Path: "/albums/<id>", Summary: "Delete an album", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Response: Album{}, Errors: []int{http.StatusBadRequest, http.StatusPreconditionFailed}},
+}
+
+// fieldSchema declares the fields of albums that can be selected. Albums have no relations to embed.
+var fieldSchema = fieldset.NewSchema(entity.Album{})
+
 type resource struct {
 	service Service
 	logger  log.Logger
 }
 
 func (r resource) get(c *routing.Context) error {
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	album, err := r.service.Get(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		return err
 	}
-
-	return c.Write(album)
+	if etag.NotModified(c.Response, c.Request, album.Version) {
+		return nil
+	}
+	if selection.IsEmpty() {
+		return c.Write(album)
+	}
+	item, err := selection.Render(album)
+	if err != nil {
+		return err
+	}
+	return c.Write(item)
 }
 
+// query writes a page of albums, filtered and sorted as requested with the filter and sort query parameters.
+// Pages are in cursor mode if the cursor query parameter is present, and are numbered otherwise.
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	q, err := query.NewFromRequest(c.Request, querySchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pagination.IsCursorRequest(c.Request) {
+		return r.queryCursor(c, q, selection)
+	}
+	count, err := r.service.Count(ctx, q)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	albums, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	albums, err := r.service.Query(ctx, q, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = albums
+	if !selection.IsEmpty() {
+		if pages.Items, err = render(selection, albums); err != nil {
+			return err
+		}
+	}
+	return c.Write(pages)
+}
+
+// queryCursor writes a page of albums in cursor mode. The total count is only included if requested.
+func (r resource) queryCursor(c *routing.Context, q query.Query, selection fieldset.Selection) error {
+	ctx := c.Request.Context()
+	pages, err := pagination.NewCursorFromRequest(c.Request, q)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pages.IncludeTotal {
+		count, err := r.service.Count(ctx, q)
+		if err != nil {
+			return err
+		}
+		pages.TotalCount = &count
+	}
+	albums, err := r.service.Query(ctx, pages.Query(), 0, pages.Limit())
+	if err != nil {
+		return err
+	}
+	if err := pages.SetItems(albums); err != nil {
+		return err
+	}
+	if !selection.IsEmpty() {
+		if pages.Items, err = render(selection, pages.Items.([]Album)); err != nil {
+			return err
+		}
+	}
 	return c.Write(pages)
 }
 
+// render returns the albums with the fields selected by the request.
+func render(selection fieldset.Selection, albums []Album) ([]fieldset.Resource, error) {
+	items := make([]fieldset.Resource, len(albums))
+	for i, album := range albums {
+		item, err := selection.Render(album)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
 func (r resource) create(c *routing.Context) error {
 	var input CreateAlbumRequest
 	if err := c.Read(&input); err != nil {
@@ -63,26 +158,36 @@ func (r resource) create(c *routing.Context) error {
 		return err
 	}
 
+	etag.Set(c.Response, album.Version)
 	return c.WriteWithStatus(album, http.StatusCreated)
 }
 
 func (r resource) update(c *routing.Context) error {
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	var input UpdateAlbumRequest
 	if err := c.Read(&input); err != nil {
 		r.logger.With(c.Request.Context()).Info(err)
 		return errors.BadRequest("")
 	}
 
-	album, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	album, err := r.service.Update(c.Request.Context(), c.Param("id"), version, input)
 	if err != nil {
 		return err
 	}
 
+	etag.Set(c.Response, album.Version)
 	return c.Write(album)
 }
 
 func (r resource) delete(c *routing.Context) error {
-	album, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	album, err := r.service.Delete(c.Request.Context(), c.Param("id"), version)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package album
 import (
 	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"net/http"
@@ -14,23 +15,43 @@ func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
 	repo := &mockRepository{items: []entity.Album{
-		{"123", "album123", time.Now(), time.Now()},
+		{"123", "album123", 1, time.Now(), time.Now()},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	RegisterHandlers(router.Group(""), NewService(repo, &event.Recorder{}, test.MockTransactional, logger), auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
+	ifNoneMatch := http.Header{"If-None-Match": {`"1"`}}
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
 
 	tests := []test.APITestCase{
 		{"get all", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get cursor", "GET", "/albums?cursor=&include_total=true", "", nil, http.StatusOK, `*{"per_page":100,"total_count":1,"items":[{"id":"123"*`},
+		{"get invalid cursor", "GET", "/albums?cursor=abc", "", nil, http.StatusBadRequest, `*the cursor is invalid or expired*`},
+		{"get filtered", "GET", "/albums?filter[name][contains]=album&sort=-created_at", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get filter error", "GET", "/albums?filter[title]=x", "", nil, http.StatusBadRequest, `*unknown filter field \"title\"*`},
+		{"get sort error", "GET", "/albums?sort=-title", "", nil, http.StatusBadRequest, `*unknown sort field \"title\"*`},
 		{"get 123", "GET", "/albums/123", "", nil, http.StatusOK, `*album123*`},
+		{"get fields", "GET", "/albums/123?fields=name", "", nil, http.StatusOK, `{"name":"album123"}`},
+		{"get all fields", "GET", "/albums?fields=id,name", "", nil, http.StatusOK, `*"items":[{"id":"123","name":"album123"}]*`},
+		{"get cursor fields", "GET", "/albums?cursor=&fields=id", "", nil, http.StatusOK, `*"items":[{"id":"123"}]*`},
+		{"get fields error", "GET", "/albums?fields=title", "", nil, http.StatusBadRequest, `*unknown field \"title\", must be one of: created_at, id, name, updated_at*`},
+		{"get include error", "GET", "/albums/123?include=tracks", "", nil, http.StatusBadRequest, `*unknown relation \"tracks\", this resource has no relations*`},
+		{"get not modified", "GET", "/albums/123", "", ifNoneMatch, http.StatusNotModified, ""},
 		{"get unknown", "GET", "/albums/1234", "", nil, http.StatusNotFound, ""},
 		{"create ok", "POST", "/albums", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
 		{"create ok count", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":2*`},
 		{"create auth error", "POST", "/albums", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
 		{"create input error", "POST", "/albums", `"name":"test"}`, header, http.StatusBadRequest, ""},
-		{"update ok", "PUT", "/albums/123", `{"name":"albumxyz"}`, header, http.StatusOK, "*albumxyz*"},
-		{"update verify", "GET", "/albums/123", "", nil, http.StatusOK, `*albumxyz*`},
+		{"update conflict", "PUT", "/albums/123", `{"name":"albumxyz"}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update if-match error", "PUT", "/albums/123", `{"name":"albumxyz"}`, ifMatch(`"1", "2"`), http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/albums/123", `{"name":"albumxyz"}`, ifMatch(`"1"`), http.StatusOK, `*"name":"albumxyz","version":2*`},
+		{"update verify", "GET", "/albums/123", "", ifNoneMatch, http.StatusOK, `*albumxyz*`},
 		{"update auth error", "PUT", "/albums/123", `{"name":"albumxyz"}`, nil, http.StatusUnauthorized, ""},
 		{"update input error", "PUT", "/albums/123", `"name":"albumxyz"}`, header, http.StatusBadRequest, ""},
+		{"delete conflict", "DELETE", "/albums/123", ``, ifMatch(`"1"`), http.StatusPreconditionFailed, ""},
 		{"delete ok", "DELETE", "/albums/123", ``, header, http.StatusOK, "*albumxyz*"},
 		{"delete verify", "DELETE", "/albums/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/albums/123", ``, nil, http.StatusUnauthorized, ""},
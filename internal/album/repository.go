@@ -2,25 +2,37 @@ package album
 
 import (
 	"context"
+	dbx "github.com/go-ozzo/ozzo-dbx"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // Repository encapsulates the logic to access albums from the data source.
 type Repository interface {
 	// Get returns the album with the specified album ID.
 	Get(ctx context.Context, id string) (entity.Album, error)
-	// Count returns the number of albums.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of albums with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Album, error)
+	// Count returns the number of albums matching the query.
+	Count(ctx context.Context, q query.Query) (int, error)
+	// Query returns the list of albums matching the query with the given offset and limit.
+	Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Album, error)
 	// Create saves a new album in the storage.
 	Create(ctx context.Context, album entity.Album) error
-	// Update updates the album with given ID in the storage.
+	// Update updates the album with given ID in the storage and increments its version.
+	// It returns dbcontext.ErrConflict if the stored album is not at the version of the given album.
 	Update(ctx context.Context, album entity.Album) error
-	// Delete removes the album with given ID from the storage.
-	Delete(ctx context.Context, id string) error
+	// Delete removes the album with given ID at the given version from the storage.
+	// It returns dbcontext.ErrConflict if the stored album is not at that version.
+	Delete(ctx context.Context, id string, version int) error
+}
+
+// querySchema declares the fields by which albums can be filtered and sorted.
+var querySchema = query.Schema{
+	"id":         {Type: query.String, Operators: []string{query.Eq, query.In}, Sortable: true},
+	"name":       {Type: query.String, Operators: query.StringOperators, Sortable: true},
+	"created_at": {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
+	"updated_at": {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
 }
 
 // repository persists albums in database
@@ -47,33 +59,36 @@ func (r repository) Create(ctx context.Context, album entity.Album) error {
 	return r.db.With(ctx).Model(&album).Insert()
 }
 
-// Update saves the changes to an album in the database.
+// Update saves the changes to an album in the database if the album has not been changed since it was read.
 func (r repository) Update(ctx context.Context, album entity.Album) error {
-	return r.db.With(ctx).Model(&album).Update()
+	return r.db.UpdateVersion(ctx, "album", dbx.Params{
+		"name":       album.Name,
+		"updated_at": album.UpdatedAt,
+	}, dbx.HashExp{"id": album.ID}, album.Version)
 }
 
-// Delete deletes an album with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, id string) error {
-	album, err := r.Get(ctx, id)
-	if err != nil {
+// Delete deletes an album with the specified ID and version from the database.
+func (r repository) Delete(ctx context.Context, id string, version int) error {
+	if _, err := r.Get(ctx, id); err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&album).Delete()
+	return r.db.DeleteVersion(ctx, "album", dbx.HashExp{"id": id}, version)
 }
 
-// Count returns the number of the album records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Count returns the number of the album records matching the query in the database.
+func (r repository) Count(ctx context.Context, q query.Query) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("album").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("album").Where(q.Expression()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the album records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
+// Query retrieves the album records matching the query with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Album, error) {
 	var albums []entity.Album
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(q.Expression()).
+		OrderBy(q.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&albums)
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -20,18 +22,19 @@ func TestRepository(t *testing.T) {
 	ctx := context.Background()
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, query.Query{})
 	assert.Nil(t, err)
 
 	// create
 	err = repo.Create(ctx, entity.Album{
 		ID:        "test1",
 		Name:      "album1",
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count2-count)
 
 	// get
@@ -45,23 +48,38 @@ func TestRepository(t *testing.T) {
 	err = repo.Update(ctx, entity.Album{
 		ID:        "test1",
 		Name:      "album1 updated",
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
 	assert.Nil(t, err)
 	album, _ = repo.Get(ctx, "test1")
 	assert.Equal(t, "album1 updated", album.Name)
+	assert.Equal(t, 2, album.Version)
+	err = repo.Update(ctx, entity.Album{ID: "test1", Name: "album1 stale", Version: 1})
+	assert.Equal(t, dbcontext.ErrConflict, err)
 
 	// query
-	albums, err := repo.Query(ctx, 0, count2)
+	albums, err := repo.Query(ctx, query.Query{}, 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(albums))
+	q := query.Query{Conditions: []query.Condition{{Field: "name", Column: "name", Operator: query.Contains, Value: "UPDATED"}}}
+	count, err = repo.Count(ctx, q)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	albums, err = repo.Query(ctx, q, 0, count2)
+	assert.Nil(t, err)
+	if assert.Len(t, albums, 1) {
+		assert.Equal(t, "test1", albums[0].ID)
+	}
 
 	// delete
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, "test1", 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	err = repo.Delete(ctx, "test1", 2)
 	assert.Nil(t, err)
 	_, err = repo.Get(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, "test1", 2)
 	assert.Equal(t, sql.ErrNoRows, err)
 }
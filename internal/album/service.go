@@ -4,18 +4,21 @@ import (
 	"context"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"time"
 )
 
 // Service encapsulates usecase logic for albums.
 type Service interface {
 	Get(ctx context.Context, id string) (Album, error)
-	Query(ctx context.Context, offset, limit int) ([]Album, error)
-	Count(ctx context.Context) (int, error)
+	Query(ctx context.Context, q query.Query, offset, limit int) ([]Album, error)
+	Count(ctx context.Context, q query.Query) (int, error)
 	Create(ctx context.Context, input CreateAlbumRequest) (Album, error)
-	Update(ctx context.Context, id string, input UpdateAlbumRequest) (Album, error)
-	Delete(ctx context.Context, id string) (Album, error)
+	Update(ctx context.Context, id string, version int, input UpdateAlbumRequest) (Album, error)
+	Delete(ctx context.Context, id string, version int) (Album, error)
 }
 
 // Album represents the data about an album.
@@ -30,9 +33,14 @@ type CreateAlbumRequest struct {
 
 // Validate validates the CreateAlbumRequest fields.
 func (m CreateAlbumRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the CreateAlbumRequest fields.
+func (m *CreateAlbumRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
-	)
+	}
 }
 
 // UpdateAlbumRequest represents an album update request.
@@ -42,19 +50,27 @@ type UpdateAlbumRequest struct {
 
 // Validate validates the CreateAlbumRequest fields.
 func (m UpdateAlbumRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the UpdateAlbumRequest fields.
+func (m *UpdateAlbumRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
-	)
+	}
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	events        event.Publisher
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
 }
 
 // NewService creates a new album service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// Every change of an album publishes an event in the transaction of the change.
+func NewService(repo Repository, events event.Publisher, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, events, transactional, logger}
 }
 
 // Get returns the album with the specified the album ID.
@@ -73,20 +89,32 @@ func (s service) Create(ctx context.Context, req CreateAlbumRequest) (Album, err
 	}
 	id := entity.GenerateID()
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.Album{
-		ID:        id,
-		Name:      req.Name,
-		CreatedAt: now,
-		UpdatedAt: now,
+	var album Album
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		err := s.repo.Create(ctx, entity.Album{
+			ID:        id,
+			Name:      req.Name,
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		if album, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.AlbumCreated, 0, id, album)
 	})
 	if err != nil {
 		return Album{}, err
 	}
-	return s.Get(ctx, id)
+	return album, nil
 }
 
 // Update updates the album with the specified ID.
-func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest) (Album, error) {
+// If version is not 0, the album is only updated if it is at that version.
+func (s service) Update(ctx context.Context, id string, version int, req UpdateAlbumRequest) (Album, error) {
 	if err := req.Validate(); err != nil {
 		return Album{}, err
 	}
@@ -95,35 +123,55 @@ func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest)
 	if err != nil {
 		return album, err
 	}
+	if err := dbcontext.CheckVersion(album.Version, version); err != nil {
+		return album, err
+	}
 	album.Name = req.Name
 	album.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(ctx, album.Album); err != nil {
-		return album, err
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, album.Album); err != nil {
+			return err
+		}
+		album.Version++
+		return s.events.Publish(ctx, event.AlbumUpdated, 0, id, album)
+	})
+	if err != nil {
+		return Album{}, err
 	}
 	return album, nil
 }
 
 // Delete deletes the album with the specified ID.
-func (s service) Delete(ctx context.Context, id string) (Album, error) {
+// If version is not 0, the album is only deleted if it is at that version.
+func (s service) Delete(ctx context.Context, id string, version int) (Album, error) {
 	album, err := s.Get(ctx, id)
 	if err != nil {
 		return Album{}, err
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	if err := dbcontext.CheckVersion(album.Version, version); err != nil {
+		return Album{}, err
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id, album.Version); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.AlbumDeleted, 0, id, album)
+	})
+	if err != nil {
 		return Album{}, err
 	}
 	return album, nil
 }
 
-// Count returns the number of albums.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of albums matching the query.
+func (s service) Count(ctx context.Context, q query.Query) (int, error) {
+	return s.repo.Count(ctx, q)
 }
 
-// Query returns the albums with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Album, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the albums matching the query with the specified offset and limit.
+func (s service) Query(ctx context.Context, q query.Query, offset, limit int) ([]Album, error) {
+	items, err := s.repo.Query(ctx, q, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -5,7 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -50,12 +54,13 @@ func TestUpdateAlbumRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	events := &event.Recorder{}
+	s := NewService(&mockRepository{}, events, test.MockTransactional, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, query.Query{})
 	assert.Equal(t, 0, count)
 
 	// successful creation
@@ -66,40 +71,46 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, "test", album.Name)
 	assert.NotEmpty(t, album.CreatedAt)
 	assert.NotEmpty(t, album.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateAlbumRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
 	_, err = s.Create(ctx, CreateAlbumRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
 
 	_, _ = s.Create(ctx, CreateAlbumRequest{Name: "test2"})
 
 	// update
-	album, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "test updated"})
+	assert.Equal(t, 1, album.Version)
+	album, err = s.Update(ctx, id, 0, UpdateAlbumRequest{Name: "test updated"})
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
-	_, err = s.Update(ctx, "none", UpdateAlbumRequest{Name: "test updated"})
+	assert.Equal(t, 2, album.Version)
+	_, err = s.Update(ctx, "none", 0, UpdateAlbumRequest{Name: "test updated"})
 	assert.NotNil(t, err)
 
+	// update of a stale version
+	_, err = s.Update(ctx, id, 1, UpdateAlbumRequest{Name: "test stale"})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: ""})
+	_, err = s.Update(ctx, id, 2, UpdateAlbumRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 2, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "error"})
+	_, err = s.Update(ctx, id, 2, UpdateAlbumRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 2, count)
 
 	// get
@@ -111,17 +122,24 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, id, album.ID)
 
 	// query
-	albums, _ := s.Query(ctx, 0, 0)
+	albums, _ := s.Query(ctx, query.Query{}, 0, 0)
 	assert.Equal(t, 2, len(albums))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, "none", 0)
 	assert.NotNil(t, err)
-	album, err = s.Delete(ctx, id)
+	_, err = s.Delete(ctx, id, 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	album, err = s.Delete(ctx, id, 2)
 	assert.Nil(t, err)
 	assert.Equal(t, id, album.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, query.Query{})
 	assert.Equal(t, 1, count)
+
+	// events
+	assert.Equal(t, []string{event.AlbumCreated, event.AlbumCreated, event.AlbumUpdated, event.AlbumDeleted}, events.Types())
+	assert.Equal(t, id, events.Events[3].ResourceID)
+	assert.Nil(t, events.Events[3].AccountID)
 }
 
 type mockRepository struct {
@@ -137,11 +155,11 @@ func (m mockRepository) Get(ctx context.Context, id string) (entity.Album, error
 	return entity.Album{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
+func (m mockRepository) Count(ctx context.Context, q query.Query) (int, error) {
 	return len(m.items), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
+func (m mockRepository) Query(ctx context.Context, q query.Query, offset, limit int) ([]entity.Album, error) {
 	return m.items, nil
 }
 
@@ -159,20 +177,27 @@ func (m *mockRepository) Update(ctx context.Context, album entity.Album) error {
 	}
 	for i, item := range m.items {
 		if item.ID == album.ID {
+			if item.Version != album.Version {
+				return dbcontext.ErrConflict
+			}
+			album.Version++
 			m.items[i] = album
-			break
+			return nil
 		}
 	}
-	return nil
+	return dbcontext.ErrConflict
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id string) error {
+func (m *mockRepository) Delete(ctx context.Context, id string, version int) error {
 	for i, item := range m.items {
 		if item.ID == id {
+			if item.Version != version {
+				return dbcontext.ErrConflict
+			}
 			m.items[i] = m.items[len(m.items)-1]
 			m.items = m.items[:len(m.items)-1]
-			break
+			return nil
 		}
 	}
-	return nil
+	return sql.ErrNoRows
 }
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"net/http"
+
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 )
 
 // RegisterHandlers registers handlers for different HTTP requests.
@@ -11,13 +14,27 @@ func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger
 	rg.Post("/login", login(service, logger))
 }
 
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "POST", Path: "/login", Summary: "Log in and get a bearer token", Request: loginRequest{}, Response: tokenResponse{},
+		Errors: []int{http.StatusUnauthorized}},
+}
+
+// loginRequest represents a user login request.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// tokenResponse represents the response to a successful login.
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
 // login returns a handler that handles user login request.
 func login(service Service, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
-		var req struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-		}
+		var req loginRequest
 
 		if err := c.Read(&req); err != nil {
 			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
@@ -28,8 +45,6 @@ func login(service Service, logger log.Logger) routing.Handler {
 		if err != nil {
 			return err
 		}
-		return c.Write(struct {
-			Token string `json:"token"`
-		}{token})
+		return c.Write(tokenResponse{token})
 	}
 }
@@ -3,6 +3,8 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -17,11 +19,14 @@ func Handler(verificationKey string) routing.Handler {
 }
 
 // handleToken stores the user identity in the request context so that it can be accessed elsewhere.
+// Tokens without an account ID are those of operators.
 func handleToken(c *routing.Context, token *jwt.Token) error {
+	accountID, _ := token.Claims.(jwt.MapClaims)["account_id"].(float64)
 	ctx := WithUser(
 		c.Request.Context(),
 		token.Claims.(jwt.MapClaims)["id"].(string),
 		token.Claims.(jwt.MapClaims)["name"].(string),
+		int(accountID),
 	)
 	c.Request = c.Request.WithContext(ctx)
 	return nil
@@ -34,8 +39,8 @@ const (
 )
 
 // WithUser returns a context that contains the user identity from the given JWT.
-func WithUser(ctx context.Context, id, name string) context.Context {
-	return context.WithValue(ctx, userKey, entity.User{ID: id, Name: name})
+func WithUser(ctx context.Context, id, name string, accountID int) context.Context {
+	return context.WithValue(ctx, userKey, entity.User{ID: id, Name: name, AccountID: accountID})
 }
 
 // CurrentUser returns the user identity from the given context.
@@ -47,22 +52,50 @@ func CurrentUser(ctx context.Context) Identity {
 	return nil
 }
 
+// CheckAccount returns an error unless the current user may access the account with the specified ID.
+// Operators may access every account, while the users of an account are forbidden the other accounts.
+// An account ID of 0 stands for all the accounts, which only operators may access.
+func CheckAccount(ctx context.Context, accountID int) error {
+	user := CurrentUser(ctx)
+	if user == nil {
+		return errors.Unauthorized("")
+	}
+	if id := user.GetAccountID(); id != 0 && id != accountID {
+		return errors.Forbidden("")
+	}
+	return nil
+}
+
 // MockAuthHandler creates a mock authentication middleware for testing purpose.
 // If the request contains an Authorization header whose value is "TEST", then
-// it considers the user is authenticated as "Tester" whose ID is "100".
+// it considers the user is authenticated as the operator "Tester" whose ID is "100".
+// If the value is "TEST <account ID>", the user belongs to that account instead.
 // It fails the authentication otherwise.
 func MockAuthHandler(c *routing.Context) error {
-	if c.Request.Header.Get("Authorization") != "TEST" {
+	value := c.Request.Header.Get("Authorization")
+	if value != "TEST" && !strings.HasPrefix(value, "TEST ") {
 		return errors.Unauthorized("")
 	}
-	ctx := WithUser(c.Request.Context(), "100", "Tester")
+	accountID, err := strconv.Atoi(strings.TrimPrefix(value, "TEST "))
+	if value != "TEST" && (err != nil || accountID < 1) {
+		return errors.Unauthorized("")
+	}
+	ctx := WithUser(c.Request.Context(), "100", "Tester", accountID)
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
 
-// MockAuthHeader returns an HTTP header that can pass the authentication check by MockAuthHandler.
+// MockAuthHeader returns an HTTP header that can pass the authentication check by MockAuthHandler as an operator.
 func MockAuthHeader() http.Header {
 	header := http.Header{}
 	header.Add("Authorization", "TEST")
 	return header
 }
+
+// MockAccountAuthHeader returns an HTTP header that can pass the authentication check by MockAuthHandler
+// as a user of the given account.
+func MockAccountAuthHeader(accountID int) http.Header {
+	header := http.Header{}
+	header.Add("Authorization", "TEST "+strconv.Itoa(accountID))
+	return header
+}
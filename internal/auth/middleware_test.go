@@ -12,11 +12,12 @@ import (
 func TestCurrentUser(t *testing.T) {
 	ctx := context.Background()
 	assert.Nil(t, CurrentUser(ctx))
-	ctx = WithUser(ctx, "100", "test")
+	ctx = WithUser(ctx, "100", "test", 2)
 	identity := CurrentUser(ctx)
 	if assert.NotNil(t, identity) {
 		assert.Equal(t, "100", identity.GetID())
 		assert.Equal(t, "test", identity.GetName())
+		assert.Equal(t, 2, identity.GetAccountID())
 	}
 }
 
@@ -40,7 +41,19 @@ func Test_handleToken(t *testing.T) {
 	if assert.NotNil(t, identity) {
 		assert.Equal(t, "100", identity.GetID())
 		assert.Equal(t, "test", identity.GetName())
+		assert.Equal(t, 0, identity.GetAccountID())
 	}
+
+	// the account ID is decoded from JSON as a number
+	err = handleToken(ctx, &jwt.Token{
+		Claims: jwt.MapClaims{
+			"id":         "101",
+			"name":       "test",
+			"account_id": float64(2),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, CurrentUser(ctx.Request.Context()).GetAccountID())
 }
 
 func TestMocks(t *testing.T) {
@@ -50,5 +63,32 @@ func TestMocks(t *testing.T) {
 	req.Header = MockAuthHeader()
 	ctx, _ = test.MockRoutingContext(req)
 	assert.Nil(t, MockAuthHandler(ctx))
-	assert.NotNil(t, CurrentUser(ctx.Request.Context()))
+	if assert.NotNil(t, CurrentUser(ctx.Request.Context())) {
+		assert.Equal(t, 0, CurrentUser(ctx.Request.Context()).GetAccountID())
+	}
+	req.Header = MockAccountAuthHeader(2)
+	ctx, _ = test.MockRoutingContext(req)
+	assert.Nil(t, MockAuthHandler(ctx))
+	if assert.NotNil(t, CurrentUser(ctx.Request.Context())) {
+		assert.Equal(t, 2, CurrentUser(ctx.Request.Context()).GetAccountID())
+	}
+	req.Header.Set("Authorization", "TEST x")
+	ctx, _ = test.MockRoutingContext(req)
+	assert.NotNil(t, MockAuthHandler(ctx))
+}
+
+func TestCheckAccount(t *testing.T) {
+	ctx := context.Background()
+	assert.NotNil(t, CheckAccount(ctx, 1))
+
+	// operators access every account
+	operator := WithUser(ctx, "100", "Tester", 0)
+	assert.Nil(t, CheckAccount(operator, 0))
+	assert.Nil(t, CheckAccount(operator, 1))
+
+	// the users of an account only access their account
+	user := WithUser(ctx, "100", "Tester", 1)
+	assert.Nil(t, CheckAccount(user, 1))
+	assert.NotNil(t, CheckAccount(user, 2))
+	assert.NotNil(t, CheckAccount(user, 0))
 }
@@ -23,6 +23,9 @@ type Identity interface {
 	GetID() string
 	// GetName returns the user name.
 	GetName() string
+	// GetAccountID returns the ID of the account the user belongs to, or 0 if the user is an operator
+	// with access to every account.
+	GetAccountID() int
 }
 
 type service struct {
@@ -62,8 +65,9 @@ func (s service) authenticate(ctx context.Context, username, password string) Id
 // generateJWT generates a JWT that encodes an identity.
 func (s service) generateJWT(identity Identity) (string, error) {
 	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":   identity.GetID(),
-		"name": identity.GetName(),
-		"exp":  time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
+		"id":         identity.GetID(),
+		"name":       identity.GetName(),
+		"account_id": identity.GetAccountID(),
+		"exp":        time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
 	}).SignedString([]byte(s.signingKey))
 }
@@ -0,0 +1,52 @@
+package batch
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/batch", res.run)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "POST", Path: "/batch", Summary: "Run several operations in one request",
+		Description: "The operations are run in order with the authorization of the batch. The operations of an atomic batch are all applied or none is.",
+		Auth:        true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam}, Request: Request{}, Response: BatchResponse{}},
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// BatchResponse represents the results of the operations of a batch, in the order of the operations.
+type BatchResponse struct {
+	Results []Result `json:"results"`
+}
+
+func (r resource) run(c *routing.Context) error {
+	if inBatch(c.Request.Context()) {
+		return errors.BadRequest("A batch cannot contain batch operations.")
+	}
+	var input Request
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	results, err := r.service.Run(c.Request.Context(), c.Request.Header, input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(BatchResponse{results})
+}
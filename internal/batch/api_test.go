@@ -0,0 +1,31 @@
+package batch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &mockStore{}
+	router := store.router(logger)
+	RegisterHandlers(router.Group(""), NewService(router, store.transactional, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"run ok", "POST", "/batch", `{"operations":[{"method":"POST","path":"/items","body":{"name":"a"}},{"method":"GET","path":"/items"}]}`, header, http.StatusOK, `{"results":[{"status":201,"headers":{"Location":"/items/1"},"body":{"id":1,"name":"a"}},{"status":200,"body":["a"]}]}`},
+		{"run atomic", "POST", "/batch", `{"atomic":true,"operations":[{"method":"POST","path":"/items","body":{"name":"b"}},{"method":"POST","path":"/items","body":{}}]}`, header, http.StatusOK, `*{"status":424,"body":{"status":424,"code":"failed_dependency","message":"The operation was not applied because operation 1 of the atomic batch failed."}},{"status":400,*`},
+		{"run verify", "POST", "/batch", `{"operations":[{"method":"GET","path":"/items"}]}`, header, http.StatusOK, `{"results":[{"status":200,"body":["a"]}]}`},
+		{"nested batch", "POST", "/batch", `{"operations":[{"method":"POST","path":"/batch","body":{"operations":[{"method":"GET","path":"/items"}]}}]}`, header, http.StatusOK, `*"status":400,"code":"bad_request","message":"A batch cannot contain batch operations."*`},
+		{"validation error", "POST", "/batch", `{"operations":[]}`, header, http.StatusBadRequest, `*"field":"operations"*`},
+		{"input error", "POST", "/batch", `"operations":[]}`, header, http.StatusBadRequest, ""},
+		{"auth error", "POST", "/batch", `{"operations":[{"method":"GET","path":"/items"}]}`, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
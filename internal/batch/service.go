@@ -0,0 +1,238 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	apierrors "github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// maxOperations is the maximum number of operations in a batch.
+const maxOperations = 50
+
+// resultHeaders are the response headers of an operation that are returned in its result.
+var resultHeaders = []string{"ETag", "Link", "Location", "X-Total-Count"}
+
+// Service encapsulates the logic of running batches of operations.
+type Service interface {
+	// Run dispatches the operations of a batch in order with the given request header and returns their results.
+	Run(ctx context.Context, header http.Header, req Request) ([]Result, error)
+}
+
+// Request represents a batch of operations.
+type Request struct {
+	// Atomic indicates whether the operations are run in a single transaction that is rolled back
+	// if any of them fails.
+	Atomic     bool        `json:"atomic"`
+	Operations []Operation `json:"operations"`
+}
+
+// Operation represents an API request in a batch.
+type Operation struct {
+	Method string `json:"method"`
+	// Path is the path of the request, including the API version prefix and the query string, e.g. /v1/accounts?limit=5.
+	Path string `json:"path"`
+	// Headers are additional request headers, e.g. If-Match. The authorization of the batch is always used.
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Result represents the response to an operation in a batch.
+type Result struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Validate validates the Request fields.
+func (m Request) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the Request fields.
+func (m *Request) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.Operations, validation.Required, validation.Length(1, maxOperations),
+			validation.Each(validation.By(validateOperation))),
+	}
+}
+
+func validateOperation(value interface{}) error {
+	op := value.(Operation)
+	return validation.ValidateStruct(&op, op.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the Operation fields.
+func (m *Operation) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.Method, validation.Required,
+			validation.In(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)),
+		validation.Field(&m.Path, validation.Required, validation.Length(0, 2048), validation.By(func(value interface{}) error {
+			if !strings.HasPrefix(value.(string), "/") || strings.HasPrefix(value.(string), "//") {
+				return errors.New("must be an absolute path")
+			}
+			return nil
+		})),
+	}
+}
+
+// errRollback makes a transaction roll back when an operation of an atomic batch fails.
+var errRollback = errors.New("rollback")
+
+type service struct {
+	handler       http.Handler
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new batch service that dispatches the operations to the given handler.
+func NewService(handler http.Handler, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{handler, transactional, logger}
+}
+
+// Run dispatches the operations of a batch in order and returns their results.
+// The operations of an atomic batch are run in a single transaction. If one of them fails with a 4xx or 5xx status,
+// the transaction is rolled back, the remaining operations are skipped, and all operations but the failed one
+// get a 424 (Failed Dependency) result.
+func (s service) Run(ctx context.Context, header http.Header, req Request) ([]Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, batchKey, true)
+	if !req.Atomic {
+		results := make([]Result, len(req.Operations))
+		for i, op := range req.Operations {
+			results[i] = s.dispatch(ctx, header, op)
+		}
+		return results, nil
+	}
+
+	results := make([]Result, len(req.Operations))
+	failed := -1
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		for i, op := range req.Operations {
+			results[i] = s.dispatch(ctx, header, op)
+			if results[i].Status >= http.StatusBadRequest {
+				failed = i
+				return errRollback
+			}
+		}
+		return nil
+	})
+	if failed < 0 {
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	for i := range results {
+		if i != failed {
+			results[i] = failedDependency(failed)
+		}
+	}
+	return results, nil
+}
+
+// dispatch sends an operation to the handler and returns its result.
+func (s service) dispatch(ctx context.Context, header http.Header, op Operation) Result {
+	req, err := http.NewRequest(op.Method, op.Path, bytes.NewReader(op.Body))
+	if err != nil {
+		return errorResult(apierrors.BadRequest(err.Error()))
+	}
+	req = req.WithContext(ctx)
+	for name, value := range op.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Authorization", header.Get("Authorization"))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	rw := &responseRecorder{header: http.Header{}}
+	s.handler.ServeHTTP(rw, req)
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	result := Result{Status: rw.status, Body: jsonBody(rw.body.Bytes())}
+	for _, name := range resultHeaders {
+		if value := rw.header.Get(name); value != "" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = value
+		}
+	}
+	return result
+}
+
+// jsonBody returns the body of a response as JSON. A body that is not JSON is returned as a JSON string.
+func jsonBody(body []byte) json.RawMessage {
+	if len(body) == 0 || json.Valid(body) {
+		return body
+	}
+	s, _ := json.Marshal(string(body))
+	return s
+}
+
+// failedDependency returns the result of an operation that is not applied because another operation
+// of the atomic batch failed.
+func failedDependency(failed int) Result {
+	return errorResult(apierrors.ErrorResponse{
+		Status:  http.StatusFailedDependency,
+		Code:    apierrors.CodeFailedDependency,
+		Message: fmt.Sprintf("The operation was not applied because operation %d of the atomic batch failed.", failed),
+	})
+}
+
+// errorResult returns the result of an operation failing with the given error.
+func errorResult(err apierrors.ErrorResponse) Result {
+	body, _ := json.Marshal(err)
+	return Result{Status: err.Status, Body: body}
+}
+
+// responseRecorder records the response to an operation.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header returns the response header.
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader records the status of the response.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// Write records the body of the response.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+type contextKey int
+
+const (
+	batchKey contextKey = iota
+)
+
+// inBatch returns whether the context is the context of an operation in a batch.
+func inBatch(ctx context.Context) bool {
+	inBatch, _ := ctx.Value(batchKey).(bool)
+	return inBatch
+}
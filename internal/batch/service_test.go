@@ -0,0 +1,147 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     Request
+		wantError bool
+	}{
+		{"success", Request{Operations: []Operation{{Method: "GET", Path: "/items"}}}, false},
+		{"no operations", Request{}, true},
+		{"too many operations", Request{Operations: make([]Operation, maxOperations+1)}, true},
+		{"invalid method", Request{Operations: []Operation{{Method: "HEAD", Path: "/items"}}}, true},
+		{"relative path", Request{Operations: []Operation{{Method: "GET", Path: "items"}}}, true},
+		{"other host", Request{Operations: []Operation{{Method: "GET", Path: "//example.com/items"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Run(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := &mockStore{}
+	s := NewService(store.router(logger), store.transactional, logger)
+	ctx := context.Background()
+	header := auth.MockAuthHeader()
+
+	// validation error
+	_, err := s.Run(ctx, header, Request{})
+	assert.NotNil(t, err)
+
+	// operations run in order and keep their results when others fail
+	results, err := s.Run(ctx, header, Request{Operations: []Operation{
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"a"}`)},
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{}`)},
+		{Method: "GET", Path: "/items"},
+		{Method: "GET", Path: "/items/text"},
+		{Method: "GET", Path: "/items", Headers: map[string]string{"Authorization": "other"}},
+	}})
+	assert.Nil(t, err)
+	if assert.Len(t, results, 5) {
+		assert.Equal(t, http.StatusCreated, results[0].Status)
+		assert.Equal(t, map[string]string{"Location": "/items/1"}, results[0].Headers)
+		assert.JSONEq(t, `{"id":1,"name":"a"}`, string(results[0].Body))
+		assert.Equal(t, http.StatusBadRequest, results[1].Status)
+		assert.Equal(t, http.StatusOK, results[2].Status)
+		assert.JSONEq(t, `["a"]`, string(results[2].Body))
+		assert.JSONEq(t, `"a"`, string(results[3].Body))
+		assert.Equal(t, http.StatusOK, results[4].Status)
+	}
+
+	// atomic batch
+	results, err = s.Run(ctx, header, Request{Atomic: true, Operations: []Operation{
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"b"}`)},
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"c"}`)},
+	}})
+	assert.Nil(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, http.StatusCreated, results[1].Status)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, store.items)
+
+	// failed atomic batch
+	results, err = s.Run(ctx, header, Request{Atomic: true, Operations: []Operation{
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"d"}`)},
+		{Method: "DELETE", Path: "/items/5"},
+		{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"e"}`)},
+	}})
+	assert.Nil(t, err)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, http.StatusFailedDependency, results[0].Status)
+		assert.Equal(t, http.StatusNotFound, results[1].Status)
+		assert.Equal(t, http.StatusFailedDependency, results[2].Status)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, store.items)
+
+	// unauthenticated batch
+	results, err = s.Run(ctx, http.Header{}, Request{Operations: []Operation{{Method: "POST", Path: "/items", Body: json.RawMessage(`{"name":"f"}`)}}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, results[0].Status)
+}
+
+// mockStore serves a list of item names through an API whose changes can be rolled back.
+type mockStore struct {
+	items []string
+}
+
+func (m *mockStore) router(logger log.Logger) *routing.Router {
+	router := test.MockRouter(logger)
+	router.Get("/items", func(c *routing.Context) error {
+		return c.Write(m.items)
+	})
+	router.Get("/items/text", func(c *routing.Context) error {
+		c.Response.Header().Set("Content-Type", "text/plain")
+		_, err := c.Response.Write([]byte(m.items[0]))
+		return err
+	})
+	router.Use(auth.MockAuthHandler)
+	router.Post("/items", func(c *routing.Context) error {
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := c.Read(&input); err != nil || input.Name == "" {
+			return errors.BadRequest("")
+		}
+		m.items = append(m.items, input.Name)
+		c.Response.Header().Set("Location", "/items/"+strconv.Itoa(len(m.items)))
+		return c.WriteWithStatus(map[string]interface{}{"id": len(m.items), "name": input.Name}, http.StatusCreated)
+	})
+	router.Delete("/items/<id>", func(c *routing.Context) error {
+		id, _ := strconv.Atoi(c.Param("id"))
+		if id < 1 || id > len(m.items) {
+			return errors.NotFound("")
+		}
+		m.items = append(m.items[:id-1], m.items[id:]...)
+		return nil
+	})
+	return router
+}
+
+// transactional restores the items if the function fails.
+func (m *mockStore) transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	items := append([]string{}, m.items...)
+	err := f(ctx)
+	if err != nil {
+		m.items = items
+	}
+	return err
+}
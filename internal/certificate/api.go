@@ -0,0 +1,73 @@
+package certificate
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/domains/<id>/certificate", res.get)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/domains/<id>/certificate", Summary: "Get the certificate of a domain", Response: Certificate{},
+		Errors: []int{http.StatusNotModified}},
+}
+
+// ChallengeRoutes describes the routes registered by RegisterChallengeHandlers.
+var ChallengeRoutes = []openapi.Route{
+	{Method: "GET", Path: "/.well-known/acme-challenge/<token>", Summary: "Respond to an ACME HTTP-01 challenge",
+		Response: "", ResponseType: "text/plain"},
+}
+
+// RegisterChallengeHandlers registers the handler answering ACME HTTP-01 challenges.
+// It must be registered on the root router because the certificate authority requests
+// http://<domain>/.well-known/acme-challenge/<token>.
+func RegisterChallengeHandlers(r *routing.Router, service Service) {
+	r.Get("/.well-known/acme-challenge/<token>", challenge(service))
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	certificate, err := r.service.Get(c.Request.Context(), domainID)
+	if err != nil {
+		return err
+	}
+	if etag.NotModified(c.Response, c.Request, certificate.Version) {
+		return nil
+	}
+
+	return c.Write(certificate)
+}
+
+// challenge returns a handler that responds with the key authorization of an HTTP-01 challenge.
+func challenge(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		keyAuthorization, err := service.Challenge(c.Request.Context(), c.Param("token"))
+		if err != nil {
+			return err
+		}
+		c.Response.Header().Set("Content-Type", "text/plain")
+		c.Response.WriteHeader(http.StatusOK)
+		_, err = c.Response.Write([]byte(keyAuthorization))
+		return err
+	}
+}
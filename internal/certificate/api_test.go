@@ -0,0 +1,38 @@
+package certificate
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockRepository{
+		certificates: map[int]entity.Certificate{
+			123: {DomainID: 123, Status: entity.CertificateIssued, SerialNumber: "abc", NotAfter: &notAfter, KeyEncrypted: []byte("secret"), Version: 2},
+		},
+		challenges: map[string]string{"token1": "token1.thumbprint"},
+	}
+	service := NewService(repo, mockIssuer{}, nil, time.Hour, logger)
+	RegisterHandlers(router.Group(""), service, logger)
+	RegisterChallengeHandlers(router, service)
+
+	tests := []test.APITestCase{
+		{"get 123", "GET", "/domains/123/certificate", "", nil, http.StatusOK, `*"status":"issued","serial_number":"abc"*`},
+		{"get not modified", "GET", "/domains/123/certificate", "", http.Header{"If-None-Match": {`"2"`}}, http.StatusNotModified, ""},
+		{"get unknown", "GET", "/domains/1234/certificate", "", nil, http.StatusNotFound, ""},
+		{"get invalid", "GET", "/domains/abc/certificate", "", nil, http.StatusNotFound, ""},
+		{"challenge ok", "GET", "/.well-known/acme-challenge/token1", "", nil, http.StatusOK, "*token1.thumbprint*"},
+		{"challenge unknown", "GET", "/.well-known/acme-challenge/token0", "", nil, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
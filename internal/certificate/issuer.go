@@ -0,0 +1,224 @@
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+	"golang.org/x/crypto/acme"
+)
+
+// Issuer obtains TLS certificates for domain names.
+type Issuer interface {
+	// Issue orders a certificate for the given domain name.
+	// It returns the PEM-encoded certificate chain and the PEM-encoded private key.
+	Issue(ctx context.Context, domain string) (certPEM, keyPEM []byte, err error)
+}
+
+// acmeIssuer orders certificates from an ACME (RFC 8555) certificate authority using the HTTP-01 challenge.
+// Challenge responses are stored via Repository so that any server instance can answer them.
+type acmeIssuer struct {
+	directoryURL string
+	email        string
+	httpClient   *http.Client
+	repo         Repository
+	box          *secretbox.Box
+	logger       log.Logger
+
+	mu     sync.Mutex
+	client *acme.Client
+}
+
+// NewACMEIssuer creates an Issuer that orders certificates from the ACME server with the given directory URL.
+// The ACME account key is created on first use and stored encrypted by box.
+// If httpClient is nil, http.DefaultClient will be used.
+func NewACMEIssuer(directoryURL, email string, httpClient *http.Client, repo Repository, box *secretbox.Box, logger log.Logger) Issuer {
+	return &acmeIssuer{
+		directoryURL: directoryURL,
+		email:        email,
+		httpClient:   httpClient,
+		repo:         repo,
+		box:          box,
+		logger:       logger,
+	}
+}
+
+// Issue orders a certificate for the given domain name.
+func (i *acmeIssuer) Issue(ctx context.Context, domain string) ([]byte, []byte, error) {
+	client, err := i.acmeClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := i.authorize(ctx, client, url); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// authorize fulfills the HTTP-01 challenge of the authorization with the given URL.
+func (i *acmeIssuer) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no http-01 challenge offered for %v", authz.Identifier.Value)
+	}
+
+	response, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	if err := i.repo.SaveChallenge(ctx, entity.ACMEChallenge{
+		Token:            challenge.Token,
+		KeyAuthorization: response,
+		CreatedAt:        time.Now(),
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		if err := i.repo.DeleteChallenge(context.Background(), challenge.Token); err != nil {
+			i.logger.With(ctx).Errorf("failed to delete ACME challenge: %v", err)
+		}
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// acmeClient returns an ACME client whose account is registered with the certificate authority.
+// The account is loaded from the repository, or registered and saved if it does not exist yet.
+func (i *acmeIssuer) acmeClient(ctx context.Context) (*acme.Client, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.client != nil {
+		return i.client, nil
+	}
+
+	client := &acme.Client{DirectoryURL: i.directoryURL, HTTPClient: i.httpClient}
+	account, err := i.repo.GetAccount(ctx, i.directoryURL)
+	if err == nil {
+		keyPEM, err := i.box.Open(account.KeyEncrypted)
+		if err != nil {
+			return nil, err
+		}
+		if client.Key, err = decodeKey(keyPEM); err != nil {
+			return nil, err
+		}
+		i.client = client
+		return client, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	client.Key = key
+	var contact []string
+	if i.email != "" {
+		contact = []string{"mailto:" + i.email}
+	}
+	registered, err := client.Register(ctx, &acme.Account{Contact: contact}, acme.AcceptTOS)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyEncrypted, err := i.box.Seal(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.repo.SaveAccount(ctx, entity.ACMEAccount{
+		DirectoryURL: i.directoryURL,
+		URI:          registered.URI,
+		KeyEncrypted: keyEncrypted,
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	i.logger.With(ctx, "uri", registered.URI).Infof("registered ACME account with %v", i.directoryURL)
+	i.client = client
+	return client, nil
+}
+
+// encodeKey returns the PEM encoding of an ECDSA private key.
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// decodeKey parses a PEM-encoded ECDSA private key.
+func decodeKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("invalid PEM-encoded private key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
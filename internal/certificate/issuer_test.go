@@ -0,0 +1,70 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestACMEIssuer runs against a local Pebble ACME test server (https://github.com/letsencrypt/pebble).
+// Start Pebble together with pebble-challtestsrv resolving every name to this host, e.g.
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 &
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//
+// and set PEBBLE_DIRECTORY_URL (e.g. https://127.0.0.1:14000/dir). The HTTP-01 challenges are answered
+// on PEBBLE_HTTP_ADDRESS which defaults to the Pebble httpPort ":5002".
+func TestACMEIssuer(t *testing.T) {
+	directoryURL, ok := os.LookupEnv("PEBBLE_DIRECTORY_URL")
+	if !ok {
+		t.Skip("PEBBLE_DIRECTORY_URL is not set")
+	}
+	address, ok := os.LookupEnv("PEBBLE_HTTP_ADDRESS")
+	if !ok {
+		address = ":5002"
+	}
+
+	logger, _ := log.NewForTest()
+	box, _ := secretbox.New(bytes.Repeat([]byte("k"), secretbox.KeySize))
+	repo := &mockRepository{challenges: map[string]string{}}
+
+	// answer HTTP-01 challenges through the same handler used by the API server
+	router := routing.New()
+	RegisterChallengeHandlers(router, NewService(repo, nil, box, time.Hour, logger))
+	server := &http.Server{Addr: address, Handler: router}
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	defer server.Close()
+
+	// Pebble uses a self-signed certificate for its API
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	issuer := NewACMEIssuer(directoryURL, "test@example.com", client, repo, box, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	certPEM, keyPEM, err := issuer.Issue(ctx, "test.example.com")
+	if !assert.Nil(t, err) {
+		return
+	}
+	block, _ := pem.Decode(certPEM)
+	if assert.NotNil(t, block) {
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"test.example.com"}, leaf.DNSNames)
+	}
+	assert.Contains(t, string(keyPEM), "PRIVATE KEY")
+	assert.NotNil(t, repo.account)
+	assert.Empty(t, repo.challenges)
+}
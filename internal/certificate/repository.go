@@ -0,0 +1,125 @@
+package certificate
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access certificates and ACME state from the data source.
+type Repository interface {
+	// Get returns the certificate of the domain with the specified ID.
+	Get(ctx context.Context, domainID int) (entity.Certificate, error)
+	// Save creates the certificate of a domain if its version is 0, or updates it if it is still at its version.
+	// It returns dbcontext.ErrConflict if the certificate has been saved concurrently.
+	Save(ctx context.Context, certificate entity.Certificate) error
+	// QueryDue returns the verified domains which need a new certificate.
+	// A domain is due if it has no certificate, if the order is pending,
+	// or if the certificate expires before renewBefore. Domains whose retry time is after now are skipped.
+	QueryDue(ctx context.Context, renewBefore, now time.Time, limit int) ([]entity.Domain, error)
+	// GetAccount returns the ACME account registered with the specified directory.
+	GetAccount(ctx context.Context, directoryURL string) (entity.ACMEAccount, error)
+	// SaveAccount saves an ACME account.
+	SaveAccount(ctx context.Context, account entity.ACMEAccount) error
+	// GetChallenge returns the HTTP-01 challenge with the specified token.
+	GetChallenge(ctx context.Context, token string) (entity.ACMEChallenge, error)
+	// SaveChallenge saves an HTTP-01 challenge.
+	SaveChallenge(ctx context.Context, challenge entity.ACMEChallenge) error
+	// DeleteChallenge removes the HTTP-01 challenge with the specified token.
+	DeleteChallenge(ctx context.Context, token string) error
+}
+
+// repository persists certificates in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new certificate repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the certificate of the specified domain from the database.
+func (r repository) Get(ctx context.Context, domainID int) (entity.Certificate, error) {
+	var certificate entity.Certificate
+	err := r.db.With(ctx).Select().Model(domainID, &certificate)
+	return certificate, err
+}
+
+// Save inserts the certificate record in the database, or updates it if it has a version.
+func (r repository) Save(ctx context.Context, certificate entity.Certificate) error {
+	if certificate.Version == 0 {
+		certificate.Version = 1
+		return r.db.With(ctx).Model(&certificate).Insert()
+	}
+	return r.db.UpdateVersion(ctx, "certificate", dbx.Params{
+		"status":         certificate.Status,
+		"serial_number":  certificate.SerialNumber,
+		"not_before":     certificate.NotBefore,
+		"not_after":      certificate.NotAfter,
+		"cert_encrypted": certificate.CertEncrypted,
+		"key_encrypted":  certificate.KeyEncrypted,
+		"last_error":     certificate.LastError,
+		"retry_after":    certificate.RetryAfter,
+		"updated_at":     certificate.UpdatedAt,
+	}, dbx.HashExp{"domain_id": certificate.DomainID}, certificate.Version)
+}
+
+// QueryDue retrieves the verified domains that need to be issued or renewed a certificate.
+func (r repository) QueryDue(ctx context.Context, renewBefore, now time.Time, limit int) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	err := r.db.With(ctx).
+		Select("domain.*").
+		From("domain").
+		LeftJoin("certificate", dbx.NewExp("certificate.domain_id = domain.id")).
+		Where(dbx.NewExp("domain.verified_at IS NOT NULL")).
+		AndWhere(dbx.Or(
+			dbx.NewExp("certificate.domain_id IS NULL"),
+			dbx.HashExp{"certificate.status": entity.CertificatePending},
+			dbx.NewExp("certificate.not_after IS NULL"),
+			dbx.NewExp("certificate.not_after < {:renew_before}", dbx.Params{"renew_before": renewBefore}),
+		)).
+		AndWhere(dbx.Or(
+			dbx.NewExp("certificate.retry_after IS NULL"),
+			dbx.NewExp("certificate.retry_after <= {:now}", dbx.Params{"now": now}),
+		)).
+		OrderBy("domain.id").
+		Limit(int64(limit)).
+		All(&domains)
+	return domains, err
+}
+
+// GetAccount reads the ACME account of the specified directory from the database.
+func (r repository) GetAccount(ctx context.Context, directoryURL string) (entity.ACMEAccount, error) {
+	var account entity.ACMEAccount
+	err := r.db.With(ctx).Select().Model(directoryURL, &account)
+	return account, err
+}
+
+// SaveAccount saves a new ACME account record in the database.
+func (r repository) SaveAccount(ctx context.Context, account entity.ACMEAccount) error {
+	return r.db.With(ctx).Model(&account).Insert()
+}
+
+// GetChallenge reads the HTTP-01 challenge with the specified token from the database.
+func (r repository) GetChallenge(ctx context.Context, token string) (entity.ACMEChallenge, error) {
+	var challenge entity.ACMEChallenge
+	err := r.db.With(ctx).Select().Model(token, &challenge)
+	return challenge, err
+}
+
+// SaveChallenge saves a new HTTP-01 challenge record in the database.
+func (r repository) SaveChallenge(ctx context.Context, challenge entity.ACMEChallenge) error {
+	return r.db.With(ctx).Model(&challenge).Insert()
+}
+
+// DeleteChallenge deletes the HTTP-01 challenge with the specified token from the database.
+func (r repository) DeleteChallenge(ctx context.Context, token string) error {
+	_, err := r.db.With(ctx).Delete("acme_challenge", dbx.HashExp{"token": token}).Execute()
+	return err
+}
@@ -0,0 +1,94 @@
+package certificate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "certificate", "acme_challenge", "acme_account", "domain", "account")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// domains
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "test@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	for _, domain := range []entity.Domain{
+		{ID: 1, AccountId: 1, Domain: "new.example.com", VerifiedAt: &now, CreatedAt: now, UpdatedAt: now},
+		{ID: 2, AccountId: 1, Domain: "issued.example.com", VerifiedAt: &now, CreatedAt: now, UpdatedAt: now},
+		{ID: 3, AccountId: 1, Domain: "unverified.example.com", CreatedAt: now, UpdatedAt: now},
+	} {
+		assert.Nil(t, db.DB().Model(&domain).Insert())
+	}
+
+	// save and get
+	notAfter := now.Add(90 * 24 * time.Hour)
+	err = repo.Save(ctx, entity.Certificate{
+		DomainID:      2,
+		Status:        entity.CertificateIssued,
+		SerialNumber:  "abc",
+		NotAfter:      &notAfter,
+		CertEncrypted: []byte("cert"),
+		KeyEncrypted:  []byte("key"),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	assert.Nil(t, err)
+	certificate, err := repo.Get(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", certificate.SerialNumber)
+	assert.Equal(t, []byte("key"), certificate.KeyEncrypted)
+	assert.Equal(t, 1, certificate.Version)
+	_, err = repo.Get(ctx, 1)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query due
+	domains, err := repo.QueryDue(ctx, now.Add(30*24*time.Hour), now, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(domains)) {
+		assert.Equal(t, "new.example.com", domains[0].Domain)
+	}
+	domains, _ = repo.QueryDue(ctx, now.Add(100*24*time.Hour), now, 10)
+	assert.Equal(t, 2, len(domains))
+
+	// save updates the existing record
+	retryAfter := now.Add(time.Hour)
+	certificate.LastError = "failed"
+	certificate.RetryAfter = &retryAfter
+	assert.Nil(t, repo.Save(ctx, certificate))
+	assert.Equal(t, dbcontext.ErrConflict, repo.Save(ctx, certificate))
+	certificate, _ = repo.Get(ctx, 2)
+	assert.Equal(t, "failed", certificate.LastError)
+	assert.Equal(t, 2, certificate.Version)
+	domains, _ = repo.QueryDue(ctx, now.Add(100*24*time.Hour), now, 10)
+	assert.Equal(t, 1, len(domains))
+
+	// account
+	_, err = repo.GetAccount(ctx, "https://acme.example.com/dir")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, repo.SaveAccount(ctx, entity.ACMEAccount{DirectoryURL: "https://acme.example.com/dir", URI: "acct1", KeyEncrypted: []byte("key"), CreatedAt: now}))
+	account, err := repo.GetAccount(ctx, "https://acme.example.com/dir")
+	assert.Nil(t, err)
+	assert.Equal(t, "acct1", account.URI)
+
+	// challenge
+	assert.Nil(t, repo.SaveChallenge(ctx, entity.ACMEChallenge{Token: "token1", KeyAuthorization: "token1.thumbprint", CreatedAt: now}))
+	challenge, err := repo.GetChallenge(ctx, "token1")
+	assert.Nil(t, err)
+	assert.Equal(t, "token1.thumbprint", challenge.KeyAuthorization)
+	assert.Nil(t, repo.DeleteChallenge(ctx, "token1"))
+	_, err = repo.GetChallenge(ctx, "token1")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,174 @@
+package certificate
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+)
+
+const (
+	// renewBatchSize is the maximum number of certificates ordered in one renewal run.
+	renewBatchSize = 50
+	// orderTimeout is the maximum time allowed for a single certificate order.
+	orderTimeout = 5 * time.Minute
+	// retryDelay is how long to wait before retrying a failed order.
+	retryDelay = time.Hour
+)
+
+// Service encapsulates usecase logic for domain certificates.
+type Service interface {
+	// Get returns the certificate status of the domain with the specified ID.
+	Get(ctx context.Context, domainID int) (Certificate, error)
+	// Challenge returns the key authorization answering the HTTP-01 challenge with the specified token.
+	Challenge(ctx context.Context, token string) (string, error)
+	// Renew orders certificates for the verified domains that have none or whose certificate expires soon.
+	Renew(ctx context.Context) error
+}
+
+// Certificate represents the status of a domain certificate.
+type Certificate struct {
+	entity.Certificate
+}
+
+type service struct {
+	repo        Repository
+	issuer      Issuer
+	box         *secretbox.Box
+	renewBefore time.Duration
+	logger      log.Logger
+}
+
+// NewService creates a new certificate service.
+// Certificates are renewed when they expire within renewBefore.
+func NewService(repo Repository, issuer Issuer, box *secretbox.Box, renewBefore time.Duration, logger log.Logger) Service {
+	return service{repo, issuer, box, renewBefore, logger}
+}
+
+// Get returns the certificate status of the domain with the specified ID.
+func (s service) Get(ctx context.Context, domainID int) (Certificate, error) {
+	certificate, err := s.repo.Get(ctx, domainID)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{certificate}, nil
+}
+
+// Challenge returns the key authorization answering the HTTP-01 challenge with the specified token.
+func (s service) Challenge(ctx context.Context, token string) (string, error) {
+	challenge, err := s.repo.GetChallenge(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return challenge.KeyAuthorization, nil
+}
+
+// Renew orders certificates for the verified domains that have none or whose certificate expires soon.
+// A failed order is recorded with the certificate and retried after a delay.
+func (s service) Renew(ctx context.Context) error {
+	now := time.Now()
+	domains, err := s.repo.QueryDue(ctx, now.Add(s.renewBefore), now, renewBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, domain := range domains {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.renew(ctx, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renew orders a certificate for the given domain and saves the outcome.
+func (s service) renew(ctx context.Context, domain entity.Domain) error {
+	logger := s.logger.With(ctx, "domain", domain.Domain)
+
+	certificate, err := s.repo.Get(ctx, domain.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		certificate = entity.Certificate{
+			DomainID:  domain.ID,
+			Status:    entity.CertificatePending,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	orderCtx, cancel := context.WithTimeout(ctx, orderTimeout)
+	certPEM, keyPEM, err := s.issuer.Issue(orderCtx, domain.Domain)
+	cancel()
+	if err == nil {
+		err = s.store(&certificate, certPEM, keyPEM)
+	}
+
+	now := time.Now()
+	certificate.UpdatedAt = now
+	if err != nil {
+		logger.Errorf("failed to issue certificate: %v", err)
+		retryAfter := now.Add(retryDelay)
+		certificate.LastError = err.Error()
+		certificate.RetryAfter = &retryAfter
+		if certificate.NotAfter == nil || certificate.NotAfter.Before(now) {
+			certificate.Status = entity.CertificateFailed
+		}
+	} else {
+		logger.Infof("issued certificate %v valid until %v", certificate.SerialNumber, certificate.NotAfter)
+	}
+	return s.repo.Save(ctx, certificate)
+}
+
+// store encrypts the issued certificate and key into the certificate record.
+func (s service) store(certificate *entity.Certificate, certPEM, keyPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return errors.New("issued certificate is not PEM-encoded")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	certEncrypted, err := s.box.Seal(certPEM)
+	if err != nil {
+		return err
+	}
+	keyEncrypted, err := s.box.Seal(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	certificate.Status = entity.CertificateIssued
+	certificate.SerialNumber = leaf.SerialNumber.Text(16)
+	certificate.NotBefore = &leaf.NotBefore
+	certificate.NotAfter = &leaf.NotAfter
+	certificate.CertEncrypted = certEncrypted
+	certificate.KeyEncrypted = keyEncrypted
+	certificate.LastError = ""
+	certificate.RetryAfter = nil
+	return nil
+}
+
+// RunRenewal calls Service.Renew periodically with the given interval until the context is cancelled.
+func RunRenewal(ctx context.Context, service Service, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := service.Renew(ctx); err != nil && ctx.Err() == nil {
+			logger.With(ctx).Errorf("certificate renewal failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+)
+
+var errIssue = errors.New("error issue")
+
+func Test_service_Renew(t *testing.T) {
+	logger, _ := log.NewForTest()
+	box, _ := secretbox.New(bytes.Repeat([]byte("k"), secretbox.KeySize))
+	now := time.Now()
+	expiring := now.Add(24 * time.Hour)
+	repo := &mockRepository{
+		domains: []entity.Domain{
+			{ID: 1, Domain: "new.example.com", VerifiedAt: &now},
+			{ID: 2, Domain: "expiring.example.com", VerifiedAt: &now},
+			{ID: 3, Domain: "error", VerifiedAt: &now},
+			{ID: 4, Domain: "unverified.example.com"},
+		},
+		certificates: map[int]entity.Certificate{
+			2: {DomainID: 2, Status: entity.CertificateIssued, NotAfter: &expiring, CreatedAt: now, Version: 1},
+		},
+	}
+	s := NewService(repo, mockIssuer{}, box, 30*24*time.Hour, logger)
+	ctx := context.Background()
+
+	assert.Nil(t, s.Renew(ctx))
+
+	// new certificate
+	certificate, err := s.Get(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.CertificateIssued, certificate.Status)
+	assert.NotEmpty(t, certificate.SerialNumber)
+	assert.True(t, certificate.NotAfter.After(now.Add(60*24*time.Hour)))
+	assert.NotContains(t, string(certificate.KeyEncrypted), "PRIVATE KEY")
+	keyPEM, err := box.Open(certificate.KeyEncrypted)
+	assert.Nil(t, err)
+	assert.Contains(t, string(keyPEM), "PRIVATE KEY")
+	assert.Equal(t, 1, certificate.Version)
+
+	// renewed certificate
+	certificate, _ = s.Get(ctx, 2)
+	assert.Equal(t, entity.CertificateIssued, certificate.Status)
+	assert.True(t, certificate.NotAfter.After(expiring))
+	assert.Equal(t, now, certificate.CreatedAt)
+	assert.Equal(t, 2, certificate.Version)
+
+	// failed order
+	certificate, _ = s.Get(ctx, 3)
+	assert.Equal(t, entity.CertificateFailed, certificate.Status)
+	assert.Equal(t, errIssue.Error(), certificate.LastError)
+	assert.NotNil(t, certificate.RetryAfter)
+
+	// unverified domain
+	_, err = s.Get(ctx, 4)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// nothing due until the failed order can be retried
+	assert.Nil(t, s.Renew(ctx))
+	assert.Equal(t, 3, repo.saves)
+}
+
+func Test_service_Challenge(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{challenges: map[string]string{"token1": "token1.thumbprint"}}
+	s := NewService(repo, mockIssuer{}, nil, time.Hour, logger)
+
+	keyAuthorization, err := s.Challenge(context.Background(), "token1")
+	assert.Nil(t, err)
+	assert.Equal(t, "token1.thumbprint", keyAuthorization)
+	_, err = s.Challenge(context.Background(), "token0")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+type mockIssuer struct{}
+
+// Issue returns a self-signed certificate valid for 90 days.
+func (m mockIssuer) Issue(ctx context.Context, domain string) ([]byte, []byte, error) {
+	if domain == "error" {
+		return nil, nil, errIssue
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, err
+}
+
+type mockRepository struct {
+	domains      []entity.Domain
+	certificates map[int]entity.Certificate
+	challenges   map[string]string
+	account      *entity.ACMEAccount
+	saves        int
+}
+
+func (m *mockRepository) Get(ctx context.Context, domainID int) (entity.Certificate, error) {
+	if certificate, ok := m.certificates[domainID]; ok {
+		return certificate, nil
+	}
+	return entity.Certificate{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Save(ctx context.Context, certificate entity.Certificate) error {
+	if certificate.Version != m.certificates[certificate.DomainID].Version {
+		return dbcontext.ErrConflict
+	}
+	certificate.Version++
+	m.certificates[certificate.DomainID] = certificate
+	m.saves++
+	return nil
+}
+
+func (m *mockRepository) QueryDue(ctx context.Context, renewBefore, now time.Time, limit int) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	for _, domain := range m.domains {
+		if domain.VerifiedAt == nil {
+			continue
+		}
+		certificate, ok := m.certificates[domain.ID]
+		if ok && certificate.RetryAfter != nil && certificate.RetryAfter.After(now) {
+			continue
+		}
+		if !ok || certificate.Status == entity.CertificatePending || certificate.NotAfter == nil || certificate.NotAfter.Before(renewBefore) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+func (m *mockRepository) GetAccount(ctx context.Context, directoryURL string) (entity.ACMEAccount, error) {
+	if m.account != nil && m.account.DirectoryURL == directoryURL {
+		return *m.account, nil
+	}
+	return entity.ACMEAccount{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) SaveAccount(ctx context.Context, account entity.ACMEAccount) error {
+	m.account = &account
+	return nil
+}
+
+func (m *mockRepository) GetChallenge(ctx context.Context, token string) (entity.ACMEChallenge, error) {
+	if keyAuthorization, ok := m.challenges[token]; ok {
+		return entity.ACMEChallenge{Token: token, KeyAuthorization: keyAuthorization}, nil
+	}
+	return entity.ACMEChallenge{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) SaveChallenge(ctx context.Context, challenge entity.ACMEChallenge) error {
+	m.challenges[challenge.Token] = challenge.KeyAuthorization
+	return nil
+}
+
+func (m *mockRepository) DeleteChallenge(ctx context.Context, token string) error {
+	delete(m.challenges, token)
+	return nil
+}
@@ -9,8 +9,21 @@ import (
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort                  = 8080
+	defaultJWTExpirationHours          = 72
+	defaultCertificateRenewBeforeDays  = 30
+	defaultCertificateCheckMinutes     = 60
+	defaultHealthCheckMinutes          = 5
+	defaultHealthCheckConcurrency      = 10
+	defaultHealthCheckJitterSeconds    = 30
+	defaultDNSUpdateTimeoutSeconds     = 10
+	defaultIdempotencyKeyTTLHours      = 24
+	defaultWebhookDispatchSeconds      = 5
+	defaultWebhookTimeoutSeconds       = 10
+	defaultWebhookMaxAttempts          = 10
+	defaultWebhookFailureLimit         = 50
+	defaultEventStreamHeartbeatSeconds = 15
+	defaultEventStreamMaxConnections   = 1000
 )
 
 // Config represents an application configuration.
@@ -23,6 +36,70 @@ type Config struct {
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
 	// JWT expiration in hours. Defaults to 72 hours (3 days)
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// ACME directory URL for ordering TLS certificates of verified domains. Certificates are not ordered if empty.
+	ACMEDirectoryURL string `yaml:"acme_directory_url" env:"ACME_DIRECTORY_URL"`
+	// contact email of the ACME account. optional.
+	ACMEEmail string `yaml:"acme_email" env:"ACME_EMAIL"`
+	// base64-encoded 32-byte key encrypting certificates and keys in the database. required if ACMEDirectoryURL is set.
+	CertificateEncryptionKey string `yaml:"certificate_encryption_key" env:"CERTIFICATE_ENCRYPTION_KEY,secret"`
+	// renew certificates this many days before they expire. Defaults to 30 days.
+	CertificateRenewBefore int `yaml:"certificate_renew_before" env:"CERTIFICATE_RENEW_BEFORE"`
+	// interval in minutes between certificate renewal runs. Defaults to 60 minutes.
+	CertificateCheckInterval int `yaml:"certificate_check_interval" env:"CERTIFICATE_CHECK_INTERVAL"`
+	// interval in minutes between domain health check runs. Defaults to 5 minutes.
+	HealthCheckInterval int `yaml:"health_check_interval" env:"HEALTH_CHECK_INTERVAL"`
+	// maximum number of domains checked at the same time. Defaults to 10.
+	HealthCheckConcurrency int `yaml:"health_check_concurrency" env:"HEALTH_CHECK_CONCURRENCY"`
+	// maximum random delay in seconds before each domain check. Defaults to 30 seconds.
+	HealthCheckJitter int `yaml:"health_check_jitter" env:"HEALTH_CHECK_JITTER"`
+	// expected CNAME target of customer domains. optional.
+	HealthCheckCNAME string `yaml:"health_check_cname" env:"HEALTH_CHECK_CNAME"`
+	// expected IP addresses of customer domains, as a JSON array in the environment variable. optional.
+	HealthCheckIPs []string `yaml:"health_check_ips" env:"HEALTH_CHECK_IPS"`
+	// address ("host:port") of the DNS server receiving dynamic updates (RFC 2136) of managed zones.
+	// Zones are only kept in memory if empty.
+	DNSUpdateServer string `yaml:"dns_update_server" env:"DNS_UPDATE_SERVER"`
+	// name of the TSIG key signing dynamic updates. Updates are not signed if empty.
+	DNSUpdateKeyName string `yaml:"dns_update_key_name" env:"DNS_UPDATE_KEY_NAME"`
+	// base64-encoded TSIG secret. required if DNSUpdateKeyName is set.
+	DNSUpdateKeySecret string `yaml:"dns_update_key_secret" env:"DNS_UPDATE_KEY_SECRET,secret"`
+	// TSIG algorithm, e.g. hmac-sha256. Defaults to hmac-sha256.
+	DNSUpdateKeyAlgorithm string `yaml:"dns_update_key_algorithm" env:"DNS_UPDATE_KEY_ALGORITHM"`
+	// timeout in seconds of dynamic updates. Defaults to 10 seconds.
+	DNSUpdateTimeout int `yaml:"dns_update_timeout" env:"DNS_UPDATE_TIMEOUT"`
+	// key signing pagination cursors. A random key is used if empty, so cursors expire when the server restarts.
+	CursorSigningKey string `yaml:"cursor_signing_key" env:"CURSOR_SIGNING_KEY,secret"`
+	// hours after which the responses saved for idempotency keys expire. Defaults to 24 hours.
+	IdempotencyKeyTTL int `yaml:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL"`
+	// base64-encoded 32-byte key encrypting the signing secrets of webhooks in the database. required.
+	WebhookEncryptionKey string `yaml:"webhook_encryption_key" env:"WEBHOOK_ENCRYPTION_KEY,secret"`
+	// interval in seconds between webhook dispatch runs. Defaults to 5 seconds.
+	WebhookDispatchInterval int `yaml:"webhook_dispatch_interval" env:"WEBHOOK_DISPATCH_INTERVAL"`
+	// timeout in seconds of webhook deliveries. Defaults to 10 seconds.
+	WebhookTimeout int `yaml:"webhook_timeout" env:"WEBHOOK_TIMEOUT"`
+	// networks in CIDR notation whose addresses webhooks may be delivered to although they are not public,
+	// e.g. 127.0.0.0/8 for a local receiver, as a JSON array in the environment variable. optional.
+	WebhookAllowedNetworks []string `yaml:"webhook_allowed_networks" env:"WEBHOOK_ALLOWED_NETWORKS"`
+	// number of failed attempts after which a webhook delivery is dead. Defaults to 10.
+	WebhookMaxAttempts int `yaml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	// number of consecutive failed delivery attempts after which a webhook is disabled. Defaults to 50.
+	WebhookFailureLimit int `yaml:"webhook_failure_limit" env:"WEBHOOK_FAILURE_LIMIT"`
+	// address ("host:port") of the SMTP server sending notification emails. Notifications are only logged if empty.
+	SMTPServer string `yaml:"smtp_server" env:"SMTP_SERVER"`
+	// username authenticating to the SMTP server. The server is not authenticated to if empty.
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	// password authenticating to the SMTP server.
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD,secret"`
+	// sender address of notification emails. required if SMTPServer is set.
+	SMTPFrom string `yaml:"smtp_from" env:"SMTP_FROM"`
+	// interval in seconds between the heartbeats of idle event streams. Defaults to 15 seconds.
+	EventStreamHeartbeat int `yaml:"event_stream_heartbeat" env:"EVENT_STREAM_HEARTBEAT"`
+	// maximum number of event streams open on a server instance at the same time. Defaults to 1000.
+	EventStreamMaxConnections int `yaml:"event_stream_max_connections" env:"EVENT_STREAM_MAX_CONNECTIONS"`
+	// whether requests are validated against the OpenAPI document before they are handled. Defaults to false.
+	ValidateRequests bool `yaml:"validate_requests" env:"VALIDATE_REQUESTS"`
+	// path to a checked-in OpenAPI document that requests are validated against. The generated document is used if empty.
+	OpenAPIFile string `yaml:"openapi_file" env:"OPENAPI_FILE"`
 }
 
 // Validate validates the application configuration.
@@ -30,6 +107,23 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.CertificateEncryptionKey, validation.When(c.ACMEDirectoryURL != "", validation.Required)),
+		validation.Field(&c.CertificateRenewBefore, validation.Min(1)),
+		validation.Field(&c.CertificateCheckInterval, validation.Min(1)),
+		validation.Field(&c.HealthCheckInterval, validation.Min(1)),
+		validation.Field(&c.HealthCheckConcurrency, validation.Min(1)),
+		validation.Field(&c.HealthCheckJitter, validation.Min(0)),
+		validation.Field(&c.DNSUpdateKeySecret, validation.When(c.DNSUpdateKeyName != "", validation.Required)),
+		validation.Field(&c.DNSUpdateTimeout, validation.Min(1)),
+		validation.Field(&c.IdempotencyKeyTTL, validation.Min(1)),
+		validation.Field(&c.WebhookEncryptionKey, validation.Required),
+		validation.Field(&c.WebhookDispatchInterval, validation.Min(1)),
+		validation.Field(&c.WebhookTimeout, validation.Min(1)),
+		validation.Field(&c.WebhookMaxAttempts, validation.Min(1)),
+		validation.Field(&c.WebhookFailureLimit, validation.Min(1)),
+		validation.Field(&c.SMTPFrom, validation.When(c.SMTPServer != "", validation.Required)),
+		validation.Field(&c.EventStreamHeartbeat, validation.Min(1)),
+		validation.Field(&c.EventStreamMaxConnections, validation.Min(1)),
 	)
 }
 
@@ -37,8 +131,21 @@ func (c Config) Validate() error {
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:                defaultServerPort,
+		JWTExpiration:             defaultJWTExpirationHours,
+		CertificateRenewBefore:    defaultCertificateRenewBeforeDays,
+		CertificateCheckInterval:  defaultCertificateCheckMinutes,
+		HealthCheckInterval:       defaultHealthCheckMinutes,
+		HealthCheckConcurrency:    defaultHealthCheckConcurrency,
+		HealthCheckJitter:         defaultHealthCheckJitterSeconds,
+		DNSUpdateTimeout:          defaultDNSUpdateTimeoutSeconds,
+		IdempotencyKeyTTL:         defaultIdempotencyKeyTTLHours,
+		WebhookDispatchInterval:   defaultWebhookDispatchSeconds,
+		WebhookTimeout:            defaultWebhookTimeoutSeconds,
+		WebhookMaxAttempts:        defaultWebhookMaxAttempts,
+		WebhookFailureLimit:       defaultWebhookFailureLimit,
+		EventStreamHeartbeat:      defaultEventStreamHeartbeatSeconds,
+		EventStreamMaxConnections: defaultEventStreamMaxConnections,
 	}
 
 	// load from YAML config file
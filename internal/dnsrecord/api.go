@@ -0,0 +1,194 @@
+package dnsrecord
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+const (
+	// zoneContentType is the media type of zone files (RFC 4027).
+	zoneContentType = "text/dns"
+	// maxZoneSize is the maximum size in bytes of an imported zone file.
+	maxZoneSize = 1 << 20
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/domains/<id>/dns/records", res.query)
+	r.Get("/domains/<id>/dns/records/<recordID>", res.get)
+	r.Get("/domains/<id>/dns/zone", res.exportZone)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/domains/<id>/dns/records", res.create)
+	r.Put("/domains/<id>/dns/records/<recordID>", res.update)
+	r.Delete("/domains/<id>/dns/records/<recordID>", res.delete)
+	r.Post("/domains/<id>/dns/zone", res.importZone)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/domains/<id>/dns/records", Summary: "List the DNS records of a domain", Params: openapi.PageParams,
+		Response: openapi.Page(Record{})},
+	{Method: "GET", Path: "/domains/<id>/dns/records/<recordID>", Summary: "Get a DNS record", Params: []openapi.Parameter{openapi.IfNoneMatchParam},
+		Response: Record{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/domains/<id>/dns/zone", Summary: "Export the zone file of a domain", Response: "", ResponseType: zoneContentType},
+	{Method: "POST", Path: "/domains/<id>/dns/records", Summary: "Create a DNS record", Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+		Request: RecordRequest{}, Status: http.StatusCreated, Response: Record{}, Errors: []int{http.StatusForbidden, http.StatusBadGateway}},
+	{Method: "PUT", Path: "/domains/<id>/dns/records/<recordID>", Summary: "Update a DNS record", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: RecordRequest{}, Response: Record{}, Errors: []int{http.StatusForbidden, http.StatusPreconditionFailed, http.StatusBadGateway}},
+	{Method: "DELETE", Path: "/domains/<id>/dns/records/<recordID>", Summary: "Delete a DNS record", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Response: Record{}, Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusBadGateway}},
+	{Method: "POST", Path: "/domains/<id>/dns/zone", Summary: "Import a zone file into the zone of a domain", Auth: true,
+		Params:  []openapi.Parameter{{Name: "replace", In: "query", Description: "Whether the existing records are replaced.", Type: "boolean"}},
+		Request: "", RequestType: zoneContentType, Status: http.StatusCreated, Response: ImportResult{},
+		Errors: []int{http.StatusForbidden, http.StatusBadGateway}},
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	domainID, id, err := recordParams(c)
+	if err != nil {
+		return err
+	}
+	record, err := r.service.Get(c.Request.Context(), domainID, id)
+	if err != nil {
+		return err
+	}
+	if etag.NotModified(c.Response, c.Request, record.Version) {
+		return nil
+	}
+
+	return c.Write(record)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	count, err := r.service.Count(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	records, err := r.service.Query(ctx, domainID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = records
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	var input RecordRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	record, err := r.service.Create(c.Request.Context(), domainID, input)
+	if err != nil {
+		return err
+	}
+
+	etag.Set(c.Response, record.Version)
+	return c.WriteWithStatus(record, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	domainID, id, err := recordParams(c)
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	var input RecordRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	record, err := r.service.Update(c.Request.Context(), domainID, id, version, input)
+	if err != nil {
+		return err
+	}
+
+	etag.Set(c.Response, record.Version)
+	return c.Write(record)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	domainID, id, err := recordParams(c)
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	record, err := r.service.Delete(c.Request.Context(), domainID, id, version)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(record)
+}
+
+// importZone adds the records of the zone file in the request body to the zone of a domain.
+// With ?replace=true the existing records of the zone are replaced.
+func (r resource) importZone(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	body := http.MaxBytesReader(c.Response, c.Request.Body, maxZoneSize)
+	result, err := r.service.ImportZone(c.Request.Context(), domainID, body, c.Query("replace") == "true")
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(result, http.StatusCreated)
+}
+
+// exportZone responds with the records of the zone of a domain as a zone file.
+func (r resource) exportZone(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	c.Response.Header().Set("Content-Type", zoneContentType)
+	return r.service.ExportZone(c.Request.Context(), domainID, c.Response)
+}
+
+// recordParams returns the domain ID and the record ID in the path.
+func recordParams(c *routing.Context) (int, int, error) {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, errors.NotFound("")
+	}
+	id, err := strconv.Atoi(c.Param("recordID"))
+	if err != nil {
+		return 0, 0, errors.NotFound("")
+	}
+	return domainID, id, nil
+}
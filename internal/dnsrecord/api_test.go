@@ -0,0 +1,63 @@
+package dnsrecord
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	s := NewService(newMockRepository(), NewMemoryProvider(), test.MockTransactional, logger)
+	RegisterHandlers(router.Group(""), s, auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+	zoneHeader := auth.MockAuthHeader()
+	zoneHeader.Set("Content-Type", "text/dns")
+	ifNoneMatch := http.Header{"If-None-Match": {`"1"`}}
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+
+	tests := []test.APITestCase{
+		{"create ok", "POST", "/domains/1/dns/records", `{"name":"www","type":"A","value":"192.0.2.1"}`, header, http.StatusCreated, `*"id":1,"domain_id":1,"name":"www","type":"A","ttl":3600,"priority":0,"value":"192.0.2.1"*`},
+		{"create mx", "POST", "/domains/1/dns/records", `{"name":"@","type":"MX","priority":10,"value":"mail.example.com"}`, header, http.StatusCreated, `*"value":"mail.example.com."*`},
+		{"create auth error", "POST", "/domains/1/dns/records", `{"name":"www","type":"A","value":"192.0.2.1"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/domains/1/dns/records", `"name":"www"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/domains/1/dns/records", `{"name":"www","type":"AAAA","value":"192.0.2.1"}`, header, http.StatusBadRequest, `*"field":"value"*`},
+		{"create conflict", "POST", "/domains/1/dns/records", `{"name":"www","type":"CNAME","value":"edge.example.net"}`, header, http.StatusBadRequest, `*CNAME*`},
+		{"create unverified", "POST", "/domains/2/dns/records", `{"name":"www","type":"A","value":"192.0.2.1"}`, header, http.StatusForbidden, ""},
+		{"create unknown domain", "POST", "/domains/3/dns/records", `{"name":"www","type":"A","value":"192.0.2.1"}`, header, http.StatusNotFound, ""},
+		{"get", "GET", "/domains/1/dns/records/1", "", nil, http.StatusOK, `*"value":"192.0.2.1"*`},
+		{"get not modified", "GET", "/domains/1/dns/records/1", "", ifNoneMatch, http.StatusNotModified, ""},
+		{"get unknown", "GET", "/domains/1/dns/records/3", "", nil, http.StatusNotFound, ""},
+		{"get other domain", "GET", "/domains/2/dns/records/1", "", nil, http.StatusNotFound, ""},
+		{"get invalid", "GET", "/domains/1/dns/records/abc", "", nil, http.StatusNotFound, ""},
+		{"get all", "GET", "/domains/1/dns/records", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"update conflict", "PUT", "/domains/1/dns/records/1", `{"name":"www","type":"A","ttl":300,"value":"192.0.2.2"}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update if-match error", "PUT", "/domains/1/dns/records/1", `{"name":"www","type":"A","ttl":300,"value":"192.0.2.2"}`, ifMatch(`"1", "2"`), http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/domains/1/dns/records/1", `{"name":"www","type":"A","ttl":300,"value":"192.0.2.2"}`, ifMatch(`"1"`), http.StatusOK, `*"ttl":300,"priority":0,"value":"192.0.2.2","version":2*`},
+		{"update verify", "GET", "/domains/1/dns/records/1", "", ifNoneMatch, http.StatusOK, `*"version":2*`},
+		{"update auth error", "PUT", "/domains/1/dns/records/1", `{"name":"www","type":"A","value":"192.0.2.2"}`, nil, http.StatusUnauthorized, ""},
+		{"update validation error", "PUT", "/domains/1/dns/records/1", `{"name":"www","type":"A","ttl":1,"value":"192.0.2.2"}`, header, http.StatusBadRequest, `*"field":"ttl"*`},
+		{"update unknown", "PUT", "/domains/1/dns/records/3", `{"name":"www","type":"A","value":"192.0.2.2"}`, header, http.StatusNotFound, ""},
+		{"export", "GET", "/domains/1/dns/zone", "", nil, http.StatusOK, "*$ORIGIN example.com.\nwww.example.com.\t300\tIN\tA\t192.0.2.2\nexample.com.\t3600\tIN\tMX\t10 mail.example.com.\n*"},
+		{"export unknown", "GET", "/domains/3/dns/zone", "", nil, http.StatusNotFound, ""},
+		{"import ok", "POST", "/domains/1/dns/zone", "txt IN TXT \"hello\"\napp IN CNAME www\n", zoneHeader, http.StatusCreated, `{"created":2,"deleted":0,"skipped":0}`},
+		{"import replace", "POST", "/domains/1/dns/zone?replace=true", "@ IN A 192.0.2.3\n", zoneHeader, http.StatusCreated, `{"created":1,"deleted":4,"skipped":0}`},
+		{"import invalid", "POST", "/domains/1/dns/zone", "@ IN A 192.0.2\n", zoneHeader, http.StatusBadRequest, `*zone file is invalid*`},
+		{"import auth error", "POST", "/domains/1/dns/zone", "@ IN A 192.0.2.4\n", nil, http.StatusUnauthorized, ""},
+		{"delete conflict", "DELETE", "/domains/1/dns/records/5", "", ifMatch(`"2"`), http.StatusPreconditionFailed, ""},
+		{"delete ok", "DELETE", "/domains/1/dns/records/5", "", ifMatch(`"1"`), http.StatusOK, `*"value":"192.0.2.3"*`},
+		{"delete verify", "DELETE", "/domains/1/dns/records/5", "", header, http.StatusNotFound, ""},
+		{"delete auth error", "DELETE", "/domains/1/dns/records/5", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
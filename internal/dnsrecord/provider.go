@@ -0,0 +1,65 @@
+package dnsrecord
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// DNSProvider pushes the changes of managed zones to the authoritative DNS servers.
+type DNSProvider interface {
+	// Update removes and adds resource records of a zone. Providers should apply the change atomically.
+	// Removing a record that does not exist and adding one that already exists are not errors.
+	Update(ctx context.Context, zone string, remove, add []dns.RR) error
+}
+
+// MemoryProvider is a DNSProvider keeping zones in memory. It is meant for tests and local development.
+type MemoryProvider struct {
+	mu    sync.Mutex
+	zones map[string]map[string]dns.RR
+}
+
+// NewMemoryProvider creates a new MemoryProvider with no zones.
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{zones: map[string]map[string]dns.RR{}}
+}
+
+// Update removes and adds resource records of a zone in memory.
+func (p *MemoryProvider) Update(ctx context.Context, zone string, remove, add []dns.RR) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	records := p.zones[zone]
+	if records == nil {
+		records = map[string]dns.RR{}
+		p.zones[zone] = records
+	}
+	for _, rr := range remove {
+		delete(records, rrKey(rr))
+	}
+	for _, rr := range add {
+		records[rrKey(rr)] = rr
+	}
+	return nil
+}
+
+// Records returns the resource records of a zone in presentation format, sorted.
+func (p *MemoryProvider) Records(zone string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	records := []string{}
+	for _, rr := range p.zones[zone] {
+		records = append(records, rr.String())
+	}
+	sort.Strings(records)
+	return records
+}
+
+// rrKey identifies a resource record by its owner, class, type and data, but not by its TTL,
+// like RFC 2136 does when deleting an RR from an RRset.
+func rrKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Ttl = 0
+	return rr.String()
+}
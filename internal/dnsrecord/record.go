@@ -0,0 +1,144 @@
+package dnsrecord
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+)
+
+// apex is the name of the records at the zone apex.
+const apex = "@"
+
+// zoneName returns the fully qualified name of the zone of a domain.
+func zoneName(domain entity.Domain) string {
+	return dns.Fqdn(strings.ToLower(domain.Domain))
+}
+
+// ownerName returns the fully qualified owner name of a record name relative to the zone.
+func ownerName(zone, name string) string {
+	if name == apex {
+		return zone
+	}
+	return name + "." + zone
+}
+
+// relativeName returns the name relative to the zone of a fully qualified owner name.
+func relativeName(zone, owner string) (string, error) {
+	owner = strings.ToLower(owner)
+	if owner == zone {
+		return apex, nil
+	}
+	if !strings.HasSuffix(owner, "."+zone) {
+		return "", fmt.Errorf("%v is not in the zone %v", owner, zone)
+	}
+	return strings.TrimSuffix(owner, "."+zone), nil
+}
+
+// toRR converts a record of the zone into a resource record.
+// It fails if the record data cannot be parsed according to the record type.
+func toRR(zone string, record entity.DNSRecord) (dns.RR, error) {
+	data := record.Value
+	switch record.Type {
+	case entity.DNSTypeMX:
+		data = strconv.Itoa(record.Priority) + " " + record.Value
+	case entity.DNSTypeTXT:
+		data = quoteTXT(record.Value)
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", ownerName(zone, record.Name), record.TTL, record.Type, data))
+	if err == nil && rr == nil {
+		err = fmt.Errorf("the %v record is empty", record.Type)
+	}
+	return rr, err
+}
+
+// toRRs converts records of the zone into resource records.
+func toRRs(zone string, records []entity.DNSRecord) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		rr, err := toRR(zone, record)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// fromRR converts a resource record into a record of the zone.
+// It fails if the record type is not supported or if the record is out of the zone.
+func fromRR(zone string, rr dns.RR) (entity.DNSRecord, error) {
+	name, err := relativeName(zone, rr.Header().Name)
+	if err != nil {
+		return entity.DNSRecord{}, err
+	}
+	record := entity.DNSRecord{
+		Name: name,
+		Type: dns.TypeToString[rr.Header().Rrtype],
+		TTL:  int(rr.Header().Ttl),
+	}
+	switch rr := rr.(type) {
+	case *dns.A:
+		record.Value = rr.A.String()
+	case *dns.AAAA:
+		record.Value = rr.AAAA.String()
+	case *dns.CNAME:
+		record.Value = strings.ToLower(rr.Target)
+	case *dns.TXT:
+		record.Value = unescapeTXT(strings.Join(rr.Txt, ""))
+	case *dns.MX:
+		record.Priority = int(rr.Preference)
+		record.Value = strings.ToLower(rr.Mx)
+	case *dns.CAA:
+		record.Value = fmt.Sprintf(`%d %s "%s"`, rr.Flag, rr.Tag, rr.Value)
+	default:
+		return entity.DNSRecord{}, fmt.Errorf("%v records are not supported", record.Type)
+	}
+	return record, nil
+}
+
+// quoteTXT returns the text of a TXT record as quoted character strings of at most 255 bytes each.
+func quoteTXT(text string) string {
+	var parts []string
+	for {
+		chunk := text
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		text = text[len(chunk):]
+		chunk = strings.Replace(chunk, `\`, `\\`, -1)
+		chunk = strings.Replace(chunk, `"`, `\"`, -1)
+		parts = append(parts, `"`+chunk+`"`)
+		if text == "" {
+			return strings.Join(parts, " ")
+		}
+	}
+}
+
+// unescapeTXT returns the text of TXT character strings, which are kept in presentation format
+// with \X and \DDD escape sequences.
+func unescapeTXT(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+			if n, err := strconv.Atoi(s[i+1 : i+4]); err == nil && n < 256 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		i++
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,133 @@
+package dnsrecord
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access DNS records from the data source.
+type Repository interface {
+	// GetDomain returns the domain with the specified ID.
+	GetDomain(ctx context.Context, id int) (entity.Domain, error)
+	// Get returns the record of a domain with the specified ID.
+	Get(ctx context.Context, domainID, id int) (entity.DNSRecord, error)
+	// Count returns the number of records of a domain.
+	Count(ctx context.Context, domainID int) (int, error)
+	// Query returns the records of a domain with the given offset and limit, ordered by name, type and ID.
+	Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DNSRecord, error)
+	// QueryAll returns all records of a domain, ordered by name, type and ID.
+	QueryAll(ctx context.Context, domainID int) ([]entity.DNSRecord, error)
+	// QueryByName returns the records of a domain with the specified name.
+	QueryByName(ctx context.Context, domainID int, name string) ([]entity.DNSRecord, error)
+	// Create saves a new record in the storage.
+	Create(ctx context.Context, record entity.DNSRecord) (entity.DNSRecord, error)
+	// Update updates the record with given ID in the storage and increments its version.
+	// It returns dbcontext.ErrConflict if the stored record is not at the version of the given record.
+	Update(ctx context.Context, record entity.DNSRecord) error
+	// Delete removes the record with given ID at the given version from the storage.
+	// It returns dbcontext.ErrConflict if the stored record is not at that version.
+	Delete(ctx context.Context, id int, version int) error
+	// DeleteAll removes all records of a domain from the storage.
+	DeleteAll(ctx context.Context, domainID int) error
+}
+
+// repository persists DNS records in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new DNS record repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetDomain reads the domain with the specified ID from the database.
+func (r repository) GetDomain(ctx context.Context, id int) (entity.Domain, error) {
+	var domain entity.Domain
+	err := r.db.With(ctx).Select().Model(id, &domain)
+	return domain, err
+}
+
+// Get reads the record of a domain with the specified ID from the database.
+func (r repository) Get(ctx context.Context, domainID, id int) (entity.DNSRecord, error) {
+	var record entity.DNSRecord
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"id": id, "domain_id": domainID}).One(&record)
+	return record, err
+}
+
+// Count returns the number of the record rows of a domain in the database.
+func (r repository) Count(ctx context.Context, domainID int) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("dns_record").Where(dbx.HashExp{"domain_id": domainID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the record rows of a domain with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DNSRecord, error) {
+	var records []entity.DNSRecord
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID}).
+		OrderBy("name", "type", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&records)
+	return records, err
+}
+
+// QueryAll retrieves all record rows of a domain from the database.
+func (r repository) QueryAll(ctx context.Context, domainID int) ([]entity.DNSRecord, error) {
+	var records []entity.DNSRecord
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID}).
+		OrderBy("name", "type", "id").
+		All(&records)
+	return records, err
+}
+
+// QueryByName retrieves the record rows of a domain with the specified name from the database.
+func (r repository) QueryByName(ctx context.Context, domainID int, name string) ([]entity.DNSRecord, error) {
+	var records []entity.DNSRecord
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID, "name": name}).
+		OrderBy("id").
+		All(&records)
+	return records, err
+}
+
+// Create saves a new record row in the database.
+// It returns the record with the ID of the newly inserted row.
+func (r repository) Create(ctx context.Context, record entity.DNSRecord) (entity.DNSRecord, error) {
+	err := r.db.With(ctx).Model(&record).Insert()
+	return record, err
+}
+
+// Update saves the changes to a record in the database if the record has not been changed since it was read.
+func (r repository) Update(ctx context.Context, record entity.DNSRecord) error {
+	return r.db.UpdateVersion(ctx, "dns_record", dbx.Params{
+		"name":       record.Name,
+		"type":       record.Type,
+		"ttl":        record.TTL,
+		"priority":   record.Priority,
+		"value":      record.Value,
+		"updated_at": record.UpdatedAt,
+	}, dbx.HashExp{"id": record.ID}, record.Version)
+}
+
+// Delete deletes the record row with the specified ID and version from the database.
+func (r repository) Delete(ctx context.Context, id int, version int) error {
+	return r.db.DeleteVersion(ctx, "dns_record", dbx.HashExp{"id": id}, version)
+}
+
+// DeleteAll deletes all record rows of a domain from the database.
+func (r repository) DeleteAll(ctx context.Context, domainID int) error {
+	_, err := r.db.With(ctx).Delete("dns_record", dbx.HashExp{"domain_id": domainID}).Execute()
+	return err
+}
@@ -0,0 +1,89 @@
+package dnsrecord
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "dns_record", "domain", "account")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "test@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	domain := entity.Domain{ID: 1, AccountId: 1, Domain: "example.com", Health: entity.HealthUnknown, CreatedAt: now, UpdatedAt: now}
+	assert.Nil(t, db.DB().Model(&domain).Insert())
+
+	// get domain
+	d, err := repo.GetDomain(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", d.Domain)
+
+	// initial count
+	count, err := repo.Count(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	// create
+	record, err := repo.Create(ctx, entity.DNSRecord{DomainID: 1, Name: "www", Type: entity.DNSTypeA, TTL: 3600, Value: "192.0.2.1", Version: 1, CreatedAt: now, UpdatedAt: now})
+	assert.Nil(t, err)
+	assert.NotZero(t, record.ID)
+	_, err = repo.Create(ctx, entity.DNSRecord{DomainID: 1, Name: apex, Type: entity.DNSTypeMX, TTL: 3600, Priority: 10, Value: "mail.example.com.", CreatedAt: now, UpdatedAt: now})
+	assert.Nil(t, err)
+	count, err = repo.Count(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// get
+	record2, err := repo.Get(ctx, 1, record.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1", record2.Value)
+	assert.Equal(t, 3600, record2.TTL)
+	_, err = repo.Get(ctx, 2, record.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	record.TTL = 300
+	record.Value = "192.0.2.2"
+	assert.Nil(t, repo.Update(ctx, record))
+	assert.Equal(t, dbcontext.ErrConflict, repo.Update(ctx, record))
+	record2, _ = repo.Get(ctx, 1, record.ID)
+	assert.Equal(t, 300, record2.TTL)
+	assert.Equal(t, 2, record2.Version)
+	assert.Equal(t, "192.0.2.2", record2.Value)
+
+	// query
+	records, err := repo.Query(ctx, 1, 0, 1)
+	assert.Nil(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, apex, records[0].Name)
+	}
+	records, err = repo.QueryAll(ctx, 1)
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	records, err = repo.QueryByName(ctx, 1, "www")
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+
+	// delete
+	assert.Equal(t, dbcontext.ErrConflict, repo.Delete(ctx, record.ID, 1))
+	assert.Nil(t, repo.Delete(ctx, record.ID, 2))
+	_, err = repo.Get(ctx, 1, record.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, repo.DeleteAll(ctx, 1))
+	count, _ = repo.Count(ctx, 1)
+	assert.Equal(t, 0, count)
+}
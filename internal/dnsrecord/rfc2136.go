@@ -0,0 +1,69 @@
+package dnsrecord
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the permitted clock skew in seconds of TSIG signed updates.
+const tsigFudge = 300
+
+// RFC2136Provider is a DNSProvider sending dynamic updates (RFC 2136) to an authoritative DNS server.
+type RFC2136Provider struct {
+	client *dns.Client
+	server string
+	// keyName is the name of the TSIG key signing the updates. Updates are not signed if it is empty.
+	keyName   string
+	algorithm string
+}
+
+// NewRFC2136Provider creates a new RFC2136Provider sending updates to the server ("host:port") over TCP.
+// If keyName is not empty, updates are signed with the base64-encoded TSIG secret using the algorithm,
+// e.g. "hmac-sha256.", which is the default if the algorithm is empty.
+func NewRFC2136Provider(server, keyName, secret, algorithm string, timeout time.Duration) *RFC2136Provider {
+	client := &dns.Client{Net: "tcp", Timeout: timeout}
+	if algorithm == "" {
+		algorithm = dns.HmacSHA256
+	}
+	if keyName != "" {
+		keyName = dns.Fqdn(keyName)
+		client.TsigSecret = map[string]string{keyName: secret}
+	}
+	return &RFC2136Provider{
+		client:    client,
+		server:    server,
+		keyName:   keyName,
+		algorithm: dns.Fqdn(algorithm),
+	}
+}
+
+// Update sends a dynamic update removing and adding resource records of a zone in one message,
+// which the server applies atomically.
+func (p *RFC2136Provider) Update(ctx context.Context, zone string, remove, add []dns.RR) error {
+	if len(remove) == 0 && len(add) == 0 {
+		return nil
+	}
+	msg := new(dns.Msg)
+	msg.SetUpdate(zone)
+	if len(remove) > 0 {
+		msg.Remove(remove)
+	}
+	if len(add) > 0 {
+		msg.Insert(add)
+	}
+	if p.keyName != "" {
+		msg.SetTsig(p.keyName, p.algorithm, tsigFudge, time.Now().Unix())
+	}
+
+	response, _, err := p.client.ExchangeContext(ctx, msg, p.server)
+	if err != nil {
+		return fmt.Errorf("failed to update the zone %v: %v", zone, err)
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("failed to update the zone %v: %v", zone, dns.RcodeToString[response.Rcode])
+	}
+	return nil
+}
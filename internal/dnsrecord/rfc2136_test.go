@@ -0,0 +1,94 @@
+package dnsrecord
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKeyName = "update-key."
+	testSecret  = "c2VjcmV0IGtleSBmb3IgdGVzdGluZyB1cGRhdGVz"
+)
+
+// updateServer is a local DNS server accepting TSIG-signed dynamic updates of the zone example.com.
+type updateServer struct {
+	mu      sync.Mutex
+	updates []*dns.Msg
+}
+
+func (s *updateServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	switch {
+	case r.Opcode != dns.OpcodeUpdate || r.IsTsig() == nil || w.TsigStatus() != nil:
+		m.Rcode = dns.RcodeNotAuth
+	case r.Question[0].Name != "example.com.":
+		m.Rcode = dns.RcodeNotZone
+	default:
+		s.mu.Lock()
+		s.updates = append(s.updates, r)
+		s.mu.Unlock()
+	}
+	if tsig := r.IsTsig(); tsig != nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+	}
+	_ = w.WriteMsg(m)
+}
+
+// startUpdateServer starts an updateServer and returns it with its address and a function stopping it.
+func startUpdateServer(t *testing.T) (*updateServer, string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &updateServer{}
+	server := &dns.Server{
+		Listener:   listener,
+		Handler:    handler,
+		TsigSecret: map[string]string{testKeyName: testSecret},
+		// the default function rejects all messages but queries and notifications
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	return handler, listener.Addr().String(), func() {
+		_ = server.Shutdown()
+	}
+}
+
+func TestRFC2136Provider_Update(t *testing.T) {
+	server, addr, stop := startUpdateServer(t)
+	defer stop()
+	ctx := context.Background()
+	oldRR, _ := dns.NewRR("www.example.com. 3600 IN A 192.0.2.1")
+	newRR, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.2")
+
+	provider := NewRFC2136Provider(addr, "update-key", testSecret, "", time.Second)
+	assert.Nil(t, provider.Update(ctx, "example.com.", []dns.RR{oldRR}, []dns.RR{newRR}))
+	assert.Nil(t, provider.Update(ctx, "example.com.", nil, nil))
+	if assert.Equal(t, 1, len(server.updates)) {
+		update := server.updates[0]
+		if assert.Equal(t, 2, len(update.Ns)) {
+			// a removed RR has class NONE and TTL 0 (RFC 2136, section 2.5.4)
+			assert.Equal(t, uint16(dns.ClassNONE), update.Ns[0].Header().Class)
+			assert.Equal(t, "192.0.2.1", update.Ns[0].(*dns.A).A.String())
+			assert.Equal(t, uint16(dns.ClassINET), update.Ns[1].Header().Class)
+			assert.Equal(t, "192.0.2.2", update.Ns[1].(*dns.A).A.String())
+		}
+	}
+
+	// refused updates
+	assert.NotNil(t, provider.Update(ctx, "example.org.", nil, []dns.RR{newRR}))
+	unsigned := NewRFC2136Provider(addr, "", "", "", time.Second)
+	assert.NotNil(t, unsigned.Update(ctx, "example.com.", nil, []dns.RR{newRR}))
+	wrongKey := NewRFC2136Provider(addr, "update-key", "d3Jvbmcgc2VjcmV0", "", time.Second)
+	assert.NotNil(t, wrongKey.Update(ctx, "example.com.", nil, []dns.RR{newRR}))
+	assert.Equal(t, 1, len(server.updates))
+}
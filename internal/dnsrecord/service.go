@@ -0,0 +1,417 @@
+package dnsrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/miekg/dns"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	apierrors "github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// DefaultTTL is the TTL in seconds of records created without one.
+	DefaultTTL = 3600
+	minTTL     = 60
+	maxTTL     = 604800
+)
+
+var (
+	// recordName matches a name relative to the zone: dot-separated labels, optionally starting with a wildcard.
+	recordName = regexp.MustCompile(`^(\*|[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?)(\.[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?)*$`)
+	// caaValue matches the data of a CAA record: flags, tag and quoted value.
+	caaValue = regexp.MustCompile(`^\d{1,3} (issue|issuewild|iodef) "[^"]*"$`)
+
+	recordTypes = []interface{}{
+		entity.DNSTypeA, entity.DNSTypeAAAA, entity.DNSTypeCNAME,
+		entity.DNSTypeTXT, entity.DNSTypeMX, entity.DNSTypeCAA,
+	}
+)
+
+// Service encapsulates usecase logic for the DNS records of managed zones.
+type Service interface {
+	Get(ctx context.Context, domainID, id int) (Record, error)
+	Query(ctx context.Context, domainID int, offset, limit int) ([]Record, error)
+	Count(ctx context.Context, domainID int) (int, error)
+	Create(ctx context.Context, domainID int, input RecordRequest) (Record, error)
+	Update(ctx context.Context, domainID, id int, version int, input RecordRequest) (Record, error)
+	Delete(ctx context.Context, domainID, id int, version int) (Record, error)
+	// ImportZone adds the records of a zone file to the zone of a domain.
+	// If replace is true, the existing records are deleted first.
+	ImportZone(ctx context.Context, domainID int, r io.Reader, replace bool) (ImportResult, error)
+	// ExportZone writes the records of the zone of a domain as a zone file.
+	ExportZone(ctx context.Context, domainID int, w io.Writer) error
+}
+
+// Record represents the data about a DNS record.
+type Record struct {
+	entity.DNSRecord
+}
+
+// RecordRequest represents a DNS record creation or update request.
+type RecordRequest struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority"`
+	Value    string `json:"value"`
+}
+
+// ImportResult represents the outcome of a zone file import.
+type ImportResult struct {
+	Created int `json:"created"`
+	Deleted int `json:"deleted"`
+	// Skipped is the number of SOA and apex NS records in the zone file, which are managed by the DNS provider.
+	Skipped int `json:"skipped"`
+}
+
+// normalize returns the request with lower case names and fully qualified host names.
+// Records without a TTL get DefaultTTL.
+func (m RecordRequest) normalize() RecordRequest {
+	m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+	m.Type = strings.ToUpper(strings.TrimSpace(m.Type))
+	if m.TTL == 0 {
+		m.TTL = DefaultTTL
+	}
+	switch m.Type {
+	case entity.DNSTypeA, entity.DNSTypeAAAA, entity.DNSTypeCAA:
+		m.Value = strings.TrimSpace(m.Value)
+	case entity.DNSTypeCNAME, entity.DNSTypeMX:
+		m.Value = strings.ToLower(strings.TrimSpace(m.Value))
+		if m.Value != "" {
+			m.Value = dns.Fqdn(m.Value)
+		}
+	}
+	return m
+}
+
+// Validate validates the RecordRequest fields according to the record type.
+func (m RecordRequest) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the RecordRequest fields.
+func (m *RecordRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 200),
+			validation.When(m.Name != apex, validation.Match(recordName)),
+			validation.When(m.Type == entity.DNSTypeCNAME, validation.NotIn(apex).Error("a CNAME record cannot be at the zone apex"))),
+		validation.Field(&m.Type, validation.Required, validation.In(recordTypes...)),
+		validation.Field(&m.TTL, validation.Min(minTTL), validation.Max(maxTTL)),
+		validation.Field(&m.Priority, validation.Min(0), validation.Max(65535),
+			validation.When(m.Type != entity.DNSTypeMX, validation.Max(0).Error("must be 0 unless the type is MX"))),
+		validation.Field(&m.Value, validation.Required, validation.Length(0, 4096),
+			validation.When(m.Type == entity.DNSTypeA, is.IPv4),
+			validation.When(m.Type == entity.DNSTypeAAAA, is.IPv6),
+			validation.When(m.Type == entity.DNSTypeCNAME || m.Type == entity.DNSTypeMX, is.DNSName),
+			validation.When(m.Type == entity.DNSTypeTXT || m.Type == entity.DNSTypeCAA, validation.By(printable)),
+			validation.When(m.Type == entity.DNSTypeCAA, validation.Match(caaValue).Error(`must be in the format <flags> <tag> "<value>"`))),
+	}
+}
+
+// printable checks that a string contains no control characters.
+func printable(value interface{}) error {
+	for _, r := range value.(string) {
+		if unicode.IsControl(r) {
+			return errors.New("must not contain control characters")
+		}
+	}
+	return nil
+}
+
+type service struct {
+	repo          Repository
+	provider      DNSProvider
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new DNS record service pushing the changes of zones to the provider.
+func NewService(repo Repository, provider DNSProvider, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, provider, transactional, logger}
+}
+
+// Get returns the record of a domain with the specified ID.
+func (s service) Get(ctx context.Context, domainID, id int) (Record, error) {
+	record, err := s.repo.Get(ctx, domainID, id)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{record}, nil
+}
+
+// Count returns the number of records of a domain.
+func (s service) Count(ctx context.Context, domainID int) (int, error) {
+	return s.repo.Count(ctx, domainID)
+}
+
+// Query returns the records of a domain with the specified offset and limit.
+func (s service) Query(ctx context.Context, domainID int, offset, limit int) ([]Record, error) {
+	items, err := s.repo.Query(ctx, domainID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Record{}
+	for _, item := range items {
+		result = append(result, Record{item})
+	}
+	return result, nil
+}
+
+// Create adds a record to the zone of a domain.
+func (s service) Create(ctx context.Context, domainID int, req RecordRequest) (Record, error) {
+	zone, err := s.zone(ctx, domainID)
+	if err != nil {
+		return Record{}, err
+	}
+	now := time.Now()
+	record, err := s.newRecord(zone, domainID, req, now)
+	if err != nil {
+		return Record{}, err
+	}
+	if err := s.checkConflicts(ctx, record); err != nil {
+		return Record{}, err
+	}
+
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if record, err = s.repo.Create(ctx, record); err != nil {
+			return err
+		}
+		return s.push(ctx, zone, nil, []entity.DNSRecord{record})
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{record}, nil
+}
+
+// Update replaces the record of a domain with the specified ID.
+// If version is not 0, the record is only replaced if it is at that version.
+func (s service) Update(ctx context.Context, domainID, id int, version int, req RecordRequest) (Record, error) {
+	zone, err := s.zone(ctx, domainID)
+	if err != nil {
+		return Record{}, err
+	}
+	old, err := s.repo.Get(ctx, domainID, id)
+	if err != nil {
+		return Record{}, err
+	}
+	if err := dbcontext.CheckVersion(old.Version, version); err != nil {
+		return Record{}, err
+	}
+	record, err := s.newRecord(zone, domainID, req, time.Now())
+	if err != nil {
+		return Record{}, err
+	}
+	record.ID = old.ID
+	record.Version = old.Version
+	record.CreatedAt = old.CreatedAt
+	if err := s.checkConflicts(ctx, record); err != nil {
+		return Record{}, err
+	}
+
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, record); err != nil {
+			return err
+		}
+		return s.push(ctx, zone, []entity.DNSRecord{old}, []entity.DNSRecord{record})
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	record.Version++
+	return Record{record}, nil
+}
+
+// Delete removes the record of a domain with the specified ID.
+// If version is not 0, the record is only removed if it is at that version.
+func (s service) Delete(ctx context.Context, domainID, id int, version int) (Record, error) {
+	zone, err := s.zone(ctx, domainID)
+	if err != nil {
+		return Record{}, err
+	}
+	record, err := s.repo.Get(ctx, domainID, id)
+	if err != nil {
+		return Record{}, err
+	}
+	if err := dbcontext.CheckVersion(record.Version, version); err != nil {
+		return Record{}, err
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id, record.Version); err != nil {
+			return err
+		}
+		return s.push(ctx, zone, []entity.DNSRecord{record}, nil)
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{record}, nil
+}
+
+// ImportZone parses a zone file and adds its records to the zone of a domain in one transaction.
+// Nothing is imported if any record is invalid.
+func (s service) ImportZone(ctx context.Context, domainID int, r io.Reader, replace bool) (ImportResult, error) {
+	zone, err := s.zone(ctx, domainID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	parsed, skipped, err := parseZone(zone, r, DefaultTTL)
+	if err != nil {
+		return ImportResult{}, apierrors.BadRequest("The zone file is invalid: " + err.Error())
+	}
+
+	var existing []entity.DNSRecord
+	if !replace {
+		if existing, err = s.repo.QueryAll(ctx, domainID); err != nil {
+			return ImportResult{}, err
+		}
+	}
+	now := time.Now()
+	records := make([]entity.DNSRecord, 0, len(parsed))
+	errs := validation.Errors{}
+	for i, item := range parsed {
+		record, err := s.newRecord(zone, domainID, RecordRequest{item.Name, item.Type, item.TTL, item.Priority, item.Value}, now)
+		if err == nil {
+			err = conflict(append(existing, records...), record)
+		}
+		if err != nil {
+			errs[fmt.Sprintf("record %d (%s %s)", i+1, item.Name, item.Type)] = err
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(errs) > 0 {
+		return ImportResult{}, errs
+	}
+
+	result := ImportResult{Skipped: skipped}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		var removed []entity.DNSRecord
+		if replace {
+			if removed, err = s.repo.QueryAll(ctx, domainID); err != nil {
+				return err
+			}
+			if err := s.repo.DeleteAll(ctx, domainID); err != nil {
+				return err
+			}
+		}
+		for i := range records {
+			if records[i], err = s.repo.Create(ctx, records[i]); err != nil {
+				return err
+			}
+		}
+		result.Created, result.Deleted = len(records), len(removed)
+		return s.push(ctx, zone, removed, records)
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+// ExportZone writes all records of the zone of a domain in zone file format.
+func (s service) ExportZone(ctx context.Context, domainID int, w io.Writer) error {
+	domain, err := s.repo.GetDomain(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	records, err := s.repo.QueryAll(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	return writeZone(w, zoneName(domain), records)
+}
+
+// zone returns the name of the zone of a domain whose records can be changed.
+// Only the zones of verified domains are managed.
+func (s service) zone(ctx context.Context, domainID int) (string, error) {
+	domain, err := s.repo.GetDomain(ctx, domainID)
+	if err != nil {
+		return "", err
+	}
+	if domain.VerifiedAt == nil {
+		return "", apierrors.Forbidden("DNS records can only be managed for verified domains.")
+	}
+	return zoneName(domain), nil
+}
+
+// newRecord validates a request and returns the record it describes.
+func (s service) newRecord(zone string, domainID int, req RecordRequest, now time.Time) (entity.DNSRecord, error) {
+	req = req.normalize()
+	if err := req.Validate(); err != nil {
+		return entity.DNSRecord{}, err
+	}
+	record := entity.DNSRecord{
+		DomainID:  domainID,
+		Name:      req.Name,
+		Type:      req.Type,
+		TTL:       req.TTL,
+		Priority:  req.Priority,
+		Value:     req.Value,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := toRR(zone, record); err != nil {
+		return entity.DNSRecord{}, validation.Errors{"value": errors.New("is not valid for the record type")}
+	}
+	return record, nil
+}
+
+// checkConflicts checks that a record can be saved next to the other records with the same name.
+func (s service) checkConflicts(ctx context.Context, record entity.DNSRecord) error {
+	records, err := s.repo.QueryByName(ctx, record.DomainID, record.Name)
+	if err != nil {
+		return err
+	}
+	return conflict(records, record)
+}
+
+// conflict returns a validation error if a record duplicates one of the others or if a CNAME record
+// would share its name with other records (RFC 1034, section 3.6.2). Records with the same ID are ignored.
+func conflict(others []entity.DNSRecord, record entity.DNSRecord) error {
+	for _, other := range others {
+		if other.Name != record.Name || (other.ID != 0 && other.ID == record.ID) {
+			continue
+		}
+		if other.Type == entity.DNSTypeCNAME || record.Type == entity.DNSTypeCNAME {
+			return validation.Errors{"name": errors.New("a CNAME record cannot share its name with other records")}
+		}
+		if other.Type == record.Type && other.Priority == record.Priority && other.Value == record.Value {
+			return validation.Errors{"value": errors.New("the record already exists")}
+		}
+	}
+	return nil
+}
+
+// push sends the changes of a zone to the DNS provider.
+func (s service) push(ctx context.Context, zone string, remove, add []entity.DNSRecord) error {
+	removeRRs, err := toRRs(zone, remove)
+	if err != nil {
+		return err
+	}
+	addRRs, err := toRRs(zone, add)
+	if err != nil {
+		return err
+	}
+	if err := s.provider.Update(ctx, zone, removeRRs, addRRs); err != nil {
+		s.logger.With(ctx, "zone", zone).Errorf("failed to update DNS zone: %v", err)
+		return apierrors.ErrorResponse{
+			Status:  http.StatusBadGateway,
+			Message: "The DNS server failed to apply the change.",
+		}
+	}
+	return nil
+}
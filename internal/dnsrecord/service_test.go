@@ -0,0 +1,319 @@
+package dnsrecord
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	apierrors "github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errProvider = errors.New("error provider")
+
+func TestRecordRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     RecordRequest
+		wantError bool
+	}{
+		{"A", RecordRequest{Name: "www", Type: "A", Value: "192.0.2.1"}, false},
+		{"A apex", RecordRequest{Name: "@", Type: "A", Value: "192.0.2.1"}, false},
+		{"A wildcard", RecordRequest{Name: "*.app", Type: "A", Value: "192.0.2.1"}, false},
+		{"A invalid", RecordRequest{Name: "www", Type: "A", Value: "2001:db8::1"}, true},
+		{"AAAA", RecordRequest{Name: "www", Type: "AAAA", Value: "2001:db8::1"}, false},
+		{"AAAA invalid", RecordRequest{Name: "www", Type: "AAAA", Value: "192.0.2.1"}, true},
+		{"CNAME", RecordRequest{Name: "www", Type: "CNAME", Value: "edge.example.net."}, false},
+		{"CNAME apex", RecordRequest{Name: "@", Type: "CNAME", Value: "edge.example.net."}, true},
+		{"CNAME invalid", RecordRequest{Name: "www", Type: "CNAME", Value: "edge example"}, true},
+		{"TXT", RecordRequest{Name: "_acme-challenge", Type: "TXT", Value: `v=spf1 include:"example.net" -all`}, false},
+		{"TXT control", RecordRequest{Name: "@", Type: "TXT", Value: "a\nb"}, true},
+		{"MX", RecordRequest{Name: "@", Type: "MX", Priority: 10, Value: "mail.example.com."}, false},
+		{"MX priority", RecordRequest{Name: "@", Type: "MX", Priority: 65536, Value: "mail.example.com."}, true},
+		{"priority without MX", RecordRequest{Name: "@", Type: "A", Priority: 10, Value: "192.0.2.1"}, true},
+		{"CAA", RecordRequest{Name: "@", Type: "CAA", Value: `0 issue "letsencrypt.org"`}, false},
+		{"CAA invalid", RecordRequest{Name: "@", Type: "CAA", Value: "letsencrypt.org"}, true},
+		{"CAA control character", RecordRequest{Name: "@", Type: "CAA", Value: "0 issue \"letsencrypt.org\nexample.com. IN A 1.2.3.4\""}, true},
+		{"type", RecordRequest{Name: "@", Type: "SRV", Value: "0 5 5060 sip.example.com."}, true},
+		{"name", RecordRequest{Name: "www..app", Type: "A", Value: "192.0.2.1"}, true},
+		{"name required", RecordRequest{Type: "A", Value: "192.0.2.1"}, true},
+		{"value required", RecordRequest{Name: "www", Type: "A"}, true},
+		{"ttl", RecordRequest{Name: "www", Type: "A", TTL: 30, Value: "192.0.2.1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.normalize().Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	provider := NewMemoryProvider()
+	s := NewService(newMockRepository(), provider, test.MockTransactional, logger)
+	ctx := context.Background()
+
+	// unverified or unknown domain
+	_, err := s.Create(ctx, 2, RecordRequest{Name: "www", Type: "A", Value: "192.0.2.1"})
+	assert.Equal(t, http.StatusForbidden, err.(apierrors.ErrorResponse).Status)
+	_, err = s.Create(ctx, 3, RecordRequest{Name: "www", Type: "A", Value: "192.0.2.1"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// create
+	record, err := s.Create(ctx, 1, RecordRequest{Name: "WWW", Type: "a", Value: "192.0.2.1"})
+	assert.Nil(t, err)
+	assert.NotZero(t, record.ID)
+	assert.Equal(t, "www", record.Name)
+	assert.Equal(t, "A", record.Type)
+	assert.Equal(t, DefaultTTL, record.TTL)
+	id := record.ID
+	_, err = s.Create(ctx, 1, RecordRequest{Name: "@", Type: "MX", Priority: 10, Value: "Mail.Example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"example.com.\t3600\tIN\tMX\t10 mail.example.com.",
+		"www.example.com.\t3600\tIN\tA\t192.0.2.1",
+	}, provider.Records("example.com."))
+	count, _ := s.Count(ctx, 1)
+	assert.Equal(t, 2, count)
+
+	// validation error and conflicts
+	_, err = s.Create(ctx, 1, RecordRequest{Name: "www", Type: "A", Value: "192.0.2"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, 1, RecordRequest{Name: "www", Type: "A", Value: "192.0.2.1"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, 1, RecordRequest{Name: "www", Type: "CNAME", Value: "edge.example.net"})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx, 1)
+	assert.Equal(t, 2, count)
+
+	// update
+	record, err = s.Update(ctx, 1, id, 0, RecordRequest{Name: "www", Type: "A", TTL: 300, Value: "192.0.2.2"})
+	assert.Nil(t, err)
+	assert.Equal(t, 300, record.TTL)
+	assert.Equal(t, 2, record.Version)
+	record, _ = s.Get(ctx, 1, id)
+	assert.Equal(t, "192.0.2.2", record.Value)
+	assert.Contains(t, provider.Records("example.com."), "www.example.com.\t300\tIN\tA\t192.0.2.2")
+	assert.NotContains(t, provider.Records("example.com."), "www.example.com.\t3600\tIN\tA\t192.0.2.1")
+	_, err = s.Update(ctx, 1, id, 1, RecordRequest{Name: "www", Type: "CNAME", Value: "edge.example.net"})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	record, err = s.Update(ctx, 1, id, 2, RecordRequest{Name: "www", Type: "CNAME", Value: "edge.example.net"})
+	assert.Nil(t, err)
+	assert.Equal(t, "edge.example.net.", record.Value)
+	assert.Equal(t, 3, record.Version)
+	_, err = s.Update(ctx, 1, 0, 0, RecordRequest{Name: "www", Type: "A", Value: "192.0.2.2"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	records, err := s.Query(ctx, 1, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+
+	// delete
+	_, err = s.Delete(ctx, 1, 0, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(ctx, 1, id, 2)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	record, err = s.Delete(ctx, 1, id, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, id, record.ID)
+	assert.Equal(t, []string{"example.com.\t3600\tIN\tMX\t10 mail.example.com."}, provider.Records("example.com."))
+}
+
+func Test_service_ProviderError(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, failingProvider{}, test.MockTransactional, logger)
+
+	_, err := s.Create(context.Background(), 1, RecordRequest{Name: "www", Type: "A", Value: "192.0.2.1"})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadGateway, err.(apierrors.ErrorResponse).Status)
+	}
+}
+
+func Test_service_Zone(t *testing.T) {
+	logger, _ := log.NewForTest()
+	provider := NewMemoryProvider()
+	s := NewService(newMockRepository(), provider, test.MockTransactional, logger)
+	ctx := context.Background()
+
+	_, _ = s.Create(ctx, 1, RecordRequest{Name: "old", Type: "A", Value: "192.0.2.9"})
+
+	zone := `$ORIGIN example.com.
+$TTL 600
+@       IN SOA ns1.example.net. hostmaster.example.com. 1 7200 3600 1209600 3600
+@       IN NS  ns1.example.net.
+@       IN A   192.0.2.1
+www     300 IN CNAME @
+@       IN MX  10 mail
+@       IN TXT "v=spf1 -all"
+@       IN CAA 0 issue "letsencrypt.org"
+sub     IN NS  ns.other.example.
+`
+	// invalid records
+	_, err := s.ImportZone(ctx, 1, strings.NewReader(zone), false)
+	assert.NotNil(t, err)
+	_, err = s.ImportZone(ctx, 1, strings.NewReader("@ IN A 1.2.3"), false)
+	assert.NotNil(t, err)
+	_, err = s.ImportZone(ctx, 1, strings.NewReader("www IN A 192.0.2.1\nwww IN CNAME edge.example.net."), false)
+	assert.NotNil(t, err)
+	count, _ := s.Count(ctx, 1)
+	assert.Equal(t, 1, count)
+
+	// import
+	zone = strings.Replace(zone, "sub     IN NS  ns.other.example.\n", "", 1)
+	result, err := s.ImportZone(ctx, 1, strings.NewReader(zone), false)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportResult{Created: 5, Skipped: 2}, result)
+	count, _ = s.Count(ctx, 1)
+	assert.Equal(t, 6, count)
+	assert.Equal(t, 6, len(provider.Records("example.com.")))
+
+	// import again as duplicates
+	_, err = s.ImportZone(ctx, 1, strings.NewReader(zone), false)
+	assert.NotNil(t, err)
+
+	// replace
+	result, err = s.ImportZone(ctx, 1, strings.NewReader(zone), true)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportResult{Created: 5, Deleted: 6, Skipped: 2}, result)
+	count, _ = s.Count(ctx, 1)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, 5, len(provider.Records("example.com.")))
+
+	// export
+	var buf bytes.Buffer
+	assert.Nil(t, s.ExportZone(ctx, 1, &buf))
+	exported := buf.String()
+	assert.True(t, strings.HasPrefix(exported, "$ORIGIN example.com.\n"))
+	assert.Contains(t, exported, "www.example.com.\t300\tIN\tCNAME\texample.com.\n")
+	assert.Contains(t, exported, "example.com.\t600\tIN\tTXT\t\"v=spf1 -all\"\n")
+
+	// the exported zone can be imported again
+	result, err = s.ImportZone(ctx, 1, strings.NewReader(exported), true)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportResult{Created: 5, Deleted: 5}, result)
+}
+
+type failingProvider struct{}
+
+func (failingProvider) Update(ctx context.Context, zone string, remove, add []dns.RR) error {
+	return errProvider
+}
+
+type mockRepository struct {
+	domains []entity.Domain
+	records []entity.DNSRecord
+	lastID  int
+}
+
+func newMockRepository() *mockRepository {
+	now := time.Now()
+	return &mockRepository{domains: []entity.Domain{
+		{ID: 1, Domain: "Example.com", VerifiedAt: &now},
+		{ID: 2, Domain: "unverified.example.com"},
+	}}
+}
+
+func (m mockRepository) GetDomain(ctx context.Context, id int) (entity.Domain, error) {
+	for _, domain := range m.domains {
+		if domain.ID == id {
+			return domain, nil
+		}
+	}
+	return entity.Domain{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Get(ctx context.Context, domainID, id int) (entity.DNSRecord, error) {
+	for _, record := range m.records {
+		if record.DomainID == domainID && record.ID == id {
+			return record, nil
+		}
+	}
+	return entity.DNSRecord{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, domainID int) (int, error) {
+	records, _ := m.QueryAll(ctx, domainID)
+	return len(records), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DNSRecord, error) {
+	return m.QueryAll(ctx, domainID)
+}
+
+func (m mockRepository) QueryAll(ctx context.Context, domainID int) ([]entity.DNSRecord, error) {
+	var records []entity.DNSRecord
+	for _, record := range m.records {
+		if record.DomainID == domainID {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m mockRepository) QueryByName(ctx context.Context, domainID int, name string) ([]entity.DNSRecord, error) {
+	var records []entity.DNSRecord
+	for _, record := range m.records {
+		if record.DomainID == domainID && record.Name == name {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, record entity.DNSRecord) (entity.DNSRecord, error) {
+	m.lastID++
+	record.ID = m.lastID
+	m.records = append(m.records, record)
+	return record, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, record entity.DNSRecord) error {
+	for i, item := range m.records {
+		if item.ID == record.ID {
+			if item.Version != record.Version {
+				return dbcontext.ErrConflict
+			}
+			record.Version++
+			m.records[i] = record
+			return nil
+		}
+	}
+	return dbcontext.ErrConflict
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id int, version int) error {
+	for i, item := range m.records {
+		if item.ID == id {
+			if item.Version != version {
+				return dbcontext.ErrConflict
+			}
+			m.records = append(m.records[:i], m.records[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeleteAll(ctx context.Context, domainID int) error {
+	var records []entity.DNSRecord
+	for _, item := range m.records {
+		if item.DomainID != domainID {
+			records = append(records, item)
+		}
+	}
+	m.records = records
+	return nil
+}
@@ -0,0 +1,58 @@
+package dnsrecord
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/miekg/dns"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+)
+
+// parseZone parses the records of a zone from a zone file (RFC 1035).
+// Relative names are relative to the zone, and records without a TTL get defaultTTL.
+// SOA records and NS records at the zone apex are skipped as they are managed by the DNS provider.
+// It fails on records of unsupported types or out of the zone.
+func parseZone(zone string, r io.Reader, defaultTTL int) (records []entity.DNSRecord, skipped int, err error) {
+	parser := dns.NewZoneParser(r, zone, "")
+	parser.SetDefaultTTL(uint32(defaultTTL))
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			skipped++
+			continue
+		case dns.TypeNS:
+			if dns.CanonicalName(rr.Header().Name) == zone {
+				skipped++
+				continue
+			}
+		}
+		record, err := fromRR(zone, rr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%v: %v", rr.String(), err)
+		}
+		records = append(records, record)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, 0, err
+	}
+	return records, skipped, nil
+}
+
+// writeZone writes the records of a zone in zone file format (RFC 1035).
+func writeZone(w io.Writer, zone string, records []entity.DNSRecord) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "$ORIGIN %s\n", zone); err != nil {
+		return err
+	}
+	for _, record := range records {
+		rr, err := toRR(zone, record)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(bw, rr.String()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,53 @@
+package dnsrecord
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseZone(t *testing.T) {
+	// records without a TTL get the TTL of the previous record (RFC 1035, section 5.1)
+	records, skipped, err := parseZone("example.com.", strings.NewReader(`
+@          IN SOA ns1.example.net. hostmaster.example.com. 1 7200 3600 1209600 3600
+@          IN NS  ns1.example.net.
+@      600 IN A   192.0.2.1
+WWW.example.com.  IN AAAA 2001:db8::1
+mail       IN MX  10 mx.example.net.
+txt        IN TXT "part one" " and two"
+`), 3600)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, skipped)
+	assert.Equal(t, []entity.DNSRecord{
+		{Name: "@", Type: "A", TTL: 600, Value: "192.0.2.1"},
+		{Name: "www", Type: "AAAA", TTL: 600, Value: "2001:db8::1"},
+		{Name: "mail", Type: "MX", TTL: 600, Priority: 10, Value: "mx.example.net."},
+		{Name: "txt", Type: "TXT", TTL: 600, Value: "part one and two"},
+	}, records)
+
+	_, _, err = parseZone("example.com.", strings.NewReader("www.example.org. IN A 192.0.2.1"), 3600)
+	assert.NotNil(t, err)
+	_, _, err = parseZone("example.com.", strings.NewReader("sip IN SRV 0 5 5060 sip.example.net."), 3600)
+	assert.NotNil(t, err)
+	_, _, err = parseZone("example.com.", strings.NewReader("www IN A"), 3600)
+	assert.NotNil(t, err)
+}
+
+func Test_writeZone(t *testing.T) {
+	long := strings.Repeat("a", 300) + `"\ é`
+	records := []entity.DNSRecord{
+		{Name: "@", Type: "CAA", TTL: 3600, Value: `0 issue "letsencrypt.org"`},
+		{Name: "long", Type: "TXT", TTL: 3600, Value: long},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, writeZone(&buf, "example.com.", records))
+	assert.Contains(t, buf.String(), "example.com.\t3600\tIN\tCAA\t0 issue \"letsencrypt.org\"\n")
+
+	// long TXT records are split into character strings of at most 255 bytes
+	parsed, _, err := parseZone("example.com.", &buf, 3600)
+	assert.Nil(t, err)
+	assert.Equal(t, records, parsed)
+}
@@ -1,61 +1,247 @@
 package domain
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/export"
+	"github.com/qiangxue/go-rest-api/pkg/fieldset"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
 func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
 	res := resource{service, logger}
 
-	r.Get("/domains", res.query)
+	r.Get("/domains/<id>", res.get)
+	r.Get("/domains", authUnlessAccount(authHandler), res.query)
+	r.Get("/accounts/<id>/domains", res.queryByAccount)
 
 	r.Use(authHandler)
 
 	// the following endpoints require a valid JWT
 	r.Post("/domains", res.create)
+	r.Post("/accounts/<id>/domains", res.createForAccount)
 	r.Put("/domains/<id>", res.update)
-	r.Delete("/domains", res.delete)
+	r.Patch("/domains/<id>", res.patch)
+	r.Delete("/domains/<id>", res.delete)
+	// deprecated: use DELETE /domains/<id> instead
+	r.Delete("/domains", res.deleteByName)
+	r.Post("/accounts/<id>/domains:import", res.importDomains)
+	r.Get("/domains:export", res.export)
+	r.Get("/accounts/<id>/domains:export", res.exportByAccount)
 }
 
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/domains/<id>", Summary: "Get a domain", Params: openapi.Params(openapi.FieldsetParams, []openapi.Parameter{openapi.IfNoneMatchParam}),
+		Response: Domain{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/domains", Summary: "List domains", Description: "Authentication is required unless the domains are those of an account.", Params: openapi.Params(listParams, []openapi.Parameter{{Name: "account_id", In: "query", Description: "The ID of the account owning the domains.", Type: "integer"}}),
+		Response: openapi.OneOf(openapi.Page(Domain{}), openapi.CursorPage(Domain{})), Errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+	{Method: "GET", Path: "/accounts/<id>/domains", Summary: "List the domains of an account", Params: listParams,
+		Response: openapi.OneOf(openapi.Page(Domain{}), openapi.CursorPage(Domain{})), Errors: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/domains", Summary: "Create a domain", Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+		Request: CreateDomainRequest{}, Status: http.StatusCreated, Response: Domain{}, Errors: []int{http.StatusForbidden}},
+	{Method: "POST", Path: "/accounts/<id>/domains", Summary: "Create a domain of an account", Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+		Request: CreateDomainRequest{}, Status: http.StatusCreated, Response: Domain{}, Errors: []int{http.StatusForbidden}},
+	{Method: "PUT", Path: "/domains/<id>", Summary: "Update a domain", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: UpdateDomainRequest{}, Response: Domain{}, Errors: []int{http.StatusPreconditionFailed}},
+	{Method: "PATCH", Path: "/domains/<id>", Summary: "Partially update a domain", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: PatchDomainRequest{}, Response: Domain{}, Errors: []int{http.StatusPreconditionFailed}},
+	{Method: "DELETE", Path: "/domains/<id>", Summary: "Delete a domain", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Response: Domain{}, Errors: []int{http.StatusBadRequest, http.StatusPreconditionFailed}},
+	{Method: "DELETE", Path: "/domains", Summary: "Delete a domain by name", Description: "Use DELETE /domains/{id} instead.", Auth: true, Deprecated: true,
+		Params: []openapi.Parameter{
+			{Name: "account_id", In: "query", Description: "The ID of the account owning the domain.", Required: true, Type: "integer"},
+			{Name: "domain", In: "query", Description: "The name of the domain.", Required: true},
+		},
+		Response: Domain{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{Method: "POST", Path: "/accounts/<id>/domains:import", Summary: "Import the domains of an account",
+		Description: "In the default atomic mode no domain is imported if any row is invalid. With mode=best_effort the valid rows are imported.",
+		Auth:        true, Params: []openapi.Parameter{openapi.QueryParam("mode", "The import mode, atomic or best_effort.")},
+		Request: "", RequestType: mimeCSV + "," + mimeNDJSON, Status: http.StatusCreated, Response: ImportResult{},
+		Errors: []int{http.StatusForbidden, http.StatusUnsupportedMediaType}},
+	{Method: "GET", Path: "/domains:export", Summary: "Export domains", Auth: true,
+		Params:   openapi.Params(exportParams, []openapi.Parameter{{Name: "account_id", In: "query", Description: "The ID of the account owning the domains.", Type: "integer"}}),
+		Response: "", ResponseType: mimeNDJSON + "," + mimeCSV, Errors: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/accounts/<id>/domains:export", Summary: "Export the domains of an account", Auth: true, Params: exportParams,
+		Response: "", ResponseType: mimeNDJSON + "," + mimeCSV, Errors: []int{http.StatusBadRequest}},
+}
+
+// listParams are the query parameters of the endpoints listing domains.
+var listParams = openapi.Params(openapi.PageParams, openapi.CursorParams, openapi.QueryParams, openapi.FieldsetParams,
+	[]openapi.Parameter{openapi.QueryParam("label", "Label selectors like env=prod,team!=growth.")})
+
+// exportParams are the query parameters of the endpoints exporting domains.
+var exportParams = openapi.Params(openapi.QueryParams, []openapi.Parameter{
+	openapi.QueryParam("format", "The export format, csv or ndjson. Defaults to the format accepted by the client."),
+	openapi.QueryParam("label", "Label selectors like env=prod,team!=growth."),
+})
+
+// includeAccount is the relation that embeds the account of the domains.
+const includeAccount = "account"
+
+// fieldSchema declares the fields of domains that can be selected and the relations that can be embedded.
+var fieldSchema = fieldset.NewSchema(entity.Domain{}, includeAccount)
+
 type resource struct {
 	service Service
 	logger  log.Logger
 }
 
 func (r resource) get(c *routing.Context) error {
-	accountId, err := strconv.Atoi(c.Param("account_id"))
-	domain, err := r.service.Get(c.Request.Context(), c.Param("domain"), accountId)
+	id, err := intParam(c, "id")
 	if err != nil {
 		return err
 	}
-
-	return c.Write(domain)
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	domain, err := r.service.Get(c.Request.Context(), id)
+	if err != nil {
+		return err
+	}
+	if etag.NotModified(c.Response, c.Request, domain.Version) {
+		return nil
+	}
+	if selection.IsEmpty() {
+		return c.Write(domain)
+	}
+	items, err := r.render(c.Request.Context(), selection, []Domain{domain})
+	if err != nil {
+		return err
+	}
+	return c.Write(items[0])
 }
 
 func (r resource) query(c *routing.Context) error {
+	accountID, err := accountIDQuery(c)
+	if err != nil {
+		return err
+	}
+	return r.list(c, accountID)
+}
+
+func (r resource) queryByAccount(c *routing.Context) error {
+	accountID, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	return r.list(c, accountID)
+}
+
+// list writes a page of the domains of the given account, or of all accounts if accountID is 0.
+// The domains can be selected by their labels with one or more "label" query parameters, e.g. ?label=env=prod,team!=growth,
+// and filtered and sorted with the filter and sort query parameters.
+// Pages are in cursor mode if the cursor query parameter is present, and are numbered otherwise.
+func (r resource) list(c *routing.Context, accountID int) error {
 	ctx := c.Request.Context()
-	accountId, err := strconv.Atoi(c.Query("account_id"))
-	count, err := r.service.Count(ctx, accountId)
+	filter, err := filterFromRequest(c, accountID)
+	if err != nil {
+		return err
+	}
+	selection, err := fieldset.NewFromRequest(c.Request, fieldSchema)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pagination.IsCursorRequest(c.Request) {
+		return r.listCursor(c, filter, selection)
+	}
+	count, err := r.service.Count(ctx, filter)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	domains, err := r.service.Query(ctx, pages.Offset(), pages.Limit(), accountId)
+	domains, err := r.service.Query(ctx, filter, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = domains
+	if !selection.IsEmpty() {
+		if pages.Items, err = r.render(ctx, selection, domains); err != nil {
+			return err
+		}
+	}
 	return c.Write(pages)
 }
 
+// listCursor writes a page of the domains selected by the filter in cursor mode.
+// The total count is only included if requested.
+func (r resource) listCursor(c *routing.Context, filter Filter, selection fieldset.Selection) error {
+	ctx := c.Request.Context()
+	pages, err := pagination.NewCursorFromRequest(c.Request, filter.Query)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	if pages.IncludeTotal {
+		count, err := r.service.Count(ctx, filter)
+		if err != nil {
+			return err
+		}
+		pages.TotalCount = &count
+	}
+	filter.Query = pages.Query()
+	domains, err := r.service.Query(ctx, filter, 0, pages.Limit())
+	if err != nil {
+		return err
+	}
+	if err := pages.SetItems(domains); err != nil {
+		return err
+	}
+	if !selection.IsEmpty() {
+		if pages.Items, err = r.render(ctx, selection, pages.Items.([]Domain)); err != nil {
+			return err
+		}
+	}
+	return c.Write(pages)
+}
+
+// render returns the domains with the fields and relations selected by the request.
+// The accounts of all domains are loaded with a single query if they are included.
+func (r resource) render(ctx context.Context, selection fieldset.Selection, domains []Domain) ([]fieldset.Resource, error) {
+	var accounts map[int]entity.Account
+	if selection.Includes(includeAccount) {
+		var ids []int
+		seen := map[int]bool{}
+		for _, domain := range domains {
+			if !seen[domain.AccountId] {
+				seen[domain.AccountId] = true
+				ids = append(ids, domain.AccountId)
+			}
+		}
+		var err error
+		if accounts, err = r.service.QueryAccounts(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+	items := make([]fieldset.Resource, len(domains))
+	for i, domain := range domains {
+		item, err := selection.Render(domain)
+		if err != nil {
+			return nil, err
+		}
+		if accounts != nil {
+			if account, ok := accounts[domain.AccountId]; ok {
+				item[includeAccount] = account
+			} else {
+				item[includeAccount] = nil
+			}
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
 func (r resource) create(c *routing.Context) error {
 	var input CreateDomainRequest
 	if err := c.Read(&input); err != nil {
@@ -67,32 +253,245 @@ func (r resource) create(c *routing.Context) error {
 		return err
 	}
 
+	etag.Set(c.Response, domain.Version)
+	return c.WriteWithStatus(domain, http.StatusCreated)
+}
+
+func (r resource) createForAccount(c *routing.Context) error {
+	accountID, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var input CreateDomainRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	input.AccountId = accountID
+	domain, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	etag.Set(c.Response, domain.Version)
 	return c.WriteWithStatus(domain, http.StatusCreated)
 }
 
 func (r resource) update(c *routing.Context) error {
+	id, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
 	var input UpdateDomainRequest
 	if err := c.Read(&input); err != nil {
 		r.logger.With(c.Request.Context()).Info(err)
 		return errors.BadRequest("")
 	}
 
-	domain, err := r.service.Update(c.Request.Context(), c.Param("domain"), input)
+	domain, err := r.service.Update(c.Request.Context(), id, version, input)
+	if err != nil {
+		return err
+	}
+
+	etag.Set(c.Response, domain.Version)
+	return c.Write(domain)
+}
+
+func (r resource) patch(c *routing.Context) error {
+	id, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	var input PatchDomainRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	domain, err := r.service.Patch(c.Request.Context(), id, version, input)
 	if err != nil {
 		return err
 	}
 
+	etag.Set(c.Response, domain.Version)
 	return c.Write(domain)
 }
 
 func (r resource) delete(c *routing.Context) error {
-	accountId, err := strconv.Atoi(c.Query("account_id"))
-	domainParam := c.Query("domain")
-	print(fmt.Sprintf("api.go Deleting domain %s %s", domainParam, c.Query("account_id")))
-	domain, err := r.service.Delete(c.Request.Context(), domainParam, accountId)
+	id, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	domain, err := r.service.Delete(c.Request.Context(), id, version)
 	if err != nil {
 		return err
 	}
 
 	return c.Write(domain)
 }
+
+// deleteByName handles the deprecated DELETE /domains?account_id=<account>&domain=<name> request.
+func (r resource) deleteByName(c *routing.Context) error {
+	c.Response.Header().Set("Deprecation", "true")
+	r.logger.With(c.Request.Context()).Info("deprecated endpoint DELETE /domains called")
+
+	accountID, err := strconv.Atoi(c.Query("account_id"))
+	if err != nil || c.Query("domain") == "" {
+		return errors.BadRequest("account_id and domain are required")
+	}
+	domain, err := r.service.DeleteByName(c.Request.Context(), accountID, c.Query("domain"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(domain)
+}
+
+// importDomains creates the domains of an account listed in a CSV or NDJSON request body.
+// In the default atomic mode the import fails with the invalid rows in the error details if any row is invalid.
+// With ?mode=best_effort the valid rows are created and a report of all rows is returned.
+func (r resource) importDomains(c *routing.Context) error {
+	accountID, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	rows, err := readImportRows(c.Request.Header.Get("Content-Type"), c.Request.Body)
+	if err != nil {
+		return err
+	}
+	result, err := r.service.Import(c.Request.Context(), accountID, rows, c.Query("mode"))
+	if err != nil {
+		return err
+	}
+
+	if result.Mode == ImportBestEffort {
+		return c.Write(result)
+	}
+	if result.Failed > 0 {
+		failed := []ImportRow{}
+		for _, row := range result.Rows {
+			if row.Error != "" {
+				failed = append(failed, row)
+			}
+		}
+		return errors.ErrorResponse{
+			Status:  http.StatusBadRequest,
+			Message: "No domains were imported because some rows are invalid.",
+			Details: failed,
+		}
+	}
+	return c.WriteWithStatus(result, http.StatusCreated)
+}
+
+func (r resource) export(c *routing.Context) error {
+	accountID, err := accountIDQuery(c)
+	if err != nil {
+		return err
+	}
+	return r.writeExport(c, accountID)
+}
+
+func (r resource) exportByAccount(c *routing.Context) error {
+	accountID, err := intParam(c, "id")
+	if err != nil {
+		return err
+	}
+	return r.writeExport(c, accountID)
+}
+
+// writeExport streams the domains of the given account, or of all accounts if accountID is 0, as NDJSON or CSV.
+// The domains are selected and sorted the same as by list, and are read from a database cursor one at a time.
+// The export stops when the client disconnects.
+func (r resource) writeExport(c *routing.Context, accountID int) error {
+	ctx := c.Request.Context()
+	format, err := export.FormatFromRequest(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	filter, err := filterFromRequest(c, accountID)
+	if err != nil {
+		return err
+	}
+
+	w, err := export.NewWriter(ctx, c.Response, format, csvHeader)
+	if err != nil {
+		return err
+	}
+	err = r.service.Export(ctx, filter, func(domain Domain) error {
+		return w.Write(domain)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	// the error is responded as long as nothing has been sent, e.g. if the database cannot be queried
+	if err != nil && ctx.Err() == nil && !w.Started() {
+		return err
+	}
+	// once the export has started, the status code can no longer be changed, so errors are only logged
+	if err != nil && ctx.Err() != nil {
+		r.logger.With(ctx).Infof("domain export canceled after %v domains: %v", w.Count(), err)
+	} else if err != nil {
+		r.logger.With(ctx).Errorf("failed to export domains after %v domains: %v", w.Count(), err)
+	}
+	return nil
+}
+
+// filterFromRequest returns the filter selecting the domains of the given account, or of all accounts if accountID is 0,
+// by the label, filter and sort query parameters of the request.
+func filterFromRequest(c *routing.Context, accountID int) (Filter, error) {
+	selector, err := ParseSelector(strings.Join(c.Request.URL.Query()["label"], ","))
+	if err != nil {
+		return Filter{}, errors.BadRequest(err.Error())
+	}
+	q, err := query.NewFromRequest(c.Request, querySchema)
+	if err != nil {
+		return Filter{}, errors.BadRequest(err.Error())
+	}
+	return Filter{AccountID: accountID, Labels: selector, Query: q}, nil
+}
+
+// accountIDQuery returns the value of the optional account_id query parameter, or 0 if it is absent.
+func accountIDQuery(c *routing.Context) (int, error) {
+	value := c.Query("account_id")
+	if value == "" {
+		return 0, nil
+	}
+	accountID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.BadRequest("account_id must be an integer")
+	}
+	return accountID, nil
+}
+
+// authUnlessAccount returns a middleware requiring authentication for the lists of domains
+// that are not restricted to an account with the account_id query parameter.
+func authUnlessAccount(authHandler routing.Handler) routing.Handler {
+	return func(c *routing.Context) error {
+		if c.Query("account_id") != "" {
+			return nil
+		}
+		return authHandler(c)
+	}
+}
+
+// intParam returns the integer value of the named path parameter.
+// A not-found error is returned if the value is not an integer, as no resource can be identified by it.
+func intParam(c *routing.Context, name string) (int, error) {
+	value, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, errors.NotFound("")
+	}
+	return value, nil
+}
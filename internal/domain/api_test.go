@@ -7,6 +7,7 @@ import (
 
 	"github.com/qiangxue/go-rest-api/internal/auth"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
 	"github.com/qiangxue/go-rest-api/internal/test"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 )
@@ -15,28 +16,104 @@ func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
 	repo := &mockRepository{items: []entity.Domain{
-		{"123", "12345", "example.com", time.Now(), time.Now()},
+		{ID: 123, AccountId: 12345, Domain: "example.com", Labels: entity.Labels{"env": "prod", "team": "growth"}, Version: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ID: 124, AccountId: 12346, Domain: "example.org", Labels: entity.Labels{"env": "prod"}, Version: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	}, accounts: []entity.Account{
+		{ID: 12345, Email: "a@example.com", PlanID: entity.DefaultPlan, Version: 1},
+		{ID: 12346, Email: "b@example.com", PlanID: entity.DefaultPlan, Version: 1},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	RegisterHandlers(router.Group(""), NewService(repo, mockQuotas{repo, 0}, &event.Recorder{}, test.MockTransactional, logger), auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
+	ifNoneMatch := http.Header{"If-None-Match": {`"1"`}}
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+	csvHeader := auth.MockAuthHeader()
+	csvHeader.Set("Content-Type", "text/csv")
+	ndjsonHeader := auth.MockAuthHeader()
+	ndjsonHeader.Set("Content-Type", "application/x-ndjson")
+	acceptCSV := auth.MockAuthHeader()
+	acceptCSV.Set("Accept", "text/csv")
 
 	tests := []test.APITestCase{
-		{"get all", "GET", "/domains", "", nil, http.StatusOK, `*"total_count":1*`},
-		{"get 123", "GET", "/domains/123", "", nil, http.StatusOK, `*{"id":"123","account_id":"12345","domain":"example.com"}*`},
+		{"get all", "GET", "/domains", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get all unauthorized", "GET", "/domains", "", nil, http.StatusUnauthorized, ""},
+		{"get cursor", "GET", "/domains?cursor=&per_page=1", "", header, http.StatusOK, `*{"per_page":1,"next_cursor":"*`},
+		{"get cursor total", "GET", "/accounts/12345/domains?cursor=&include_total=true", "", nil, http.StatusOK, `*{"per_page":100,"total_count":1,"items":[{"id":123*`},
+		{"get invalid cursor", "GET", "/domains?cursor=abc", "", header, http.StatusBadRequest, `*the cursor is invalid or expired*`},
+		{"get by account", "GET", "/domains?account_id=12345", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get by invalid account", "GET", "/domains?account_id=abc", "", nil, http.StatusBadRequest, ""},
+		{"get by label", "GET", "/domains?label=env=prod,team!=growth", "", header, http.StatusOK, `*"total_count":1,"items":[{"id":124*`},
+		{"get by labels", "GET", "/domains?label=env=prod&label=team", "", header, http.StatusOK, `*"total_count":1,"items":[{"id":123*`},
+		{"get by invalid label", "GET", "/domains?label=env=prod%20eu", "", header, http.StatusBadRequest, `*invalid label selector*`},
+		{"get filtered", "GET", "/domains?filter[domain][prefix]=example&sort=-created_at", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get filter error", "GET", "/domains?filter[name]=example.com", "", header, http.StatusBadRequest, `*unknown filter field \"name\", must be one of: account_id, created_at, domain, health, id, updated_at, verified_at*`},
+		{"get sort error", "GET", "/domains?sort=labels", "", header, http.StatusBadRequest, `*unknown sort field \"labels\"*`},
+		{"get nested by label", "GET", "/accounts/12346/domains?label=!env", "", nil, http.StatusOK, `*"total_count":0*`},
+		{"get nested", "GET", "/accounts/12346/domains", "", nil, http.StatusOK, `*"domain":"example.org"*`},
+		{"get 123", "GET", "/domains/123", "", nil, http.StatusOK, `*{"id":123,"account_id":12345,"domain":"example.com"*`},
+		{"get fields", "GET", "/domains/124?fields=id,domain", "", nil, http.StatusOK, `{"id":124,"domain":"example.org"}`},
+		{"get include", "GET", "/domains/124?fields=id&include=account", "", nil, http.StatusOK, `{"id":124,"account":{"id":12346,"email":"b@example.com","firebase_id":"","plan_id":"free","version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}}`},
+		{"get all include", "GET", "/domains?fields=domain&include=account", "", header, http.StatusOK, `*"items":[{"account":{"id":12345,"email":"a@example.com","firebase_id":"","plan_id":"free","version":1,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},"domain":"example.com"},{"account":{"id":12346,*`},
+		{"get cursor fields", "GET", "/domains?cursor=&per_page=1&fields=id", "", header, http.StatusOK, `*"items":[{"id":123}]*`},
+		{"get fields error", "GET", "/domains?fields=id,name", "", header, http.StatusBadRequest, `*unknown field \"name\"*`},
+		{"get include error", "GET", "/domains/124?include=records", "", nil, http.StatusBadRequest, `*unknown relation \"records\", must be one of: account*`},
+		{"get not modified", "GET", "/domains/123", "", ifNoneMatch, http.StatusNotModified, ""},
 		{"get unknown", "GET", "/domains/1234", "", nil, http.StatusNotFound, ""},
-		{"create ok", "POST", "/domains", `{"name":"test.com","account_id":"12345"}`, header, http.StatusCreated, "*test.com*"},
-		{"create ok count", "GET", "/domains", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get invalid", "GET", "/domains/abc", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/domains", `{"name":"test.com","account_id":12345}`, header, http.StatusCreated, "*test.com*"},
+		{"create ok count", "GET", "/domains?account_id=12345", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"create nested", "POST", "/accounts/12346/domains", `{"name":"test.org"}`, header, http.StatusCreated, `*"account_id":12346,"domain":"test.org"*`},
+		{"create labels", "POST", "/accounts/12346/domains", `{"name":"test.net","labels":{"env":"staging"}}`, header, http.StatusCreated, `*"labels":{"env":"staging"}*`},
+		{"create labels error", "POST", "/accounts/12346/domains", `{"name":"test.net","labels":{"env":"staging area"}}`, header, http.StatusBadRequest, `*labels*`},
 		{"create auth error", "POST", "/domains", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
 		{"create input error", "POST", "/domains", `"name":"test"}`, header, http.StatusBadRequest, ""},
-		{"update ok", "PUT", "/domains/123", `{"name":"domainxyz"}`, header, http.StatusOK, "*domainxyz*"},
-		{"update verify", "GET", "/domains/123", "", nil, http.StatusOK, `*domainxyz*`},
+		{"update conflict", "PUT", "/domains/123", `{"name":"domainxyz"}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update ok", "PUT", "/domains/123", `{"name":"domainxyz"}`, ifMatch(`"1"`), http.StatusOK, "*domainxyz*"},
+		{"update verify", "GET", "/domains/123", "", ifNoneMatch, http.StatusOK, `*"labels":{},"version":2,*`},
 		{"update auth error", "PUT", "/domains/123", `{"name":"domainxyz"}`, nil, http.StatusUnauthorized, ""},
 		{"update input error", "PUT", "/domains/123", `"name":"domainxyz"}`, header, http.StatusBadRequest, ""},
-		{"delete ok", "DELETE", "/domains/123", ``, header, http.StatusOK, "*domainxyz*"},
+		{"patch conflict", "PATCH", "/domains/123", `{"name":"domainabc"}`, ifMatch(`"1"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"patch if-match error", "PATCH", "/domains/123", `{"name":"domainabc"}`, ifMatch(`"1", "2"`), http.StatusBadRequest, ""},
+		{"patch ok", "PATCH", "/domains/123", `{"name":"domainabc"}`, ifMatch(`"2"`), http.StatusOK, "*domainabc*"},
+		{"patch labels", "PATCH", "/domains/123", `{"labels":{"team":null,"campaign":"spring"}}`, header, http.StatusOK, `*"labels":{"campaign":"spring"}*`},
+		{"patch empty", "PATCH", "/domains/123", `{}`, header, http.StatusOK, "*domainabc*"},
+		{"patch input error", "PATCH", "/domains/123", `{"name":""}`, header, http.StatusBadRequest, ""},
+		{"patch unknown", "PATCH", "/domains/1234", `{"name":"domainabc"}`, header, http.StatusNotFound, ""},
+		{"delete conflict", "DELETE", "/domains/123", ``, ifMatch(`"4"`), http.StatusPreconditionFailed, ""},
+		{"delete ok", "DELETE", "/domains/123", ``, header, http.StatusOK, "*domainabc*"},
 		{"delete verify", "DELETE", "/domains/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/domains/123", ``, nil, http.StatusUnauthorized, ""},
+		{"delete by name ok", "DELETE", "/domains?account_id=12346&domain=example.org", ``, header, http.StatusOK, "*example.org*"},
+		{"delete by name verify", "DELETE", "/domains?account_id=12346&domain=example.org", ``, header, http.StatusNotFound, ""},
+		{"delete by name input error", "DELETE", "/domains?domain=example.org", ``, header, http.StatusBadRequest, ""},
+		{"import csv", "POST", "/accounts/12347/domains:import", "name\nimport1.com\nImport2.com.\n", csvHeader, http.StatusCreated, `*"created":2*`},
+		{"import ndjson", "POST", "/accounts/12347/domains:import", "{\"name\":\"import3.com\"}\n\n{\"name\":\"import4.com\"}\n", ndjsonHeader, http.StatusCreated, `*{"row":2,"name":"import4.com","id":*`},
+		{"import atomic error", "POST", "/accounts/12347/domains:import", "import5.com\nimport1.com\n", csvHeader, http.StatusBadRequest, `*"details":[{"row":2,"name":"import1.com","error":"already registered"}]*`},
+		{"import best effort", "POST", "/accounts/12347/domains:import?mode=best_effort", "import5.com\nimport1.com\n", csvHeader, http.StatusOK, `*"created":1,"failed":1*`},
+		{"import invalid json", "POST", "/accounts/12347/domains:import", "{\"name\"\n", ndjsonHeader, http.StatusBadRequest, `*"error":"the line is not a valid JSON object"*`},
+		{"import media type error", "POST", "/accounts/12347/domains:import", `{"name":"import6.com"}`, header, http.StatusUnsupportedMediaType, ""},
+		{"import auth error", "POST", "/accounts/12347/domains:import", "import6.com\n", nil, http.StatusUnauthorized, ""},
+		{"export ndjson", "GET", "/accounts/12347/domains:export", "", header, http.StatusOK, `*"account_id":12347,"domain":"import5.com"*`},
+		{"export csv", "GET", "/accounts/12347/domains:export?format=csv", "", header, http.StatusOK, "*id,account_id,domain,verified_at,health,labels,created_at,updated_at\n*"},
+		{"export csv accept", "GET", "/accounts/12347/domains:export", "", acceptCSV, http.StatusOK, "*,12347,import1.com,,unknown,{},*"},
+		{"export auth error", "GET", "/accounts/12347/domains:export", "", nil, http.StatusUnauthorized, ""},
+		{"export format error", "GET", "/accounts/12347/domains:export?format=xml", "", header, http.StatusBadRequest, ""},
+		{"export all", "GET", "/domains:export?account_id=12347", "", header, http.StatusOK, `*"account_id":12347,"domain":"import5.com"*`},
+		{"export filter", "GET", "/domains:export?format=csv&filter[domain]=import5.com", "", header, http.StatusOK, "*,12347,import5.com,,unknown,{},*"},
+		{"export filter error", "GET", "/domains:export?filter[name]=a", "", header, http.StatusBadRequest, ""},
+		{"export account error", "GET", "/domains:export?account_id=a", "", header, http.StatusBadRequest, ""},
+		{"export all auth error", "GET", "/domains:export", "", nil, http.StatusUnauthorized, ""},
 	}
 	for _, tc := range tests {
 		test.Endpoint(t, router, tc)
 	}
+
+	// an export failing before anything is sent responds with the error
+	router = test.MockRouter(logger)
+	RegisterHandlers(router.Group(""), NewService(failingRepository{repo}, mockQuotas{repo, 0}, &event.Recorder{}, test.MockTransactional, logger), auth.MockAuthHandler, logger)
+	test.Endpoint(t, router, test.APITestCase{"export error", "GET", "/accounts/12347/domains:export", "", header, http.StatusInternalServerError, `*"code":"internal_error"*`})
+	test.Endpoint(t, router, test.APITestCase{"export csv error", "GET", "/accounts/12347/domains:export", "", acceptCSV, http.StatusInternalServerError, ""})
 }
@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+)
+
+const (
+	// maxLabels is the maximum number of labels of a domain.
+	maxLabels = 64
+	// maxLabelLength is the maximum length of a label key or value.
+	maxLabelLength = 63
+)
+
+var (
+	// labelKey matches a valid label key: alphanumeric characters, '-', '_', '.' and '/',
+	// starting and ending with an alphanumeric character.
+	labelKey = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+	// labelValue matches a valid label value, which is either empty or like a key without '/'.
+	labelValue = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// validateLabels checks the number of labels and the format of their keys and values.
+func validateLabels(value interface{}) error {
+	labels, _ := value.(entity.Labels)
+	if len(labels) > maxLabels {
+		return fmt.Errorf("must have at most %v labels", maxLabels)
+	}
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("key %q %v", key, err)
+		}
+		if err := validateLabelValue(value); err != nil {
+			return fmt.Errorf("value of %q %v", key, err)
+		}
+	}
+	return nil
+}
+
+func validateLabelKey(key string) error {
+	return validation.Validate(key, validation.Required, validation.Length(0, maxLabelLength), validation.Match(labelKey))
+}
+
+func validateLabelValue(value string) error {
+	return validation.Validate(value, validation.Length(0, maxLabelLength), validation.Match(labelValue))
+}
+
+// Label selector operators.
+const (
+	opEquals    = "="
+	opNotEquals = "!="
+	opExists    = "exists"
+	opNotExists = "!exists"
+)
+
+// Requirement represents a single condition of a label selector.
+type Requirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// Selector represents a label selector. A domain matches a selector if it matches all of its requirements.
+type Selector []Requirement
+
+// ParseSelector parses a comma-separated list of label requirements. The following forms are supported:
+//
+//	key=value    the domain has the label with the value (key==value is accepted too)
+//	key!=value   the domain does not have the label with the value
+//	key          the domain has the label
+//	!key         the domain does not have the label
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var r Requirement
+		if i := strings.Index(term, "!="); i >= 0 {
+			r = Requirement{term[:i], opNotEquals, term[i+2:]}
+		} else if i := strings.Index(term, "="); i >= 0 {
+			r = Requirement{term[:i], opEquals, strings.TrimPrefix(term[i+1:], "=")}
+		} else if strings.HasPrefix(term, "!") {
+			r = Requirement{Key: term[1:], Operator: opNotExists}
+		} else {
+			r = Requirement{Key: term, Operator: opExists}
+		}
+		r.Key, r.Value = strings.TrimSpace(r.Key), strings.TrimSpace(r.Value)
+		if err := validateLabelKey(r.Key); err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: key %v", term, err)
+		}
+		if err := validateLabelValue(r.Value); err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: value %v", term, err)
+		}
+		selector = append(selector, r)
+	}
+	if len(selector) > maxLabels {
+		return nil, errors.New("too many label requirements")
+	}
+	return selector, nil
+}
+
+// Matches reports whether the given labels satisfy the selector.
+func (s Selector) Matches(labels entity.Labels) bool {
+	for _, r := range s {
+		value, ok := labels[r.Key]
+		switch r.Operator {
+		case opEquals:
+			ok = ok && value == r.Value
+		case opNotEquals:
+			ok = !ok || value != r.Value
+		case opNotExists:
+			ok = !ok
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Expression returns the SQL condition on the labels JSONB column that is equivalent to the selector,
+// or nil if the selector is empty. Keys and values are always bound as parameters.
+func (s Selector) Expression() dbx.Expression {
+	if len(s) == 0 {
+		return nil
+	}
+	exps := make([]dbx.Expression, len(s))
+	for i, r := range s {
+		name := "label" + strconv.Itoa(i)
+		switch r.Operator {
+		case opEquals, opNotEquals:
+			label, _ := json.Marshal(map[string]string{r.Key: r.Value})
+			exp := "labels @> {:" + name + "}::jsonb"
+			if r.Operator == opNotEquals {
+				exp = "NOT " + exp
+			}
+			exps[i] = dbx.NewExp(exp, dbx.Params{name: string(label)})
+		case opExists:
+			exps[i] = dbx.NewExp("labels ? {:"+name+"}", dbx.Params{name: r.Key})
+		case opNotExists:
+			exps[i] = dbx.NewExp("NOT labels ? {:"+name+"}", dbx.Params{name: r.Key})
+		}
+	}
+	return dbx.And(exps...)
+}
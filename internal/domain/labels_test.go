@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"testing"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name      string
+		selector  string
+		want      Selector
+		wantError bool
+	}{
+		{"empty", "", nil, false},
+		{"equals", "env=prod", Selector{{"env", opEquals, "prod"}}, false},
+		{"double equals", "env==prod", Selector{{"env", opEquals, "prod"}}, false},
+		{"not equals", "team!=growth", Selector{{"team", opNotEquals, "growth"}}, false},
+		{"exists", "env", Selector{{"env", opExists, ""}}, false},
+		{"not exists", "!env", Selector{{"env", opNotExists, ""}}, false},
+		{"empty value", "env=", Selector{{"env", opEquals, ""}}, false},
+		{"multiple", " env=prod , team!=growth,,example.com/campaign", Selector{
+			{"env", opEquals, "prod"},
+			{"team", opNotEquals, "growth"},
+			{"example.com/campaign", opExists, ""},
+		}, false},
+		{"empty key", "=prod", nil, true},
+		{"invalid key", "env'; DROP TABLE domain; --=prod", nil, true},
+		{"invalid value", "env=prod eu", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			assert.Equal(t, tt.wantError, err != nil)
+			assert.Equal(t, tt.want, selector)
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := entity.Labels{"env": "prod", "team": "growth"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=staging", false},
+		{"env!=staging", true},
+		{"team!=growth", false},
+		{"campaign!=spring", true},
+		{"env", true},
+		{"campaign", false},
+		{"!campaign", true},
+		{"!env", false},
+		{"env=prod,team!=growth", false},
+		{"env=prod,team=growth", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, selector.Matches(labels))
+		})
+	}
+}
+
+func TestSelector_Expression(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	assert.Nil(t, Selector{}.Expression())
+
+	selector, _ := ParseSelector("env=prod,team!=growth,campaign,!legacy")
+	params := dbx.Params{}
+	sql := selector.Expression().Build(db, params)
+	assert.Equal(t, "(labels @> {:label0}::jsonb) AND (NOT labels @> {:label1}::jsonb) AND (labels ? {:label2}) AND (NOT labels ? {:label3})", sql)
+	assert.Equal(t, dbx.Params{
+		"label0": `{"env":"prod"}`,
+		"label1": `{"team":"growth"}`,
+		"label2": "campaign",
+		"label3": "legacy",
+	}, params)
+}
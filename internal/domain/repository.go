@@ -2,28 +2,81 @@ package domain
 
 import (
 	"context"
-	"fmt"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 )
 
 // Repository encapsulates the logic to access domains from the data source.
 type Repository interface {
 	// Get returns the domain with the specified domain ID.
-	Get(ctx context.Context, domain string, accountId int) (entity.Domain, error)
-	// Count returns the number of domains.
-	Count(ctx context.Context, accountId int) (int, error)
-	// Query returns the list of domains with the given offset and limit.
-	Query(ctx context.Context, offset, limit int, accountId int) ([]entity.Domain, error)
+	Get(ctx context.Context, id int) (entity.Domain, error)
+	// GetByName returns the domain of an account with the specified domain name.
+	GetByName(ctx context.Context, accountID int, name string) (entity.Domain, error)
+	// Count returns the number of domains selected by the filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Query returns the list of domains selected by the filter with the given offset and limit.
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.Domain, error)
 	// Create saves a new domain in the storage.
 	Create(ctx context.Context, domain entity.Domain) (entity.Domain, error)
-	// Update updates the domain with given ID in the storage.
+	// Update updates the domain with given ID in the storage and increments its version.
+	// It returns dbcontext.ErrConflict if the stored domain is not at the version of the given domain.
 	Update(ctx context.Context, domain entity.Domain) error
-	// Delete removes the domain with given ID from the storage.
-	Delete(ctx context.Context, name string, accountId int) error
+	// Delete removes the domain with given ID at the given version from the storage.
+	// It returns dbcontext.ErrConflict if the stored domain is not at that version.
+	Delete(ctx context.Context, id int, version int) error
+	// ExistingNames returns those of the given domain names that the account already has.
+	ExistingNames(ctx context.Context, accountID int, names []string) ([]string, error)
+	// Each calls f for every domain selected by the filter in the order of its query, reading one domain at a time.
+	// It stops at the first error returned by f.
+	Each(ctx context.Context, filter Filter, f func(entity.Domain) error) error
+	// QueryAccounts returns the accounts with the specified IDs.
+	QueryAccounts(ctx context.Context, ids []int) ([]entity.Account, error)
+}
+
+// Filter represents the conditions selecting domains.
+type Filter struct {
+	// AccountID selects the domains of an account. The domains of all accounts are selected if it is 0.
+	AccountID int
+	// Labels selects the domains whose labels match the selector.
+	Labels Selector
+	// Query selects the domains matching its filter conditions and sorts them.
+	Query query.Query
+}
+
+// querySchema declares the fields by which domains can be filtered and sorted.
+var querySchema = query.Schema{
+	"id":         {Type: query.Int, Operators: query.OrderedOperators, Sortable: true},
+	"account_id": {Type: query.Int, Operators: []string{query.Eq, query.Ne, query.In}, Sortable: true},
+	"domain":     {Type: query.String, Operators: query.StringOperators, Sortable: true},
+	"health":     {Type: query.String, Operators: []string{query.Eq, query.Ne, query.In}, Sortable: true},
+	// verified_at is nullable, so it is not sortable: keyset pagination cannot seek past NULL values.
+	"verified_at": {Type: query.Time, Operators: []string{query.Lt, query.Lte, query.Gt, query.Gte}},
+	"created_at":  {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
+	"updated_at":  {Type: query.Time, Operators: query.OrderedOperators, Sortable: true},
+}
+
+// Matches reports whether a domain is selected by the account and the labels of the filter.
+// The conditions of the query are only applied by the database.
+func (f Filter) Matches(domain entity.Domain) bool {
+	return (f.AccountID == 0 || domain.AccountId == f.AccountID) && f.Labels.Matches(domain.Labels)
+}
+
+// expression returns the SQL condition equivalent to the filter, or nil if it selects all domains.
+func (f Filter) expression() dbx.Expression {
+	var exps []dbx.Expression
+	for _, exp := range []dbx.Expression{accountFilter(f.AccountID), f.Labels.Expression(), f.Query.Expression()} {
+		if exp != nil {
+			exps = append(exps, exp)
+		}
+	}
+	if len(exps) == 0 {
+		return nil
+	}
+	return dbx.And(exps...)
 }
 
 // repository persists domains in database
@@ -38,51 +91,130 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 }
 
 // Get reads the domain with the specified ID from the database.
-func (r repository) Get(ctx context.Context, name string, accountId int) (entity.Domain, error) {
+func (r repository) Get(ctx context.Context, id int) (entity.Domain, error) {
+	var domain entity.Domain
+	err := r.db.With(ctx).Select().Model(id, &domain)
+	return domain, err
+}
+
+// GetByName reads the domain of an account with the specified name from the database.
+func (r repository) GetByName(ctx context.Context, accountID int, name string) (entity.Domain, error) {
 	var domain entity.Domain
 	err := r.db.With(ctx).Select().
-		Where(dbx.HashExp{"account_id": accountId}).
-		AndWhere(dbx.HashExp{"domain": name}).One(&domain)
+		Where(dbx.HashExp{"account_id": accountID, "domain": name}).
+		One(&domain)
 	return domain, err
 }
 
 // Create saves a new domain record in the database.
-// It returns the ID of the newly inserted domain record.
+// It returns the domain with the ID of the newly inserted record.
 func (r repository) Create(ctx context.Context, domain entity.Domain) (entity.Domain, error) {
-	return domain, r.db.With(ctx).Model(&domain).Insert()
+	err := r.db.With(ctx).Model(&domain).Insert()
+	return domain, err
 }
 
-// Update saves the changes to an domain in the database.
+// Update saves the changes to a domain in the database if the domain has not been changed since it was read.
+// The verification and health of the domain are not saved as they are only changed by the domain checks.
 func (r repository) Update(ctx context.Context, domain entity.Domain) error {
-	return r.db.With(ctx).Model(&domain).Update()
+	return r.db.UpdateVersion(ctx, "domain", dbx.Params{
+		"account_id": domain.AccountId,
+		"domain":     domain.Domain,
+		"labels":     domain.Labels,
+		"updated_at": domain.UpdatedAt,
+	}, dbx.HashExp{"id": domain.ID}, domain.Version)
 }
 
-// Delete deletes an domain with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, name string, accountId int) error {
-	print(fmt.Sprintf("Deleting domain %s %s", name, accountId))
-	domain, err := r.Get(ctx, name, accountId)
-	if err != nil {
+// Delete deletes a domain with the specified ID and version from the database.
+func (r repository) Delete(ctx context.Context, id int, version int) error {
+	if _, err := r.Get(ctx, id); err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&domain).Delete()
+	return r.db.DeleteVersion(ctx, "domain", dbx.HashExp{"id": id}, version)
 }
 
 // Count returns the number of the domain records in the database.
-func (r repository) Count(ctx context.Context, accountId int) (int, error) {
+func (r repository) Count(ctx context.Context, filter Filter) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("domain").Where(dbx.HashExp{"account_id": accountId}).Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("domain").Where(filter.expression()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the domain records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int, accountId int) ([]entity.Domain, error) {
+// Query retrieves the domain records with the specified offset and limit from the database,
+// in the order of the query of the filter and then of ID.
+func (r repository) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.Domain, error) {
 	var domains []entity.Domain
 	err := r.db.With(ctx).
 		Select().
-		Where(dbx.HashExp{"account_id": accountId}).
-		OrderBy("id").
+		Where(filter.expression()).
+		OrderBy(filter.Query.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&domains)
 	return domains, err
 }
+
+// ExistingNames returns those of the given domain names that the account already has in the database.
+func (r repository) ExistingNames(ctx context.Context, accountID int, names []string) ([]string, error) {
+	var existing []string
+	if len(names) == 0 {
+		return existing, nil
+	}
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = name
+	}
+	err := r.db.With(ctx).
+		Select("domain").
+		From("domain").
+		Where(dbx.HashExp{"account_id": accountID}).
+		AndWhere(dbx.In("domain", values...)).
+		Column(&existing)
+	return existing, err
+}
+
+// Each reads the domain records selected by the filter one at a time from a database cursor and calls f for each of them.
+// The query is canceled if the context is done.
+func (r repository) Each(ctx context.Context, filter Filter, f func(entity.Domain) error) error {
+	rows, err := r.db.With(ctx).
+		Select().
+		From("domain").
+		Where(filter.expression()).
+		OrderBy(filter.Query.OrderBy()...).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain entity.Domain
+		if err := rows.ScanStruct(&domain); err != nil {
+			return err
+		}
+		if err := f(domain); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// QueryAccounts retrieves the account records with the specified IDs from the database in one query.
+func (r repository) QueryAccounts(ctx context.Context, ids []int) ([]entity.Account, error) {
+	var accounts []entity.Account
+	if len(ids) == 0 {
+		return accounts, nil
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	err := r.db.With(ctx).Select().Where(dbx.In("id", values...)).OrderBy("id").All(&accounts)
+	return accounts, err
+}
+
+// accountFilter returns the condition selecting the domains of the given account, or nil if accountID is 0.
+func accountFilter(accountID int) dbx.Expression {
+	if accountID == 0 {
+		return nil
+	}
+	return dbx.HashExp{"account_id": accountID}
+}
@@ -3,66 +3,149 @@ package domain
 import (
 	"context"
 	"database/sql"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/query"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "domain")
+	test.ResetTables(t, db, "domain", "account")
 	repo := NewRepository(db, logger)
 
 	ctx := context.Background()
+	now := time.Now()
+	for id, email := range map[int]string{1: "account1@example.com", 2: "account2@example.com"} {
+		_, err := db.DB().Insert("account", map[string]interface{}{"id": id, "email": email, "created_at": now, "updated_at": now}).Execute()
+		assert.Nil(t, err)
+	}
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, Filter{})
 	assert.Nil(t, err)
 
 	// create
-	err = repo.Create(ctx, entity.Domain{
-		ID:        "test1",
+	domain, err := repo.Create(ctx, entity.Domain{
+		AccountId: 1,
 		Domain:    "domain1",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Health:    entity.HealthUnknown,
+		Labels:    entity.Labels{"env": "prod", "team": "growth"},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
-	assert.Equal(t, 1, count2-count)
+	assert.NotZero(t, domain.ID)
+	id := domain.ID
+	_, err = repo.Create(ctx, entity.Domain{
+		AccountId: 2,
+		Domain:    "domain2",
+		Health:    entity.HealthUnknown,
+		Labels:    entity.Labels{"env": "prod"},
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	assert.Nil(t, err)
+	count2, _ := repo.Count(ctx, Filter{})
+	assert.Equal(t, 2, count2-count)
+	count, _ = repo.Count(ctx, Filter{AccountID: 1})
+	assert.Equal(t, 1, count)
 
 	// get
-	domain, err := repo.Get(ctx, "test1")
+	domain, err = repo.Get(ctx, id)
 	assert.Nil(t, err)
 	assert.Equal(t, "domain1", domain.Domain)
-	_, err = repo.Get(ctx, "test0")
+	_, err = repo.Get(ctx, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+	domain, err = repo.GetByName(ctx, 1, "domain1")
+	assert.Nil(t, err)
+	assert.Equal(t, id, domain.ID)
+	_, err = repo.GetByName(ctx, 2, "domain1")
 	assert.Equal(t, sql.ErrNoRows, err)
 
 	// update
-	err = repo.Update(ctx, entity.Domain{
-		ID:        "test1",
-		Domain:    "domain1 updated",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
+	domain.Domain = "domain1 updated"
+	err = repo.Update(ctx, domain)
 	assert.Nil(t, err)
-	domain, _ = repo.Get(ctx, "test1")
+	err = repo.Update(ctx, domain)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	domain, _ = repo.Get(ctx, id)
 	assert.Equal(t, "domain1 updated", domain.Domain)
+	assert.Equal(t, 2, domain.Version)
 
 	// query
-	domains, err := repo.Query(ctx, 0, count2)
+	domains, err := repo.Query(ctx, Filter{}, 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(domains))
+	domains, err = repo.Query(ctx, Filter{AccountID: 2}, 0, count2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(domains)) {
+		assert.Equal(t, "domain2", domains[0].Domain)
+	}
+
+	// query by labels
+	selector, _ := ParseSelector("env=prod,team!=growth")
+	domains, err = repo.Query(ctx, Filter{Labels: selector}, 0, count2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(domains)) {
+		assert.Equal(t, "domain2", domains[0].Domain)
+		assert.Equal(t, entity.Labels{"env": "prod"}, domains[0].Labels)
+	}
+	selector, _ = ParseSelector("team,!campaign")
+	count, err = repo.Count(ctx, Filter{AccountID: 1, Labels: selector})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// query with filter conditions and sort orders
+	q, _ := query.Parse(url.Values{"filter[domain][contains]": {"DOMAIN"}, "sort": {"-domain"}}, querySchema)
+	domains, err = repo.Query(ctx, Filter{Query: q}, 0, count2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(domains)) {
+		assert.Equal(t, "domain2", domains[0].Domain)
+	}
+	q, _ = query.Parse(url.Values{"filter[domain][prefix]": {"domain1"}}, querySchema)
+	count, err = repo.Count(ctx, Filter{AccountID: 1, Query: q})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// query after a position
+	domains, err = repo.Query(ctx, Filter{Query: query.Query{Position: &query.Position{Values: []interface{}{id}}}}, 0, count2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(domains)) {
+		assert.Equal(t, "domain2", domains[0].Domain)
+	}
+
+	// each
+	var names []string
+	err = repo.Each(ctx, Filter{Query: q}, func(domain entity.Domain) error {
+		names = append(names, domain.Domain)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"domain1 updated"}, names)
+
+	// query accounts
+	accounts, err := repo.QueryAccounts(ctx, []int{2, 3})
+	assert.Nil(t, err)
+	if assert.Len(t, accounts, 1) {
+		assert.Equal(t, "account2@example.com", accounts[0].Email)
+	}
 
 	// delete
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, id, 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	err = repo.Delete(ctx, id, 2)
 	assert.Nil(t, err)
-	_, err = repo.Get(ctx, "test1")
+	_, err = repo.Get(ctx, id)
 	assert.Equal(t, sql.ErrNoRows, err)
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, id, 2)
 	assert.Equal(t, sql.ErrNoRows, err)
 }
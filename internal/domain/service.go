@@ -2,21 +2,49 @@ package domain
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/plan"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 )
 
+const (
+	// ImportAtomic is the import mode that creates either all domains or none of them.
+	ImportAtomic = "atomic"
+	// ImportBestEffort is the import mode that creates every valid domain and reports the failed ones.
+	ImportBestEffort = "best_effort"
+
+	// MaxImportRows is the maximum number of domains that can be imported in one request.
+	MaxImportRows = 10000
+)
+
 // Service encapsulates usecase logic for Domains.
 type Service interface {
-	Get(ctx context.Context, name string, accountId int) (Domain, error)
-	Query(ctx context.Context, offset, limit int, accountId int) ([]Domain, error)
-	Count(ctx context.Context, accountId int) (int, error)
+	Get(ctx context.Context, id int) (Domain, error)
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]Domain, error)
+	Count(ctx context.Context, filter Filter) (int, error)
 	Create(ctx context.Context, input CreateDomainRequest) (Domain, error)
-	Update(ctx context.Context, name string, input UpdateDomainRequest) (Domain, error)
-	Delete(ctx context.Context, name string, accountId int) (Domain, error)
+	Update(ctx context.Context, id int, version int, input UpdateDomainRequest) (Domain, error)
+	Patch(ctx context.Context, id int, version int, input PatchDomainRequest) (Domain, error)
+	Delete(ctx context.Context, id int, version int) (Domain, error)
+	// DeleteByName deletes the domain of an account with the specified name.
+	// Deprecated: domains should be deleted by ID.
+	DeleteByName(ctx context.Context, accountID int, name string) (Domain, error)
+	// Import validates, normalizes and creates the domains of an account in the given mode.
+	Import(ctx context.Context, accountID int, rows []ImportRow, mode string) (ImportResult, error)
+	// Export calls f for every domain selected by the filter without loading all of them into memory.
+	Export(ctx context.Context, filter Filter, f func(Domain) error) error
+	// QueryAccounts returns the accounts with the specified IDs, mapped by ID.
+	QueryAccounts(ctx context.Context, ids []int) (map[int]entity.Account, error)
 }
 
 // Domain represents the data about an Domain.
@@ -26,44 +54,113 @@ type Domain struct {
 
 // CreateDomainRequest represents an Domain creation request.
 type CreateDomainRequest struct {
-	Name      string `json:"name"`
-	AccountId int    `json:"account_id"`
+	Name      string        `json:"name"`
+	AccountId int           `json:"account_id"`
+	Labels    entity.Labels `json:"labels"`
 }
 
 // Validate validates the CreateDomainRequest fields.
 func (m CreateDomainRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the CreateDomainRequest fields.
+func (m *CreateDomainRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.AccountId, validation.Required, validation.Min(0)),
-	)
+		validation.Field(&m.Labels, validation.By(validateLabels)),
+	}
 }
 
 // UpdateDomainRequest represents an Domain update request.
+// The labels of the Domain are replaced by those of the request.
 type UpdateDomainRequest struct {
-	Name      string `json:"name"`
-	AccountId int    `json:"account_id"`
+	Name   string        `json:"name"`
+	Labels entity.Labels `json:"labels"`
 }
 
-// Validate validates the CreateDomainRequest fields.
+// Validate validates the UpdateDomainRequest fields.
 func (m UpdateDomainRequest) Validate() error {
-	return validation.ValidateStruct(&m,
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the UpdateDomainRequest fields.
+func (m *UpdateDomainRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
-	)
+		validation.Field(&m.Labels, validation.By(validateLabels)),
+	}
+}
+
+// PatchDomainRequest represents a partial Domain update request.
+// Only the fields present in the request are changed. Labels are merged into the existing ones,
+// and a label with a null value is removed.
+type PatchDomainRequest struct {
+	Name   *string            `json:"name"`
+	Labels map[string]*string `json:"labels"`
+}
+
+// Validate validates the PatchDomainRequest fields.
+func (m PatchDomainRequest) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the PatchDomainRequest fields.
+func (m *PatchDomainRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.Name, validation.NilOrNotEmpty, validation.Length(0, 128)),
+		validation.Field(&m.Labels, validation.By(func(interface{}) error {
+			labels := entity.Labels{}
+			for key, value := range m.Labels {
+				if value != nil {
+					labels[key] = *value
+				} else {
+					labels[key] = ""
+				}
+			}
+			return validateLabels(labels)
+		})),
+	}
+}
+
+// ImportRow represents a domain to be imported and the outcome of importing it.
+type ImportRow struct {
+	// Row is the 1-based number of the row in the imported data.
+	Row  int    `json:"row"`
+	Name string `json:"name"`
+	// ID is the ID of the created domain.
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ImportResult represents the outcome of a domain import.
+type ImportResult struct {
+	Mode    string      `json:"mode"`
+	Total   int         `json:"total"`
+	Created int         `json:"created"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	quotas        plan.Quotas
+	events        event.Publisher
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
 }
 
 // NewService creates a new Domain service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The domains of an account are limited by the plan of the account,
+// and every change of a Domain publishes an event in the transaction of the change.
+func NewService(repo Repository, quotas plan.Quotas, events event.Publisher, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, quotas, events, transactional, logger}
 }
 
 // Get returns the Domain with the specified the Domain ID.
-func (s service) Get(ctx context.Context, name string, accountId int) (Domain, error) {
-	domain, err := s.repo.Get(ctx, name, accountId)
+func (s service) Get(ctx context.Context, id int) (Domain, error) {
+	domain, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return Domain{}, err
 	}
@@ -71,62 +168,162 @@ func (s service) Get(ctx context.Context, name string, accountId int) (Domain, e
 }
 
 // Create creates a new Domain.
+// It fails with a quota exceeded error if the account already has as many domains as its plan allows.
 func (s service) Create(ctx context.Context, req CreateDomainRequest) (Domain, error) {
 	if err := req.Validate(); err != nil {
 		return Domain{}, err
 	}
-	now := time.Now()
-	domain, err := s.repo.Create(ctx, entity.Domain{
-		Domain:    req.Name,
-		AccountId: req.AccountId,
-		CreatedAt: now,
-		UpdatedAt: now,
+	item := newDomain(req.AccountId, req.Name)
+	for key, value := range req.Labels {
+		item.Labels[key] = value
+	}
+	var domain Domain
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.quotas.Check(ctx, req.AccountId, entity.ResourceDomains, 1); err != nil {
+			return err
+		}
+		var err error
+		if domain, err = s.create(ctx, item); err != nil {
+			return err
+		}
+		domain, err = s.Get(ctx, domain.ID)
+		return err
 	})
 	if err != nil {
 		return Domain{}, err
 	}
-	return s.Get(ctx, domain.Domain, domain.AccountId)
+	return domain, nil
 }
 
 // Update updates the Domain with the specified ID.
-func (s service) Update(ctx context.Context, name string, req UpdateDomainRequest) (Domain, error) {
+// If version is not 0, the Domain is only updated if it is at that version.
+func (s service) Update(ctx context.Context, id int, version int, req UpdateDomainRequest) (Domain, error) {
 	if err := req.Validate(); err != nil {
 		return Domain{}, err
 	}
 
-	Domain, err := s.Get(ctx, name, req.AccountId)
+	domain, err := s.Get(ctx, id)
 	if err != nil {
-		return Domain, err
+		return domain, err
+	}
+	if err := dbcontext.CheckVersion(domain.Version, version); err != nil {
+		return domain, err
 	}
-	Domain.Domain.Domain = req.Name
-	Domain.UpdatedAt = time.Now()
+	domain.Domain.Domain = req.Name
+	domain.Labels = entity.Labels{}
+	for key, value := range req.Labels {
+		domain.Labels[key] = value
+	}
+	domain.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(ctx, Domain.Domain); err != nil {
-		return Domain, err
+	if err := s.update(ctx, &domain); err != nil {
+		return Domain{}, err
 	}
-	return Domain, nil
+	return domain, nil
+}
+
+// Patch updates the fields of the Domain with the specified ID that are present in the request.
+// If version is not 0, the Domain is only updated if it is at that version.
+func (s service) Patch(ctx context.Context, id int, version int, req PatchDomainRequest) (Domain, error) {
+	if err := req.Validate(); err != nil {
+		return Domain{}, err
+	}
+
+	domain, err := s.Get(ctx, id)
+	if err != nil {
+		return domain, err
+	}
+	if err := dbcontext.CheckVersion(domain.Version, version); err != nil {
+		return domain, err
+	}
+	if req.Name != nil {
+		domain.Domain.Domain = *req.Name
+	}
+	if len(req.Labels) > 0 {
+		labels := entity.Labels{}
+		for key, value := range domain.Labels {
+			labels[key] = value
+		}
+		for key, value := range req.Labels {
+			if value == nil {
+				delete(labels, key)
+			} else {
+				labels[key] = *value
+			}
+		}
+		if err := validation.Validate(labels, validation.By(validateLabels)); err != nil {
+			return Domain{}, validation.Errors{"labels": err}
+		}
+		domain.Labels = labels
+	}
+	domain.UpdatedAt = time.Now()
+
+	if err := s.update(ctx, &domain); err != nil {
+		return Domain{}, err
+	}
+	return domain, nil
 }
 
 // Delete deletes the Domain with the specified ID.
-func (s service) Delete(ctx context.Context, name string, accountId int) (Domain, error) {
-	domain, err := s.Get(ctx, name, accountId)
+// If version is not 0, the Domain is only deleted if it is at that version.
+func (s service) Delete(ctx context.Context, id int, version int) (Domain, error) {
+	domain, err := s.Get(ctx, id)
 	if err != nil {
 		return Domain{}, err
 	}
-	if err = s.repo.Delete(ctx, name, accountId); err != nil {
+	if err := dbcontext.CheckVersion(domain.Version, version); err != nil {
+		return Domain{}, err
+	}
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id, domain.Version); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.DomainDeleted, domain.AccountId, strconv.Itoa(domain.ID), domain)
+	})
+	if err != nil {
 		return Domain{}, err
 	}
 	return domain, nil
 }
 
-// Count returns the number of Domains.
-func (s service) Count(ctx context.Context, accountId int) (int, error) {
-	return s.repo.Count(ctx, accountId)
+// create saves a new domain and publishes its creation in the transaction of the context.
+func (s service) create(ctx context.Context, item entity.Domain) (Domain, error) {
+	created, err := s.repo.Create(ctx, item)
+	if err != nil {
+		return Domain{}, err
+	}
+	domain := Domain{created}
+	return domain, s.events.Publish(ctx, event.DomainCreated, domain.AccountId, strconv.Itoa(domain.ID), domain)
+}
+
+// update saves the changes to a domain, increments its version and publishes the update in one transaction.
+func (s service) update(ctx context.Context, domain *Domain) error {
+	return s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, domain.Domain); err != nil {
+			return err
+		}
+		domain.Version++
+		return s.events.Publish(ctx, event.DomainUpdated, domain.AccountId, strconv.Itoa(domain.ID), *domain)
+	})
 }
 
-// Query returns the Domains with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int, accountId int) ([]Domain, error) {
-	items, err := s.repo.Query(ctx, offset, limit, accountId)
+// DeleteByName deletes the Domain of an account with the specified name.
+func (s service) DeleteByName(ctx context.Context, accountID int, name string) (Domain, error) {
+	domain, err := s.repo.GetByName(ctx, accountID, name)
+	if err != nil {
+		return Domain{}, err
+	}
+	return s.Delete(ctx, domain.ID, 0)
+}
+
+// Count returns the number of Domains selected by the filter.
+func (s service) Count(ctx context.Context, filter Filter) (int, error) {
+	return s.repo.Count(ctx, filter)
+}
+
+// Query returns the Domains selected by the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, filter Filter, offset, limit int) ([]Domain, error) {
+	items, err := s.repo.Query(ctx, filter, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -136,3 +333,159 @@ func (s service) Query(ctx context.Context, offset, limit int, accountId int) ([
 	}
 	return result, nil
 }
+
+// Import validates, normalizes and creates the domains of an account.
+// In ImportAtomic mode nothing is created if any row is invalid or if the domains would exceed the plan of the account,
+// and all domains are created in one transaction.
+// In ImportBestEffort mode every valid row is created until the plan limit is reached, and the failed rows are reported.
+func (s service) Import(ctx context.Context, accountID int, rows []ImportRow, mode string) (ImportResult, error) {
+	if mode == "" {
+		mode = ImportAtomic
+	}
+	errs := validation.Errors{
+		"mode": validation.Validate(mode, validation.In(ImportAtomic, ImportBestEffort)),
+		"rows": validation.Validate(rows, validation.Required, validation.Length(0, MaxImportRows)),
+	}
+	if err := errs.Filter(); err != nil {
+		return ImportResult{}, err
+	}
+
+	result := ImportResult{Mode: mode, Total: len(rows), Rows: rows}
+	if err := s.validateImport(ctx, accountID, rows); err != nil {
+		return ImportResult{}, err
+	}
+
+	if mode == ImportAtomic {
+		for _, row := range rows {
+			if row.Error != "" {
+				result.Failed++
+			}
+		}
+		if result.Failed > 0 {
+			return result, nil
+		}
+		err := s.transactional(ctx, func(ctx context.Context) error {
+			if err := s.quotas.Check(ctx, accountID, entity.ResourceDomains, len(rows)); err != nil {
+				return err
+			}
+			for i := range rows {
+				domain, err := s.create(ctx, newDomain(accountID, rows[i].Name))
+				if err != nil {
+					return err
+				}
+				rows[i].ID = domain.ID
+			}
+			return nil
+		})
+		if err != nil {
+			return ImportResult{}, err
+		}
+		result.Created = len(rows)
+		return result, nil
+	}
+
+	for i := range rows {
+		if rows[i].Error == "" {
+			err := s.transactional(ctx, func(ctx context.Context) error {
+				if err := s.quotas.Check(ctx, accountID, entity.ResourceDomains, 1); err != nil {
+					return err
+				}
+				domain, err := s.create(ctx, newDomain(accountID, rows[i].Name))
+				rows[i].ID = domain.ID
+				return err
+			})
+			if err == nil {
+				result.Created++
+				continue
+			}
+			if res, ok := err.(errors.ErrorResponse); ok && res.Code == errors.CodeQuotaExceeded {
+				rows[i].Error = "exceeds the plan limit"
+			} else {
+				s.logger.With(ctx, "domain", rows[i].Name).Errorf("failed to import domain: %v", err)
+				rows[i].Error = "failed to create the domain"
+			}
+		}
+		result.Failed++
+	}
+	return result, nil
+}
+
+// validateImport normalizes the names of the imported rows and records the validation error of each invalid row,
+// including names that are duplicated in the import or already registered by the account.
+func (s service) validateImport(ctx context.Context, accountID int, rows []ImportRow) error {
+	seen := map[string]int{}
+	var names []string
+	for i := range rows {
+		row := &rows[i]
+		if row.Error != "" {
+			continue
+		}
+		row.Name = normalizeName(row.Name)
+		if err := validation.Validate(row.Name, validation.Required, validation.Length(0, 128), is.Domain); err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		if first, ok := seen[row.Name]; ok {
+			row.Error = fmt.Sprintf("duplicates row %v", first)
+			continue
+		}
+		seen[row.Name] = row.Row
+		names = append(names, row.Name)
+	}
+
+	existing, err := s.repo.ExistingNames(ctx, accountID, names)
+	if err != nil {
+		return err
+	}
+	registered := map[string]bool{}
+	for _, name := range existing {
+		registered[name] = true
+	}
+	for i := range rows {
+		if rows[i].Error == "" && registered[rows[i].Name] {
+			rows[i].Error = "already registered"
+		}
+	}
+	return nil
+}
+
+// Export calls f for every domain selected by the filter in the order of its query.
+func (s service) Export(ctx context.Context, filter Filter, f func(Domain) error) error {
+	return s.repo.Each(ctx, filter, func(domain entity.Domain) error {
+		return f(Domain{domain})
+	})
+}
+
+// QueryAccounts returns the accounts with the specified IDs, mapped by ID.
+// IDs without an account are not in the map.
+func (s service) QueryAccounts(ctx context.Context, ids []int) (map[int]entity.Account, error) {
+	accounts, err := s.repo.QueryAccounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]entity.Account, len(accounts))
+	for _, account := range accounts {
+		result[account.ID] = account
+	}
+	return result, nil
+}
+
+// newDomain returns a new domain entity of the account with the given name.
+func newDomain(accountID int, name string) entity.Domain {
+	now := time.Now()
+	return entity.Domain{
+		Domain:    name,
+		AccountId: accountID,
+		Health:    entity.HealthUnknown,
+		Labels:    entity.Labels{},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// normalizeName converts a domain name into its canonical form: lower case, without surrounding spaces
+// and without the trailing dot of a fully qualified name.
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
@@ -7,6 +7,10 @@ import (
 	"testing"
 
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	apierrors "github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,9 +23,13 @@ func TestCreateDomainRequest_Validate(t *testing.T) {
 		model     CreateDomainRequest
 		wantError bool
 	}{
-		{"success", CreateDomainRequest{Name: "test.com", AccountId: "1234"}, false},
+		{"success", CreateDomainRequest{Name: "test.com", AccountId: 1234}, false},
 		{"required", CreateDomainRequest{Name: ""}, true},
-		{"too long", CreateDomainRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
+		{"account required", CreateDomainRequest{Name: "test.com"}, true},
+		{"labels", CreateDomainRequest{Name: "test.com", AccountId: 1234, Labels: entity.Labels{"env": "prod", "example.com/team": ""}}, false},
+		{"label key", CreateDomainRequest{Name: "test.com", AccountId: 1234, Labels: entity.Labels{"-env": "prod"}}, true},
+		{"label value", CreateDomainRequest{Name: "test.com", AccountId: 1234, Labels: entity.Labels{"env": "prod/eu"}}, true},
+		{"too long", CreateDomainRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890", AccountId: 1234}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -39,6 +47,7 @@ func TestUpdateDomainRequest_Validate(t *testing.T) {
 	}{
 		{"success", UpdateDomainRequest{Name: "test"}, false},
 		{"required", UpdateDomainRequest{Name: ""}, true},
+		{"label key", UpdateDomainRequest{Name: "test", Labels: entity.Labels{"": "prod"}}, true},
 		{"too long", UpdateDomainRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
@@ -49,87 +58,320 @@ func TestUpdateDomainRequest_Validate(t *testing.T) {
 	}
 }
 
+func TestPatchDomainRequest_Validate(t *testing.T) {
+	empty, name := "", "test"
+	tests := []struct {
+		name      string
+		model     PatchDomainRequest
+		wantError bool
+	}{
+		{"success", PatchDomainRequest{Name: &name}, false},
+		{"absent", PatchDomainRequest{}, false},
+		{"empty", PatchDomainRequest{Name: &empty}, true},
+		{"labels", PatchDomainRequest{Labels: map[string]*string{"env": &name, "team": nil}}, false},
+		{"label key", PatchDomainRequest{Labels: map[string]*string{"env!": nil}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	repo := &mockRepository{}
+	events := &event.Recorder{}
+	s := NewService(repo, mockQuotas{repo, 0}, events, test.MockTransactional, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, Filter{})
 	assert.Equal(t, 0, count)
 
 	// successful creation
-	domain, err := s.Create(ctx, CreateDomainRequest{Name: "example.com", AccountId: "1234"})
+	domain, err := s.Create(ctx, CreateDomainRequest{Name: "example.com", AccountId: 1234})
 	assert.Nil(t, err)
 	assert.NotEmpty(t, domain.ID)
 	id := domain.ID
 	assert.Equal(t, "example.com", domain.Domain.Domain)
+	assert.Equal(t, 1234, domain.AccountId)
+	assert.Equal(t, entity.HealthUnknown, domain.Health)
 	assert.NotEmpty(t, domain.CreatedAt)
 	assert.NotEmpty(t, domain.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateDomainRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
-	_, err = s.Create(ctx, CreateDomainRequest{Name: "error", AccountId: "1234"})
+	_, err = s.Create(ctx, CreateDomainRequest{Name: "error", AccountId: 1234})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 1, count)
 
-	_, _ = s.Create(ctx, CreateDomainRequest{Name: "example.com"})
+	_, _ = s.Create(ctx, CreateDomainRequest{Name: "example.org", AccountId: 1235})
+	count, _ = s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 1, count)
 
 	// update
-	domain, err = s.Update(ctx, id, UpdateDomainRequest{Name: "example.com updated"})
+	domain, err = s.Update(ctx, id, 0, UpdateDomainRequest{Name: "example.com updated"})
 	assert.Nil(t, err)
 	assert.Equal(t, "example.com updated", domain.Domain.Domain)
-	_, err = s.Update(ctx, "none", UpdateDomainRequest{Name: "example.com"})
+	_, err = s.Update(ctx, 0, 0, UpdateDomainRequest{Name: "example.com"})
 	assert.NotNil(t, err)
 
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateDomainRequest{Name: ""})
+	_, err = s.Update(ctx, id, 0, UpdateDomainRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
-	assert.Equal(t, 1, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateDomainRequest{Name: "error"})
+	_, err = s.Update(ctx, id, 0, UpdateDomainRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
-	assert.Equal(t, 1, count)
+
+	// patch
+	name := "example.com patched"
+	domain, err = s.Patch(ctx, id, 0, PatchDomainRequest{Name: &name})
+	assert.Nil(t, err)
+	assert.Equal(t, name, domain.Domain.Domain)
+	domain, err = s.Patch(ctx, id, 0, PatchDomainRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, name, domain.Domain.Domain)
+	_, err = s.Patch(ctx, 0, 0, PatchDomainRequest{Name: &name})
+	assert.NotNil(t, err)
+
+	// changes of a stale version
+	assert.Equal(t, 4, domain.Version)
+	_, err = s.Update(ctx, id, 3, UpdateDomainRequest{Name: "example.com"})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	_, err = s.Patch(ctx, id, 3, PatchDomainRequest{Name: &name})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	_, err = s.Delete(ctx, id, 3)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	domain, err = s.Patch(ctx, id, 4, PatchDomainRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, domain.Version)
 
 	// get
-	_, err = s.Get(ctx, "none")
+	_, err = s.Get(ctx, 0)
 	assert.NotNil(t, err)
 	domain, err = s.Get(ctx, id)
 	assert.Nil(t, err)
-	assert.Equal(t, "example.com updated", domain.Domain.Domain)
+	assert.Equal(t, name, domain.Domain.Domain)
 	assert.Equal(t, id, domain.ID)
 
+	// labels
+	domain, err = s.Update(ctx, id, 0, UpdateDomainRequest{Name: name, Labels: entity.Labels{"env": "prod", "team": "growth"}})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Labels{"env": "prod", "team": "growth"}, domain.Labels)
+	staging := "staging"
+	domain, err = s.Patch(ctx, id, 0, PatchDomainRequest{Labels: map[string]*string{"env": &staging, "team": nil}})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Labels{"env": "staging"}, domain.Labels)
+	domain, err = s.Patch(ctx, id, 0, PatchDomainRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Labels{"env": "staging"}, domain.Labels)
+	selector, _ := ParseSelector("env=staging")
+	count, _ = s.Count(ctx, Filter{Labels: selector})
+	assert.Equal(t, 1, count)
+
 	// query
-	domains, _ := s.Query(ctx, 0, 0)
+	domains, _ := s.Query(ctx, Filter{}, 0, 0)
+	assert.Equal(t, 2, len(domains))
+	domains, _ = s.Query(ctx, Filter{AccountID: 1235}, 0, 0)
 	assert.Equal(t, 1, len(domains))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, 0, 0)
 	assert.NotNil(t, err)
-	domain, err = s.Delete(ctx, id)
+	domain, err = s.Delete(ctx, id, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, id, domain.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 1, count)
+
+	// delete by name
+	_, err = s.DeleteByName(ctx, 1234, "example.org")
+	assert.Equal(t, sql.ErrNoRows, err)
+	domain, err = s.DeleteByName(ctx, 1235, "example.org")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.org", domain.Domain.Domain)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 0, count)
+
+	// events: the failed changes publish no event
+	types := events.Types()
+	if assert.Len(t, types, 11) {
+		assert.Equal(t, []string{event.DomainCreated, event.DomainCreated, event.DomainUpdated}, types[:3])
+		assert.Equal(t, []string{event.DomainUpdated, event.DomainDeleted, event.DomainDeleted}, types[8:])
+		assert.Equal(t, 1234, *events.Events[9].AccountID)
+		assert.Contains(t, string(events.Events[9].Data), `"domain":"example.com patched"`)
+	}
+}
+
+func Test_service_Quota(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	repo := &mockRepository{items: []entity.Domain{
+		{ID: 1, AccountId: 1234, Domain: "example.com"},
+	}}
+	s := NewService(repo, mockQuotas{repo, 3}, &event.Recorder{}, test.MockTransactional, logger)
+
+	// create within the limit
+	_, err := s.Create(ctx, CreateDomainRequest{Name: "example.org", AccountId: 1234})
+	assert.Nil(t, err)
+
+	// atomic import exceeding the limit
+	_, err = s.Import(ctx, 1234, []ImportRow{{Row: 1, Name: "a.com"}, {Row: 2, Name: "b.com"}}, ImportAtomic)
+	if assert.IsType(t, apierrors.ErrorResponse{}, err) {
+		assert.Equal(t, apierrors.CodeQuotaExceeded, err.(apierrors.ErrorResponse).Code)
+	}
+	count, _ := s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 2, count)
+
+	// best effort import up to the limit
+	result, err := s.Import(ctx, 1234, []ImportRow{{Row: 1, Name: "a.com"}, {Row: 2, Name: "b.com"}}, ImportBestEffort)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, "exceeds the plan limit", result.Rows[1].Error)
+
+	// create exceeding the limit
+	_, err = s.Create(ctx, CreateDomainRequest{Name: "example.net", AccountId: 1234})
+	if assert.IsType(t, apierrors.ErrorResponse{}, err) {
+		assert.Equal(t, apierrors.CodeQuotaExceeded, err.(apierrors.ErrorResponse).Code)
+	}
+	count, _ = s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 3, count)
+
+	// other accounts are not affected
+	_, err = s.Create(ctx, CreateDomainRequest{Name: "example.net", AccountId: 1235})
+	assert.Nil(t, err)
+}
+
+func Test_service_Import(t *testing.T) {
+	logger, _ := log.NewForTest()
+	ctx := context.Background()
+	repo := &mockRepository{items: []entity.Domain{
+		{ID: 1, AccountId: 1234, Domain: "example.com"},
+	}}
+	s := NewService(repo, mockQuotas{repo, 0}, &event.Recorder{}, test.MockTransactional, logger)
+
+	// invalid input
+	_, err := s.Import(ctx, 1234, nil, "")
+	assert.NotNil(t, err)
+	_, err = s.Import(ctx, 1234, []ImportRow{{Row: 1, Name: "test.com"}}, "unknown")
+	assert.NotNil(t, err)
+
+	rows := func() []ImportRow {
+		return []ImportRow{
+			{Row: 1, Name: " Test.COM. "},
+			{Row: 2, Name: "not a domain"},
+			{Row: 3, Name: "test.com"},
+			{Row: 4, Name: "example.com"},
+			{Row: 5, Name: "test.org"},
+		}
+	}
+
+	// atomic import with invalid rows
+	result, err := s.Import(ctx, 1234, rows(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, ImportAtomic, result.Mode)
+	assert.Equal(t, 5, result.Total)
+	assert.Equal(t, 0, result.Created)
+	assert.Equal(t, 3, result.Failed)
+	assert.Equal(t, "test.com", result.Rows[0].Name)
+	assert.Equal(t, "", result.Rows[0].Error)
+	assert.NotEmpty(t, result.Rows[1].Error)
+	assert.Equal(t, "duplicates row 1", result.Rows[2].Error)
+	assert.Equal(t, "already registered", result.Rows[3].Error)
+	count, _ := s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 1, count)
+
+	// best effort import
+	result, err = s.Import(ctx, 1234, rows(), ImportBestEffort)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 3, result.Failed)
+	assert.NotZero(t, result.Rows[0].ID)
+	assert.NotZero(t, result.Rows[4].ID)
+	count, _ = s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 3, count)
+
+	// atomic import
+	result, err = s.Import(ctx, 1234, []ImportRow{{Row: 1, Name: "a.com"}, {Row: 2, Name: "b.com"}}, ImportAtomic)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 0, result.Failed)
+	count, _ = s.Count(ctx, Filter{AccountID: 1234})
+	assert.Equal(t, 5, count)
+	domain, _ := s.Get(ctx, result.Rows[1].ID)
+	assert.Equal(t, "b.com", domain.Domain.Domain)
+	assert.Equal(t, entity.HealthUnknown, domain.Health)
+}
+
+func Test_service_Export(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Domain{
+		{ID: 1, AccountId: 1234, Domain: "example.com"},
+		{ID: 2, AccountId: 1235, Domain: "example.org"},
+		{ID: 3, AccountId: 1234, Domain: "example.net"},
+	}}
+	s := NewService(repo, mockQuotas{repo, 0}, &event.Recorder{}, test.MockTransactional, logger)
+
+	var names []string
+	err := s.Export(context.Background(), Filter{AccountID: 1234}, func(domain Domain) error {
+		names = append(names, domain.Domain.Domain)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com", "example.net"}, names)
+
+	err = s.Export(context.Background(), Filter{AccountID: 1234}, func(domain Domain) error {
+		return errCRUD
+	})
+	assert.Equal(t, errCRUD, err)
+}
+
+func Test_service_QueryAccounts(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{accounts: []entity.Account{{ID: 1234, Email: "a@example.com"}, {ID: 1235, Email: "b@example.com"}}}
+	s := NewService(repo, mockQuotas{repo, 0}, &event.Recorder{}, test.MockTransactional, logger)
+
+	accounts, err := s.QueryAccounts(context.Background(), []int{1234, 1236})
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]entity.Account{1234: {ID: 1234, Email: "a@example.com"}}, accounts)
+
+	_, err = s.QueryAccounts(context.Background(), []int{0})
+	assert.Equal(t, errCRUD, err)
+}
+
+// mockQuotas limits the number of domains of each account in the repository. A limit of 0 means unlimited.
+type mockQuotas struct {
+	repo  *mockRepository
+	limit int
+}
+
+func (m mockQuotas) Check(ctx context.Context, accountID int, resource string, n int) error {
+	count, _ := m.repo.Count(ctx, Filter{AccountID: accountID})
+	if m.limit > 0 && count+n > m.limit {
+		return apierrors.QuotaExceeded("")
+	}
+	return nil
 }
 
 type mockRepository struct {
-	items []entity.Domain
+	items    []entity.Domain
+	accounts []entity.Account
 }
 
-func (m mockRepository) Get(ctx context.Context, id string) (entity.Domain, error) {
+func (m mockRepository) Get(ctx context.Context, id int) (entity.Domain, error) {
 	for _, item := range m.items {
 		if item.ID == id {
 			return item, nil
@@ -138,20 +380,42 @@ func (m mockRepository) Get(ctx context.Context, id string) (entity.Domain, erro
 	return entity.Domain{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
-	return len(m.items), nil
+func (m mockRepository) GetByName(ctx context.Context, accountID int, name string) (entity.Domain, error) {
+	for _, item := range m.items {
+		if item.AccountId == accountID && item.Domain == name {
+			return item, nil
+		}
+	}
+	return entity.Domain{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, filter Filter) (int, error) {
+	items, _ := m.Query(ctx, filter, 0, 0)
+	return len(items), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Domain, error) {
-	return m.items, nil
+func (m mockRepository) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.Domain, error) {
+	var items []entity.Domain
+	for _, item := range m.items {
+		if filter.Matches(item) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
 }
 
-func (m *mockRepository) Create(ctx context.Context, domain entity.Domain) error {
+func (m *mockRepository) Create(ctx context.Context, domain entity.Domain) (entity.Domain, error) {
 	if domain.Domain == "error" {
-		return errCRUD
+		return domain, errCRUD
+	}
+	domain.ID = 1
+	for _, item := range m.items {
+		if item.ID >= domain.ID {
+			domain.ID = item.ID + 1
+		}
 	}
 	m.items = append(m.items, domain)
-	return nil
+	return domain, nil
 }
 
 func (m *mockRepository) Update(ctx context.Context, domain entity.Domain) error {
@@ -160,20 +424,71 @@ func (m *mockRepository) Update(ctx context.Context, domain entity.Domain) error
 	}
 	for i, item := range m.items {
 		if item.ID == domain.ID {
+			if item.Version != domain.Version {
+				return dbcontext.ErrConflict
+			}
+			domain.Version++
 			m.items[i] = domain
-			break
+			return nil
 		}
 	}
-	return nil
+	return dbcontext.ErrConflict
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id string) error {
+func (m *mockRepository) Delete(ctx context.Context, id int, version int) error {
 	for i, item := range m.items {
 		if item.ID == id {
+			if item.Version != version {
+				return dbcontext.ErrConflict
+			}
 			m.items[i] = m.items[len(m.items)-1]
 			m.items = m.items[:len(m.items)-1]
-			break
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m mockRepository) ExistingNames(ctx context.Context, accountID int, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		if _, err := m.GetByName(ctx, accountID, name); err == nil {
+			existing = append(existing, name)
+		}
+	}
+	return existing, nil
+}
+
+func (m mockRepository) Each(ctx context.Context, filter Filter, f func(entity.Domain) error) error {
+	items, _ := m.Query(ctx, filter, 0, 0)
+	for _, item := range items {
+		if err := f(item); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+func (m mockRepository) QueryAccounts(ctx context.Context, ids []int) ([]entity.Account, error) {
+	var accounts []entity.Account
+	for _, account := range m.accounts {
+		for _, id := range ids {
+			if id == 0 {
+				return nil, errCRUD
+			}
+			if account.ID == id {
+				accounts = append(accounts, account)
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// failingRepository is a repository that cannot be queried for exports.
+type failingRepository struct {
+	*mockRepository
+}
+
+func (m failingRepository) Each(ctx context.Context, filter Filter, f func(entity.Domain) error) error {
+	return errCRUD
+}
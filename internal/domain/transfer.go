@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/errors"
+)
+
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// csvHeader is the header row of exported CSV files.
+// The labels column contains the labels as a JSON object.
+var csvHeader = []string{"id", "account_id", "domain", "verified_at", "health", "labels", "created_at", "updated_at"}
+
+// readImportRows parses the domains to be imported from the request body according to its content type.
+// CSV bodies contain one domain name per row in the first column, optionally preceded by a header row
+// whose first column is "name" or "domain". NDJSON bodies contain one {"name": "..."} object per line.
+func readImportRows(contentType string, body io.Reader) ([]ImportRow, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.BadRequest("the Content-Type header is invalid")
+	}
+	switch mediaType {
+	case mimeCSV:
+		return readCSVRows(body)
+	case mimeNDJSON:
+		return readNDJSONRows(body)
+	}
+	return nil, errors.ErrorResponse{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: "domains can only be imported as " + mimeCSV + " or " + mimeNDJSON,
+	}
+}
+
+func readCSVRows(body io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var rows []ImportRow
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.BadRequest("the CSV data is invalid: " + err.Error())
+		}
+		if line == 1 && isCSVHeader(record[0]) {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, errors.BadRequest("at most " + strconv.Itoa(MaxImportRows) + " domains can be imported at once")
+		}
+		rows = append(rows, ImportRow{Row: len(rows) + 1, Name: record[0]})
+	}
+	return rows, nil
+}
+
+func isCSVHeader(column string) bool {
+	column = strings.ToLower(strings.TrimSpace(column))
+	return column == "name" || column == "domain"
+}
+
+func readNDJSONRows(body io.Reader) ([]ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	var rows []ImportRow
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, errors.BadRequest("at most " + strconv.Itoa(MaxImportRows) + " domains can be imported at once")
+		}
+		row := ImportRow{Row: len(rows) + 1}
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(line), &input); err != nil {
+			row.Error = "the line is not a valid JSON object"
+		}
+		row.Name = input.Name
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.BadRequest("the NDJSON data is invalid: " + err.Error())
+	}
+	return rows, nil
+}
+
+// CSVRecord returns the columns of the domain in the order of csvHeader.
+func (domain Domain) CSVRecord() []string {
+	verifiedAt := ""
+	if domain.VerifiedAt != nil {
+		verifiedAt = domain.VerifiedAt.Format(time.RFC3339)
+	}
+	labels, _ := domain.Labels.Value()
+	return []string{
+		strconv.Itoa(domain.ID),
+		strconv.Itoa(domain.AccountId),
+		domain.Domain.Domain,
+		verifiedAt,
+		domain.Health,
+		string(labels.([]byte)),
+		domain.CreatedAt.Format(time.RFC3339),
+		domain.UpdatedAt.Format(time.RFC3339),
+	}
+}
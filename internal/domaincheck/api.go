@@ -0,0 +1,48 @@
+package domaincheck
+
+import (
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/domains/<id>/checks", res.query)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/domains/<id>/checks", Summary: "List the health checks of a domain", Params: openapi.PageParams,
+		Response: openapi.Page(Check{})},
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	count, err := r.service.Count(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	checks, err := r.service.Query(ctx, domainID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = checks
+	return c.Write(pages)
+}
@@ -0,0 +1,32 @@
+package domaincheck
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{domains: []entity.Domain{{ID: 123}, {ID: 124}}, checks: []entity.DomainCheck{
+		{ID: 1, DomainID: 123, Healthy: true, DNSOK: true, HTTPOK: true, HTTPStatus: 200, CheckedAt: time.Now()},
+		{ID: 2, DomainID: 123, Error: "no such host", CheckedAt: time.Now()},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, Checker{}, 1, 0, logger), logger)
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/domains/123/checks", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get content", "GET", "/domains/123/checks", "", nil, http.StatusOK, `*"healthy":true,"dns_ok":true*`},
+		{"get none", "GET", "/domains/124/checks", "", nil, http.StatusOK, `*"total_count":0*`},
+		{"get unknown", "GET", "/domains/1234/checks", "", nil, http.StatusNotFound, ""},
+		{"get invalid", "GET", "/domains/abc/checks", "", nil, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,125 @@
+package domaincheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+)
+
+// Resolver looks up DNS records of a host. It is implemented by *net.Resolver.
+type Resolver interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Checker checks whether a domain points at us and serves HTTP requests.
+type Checker struct {
+	// Resolver is used for DNS lookups. Defaults to net.DefaultResolver.
+	Resolver Resolver
+	// HTTPClient is used for the HTTP probe. Defaults to a client that does not follow redirects.
+	HTTPClient *http.Client
+	// CNAME is the expected CNAME target of the domains, e.g. "edge.example.net".
+	CNAME string
+	// IPs are the expected IP addresses of the domains.
+	// If neither CNAME nor IPs is set, any resolvable domain passes the DNS check.
+	IPs []string
+}
+
+// Check runs the DNS check and the HTTP probe against the given domain.
+// The HTTP probe is skipped if the DNS check fails.
+func (c Checker) Check(ctx context.Context, domain string) entity.DomainCheck {
+	start := time.Now()
+	result := entity.DomainCheck{CheckedAt: start}
+
+	var records []string
+	var err error
+	result.DNSOK, records, err = c.checkDNS(ctx, domain)
+	result.Records = strings.Join(records, ",")
+	if err == nil && !result.DNSOK {
+		err = fmt.Errorf("%v does not resolve to the expected records", domain)
+	}
+	if err == nil {
+		result.HTTPOK, result.HTTPStatus, err = c.checkHTTP(ctx, domain)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	result.Healthy = result.DNSOK && result.HTTPOK
+	result.DurationMs = int(time.Since(start).Milliseconds())
+	return result
+}
+
+// checkDNS resolves the domain and reports whether it has the expected CNAME or IP addresses.
+func (c Checker) checkDNS(ctx context.Context, domain string) (bool, []string, error) {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	var records []string
+	cname, err := resolver.LookupCNAME(ctx, domain)
+	if err != nil {
+		return false, nil, err
+	}
+	cname = normalizeHost(cname)
+	if cname != normalizeHost(domain) {
+		records = append(records, cname)
+	}
+	addrs, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		return false, records, err
+	}
+	records = append(records, addrs...)
+
+	if c.CNAME == "" && len(c.IPs) == 0 {
+		return len(addrs) > 0, records, nil
+	}
+	if c.CNAME != "" && cname == normalizeHost(c.CNAME) {
+		return true, records, nil
+	}
+	for _, addr := range addrs {
+		for _, ip := range c.IPs {
+			if addr == ip {
+				return true, records, nil
+			}
+		}
+	}
+	return false, records, nil
+}
+
+// checkHTTP sends a probe request to the domain and reports whether it is served without a server error.
+func (c Checker) checkHTTP(ctx context.Context, domain string) (bool, int, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	req, err := http.NewRequest("GET", "http://"+domain+"/", nil)
+	if err != nil {
+		return false, 0, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, 0, err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return false, res.StatusCode, fmt.Errorf("HTTP probe returned status %v", res.StatusCode)
+	}
+	return true, res.StatusCode, nil
+}
+
+// normalizeHost lower-cases a host name and removes the trailing dot of a fully qualified name.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
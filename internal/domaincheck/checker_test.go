@@ -0,0 +1,117 @@
+package domaincheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Check(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "broken.example.com" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resolver := &mockResolver{records: map[string][]string{
+		"cname.example.com":     {"edge.example.net.", "10.0.0.1"},
+		"ip.example.com":        {"ip.example.com.", "192.0.2.1"},
+		"wrong.example.com":     {"other.example.net.", "10.0.0.9"},
+		"broken.example.com":    {"edge.example.net.", "10.0.0.1"},
+		"unreachable.localhost": {"edge.example.net.", "10.0.0.1"},
+	}}
+	checker := Checker{
+		Resolver:   resolver,
+		HTTPClient: localClient(server),
+		CNAME:      "edge.example.net",
+		IPs:        []string{"192.0.2.1"},
+	}
+
+	tests := []struct {
+		name       string
+		domain     string
+		dnsOK      bool
+		httpOK     bool
+		httpStatus int
+		records    string
+	}{
+		{"cname", "cname.example.com", true, true, http.StatusOK, "edge.example.net,10.0.0.1"},
+		{"ip", "ip.example.com", true, true, http.StatusOK, "192.0.2.1"},
+		{"wrong records", "wrong.example.com", false, false, 0, "other.example.net,10.0.0.9"},
+		{"server error", "broken.example.com", true, false, http.StatusBadGateway, "edge.example.net,10.0.0.1"},
+		{"not found", "unknown.example.com", false, false, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checker.Check(context.Background(), tt.domain)
+			assert.Equal(t, tt.dnsOK, check.DNSOK)
+			assert.Equal(t, tt.httpOK, check.HTTPOK)
+			assert.Equal(t, tt.dnsOK && tt.httpOK, check.Healthy)
+			assert.Equal(t, tt.httpStatus, check.HTTPStatus)
+			assert.Equal(t, tt.records, check.Records)
+			assert.Equal(t, !check.Healthy, check.Error != "")
+			assert.False(t, check.CheckedAt.IsZero())
+		})
+	}
+
+	// without expectations any resolvable domain passes the DNS check
+	checker.CNAME, checker.IPs = "", nil
+	check := checker.Check(context.Background(), "wrong.example.com")
+	assert.True(t, check.Healthy)
+}
+
+// localClient returns an HTTP client that sends every request to the given test server regardless of the host.
+func localClient(server *httptest.Server) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+}
+
+// mockResolver resolves host names using static records.
+// The first record of a host is its CNAME, the remaining ones its addresses.
+type mockResolver struct {
+	records map[string][]string
+	delay   time.Duration
+
+	mu          sync.Mutex
+	active, max int
+}
+
+func (m *mockResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	m.mu.Lock()
+	m.active++
+	if m.active > m.max {
+		m.max = m.active
+	}
+	m.mu.Unlock()
+	time.Sleep(m.delay)
+	defer func() {
+		m.mu.Lock()
+		m.active--
+		m.mu.Unlock()
+	}()
+
+	if records, ok := m.records[host]; ok {
+		return records[0], nil
+	}
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (m *mockResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if records, ok := m.records[host]; ok {
+		return records[1:], nil
+	}
+	return nil, errors.New("no such host")
+}
@@ -0,0 +1,101 @@
+package domaincheck
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access domain checks from the data source.
+type Repository interface {
+	// GetDomain returns the domain with the specified ID.
+	GetDomain(ctx context.Context, id int) (entity.Domain, error)
+	// Count returns the number of checks of the specified domain.
+	Count(ctx context.Context, domainID int) (int, error)
+	// Query returns the checks of the specified domain with the given offset and limit, newest first.
+	Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainCheck, error)
+	// Create saves a new check and updates the health of the checked domain.
+	Create(ctx context.Context, check entity.DomainCheck) error
+	// DeleteBefore removes the checks made before the given time.
+	DeleteBefore(ctx context.Context, t time.Time) error
+	// QueryVerified returns all verified domains.
+	QueryVerified(ctx context.Context) ([]entity.Domain, error)
+}
+
+// repository persists domain checks in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new domain check repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetDomain reads the domain with the specified ID from the database.
+func (r repository) GetDomain(ctx context.Context, id int) (entity.Domain, error) {
+	var domain entity.Domain
+	err := r.db.With(ctx).Select().Model(id, &domain)
+	return domain, err
+}
+
+// Count returns the number of the check records of the specified domain in the database.
+func (r repository) Count(ctx context.Context, domainID int) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("domain_check").Where(dbx.HashExp{"domain_id": domainID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the check records of the specified domain with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainCheck, error) {
+	var checks []entity.DomainCheck
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID}).
+		OrderBy("checked_at DESC", "id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&checks)
+	return checks, err
+}
+
+// Create saves a new check record in the database and updates the health of the domain accordingly.
+// The version of the domain is only incremented if its health changes.
+func (r repository) Create(ctx context.Context, check entity.DomainCheck) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.db.With(ctx).Model(&check).Insert(); err != nil {
+			return err
+		}
+		health := entity.HealthUnhealthy
+		if check.Healthy {
+			health = entity.HealthHealthy
+		}
+		_, err := r.db.With(ctx).Update("domain", dbx.Params{
+			"health":                health,
+			dbcontext.VersionColumn: dbx.NewExp(dbcontext.VersionColumn + "+1"),
+		}, dbx.And(dbx.HashExp{"id": check.DomainID}, dbx.Not(dbx.HashExp{"health": health}))).Execute()
+		return err
+	})
+}
+
+// DeleteBefore deletes the check records made before the given time from the database.
+func (r repository) DeleteBefore(ctx context.Context, t time.Time) error {
+	_, err := r.db.With(ctx).Delete("domain_check", dbx.NewExp("checked_at < {:t}", dbx.Params{"t": t})).Execute()
+	return err
+}
+
+// QueryVerified retrieves all verified domain records from the database.
+func (r repository) QueryVerified(ctx context.Context) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.NewExp("verified_at IS NOT NULL")).
+		OrderBy("id").
+		All(&domains)
+	return domains, err
+}
@@ -0,0 +1,78 @@
+package domaincheck
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "domain_check", "domain", "account")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "test@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	for _, domain := range []entity.Domain{
+		{ID: 1, AccountId: 1, Domain: "verified.example.com", VerifiedAt: &now, Health: entity.HealthUnknown, Version: 1, CreatedAt: now, UpdatedAt: now},
+		{ID: 2, AccountId: 1, Domain: "unverified.example.com", Health: entity.HealthUnknown, Version: 1, CreatedAt: now, UpdatedAt: now},
+	} {
+		assert.Nil(t, db.DB().Model(&domain).Insert())
+	}
+
+	// get domain
+	domain, err := repo.GetDomain(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "verified.example.com", domain.Domain)
+	_, err = repo.GetDomain(ctx, 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// verified domains
+	domains, err := repo.QueryVerified(ctx)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(domains)) {
+		assert.Equal(t, "verified.example.com", domains[0].Domain)
+	}
+
+	// create
+	err = repo.Create(ctx, entity.DomainCheck{DomainID: 1, Healthy: false, Error: "timeout", CheckedAt: now.Add(-time.Hour)})
+	assert.Nil(t, err)
+	err = repo.Create(ctx, entity.DomainCheck{DomainID: 1, Healthy: true, DNSOK: true, HTTPOK: true, HTTPStatus: 200, CheckedAt: now})
+	assert.Nil(t, err)
+	err = repo.Create(ctx, entity.DomainCheck{DomainID: 1, Healthy: true, DNSOK: true, HTTPOK: true, HTTPStatus: 200, CheckedAt: now})
+	assert.Nil(t, err)
+	var health string
+	var version int
+	assert.Nil(t, db.DB().Select("health", "version").From("domain").Where(dbx.HashExp{"id": 1}).Row(&health, &version))
+	assert.Equal(t, entity.HealthHealthy, health)
+	// the version only changes with the health
+	assert.Equal(t, 3, version)
+
+	// query
+	count, err := repo.Count(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	checks, err := repo.Query(ctx, 1, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(checks)) {
+		assert.True(t, checks[0].Healthy)
+		assert.Equal(t, 200, checks[0].HTTPStatus)
+		assert.Equal(t, "timeout", checks[2].Error)
+	}
+
+	// prune
+	assert.Nil(t, repo.DeleteBefore(ctx, now.Add(-time.Minute)))
+	count, _ = repo.Count(ctx, 1)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,145 @@
+package domaincheck
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// checkTimeout is the maximum time allowed for checking a single domain.
+	checkTimeout = 10 * time.Second
+	// retention is how long check results are kept.
+	retention = 30 * 24 * time.Hour
+)
+
+// Service encapsulates usecase logic for domain health checks.
+type Service interface {
+	// Query returns the checks of the specified domain with the given offset and limit, newest first.
+	Query(ctx context.Context, domainID int, offset, limit int) ([]Check, error)
+	// Count returns the number of checks of the specified domain.
+	// sql.ErrNoRows is returned if the domain does not exist.
+	Count(ctx context.Context, domainID int) (int, error)
+	// CheckAll checks every verified domain and records the results.
+	CheckAll(ctx context.Context) error
+}
+
+// Check represents the data about a domain check.
+type Check struct {
+	entity.DomainCheck
+}
+
+type service struct {
+	repo        Repository
+	checker     Checker
+	concurrency int
+	jitter      time.Duration
+	logger      log.Logger
+}
+
+// NewService creates a new domain check service.
+// At most concurrency domains are checked at the same time, and each check is delayed
+// by a random duration up to jitter so that the checks of a run are spread out.
+func NewService(repo Repository, checker Checker, concurrency int, jitter time.Duration, logger log.Logger) Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return service{repo, checker, concurrency, jitter, logger}
+}
+
+// Query returns the checks of the specified domain with the given offset and limit.
+func (s service) Query(ctx context.Context, domainID int, offset, limit int) ([]Check, error) {
+	items, err := s.repo.Query(ctx, domainID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Check{}
+	for _, item := range items {
+		result = append(result, Check{item})
+	}
+	return result, nil
+}
+
+// Count returns the number of checks of the specified domain, after checking that the domain exists.
+func (s service) Count(ctx context.Context, domainID int) (int, error) {
+	if _, err := s.repo.GetDomain(ctx, domainID); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, domainID)
+}
+
+// CheckAll checks every verified domain and records the results.
+// Results older than the retention period are removed afterwards.
+func (s service) CheckAll(ctx context.Context) error {
+	domains, err := s.repo.QueryVerified(ctx)
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for _, domain := range domains {
+		wg.Add(1)
+		go func(domain entity.Domain, delay time.Duration) {
+			defer wg.Done()
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			s.check(ctx, domain)
+		}(domain, s.delay())
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.repo.DeleteBefore(ctx, time.Now().Add(-retention))
+}
+
+// check checks a single domain and saves the result.
+func (s service) check(ctx context.Context, domain entity.Domain) {
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	check := s.checker.Check(checkCtx, domain.Domain)
+	check.DomainID = domain.ID
+	if err := s.repo.Create(ctx, check); err != nil {
+		s.logger.With(ctx, "domain", domain.Domain).Errorf("failed to save domain check: %v", err)
+	}
+}
+
+// delay returns a random delay up to the configured jitter.
+func (s service) delay() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// RunChecks calls Service.CheckAll periodically with the given interval until the context is cancelled.
+func RunChecks(ctx context.Context, service Service, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := service.CheckAll(ctx); err != nil && ctx.Err() == nil {
+			logger.With(ctx).Errorf("domain checks failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package domaincheck
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_CheckAll(t *testing.T) {
+	logger, _ := log.NewForTest()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	now := time.Now()
+	resolver := &mockResolver{records: map[string][]string{}, delay: 10 * time.Millisecond}
+	repo := &mockRepository{}
+	for i := 1; i <= 10; i++ {
+		name := fmt.Sprintf("d%v.example.com", i)
+		repo.domains = append(repo.domains, entity.Domain{ID: i, Domain: name, VerifiedAt: &now})
+		if i%2 == 0 {
+			resolver.records[name] = []string{"edge.example.net.", "10.0.0.1"}
+		}
+	}
+	repo.domains = append(repo.domains, entity.Domain{ID: 11, Domain: "unverified.example.com"})
+	checker := Checker{Resolver: resolver, HTTPClient: localClient(server), CNAME: "edge.example.net"}
+	s := NewService(repo, checker, 3, time.Millisecond, logger)
+
+	ctx := context.Background()
+	assert.Nil(t, s.CheckAll(ctx))
+	assert.Equal(t, 10, len(repo.checks))
+	assert.True(t, resolver.max <= 3, "concurrency limit exceeded")
+	assert.True(t, repo.pruned)
+
+	count, _ := s.Count(ctx, 2)
+	assert.Equal(t, 1, count)
+	checks, err := s.Query(ctx, 2, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(checks)) {
+		assert.True(t, checks[0].Healthy)
+		assert.Equal(t, 2, checks[0].DomainID)
+	}
+	checks, _ = s.Query(ctx, 3, 0, 10)
+	if assert.Equal(t, 1, len(checks)) {
+		assert.False(t, checks[0].Healthy)
+	}
+
+	// cancellation
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, s.CheckAll(cancelled))
+}
+
+type mockRepository struct {
+	domains []entity.Domain
+	pruned  bool
+
+	mu     sync.Mutex
+	checks []entity.DomainCheck
+}
+
+func (m *mockRepository) GetDomain(ctx context.Context, id int) (entity.Domain, error) {
+	for _, domain := range m.domains {
+		if domain.ID == id {
+			return domain, nil
+		}
+	}
+	return entity.Domain{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Count(ctx context.Context, domainID int) (int, error) {
+	checks, _ := m.Query(ctx, domainID, 0, 0)
+	return len(checks), nil
+}
+
+func (m *mockRepository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainCheck, error) {
+	var checks []entity.DomainCheck
+	for _, check := range m.checks {
+		if check.DomainID == domainID {
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, check entity.DomainCheck) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	check.ID = len(m.checks) + 1
+	m.checks = append(m.checks, check)
+	return nil
+}
+
+func (m *mockRepository) DeleteBefore(ctx context.Context, t time.Time) error {
+	m.pruned = true
+	return nil
+}
+
+func (m *mockRepository) QueryVerified(ctx context.Context) ([]entity.Domain, error) {
+	var domains []entity.Domain
+	for _, domain := range m.domains {
+		if domain.VerifiedAt != nil {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
@@ -0,0 +1,102 @@
+package domainconfig
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/domains/<id>/config", res.get)
+	r.Get("/domains/<id>/config/versions", res.query)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Put("/domains/<id>/config", res.update)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/domains/<id>/config", Summary: "Get the configuration of a domain", Params: []openapi.Parameter{openapi.IfNoneMatchParam},
+		Response: DomainConfig{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/domains/<id>/config/versions", Summary: "List the configuration versions of a domain", Params: openapi.PageParams,
+		Response: openapi.Page(DomainConfig{})},
+	{Method: "PUT", Path: "/domains/<id>/config", Summary: "Update the configuration of a domain", Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+		Request: UpdateConfigRequest{}, Response: DomainConfig{}, Errors: []int{http.StatusPreconditionFailed}},
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// get responds with the current configuration of a domain. Edge nodes poll this endpoint,
+// so 304 (Not Modified) is returned without a body if the If-None-Match header matches the current version.
+func (r resource) get(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	config, err := r.service.Get(c.Request.Context(), domainID)
+	if err != nil {
+		return err
+	}
+
+	if etag.NotModified(c.Response, c.Request, config.Version) {
+		return nil
+	}
+	return c.Write(config)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	count, err := r.service.Count(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	configs, err := r.service.Query(ctx, domainID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = configs
+	return c.Write(pages)
+}
+
+func (r resource) update(c *routing.Context) error {
+	domainID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	var input UpdateConfigRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	config, err := r.service.Update(c.Request.Context(), domainID, version, input)
+	if err != nil {
+		return err
+	}
+
+	etag.Set(c.Response, config.Version)
+	return c.Write(config)
+}
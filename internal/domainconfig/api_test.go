@@ -0,0 +1,50 @@
+package domainconfig
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{domains: []int{123, 124}, configs: []entity.DomainConfig{
+		{DomainID: 123, Version: 1, Rules: entity.DomainRules{OriginURL: "https://origin.example.com"}, CreatedAt: time.Now()},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+	notModified := http.Header{"If-None-Match": []string{`"0", W/"1"`}}
+	modified := http.Header{"If-None-Match": []string{`"0"`}}
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+
+	tests := []test.APITestCase{
+		{"get", "GET", "/domains/123/config", "", nil, http.StatusOK, `*"domain_id":123,"version":1*`},
+		{"get not modified", "GET", "/domains/123/config", "", notModified, http.StatusNotModified, ""},
+		{"get modified", "GET", "/domains/123/config", "", modified, http.StatusOK, `*"origin_url":"https://origin.example.com"*`},
+		{"get unknown", "GET", "/domains/124/config", "", nil, http.StatusNotFound, ""},
+		{"get invalid", "GET", "/domains/abc/config", "", nil, http.StatusNotFound, ""},
+		{"update conflict", "PUT", "/domains/123/config", `{"origin_url":"https://new.example.com"}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update ok", "PUT", "/domains/123/config", `{"origin_url":"https://new.example.com","https_redirect":true,"redirects":[{"path":"/old","target":"/new"}],"headers":[{"name":"X-Frame-Options","value":"DENY"}]}`, ifMatch(`"1"`), http.StatusOK, `*"version":2,"rules":{"origin_url":"https://new.example.com","https_redirect":true,"redirects":[{"path":"/old","target":"/new","status":301}]*`},
+		{"update verify", "GET", "/domains/123/config", "", modified, http.StatusOK, `*"version":2*`},
+		{"update unchanged", "PUT", "/domains/123/config", `{"origin_url":"https://new.example.com","https_redirect":true,"redirects":[{"path":"/old","target":"/new","status":301}],"headers":[{"name":"X-Frame-Options","value":"DENY"}]}`, header, http.StatusOK, `*"version":2*`},
+		{"update first", "PUT", "/domains/124/config", `{"origin_url":"http://origin.example.org"}`, header, http.StatusOK, `*"domain_id":124,"version":1*`},
+		{"update unknown", "PUT", "/domains/125/config", `{"origin_url":"http://origin.example.org"}`, header, http.StatusNotFound, ""},
+		{"update auth error", "PUT", "/domains/123/config", `{"origin_url":"http://origin.example.org"}`, nil, http.StatusUnauthorized, ""},
+		{"update input error", "PUT", "/domains/123/config", `"origin_url":"http://origin.example.org"}`, header, http.StatusBadRequest, ""},
+		{"update validation error", "PUT", "/domains/123/config", `{"origin_url":"ftp://origin.example.org"}`, header, http.StatusBadRequest, `*"origin_url"*`},
+		{"versions", "GET", "/domains/123/config/versions", "", nil, http.StatusOK, `*"total_count":2*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
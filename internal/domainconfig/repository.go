@@ -0,0 +1,98 @@
+package domainconfig
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access domain configurations from the data source.
+type Repository interface {
+	// Get returns the latest version of the configuration of the specified domain.
+	Get(ctx context.Context, domainID int) (entity.DomainConfig, error)
+	// Count returns the number of configuration versions of the specified domain.
+	Count(ctx context.Context, domainID int) (int, error)
+	// Query returns the configuration versions of the specified domain with the given offset and limit, newest first.
+	Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainConfig, error)
+	// Create saves a configuration as the next version of the configuration of its domain.
+	// The assigned version is returned. If version is not 0, dbcontext.ErrConflict is returned
+	// unless the current version is that version.
+	Create(ctx context.Context, config entity.DomainConfig, version int) (entity.DomainConfig, error)
+}
+
+// repository persists domain configurations in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new domain configuration repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the latest configuration version of the specified domain from the database.
+func (r repository) Get(ctx context.Context, domainID int) (entity.DomainConfig, error) {
+	var config entity.DomainConfig
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID}).
+		OrderBy("version DESC").
+		Limit(1).
+		One(&config)
+	return config, err
+}
+
+// Count returns the number of the configuration versions of the specified domain in the database.
+func (r repository) Count(ctx context.Context, domainID int) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("domain_config").Where(dbx.HashExp{"domain_id": domainID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the configuration versions of the specified domain with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainConfig, error) {
+	var configs []entity.DomainConfig
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"domain_id": domainID}).
+		OrderBy("version DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&configs)
+	return configs, err
+}
+
+// Create inserts the configuration into the database as the next version of the configuration of its domain.
+// The domain row is locked so that concurrent changes get consecutive versions and are checked against the
+// version they were made from. sql.ErrNoRows is returned if the domain does not exist.
+func (r repository) Create(ctx context.Context, config entity.DomainConfig, version int) (entity.DomainConfig, error) {
+	err := r.db.Transactional(ctx, func(ctx context.Context) error {
+		var id int
+		err := r.db.With(ctx).
+			NewQuery("SELECT id FROM domain WHERE id={:id} FOR UPDATE").
+			Bind(dbx.Params{"id": config.DomainID}).
+			Row(&id)
+		if err != nil {
+			return err
+		}
+		var current int
+		err = r.db.With(ctx).
+			Select("COALESCE(MAX(version), 0)").
+			From("domain_config").
+			Where(dbx.HashExp{"domain_id": config.DomainID}).
+			Row(&current)
+		if err != nil {
+			return err
+		}
+		if err := dbcontext.CheckVersion(current, version); err != nil {
+			return err
+		}
+		config.Version = current + 1
+		return r.db.With(ctx).Model(&config).Insert()
+	})
+	return config, err
+}
@@ -0,0 +1,74 @@
+package domainconfig
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "domain_config", "domain", "account")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "test@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	domain := entity.Domain{ID: 1, AccountId: 1, Domain: "example.com", Health: entity.HealthUnknown, CreatedAt: now, UpdatedAt: now}
+	assert.Nil(t, db.DB().Model(&domain).Insert())
+
+	// get none
+	_, err = repo.Get(ctx, 1)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// create
+	config, err := repo.Create(ctx, entity.DomainConfig{
+		DomainID:  1,
+		Rules:     entity.DomainRules{OriginURL: "https://origin.example.com", Headers: []entity.HeaderRule{{Name: "X-Test", Value: "1"}}},
+		CreatedAt: now,
+	}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, config.Version)
+	config, err = repo.Create(ctx, entity.DomainConfig{
+		DomainID:  1,
+		Rules:     entity.DomainRules{OriginURL: "https://origin.example.com", HTTPSRedirect: true},
+		CreatedAt: now,
+	}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, config.Version)
+
+	// create from a stale version
+	_, err = repo.Create(ctx, entity.DomainConfig{DomainID: 1, CreatedAt: now}, 1)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+
+	// create for unknown domain
+	_, err = repo.Create(ctx, entity.DomainConfig{DomainID: 2, CreatedAt: now}, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// get
+	config, err = repo.Get(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, config.Version)
+	assert.True(t, config.Rules.HTTPSRedirect)
+
+	// count and query
+	count, err := repo.Count(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	configs, err := repo.Query(ctx, 1, 1, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(configs)) {
+		assert.Equal(t, 1, configs[0].Version)
+		assert.Equal(t, "X-Test", configs[0].Rules.Headers[0].Name)
+	}
+}
@@ -0,0 +1,207 @@
+package domainconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// maxRules is the maximum number of path redirects and of injected headers of a domain.
+const maxRules = 100
+
+var (
+	// headerName matches a valid HTTP header field name (RFC 7230 token).
+	headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	// absolutePath matches a path starting with a slash.
+	absolutePath = regexp.MustCompile("^/")
+
+	// reservedHeaders are the headers that cannot be injected as they are controlled by the edge nodes.
+	reservedHeaders = []interface{}{
+		"connection", "content-length", "host", "keep-alive", "proxy-connection",
+		"te", "trailer", "transfer-encoding", "upgrade",
+	}
+
+	// redirectStatuses are the status codes allowed for path redirects.
+	redirectStatuses = []interface{}{301, 302, 303, 307, 308}
+)
+
+// Service encapsulates usecase logic for domain configurations.
+type Service interface {
+	// Get returns the current configuration of a domain.
+	Get(ctx context.Context, domainID int) (DomainConfig, error)
+	// Query returns the configuration versions of a domain, newest first.
+	Query(ctx context.Context, domainID int, offset, limit int) ([]DomainConfig, error)
+	// Count returns the number of configuration versions of a domain.
+	Count(ctx context.Context, domainID int) (int, error)
+	// Update replaces the configuration of a domain, creating a new version if the rules changed.
+	// If version is not 0, the configuration is only replaced if the current version is that version.
+	Update(ctx context.Context, domainID int, version int, input UpdateConfigRequest) (DomainConfig, error)
+}
+
+// DomainConfig represents the data about a domain configuration version.
+type DomainConfig struct {
+	entity.DomainConfig
+}
+
+// UpdateConfigRequest represents a domain configuration update request.
+type UpdateConfigRequest struct {
+	OriginURL     string                `json:"origin_url"`
+	HTTPSRedirect bool                  `json:"https_redirect"`
+	Redirects     []entity.PathRedirect `json:"redirects"`
+	Headers       []entity.HeaderRule   `json:"headers"`
+}
+
+// Validate validates the UpdateConfigRequest fields.
+func (m UpdateConfigRequest) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the UpdateConfigRequest fields.
+func (m *UpdateConfigRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.OriginURL, validation.Required, validation.Length(0, 2048), is.URL, validation.By(httpURL)),
+		validation.Field(&m.Redirects, validation.Length(0, maxRules), validation.Each(validation.By(validateRedirect))),
+		validation.Field(&m.Headers, validation.Length(0, maxRules), validation.Each(validation.By(validateHeader))),
+	}
+}
+
+// rules returns the normalized rules of the request.
+// Redirects without a status code default to 301 (Moved Permanently).
+func (m UpdateConfigRequest) rules() entity.DomainRules {
+	rules := entity.DomainRules{
+		OriginURL:     m.OriginURL,
+		HTTPSRedirect: m.HTTPSRedirect,
+		Redirects:     []entity.PathRedirect{},
+		Headers:       []entity.HeaderRule{},
+	}
+	for _, redirect := range m.Redirects {
+		if redirect.Status == 0 {
+			redirect.Status = 301
+		}
+		rules.Redirects = append(rules.Redirects, redirect)
+	}
+	rules.Headers = append(rules.Headers, m.Headers...)
+	return rules
+}
+
+// httpURL checks that a URL uses the http or https scheme.
+func httpURL(value interface{}) error {
+	u, err := url.Parse(value.(string))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an http or https URL")
+	}
+	return nil
+}
+
+// redirectTarget checks that a redirect target is either an absolute path or an http(s) URL.
+func redirectTarget(value interface{}) error {
+	if strings.HasPrefix(value.(string), "/") && !strings.HasPrefix(value.(string), "//") {
+		return nil
+	}
+	return httpURL(value)
+}
+
+func validateRedirect(value interface{}) error {
+	redirect := value.(entity.PathRedirect)
+	return validation.ValidateStruct(&redirect,
+		validation.Field(&redirect.Path, validation.Required, validation.Length(0, 1024), validation.Match(absolutePath)),
+		validation.Field(&redirect.Target, validation.Required, validation.Length(0, 2048), validation.By(redirectTarget)),
+		validation.Field(&redirect.Status, validation.In(redirectStatuses...)),
+	)
+}
+
+func validateHeader(value interface{}) error {
+	header := value.(entity.HeaderRule)
+	return validation.ValidateStruct(&header,
+		validation.Field(&header.Name, validation.Required, validation.Length(0, 256), validation.Match(headerName),
+			validation.By(func(value interface{}) error {
+				return validation.Validate(strings.ToLower(value.(string)), validation.NotIn(reservedHeaders...))
+			})),
+		validation.Field(&header.Value, validation.Length(0, 4096), validation.By(func(value interface{}) error {
+			if strings.ContainsAny(value.(string), "\r\n") {
+				return errors.New("must not contain line breaks")
+			}
+			return nil
+		})),
+	)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new domain configuration service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the latest configuration version of the specified domain.
+func (s service) Get(ctx context.Context, domainID int) (DomainConfig, error) {
+	config, err := s.repo.Get(ctx, domainID)
+	if err != nil {
+		return DomainConfig{}, err
+	}
+	return DomainConfig{config}, nil
+}
+
+// Update saves the rules of the request as a new configuration version of the specified domain.
+// If the rules are the same as those of the current version, the current version is returned unchanged
+// so that edge nodes do not reload an identical configuration.
+// If version is not 0, dbcontext.ErrConflict is returned unless the current version is that version.
+func (s service) Update(ctx context.Context, domainID int, version int, req UpdateConfigRequest) (DomainConfig, error) {
+	if err := req.Validate(); err != nil {
+		return DomainConfig{}, err
+	}
+	rules := req.rules()
+
+	current, err := s.Get(ctx, domainID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return DomainConfig{}, err
+	}
+	if err := dbcontext.CheckVersion(current.Version, version); err != nil {
+		return DomainConfig{}, err
+	}
+	if current.Version != 0 && reflect.DeepEqual(current.Rules, rules) {
+		return current, nil
+	}
+
+	config, err := s.repo.Create(ctx, entity.DomainConfig{
+		DomainID:  domainID,
+		Rules:     rules,
+		CreatedAt: time.Now(),
+	}, version)
+	if err != nil {
+		return DomainConfig{}, err
+	}
+	return DomainConfig{config}, nil
+}
+
+// Count returns the number of configuration versions of the specified domain.
+func (s service) Count(ctx context.Context, domainID int) (int, error) {
+	return s.repo.Count(ctx, domainID)
+}
+
+// Query returns the configuration versions of the specified domain with the specified offset and limit.
+func (s service) Query(ctx context.Context, domainID int, offset, limit int) ([]DomainConfig, error) {
+	items, err := s.repo.Query(ctx, domainID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []DomainConfig{}
+	for _, item := range items {
+		result = append(result, DomainConfig{item})
+	}
+	return result, nil
+}
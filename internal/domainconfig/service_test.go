@@ -0,0 +1,154 @@
+package domainconfig
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateConfigRequest_Validate(t *testing.T) {
+	origin := "https://origin.example.com"
+	tests := []struct {
+		name      string
+		model     UpdateConfigRequest
+		wantError bool
+	}{
+		{"success", UpdateConfigRequest{OriginURL: origin, HTTPSRedirect: true}, false},
+		{"origin required", UpdateConfigRequest{}, true},
+		{"origin invalid", UpdateConfigRequest{OriginURL: "origin"}, true},
+		{"origin scheme", UpdateConfigRequest{OriginURL: "ftp://origin.example.com"}, true},
+		{"redirect path", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "/a", Target: "/b", Status: 302}}}, false},
+		{"redirect url", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "/a", Target: "https://example.org/b"}}}, false},
+		{"redirect relative path", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "a", Target: "/b"}}}, true},
+		{"redirect protocol relative target", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "/a", Target: "//example.org/b"}}}, true},
+		{"redirect target required", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "/a"}}}, true},
+		{"redirect status", UpdateConfigRequest{OriginURL: origin, Redirects: []entity.PathRedirect{{Path: "/a", Target: "/b", Status: 200}}}, true},
+		{"header", UpdateConfigRequest{OriginURL: origin, Headers: []entity.HeaderRule{{Name: "X-Frame-Options", Value: "DENY"}}}, false},
+		{"header name", UpdateConfigRequest{OriginURL: origin, Headers: []entity.HeaderRule{{Name: "X Frame", Value: "DENY"}}}, true},
+		{"header reserved", UpdateConfigRequest{OriginURL: origin, Headers: []entity.HeaderRule{{Name: "Content-Length", Value: "0"}}}, true},
+		{"header injection", UpdateConfigRequest{OriginURL: origin, Headers: []entity.HeaderRule{{Name: "X-Test", Value: "a\r\nSet-Cookie: b"}}}, true},
+		{"too many headers", UpdateConfigRequest{OriginURL: origin, Headers: make([]entity.HeaderRule, maxRules+1)}, true},
+		{"too long", UpdateConfigRequest{OriginURL: "https://example.com/" + strings.Repeat("a", 2048)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Update(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{domains: []int{1}}, logger)
+	ctx := context.Background()
+
+	// no configuration
+	_, err := s.Get(ctx, 1)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ := s.Count(ctx, 1)
+	assert.Equal(t, 0, count)
+
+	// unknown domain
+	_, err = s.Update(ctx, 2, 0, UpdateConfigRequest{OriginURL: "https://origin.example.com"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// validation error
+	_, err = s.Update(ctx, 1, 0, UpdateConfigRequest{})
+	assert.NotNil(t, err)
+
+	// first version
+	config, err := s.Update(ctx, 1, 0, UpdateConfigRequest{
+		OriginURL: "https://origin.example.com",
+		Redirects: []entity.PathRedirect{{Path: "/a", Target: "/b"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, config.Version)
+	assert.Equal(t, 301, config.Rules.Redirects[0].Status)
+	assert.NotNil(t, config.Rules.Headers)
+	assert.False(t, config.CreatedAt.IsZero())
+
+	// unchanged
+	config, err = s.Update(ctx, 1, 0, UpdateConfigRequest{
+		OriginURL: "https://origin.example.com",
+		Redirects: []entity.PathRedirect{{Path: "/a", Target: "/b", Status: 301}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, config.Version)
+
+	// version conflict
+	_, err = s.Update(ctx, 1, 2, UpdateConfigRequest{OriginURL: "https://origin.example.com", HTTPSRedirect: true})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+
+	// changed
+	config, err = s.Update(ctx, 1, 1, UpdateConfigRequest{OriginURL: "https://origin.example.com", HTTPSRedirect: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, config.Version)
+	config, _ = s.Get(ctx, 1)
+	assert.Equal(t, 2, config.Version)
+	assert.True(t, config.Rules.HTTPSRedirect)
+
+	// versions
+	count, _ = s.Count(ctx, 1)
+	assert.Equal(t, 2, count)
+	configs, err := s.Query(ctx, 1, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(configs)) {
+		assert.Equal(t, 2, configs[0].Version)
+		assert.Equal(t, 1, configs[1].Version)
+	}
+}
+
+type mockRepository struct {
+	domains []int
+	configs []entity.DomainConfig
+}
+
+func (m mockRepository) Get(ctx context.Context, domainID int) (entity.DomainConfig, error) {
+	configs, _ := m.Query(ctx, domainID, 0, 1)
+	if len(configs) == 0 {
+		return entity.DomainConfig{}, sql.ErrNoRows
+	}
+	return configs[0], nil
+}
+
+func (m mockRepository) Count(ctx context.Context, domainID int) (int, error) {
+	configs, _ := m.Query(ctx, domainID, 0, 0)
+	return len(configs), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, domainID int, offset, limit int) ([]entity.DomainConfig, error) {
+	var configs []entity.DomainConfig
+	for i := len(m.configs) - 1; i >= 0; i-- {
+		if m.configs[i].DomainID == domainID {
+			configs = append(configs, m.configs[i])
+		}
+	}
+	if limit > 0 && len(configs) > limit {
+		configs = configs[:limit]
+	}
+	return configs, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, config entity.DomainConfig, version int) (entity.DomainConfig, error) {
+	found := false
+	for _, id := range m.domains {
+		found = found || id == config.DomainID
+	}
+	if !found {
+		return config, sql.ErrNoRows
+	}
+	count, _ := m.Count(ctx, config.DomainID)
+	if err := dbcontext.CheckVersion(count, version); err != nil {
+		return config, err
+	}
+	config.Version = count + 1
+	m.configs = append(m.configs, config)
+	return config, nil
+}
@@ -8,6 +8,8 @@ type Account struct {
 	ID         int       `json:"id"`
 	Email      string    `json:"email"`
 	FirebaseId string    `json:"firebase_id"`
+	PlanID     string    `json:"plan_id"`
+	Version    int       `json:"version"`
 	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// CertificatePending indicates a certificate is waiting to be ordered.
+	CertificatePending = "pending"
+	// CertificateIssued indicates a valid certificate has been issued.
+	CertificateIssued = "issued"
+	// CertificateFailed indicates the last order failed and no valid certificate is available.
+	CertificateFailed = "failed"
+)
+
+// Certificate represents the TLS certificate record of a domain.
+// The certificate chain and the private key are stored encrypted.
+type Certificate struct {
+	DomainID      int        `json:"domain_id" db:"pk,domain_id"`
+	Status        string     `json:"status"`
+	SerialNumber  string     `json:"serial_number"`
+	NotBefore     *time.Time `json:"not_before"`
+	NotAfter      *time.Time `json:"not_after"`
+	CertEncrypted []byte     `json:"-"`
+	KeyEncrypted  []byte     `json:"-"`
+	LastError     string     `json:"last_error,omitempty"`
+	RetryAfter    *time.Time `json:"retry_after,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Version       int        `json:"version"`
+}
+
+// ACMEAccount represents an account registered with an ACME certificate authority.
+type ACMEAccount struct {
+	DirectoryURL string `db:"pk,directory_url"`
+	URI          string
+	KeyEncrypted []byte
+	CreatedAt    time.Time
+}
+
+// TableName returns the table name of the ACMEAccount model.
+func (ACMEAccount) TableName() string {
+	return "acme_account"
+}
+
+// ACMEChallenge represents a pending ACME HTTP-01 challenge response.
+type ACMEChallenge struct {
+	Token            string `db:"pk,token"`
+	KeyAuthorization string
+	CreatedAt        time.Time
+}
+
+// TableName returns the table name of the ACMEChallenge model.
+func (ACMEChallenge) TableName() string {
+	return "acme_challenge"
+}
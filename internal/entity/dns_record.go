@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"time"
+)
+
+// DNS record types supported in managed zones.
+const (
+	DNSTypeA     = "A"
+	DNSTypeAAAA  = "AAAA"
+	DNSTypeCNAME = "CNAME"
+	DNSTypeTXT   = "TXT"
+	DNSTypeMX    = "MX"
+	DNSTypeCAA   = "CAA"
+)
+
+// DNSRecord represents a DNS record in the managed zone of a domain.
+type DNSRecord struct {
+	ID       int `json:"id"`
+	DomainID int `json:"domain_id"`
+	// Name is the owner name relative to the zone, or "@" for the zone apex.
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  int    `json:"ttl"`
+	// Priority is the preference of an MX record. It is 0 for other types.
+	Priority int `json:"priority"`
+	// Value is the record data in presentation format, e.g. an IP address, a host name, the text of a TXT record
+	// or the `<flags> <tag> "<value>"` of a CAA record.
+	Value     string    `json:"value"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name of the DNSRecord model.
+func (DNSRecord) TableName() string {
+	return "dns_record"
+}
@@ -1,13 +1,66 @@
 package entity
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
+const (
+	// HealthUnknown indicates a domain has not been checked yet.
+	HealthUnknown = "unknown"
+	// HealthHealthy indicates the last check found the domain pointing at us and serving requests.
+	HealthHealthy = "healthy"
+	// HealthUnhealthy indicates the last check failed.
+	HealthUnhealthy = "unhealthy"
+)
+
+// Domain represents a customer domain record.
 type Domain struct {
-	ID        int       `db:"id"`
-	AccountId int       `json:"account_id"`
-	Domain    string    `json:"domain"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"created_at"`
+	ID         int        `json:"id"`
+	AccountId  int        `json:"account_id"`
+	Domain     string     `json:"domain"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	Health     string     `json:"health"`
+	Labels     Labels     `json:"labels"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Labels represents the free-form key/value metadata of a domain.
+type Labels map[string]string
+
+// Value stores the labels as a JSON object.
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan reads the labels from a JSON object.
+func (l *Labels) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return fmt.Errorf("cannot scan %T into Labels", value)
+}
+
+// DomainCheck represents the result of a domain health check.
+type DomainCheck struct {
+	ID         int       `json:"id"`
+	DomainID   int       `json:"domain_id"`
+	Healthy    bool      `json:"healthy"`
+	DNSOK      bool      `json:"dns_ok" db:"dns_ok"`
+	Records    string    `json:"records"`
+	HTTPOK     bool      `json:"http_ok" db:"http_ok"`
+	HTTPStatus int       `json:"http_status" db:"http_status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
 }
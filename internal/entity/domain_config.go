@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DomainConfig represents a version of the routing configuration of a domain.
+// Every change of the configuration is saved as a new version.
+type DomainConfig struct {
+	DomainID  int         `json:"domain_id" db:"pk,domain_id"`
+	Version   int         `json:"version"`
+	Rules     DomainRules `json:"rules"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// DomainRules represents the rules that edge nodes apply to the requests of a domain.
+type DomainRules struct {
+	// OriginURL is the URL of the origin server that requests are proxied to.
+	OriginURL string `json:"origin_url"`
+	// HTTPSRedirect indicates whether plain HTTP requests are redirected to HTTPS.
+	HTTPSRedirect bool           `json:"https_redirect"`
+	Redirects     []PathRedirect `json:"redirects"`
+	Headers       []HeaderRule   `json:"headers"`
+}
+
+// PathRedirect represents a redirect of the requests to a path.
+type PathRedirect struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Status int    `json:"status"`
+}
+
+// HeaderRule represents a header that is added to the responses of a domain.
+type HeaderRule struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Value stores the rules as JSON.
+func (r DomainRules) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan reads the rules from JSON.
+func (r *DomainRules) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	}
+	return fmt.Errorf("cannot scan %T into DomainRules", value)
+}
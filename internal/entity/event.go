@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Event represents a change of a resource, saved in the same transaction as the change.
+// Events are delivered to the webhooks subscribed to them.
+type Event struct {
+	ID int64 `json:"id"`
+	// Type is the type of the change, e.g. "domain.created".
+	Type string `json:"type"`
+	// AccountID is the ID of the account owning the resource, or nil if the resource is not owned by an account.
+	AccountID  *int      `json:"account_id"`
+	ResourceID string    `json:"resource_id"`
+	Data       EventData `json:"data"`
+	CreatedAt  time.Time `json:"created_at"`
+	// DispatchedAt is when deliveries to the subscribed webhooks were created for the event.
+	DispatchedAt *time.Time `json:"-"`
+}
+
+// EventData is the JSON encoding of the resource an event is about, after the change
+// or before it for deletions.
+type EventData []byte
+
+// MarshalJSON returns the data as it is.
+func (d EventData) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+// UnmarshalJSON keeps a copy of the data.
+func (d *EventData) UnmarshalJSON(data []byte) error {
+	*d = append((*d)[:0], data...)
+	return nil
+}
+
+// Value stores the data as JSON.
+func (d EventData) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return []byte(d), nil
+}
+
+// Scan reads a copy of the data, as the driver may reuse its buffer.
+func (d *EventData) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*d = append(EventData{}, v...)
+		return nil
+	case string:
+		*d = EventData(v)
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into EventData", value)
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"time"
+)
+
+// IdempotencyKey represents a request sent with an Idempotency-Key header together with the response to it,
+// so that the response can be replayed when the request is retried with the same key.
+type IdempotencyKey struct {
+	UserID string `db:"pk,user_id"`
+	Key    string `db:"pk,key"`
+	Method string
+	Path   string
+	// RequestHash is the hex-encoded SHA-256 hash of the request body.
+	RequestHash string
+	// Status is the status code of the response, or 0 while the request is in progress.
+	Status int
+	// Header is the JSON-encoded header of the response.
+	Header    []byte
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// TableName returns the table name of the IdempotencyKey model.
+func (IdempotencyKey) TableName() string {
+	return "idempotency_key"
+}
+
+// InProgress returns whether the request made with the key has not completed yet.
+func (k IdempotencyKey) InProgress() bool {
+	return k.Status == 0
+}
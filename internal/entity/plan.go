@@ -0,0 +1,18 @@
+package entity
+
+const (
+	// DefaultPlan is the ID of the plan new accounts are subscribed to.
+	DefaultPlan = "free"
+
+	// ResourceDomains is the name of the domain resource of an account that is limited by its plan.
+	ResourceDomains = "domains"
+)
+
+// Plan represents the limits of the accounts subscribed to it. A limit of 0 means unlimited.
+type Plan struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	MaxDomains        int    `json:"max_domains"`
+	MaxAPIKeys        int    `json:"max_api_keys" db:"max_api_keys"`
+	RequestsPerMinute int    `json:"requests_per_minute"`
+}
@@ -4,6 +4,8 @@ package entity
 type User struct {
 	ID   string
 	Name string
+	// AccountID is the account the user belongs to. The user is an operator with access to every account if it is 0.
+	AccountID int
 }
 
 // GetID returns the user ID.
@@ -15,3 +17,8 @@ func (u User) GetID() string {
 func (u User) GetName() string {
 	return u.Name
 }
+
+// GetAccountID returns the ID of the account of the user, or 0 if the user is an operator.
+func (u User) GetAccountID() int {
+	return u.AccountID
+}
@@ -0,0 +1,165 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DeliveryPending indicates a delivery waits for its next attempt.
+	DeliveryPending = "pending"
+	// DeliveryDelivered indicates the webhook accepted the event with a 2xx response.
+	DeliveryDelivered = "delivered"
+	// DeliveryDead indicates every attempt failed. Dead deliveries are only retried when replayed.
+	DeliveryDead = "dead"
+)
+
+// Webhook represents an endpoint receiving the events it is subscribed to.
+type Webhook struct {
+	ID int `json:"id"`
+	// AccountID restricts the webhook to the events of an account. The events of all accounts are delivered if it is nil.
+	AccountID *int   `json:"account_id"`
+	URL       string `json:"url"`
+	// Secret is the key of the HMAC-SHA256 signatures of the deliveries. It is stored encrypted in SecretEncrypted.
+	Secret          string `json:"-" db:"-"`
+	SecretEncrypted []byte `json:"-"`
+	// PreviousSecret is the secret replaced by the last rotation. Deliveries are signed with it as well until it expires.
+	// It is stored encrypted in PreviousSecretEncrypted.
+	PreviousSecret          string     `json:"-" db:"-"`
+	PreviousSecretEncrypted []byte     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	// EventTypes are the types of the events delivered to the webhook. Every event is delivered if it is empty.
+	EventTypes EventTypes `json:"event_types"`
+	Enabled    bool       `json:"enabled"`
+	// FailureCount is the number of consecutive failed delivery attempts. The webhook is disabled when it reaches a limit.
+	FailureCount int `json:"failure_count"`
+	// DisabledAt is when the webhook was disabled automatically, and DisabledReason why.
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Version        int        `json:"version"`
+}
+
+// Secrets returns the secrets signing the deliveries at the given time: the current one, and the previous one
+// until it expires.
+func (w Webhook) Secrets(now time.Time) []string {
+	if w.PreviousSecret != "" && w.PreviousSecretExpiresAt != nil && now.Before(*w.PreviousSecretExpiresAt) {
+		return []string{w.Secret, w.PreviousSecret}
+	}
+	return []string{w.Secret}
+}
+
+// Accepts returns whether an event is delivered to the webhook.
+func (w Webhook) Accepts(event Event) bool {
+	if !w.Enabled {
+		return false
+	}
+	if w.AccountID != nil && (event.AccountID == nil || *event.AccountID != *w.AccountID) {
+		return false
+	}
+	return w.EventTypes.Match(event.Type)
+}
+
+// EventTypes represents the types of the events a webhook is subscribed to.
+// A type ending with ".*" matches every event of a resource, e.g. "domain.*".
+type EventTypes []string
+
+// Match returns whether an event type is one of the types. Every type matches empty types.
+func (t EventTypes) Match(eventType string) bool {
+	if len(t) == 0 {
+		return true
+	}
+	for _, pattern := range t {
+		if pattern == eventType || strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value stores the types as a JSON array.
+func (t EventTypes) Value() (driver.Value, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(t)
+}
+
+// Scan reads the types from a JSON array.
+func (t *EventTypes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	}
+	return fmt.Errorf("cannot scan %T into EventTypes", value)
+}
+
+// WebhookDelivery represents the delivery of an event to a webhook.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int    `json:"webhook_id"`
+	EventID   int64  `json:"event_id"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// NextAttemptAt is when the delivery is attempted next if it is pending.
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	// ResponseStatus is the status code of the response to the last attempt, or 0 if there was no response.
+	ResponseStatus int       `json:"response_status"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name of the WebhookDelivery model.
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// WebhookAttempt represents an attempt of a delivery, with snippets of the request and of the response.
+type WebhookAttempt struct {
+	ID              int64   `json:"id"`
+	DeliveryID      int64   `json:"delivery_id"`
+	RequestHeaders  Headers `json:"request_headers"`
+	RequestBody     string  `json:"request_body"`
+	ResponseStatus  int     `json:"response_status"`
+	ResponseHeaders Headers `json:"response_headers"`
+	// ResponseBody is the beginning of the body of the response.
+	ResponseBody string `json:"response_body"`
+	Error        string `json:"error,omitempty"`
+	// Duration is the duration of the attempt in milliseconds.
+	Duration  int       `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name of the WebhookAttempt model.
+func (WebhookAttempt) TableName() string {
+	return "webhook_attempt"
+}
+
+// Headers represents the headers of an HTTP request or response, with the first value of each header.
+type Headers map[string]string
+
+// Value stores the headers as a JSON object.
+func (h Headers) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(h)
+}
+
+// Scan reads the headers from a JSON object.
+func (h *Headers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	}
+	return fmt.Errorf("cannot scan %T into Headers", value)
+}
@@ -0,0 +1,110 @@
+package errors
+
+import "net/http"
+
+// The error codes identify the kinds of errors for clients that need to handle them specifically.
+// A code is never renamed or reused for a different kind of error once it is released.
+const (
+	// CodeBadRequest is the error code of the requests in a bad format.
+	CodeBadRequest = "bad_request"
+	// CodeInvalidInput is the error code of the requests with data failing validation.
+	CodeInvalidInput = "invalid_input"
+	// CodeInvalidRequest is the error code of the requests that do not match the API specification.
+	CodeInvalidRequest = "invalid_request"
+	// CodeUnauthorized is the error code of the requests that are not authenticated.
+	CodeUnauthorized = "unauthorized"
+	// CodeForbidden is the error code of the requests that are not authorized.
+	CodeForbidden = "forbidden"
+	// CodeQuotaExceeded is the error code of the requests exceeding the limits of the plan of an account.
+	CodeQuotaExceeded = "quota_exceeded"
+	// CodeNotFound is the error code of the requests for resources that do not exist.
+	CodeNotFound = "not_found"
+	// CodeMethodNotAllowed is the error code of the requests with a method that the resource does not support.
+	CodeMethodNotAllowed = "method_not_allowed"
+	// CodeConflict is the error code of the requests conflicting with the state of the server.
+	CodeConflict = "conflict"
+	// CodeIdempotencyKeyReused is the error code of the requests reusing an idempotency key with a different request.
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	// CodeRequestInProgress is the error code of the requests retried while the original request is still in progress.
+	CodeRequestInProgress = "request_in_progress"
+	// CodeAlreadyExists is the error code of the requests creating a resource with the same unique values as an existing one.
+	CodeAlreadyExists = "already_exists"
+	// CodeStillReferenced is the error code of the requests changing a resource that other resources still refer to.
+	CodeStillReferenced = "still_referenced"
+	// CodeVersionConflict is the error code of the requests changing a resource that is not at the expected version.
+	CodeVersionConflict = "version_conflict"
+	// CodeUnsupportedMediaType is the error code of the requests with a body in a media type that is not supported.
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	// CodeInvalidReference is the error code of the requests referring to resources that do not exist.
+	CodeInvalidReference = "invalid_reference"
+	// CodeConstraintViolation is the error code of the requests with data violating a constraint of the database.
+	CodeConstraintViolation = "constraint_violation"
+	// CodeFailedDependency is the error code of the operations not applied because another operation failed.
+	CodeFailedDependency = "failed_dependency"
+	// CodeInternalError is the error code of the requests failing because of an unexpected error.
+	CodeInternalError = "internal_error"
+	// CodeUpstreamError is the error code of the requests failing because a service the server depends on failed.
+	CodeUpstreamError = "upstream_error"
+	// CodeTransactionConflict is the error code of the requests failing because of a concurrent request.
+	CodeTransactionConflict = "transaction_conflict"
+	// CodeServiceUnavailable is the error code of the requests failing because the server is temporarily unavailable.
+	CodeServiceUnavailable = "service_unavailable"
+	// CodeTimeout is the error code of the requests that took too long to process.
+	CodeTimeout = "timeout"
+)
+
+// ProblemTypeBase is the prefix of the URIs identifying the problem types of error codes in problem details.
+const ProblemTypeBase = "urn:problem-type:"
+
+// catalog lists the titles of the kinds of errors identified by the error codes.
+var catalog = map[string]string{
+	CodeBadRequest:           "Bad request",
+	CodeInvalidInput:         "Invalid input",
+	CodeInvalidRequest:       "Invalid request",
+	CodeUnauthorized:         "Not authenticated",
+	CodeForbidden:            "Not authorized",
+	CodeQuotaExceeded:        "Quota exceeded",
+	CodeNotFound:             "Resource not found",
+	CodeMethodNotAllowed:     "Method not allowed",
+	CodeConflict:             "Conflict",
+	CodeIdempotencyKeyReused: "Idempotency key reused",
+	CodeRequestInProgress:    "Request in progress",
+	CodeAlreadyExists:        "Already exists",
+	CodeStillReferenced:      "Still referenced",
+	CodeVersionConflict:      "Version conflict",
+	CodeUnsupportedMediaType: "Unsupported media type",
+	CodeInvalidReference:     "Invalid reference",
+	CodeConstraintViolation:  "Constraint violation",
+	CodeFailedDependency:     "Failed dependency",
+	CodeInternalError:        "Internal error",
+	CodeUpstreamError:        "Upstream error",
+	CodeTransactionConflict:  "Transaction conflict",
+	CodeServiceUnavailable:   "Service unavailable",
+	CodeTimeout:              "Timeout",
+}
+
+// statusCodes maps HTTP statuses to the codes of the errors that are not given a more specific code.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:           CodeBadRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusForbidden:            CodeForbidden,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusMethodNotAllowed:     CodeMethodNotAllowed,
+	http.StatusConflict:             CodeConflict,
+	http.StatusPreconditionFailed:   CodeVersionConflict,
+	http.StatusUnsupportedMediaType: CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:  CodeConstraintViolation,
+	http.StatusFailedDependency:     CodeFailedDependency,
+	http.StatusInternalServerError:  CodeInternalError,
+	http.StatusBadGateway:           CodeUpstreamError,
+	http.StatusServiceUnavailable:   CodeServiceUnavailable,
+	http.StatusGatewayTimeout:       CodeTimeout,
+}
+
+// codeOf returns the error code of an error response, falling back to the code of its status.
+func codeOf(res ErrorResponse) string {
+	if res.Code != "" {
+		return res.Code
+	}
+	return statusCodes[res.Status]
+}
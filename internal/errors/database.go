@@ -0,0 +1,69 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"regexp"
+	"strings"
+)
+
+// constraintViolation describes the database constraint violated by a request.
+type constraintViolation struct {
+	Constraint string   `json:"constraint,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+}
+
+// keyDetail matches the key columns in the details of unique and foreign key violations,
+// e.g. `Key (account_id, name)=(1, example.com) already exists.`
+var keyDetail = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+// databaseError translates an error returned by the database into an error response.
+// It returns false if the error is not a database error with a meaningful response.
+// The details of the responses name the violated constraint and the fields of the key, but not their values.
+func databaseError(err error) (ErrorResponse, bool) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout(""), true
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return ErrorResponse{}, false
+	}
+
+	violation := constraintViolation{Constraint: pqErr.Constraint}
+	if m := keyDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+		violation.Fields = strings.Split(m[1], ", ")
+	} else if pqErr.Column != "" {
+		violation.Fields = []string{pqErr.Column}
+	}
+
+	var res ErrorResponse
+	switch pqErr.Code.Name() {
+	case "unique_violation", "exclusion_violation":
+		res = AlreadyExists("")
+	case "foreign_key_violation":
+		if strings.Contains(pqErr.Detail, "is still referenced") {
+			res = StillReferenced("")
+		} else {
+			res = InvalidReference("")
+		}
+	case "check_violation", "not_null_violation", "string_data_right_truncation", "numeric_value_out_of_range":
+		res = ConstraintViolation("")
+	case "serialization_failure", "deadlock_detected", "lock_not_available":
+		return TransactionConflict(""), true
+	case "query_canceled":
+		return Timeout(""), true
+	case "too_many_connections", "admin_shutdown", "crash_shutdown", "cannot_connect_now":
+		return ServiceUnavailable(""), true
+	default:
+		if pqErr.Code.Class() == "08" {
+			// connection exception
+			return ServiceUnavailable(""), true
+		}
+		return ErrorResponse{}, false
+	}
+	if violation.Constraint != "" || len(violation.Fields) > 0 {
+		res.Details = violation
+	}
+	return res, true
+}
@@ -0,0 +1,67 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_databaseError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		ok      bool
+		status  int
+		code    string
+		details interface{}
+	}{
+		{"unique violation", &pq.Error{Code: "23505", Constraint: "domain_name_key", Detail: "Key (account_id, name)=(1, example.com) already exists."},
+			true, http.StatusConflict, CodeAlreadyExists, constraintViolation{"domain_name_key", []string{"account_id", "name"}}},
+		{"exclusion violation", &pq.Error{Code: "23P01", Constraint: "booking_overlap"},
+			true, http.StatusConflict, CodeAlreadyExists, constraintViolation{"booking_overlap", nil}},
+		{"missing reference", &pq.Error{Code: "23503", Constraint: "domain_account_id_fkey", Detail: `Key (account_id)=(5) is not present in table "account".`},
+			true, http.StatusUnprocessableEntity, CodeInvalidReference, constraintViolation{"domain_account_id_fkey", []string{"account_id"}}},
+		{"still referenced", &pq.Error{Code: "23503", Constraint: "domain_account_id_fkey", Detail: `Key (id)=(5) is still referenced from table "domain".`},
+			true, http.StatusConflict, CodeStillReferenced, constraintViolation{"domain_account_id_fkey", []string{"id"}}},
+		{"check violation", &pq.Error{Code: "23514", Constraint: "dns_record_ttl_check"},
+			true, http.StatusUnprocessableEntity, CodeConstraintViolation, constraintViolation{"dns_record_ttl_check", nil}},
+		{"not null violation", &pq.Error{Code: "23502", Column: "name"},
+			true, http.StatusUnprocessableEntity, CodeConstraintViolation, constraintViolation{"", []string{"name"}}},
+		{"value too long", &pq.Error{Code: "22001"},
+			true, http.StatusUnprocessableEntity, CodeConstraintViolation, nil},
+		{"numeric value out of range", &pq.Error{Code: "22003"},
+			true, http.StatusUnprocessableEntity, CodeConstraintViolation, nil},
+		{"serialization failure", &pq.Error{Code: "40001"},
+			true, http.StatusServiceUnavailable, CodeTransactionConflict, nil},
+		{"deadlock", &pq.Error{Code: "40P01"},
+			true, http.StatusServiceUnavailable, CodeTransactionConflict, nil},
+		{"lock not available", &pq.Error{Code: "55P03"},
+			true, http.StatusServiceUnavailable, CodeTransactionConflict, nil},
+		{"statement timeout", &pq.Error{Code: "57014"},
+			true, http.StatusGatewayTimeout, CodeTimeout, nil},
+		{"context deadline", fmt.Errorf("query: %w", context.DeadlineExceeded),
+			true, http.StatusGatewayTimeout, CodeTimeout, nil},
+		{"too many connections", &pq.Error{Code: "53300"},
+			true, http.StatusServiceUnavailable, CodeServiceUnavailable, nil},
+		{"shutdown", &pq.Error{Code: "57P01"},
+			true, http.StatusServiceUnavailable, CodeServiceUnavailable, nil},
+		{"connection failure", &pq.Error{Code: "08006"},
+			true, http.StatusServiceUnavailable, CodeServiceUnavailable, nil},
+		{"wrapped", fmt.Errorf("create domain: %w", &pq.Error{Code: "23505", Constraint: "domain_name_key"}),
+			true, http.StatusConflict, CodeAlreadyExists, constraintViolation{"domain_name_key", nil}},
+		{"syntax error", &pq.Error{Code: "42601"}, false, 0, "", nil},
+		{"other error", fmt.Errorf("test"), false, 0, "", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, ok := databaseError(tc.err)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.status, res.Status)
+			assert.Equal(t, tc.code, res.Code)
+			assert.Equal(t, tc.details, res.Details)
+		})
+	}
+}
@@ -2,13 +2,19 @@ package errors
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/i18n"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"strings"
 )
 
 // Handler creates a middleware that handles panics and errors encountered during HTTP request processing.
@@ -26,12 +32,19 @@ func Handler(logger log.Logger) routing.Handler {
 			}
 
 			if err != nil {
-				res := buildErrorResponse(err)
-				if res.StatusCode() == http.StatusInternalServerError {
-					l.Errorf("encountered internal server error: %v", err)
+				locale := i18n.FromContext(c.Request.Context())
+				res := buildErrorResponse(localize(err, locale))
+				res.Message = locale.Translate(res.Code, res.Message)
+				if res.StatusCode() >= http.StatusInternalServerError {
+					l.Errorf("encountered server error: %v", err)
 				}
-				c.Response.WriteHeader(res.StatusCode())
-				if err = c.Write(res); err != nil {
+				if acceptsProblem(c.Request.Header.Get("Accept")) {
+					err = writeProblem(c.Response, res.Problem(log.RequestID(c.Request.Context())))
+				} else {
+					c.Response.WriteHeader(res.StatusCode())
+					err = c.Write(res)
+				}
+				if err != nil {
 					l.Errorf("failed writing error response: %v", err)
 				}
 				c.Abort() // skip any pending handlers since an error has occurred
@@ -42,13 +55,23 @@ func Handler(logger log.Logger) routing.Handler {
 	}
 }
 
-// buildErrorResponse builds an error response from an error.
+// buildErrorResponse builds an error response from an error. The response is given the code of its status
+// if it has no more specific code.
 func buildErrorResponse(err error) ErrorResponse {
+	res := errorResponse(err)
+	res.Code = codeOf(res)
+	return res
+}
+
+// errorResponse converts an error into an error response.
+func errorResponse(err error) ErrorResponse {
 	switch err.(type) {
 	case ErrorResponse:
 		return err.(ErrorResponse)
 	case validation.Errors:
 		return InvalidInput(err.(validation.Errors))
+	case openapi.ValidationError:
+		return InvalidRequest(err.(openapi.ValidationError))
 	case routing.HTTPError:
 		switch err.(routing.HTTPError).StatusCode() {
 		case http.StatusNotFound:
@@ -64,5 +87,56 @@ func buildErrorResponse(err error) ErrorResponse {
 	if errors.Is(err, sql.ErrNoRows) {
 		return NotFound("")
 	}
+	if errors.Is(err, dbcontext.ErrConflict) {
+		return PreconditionFailed("")
+	}
+	if res, ok := databaseError(err); ok {
+		return res
+	}
 	return InternalServerError("")
 }
+
+// localize returns an error with the messages of its validation errors translated into the language of a locale.
+func localize(err error, locale i18n.Locale) error {
+	if errs, ok := err.(validation.Errors); ok {
+		return locale.TranslateErrors(errs)
+	}
+	return err
+}
+
+// acceptsProblem returns whether an Accept header prefers problem details (RFC 7807) to plain JSON.
+// Wildcard media ranges are ignored so that clients keep getting the legacy format unless they ask otherwise.
+func acceptsProblem(accept string) bool {
+	problem, json := 0.0, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		parts := strings.Split(mediaRange, ";")
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case MediaTypeProblem:
+			problem = q
+		case "application/json":
+			json = q
+		}
+	}
+	return problem > 0 && problem >= json
+}
+
+// writeProblem writes problem details as the response to a request.
+func writeProblem(w http.ResponseWriter, problem Problem) error {
+	data, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", MediaTypeProblem)
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(data)
+	return err
+}
@@ -4,8 +4,13 @@ import (
 	"database/sql"
 	"fmt"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/internal/i18n"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -40,6 +45,31 @@ func TestHandler(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, res.Code)
 	})
 
+	t.Run("problem details", func(t *testing.T) {
+		logger, _ := log.NewForTest()
+		handler := Handler(logger)
+		ctx, res := buildContext(handler, handlerHTTPError)
+		ctx.Request.Header.Set("Accept", "application/json;q=0.5, application/problem+json")
+		ctx.Request.Header.Set("X-Request-ID", "abc")
+		ctx.Request = ctx.Request.WithContext(log.WithRequest(ctx.Request.Context(), ctx.Request))
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.Equal(t, MediaTypeProblem, res.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"type":"urn:problem-type:not_found","title":"Resource not found","status":404,"detail":"The requested resource was not found.","instance":"abc","code":"not_found"}`, res.Body.String())
+	})
+
+	t.Run("localized messages", func(t *testing.T) {
+		logger, _ := log.NewForTest()
+		handler := Handler(logger)
+		ctx, res := buildContext(handler, content.TypeNegotiator(content.JSON), func(c *routing.Context) error {
+			return validation.Errors{"name": validation.ErrRequired, "code": validation.ErrMatchInvalid.SetMessage("must be a code")}
+		})
+		ctx.Request = ctx.Request.WithContext(i18n.WithLocale(ctx.Request.Context(), i18n.Get("de")))
+		assert.Nil(t, ctx.Next())
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.JSONEq(t, `{"status":400,"code":"invalid_input","message":"Die übermittelten Daten sind fehlerhaft.","details":[{"field":"code","error":"must be a code"},{"field":"name","error":"darf nicht leer sein"}]}`, res.Body.String())
+	})
+
 	t.Run("panic processing", func(t *testing.T) {
 		logger, entries := log.NewForTest()
 		handler := Handler(logger)
@@ -60,14 +90,39 @@ func Test_buildErrorResponse(t *testing.T) {
 	res = buildErrorResponse(validation.Errors{})
 	assert.Equal(t, http.StatusBadRequest, res.Status)
 
+	res = buildErrorResponse(openapi.ValidationError{})
+	assert.Equal(t, http.StatusBadRequest, res.Status)
+
 	res = buildErrorResponse(routing.NewHTTPError(http.StatusForbidden))
 	assert.Equal(t, http.StatusForbidden, res.Status)
 
 	res = buildErrorResponse(sql.ErrNoRows)
 	assert.Equal(t, http.StatusNotFound, res.Status)
 
+	res = buildErrorResponse(dbcontext.ErrConflict)
+	assert.Equal(t, http.StatusPreconditionFailed, res.Status)
+	assert.Equal(t, CodeVersionConflict, res.Code)
+
+	res = buildErrorResponse(&pq.Error{Code: "23505"})
+	assert.Equal(t, http.StatusConflict, res.Status)
+	assert.Equal(t, CodeAlreadyExists, res.Code)
+
 	res = buildErrorResponse(fmt.Errorf("test"))
 	assert.Equal(t, http.StatusInternalServerError, res.Status)
+
+	res = buildErrorResponse(ErrorResponse{Status: http.StatusBadGateway})
+	assert.Equal(t, CodeUpstreamError, res.Code)
+}
+
+func Test_acceptsProblem(t *testing.T) {
+	assert.False(t, acceptsProblem(""))
+	assert.False(t, acceptsProblem("*/*"))
+	assert.False(t, acceptsProblem("application/json"))
+	assert.False(t, acceptsProblem("application/problem+json;q=0"))
+	assert.False(t, acceptsProblem("application/problem+json;q=0.5, application/json"))
+	assert.True(t, acceptsProblem("application/problem+json"))
+	assert.True(t, acceptsProblem("application/json, Application/Problem+JSON"))
+	assert.True(t, acceptsProblem("application/json;q=0.8, application/problem+json; q=0.9"))
 }
 
 func buildContext(handlers ...routing.Handler) (*routing.Context, *httptest.ResponseRecorder) {
@@ -2,17 +2,61 @@ package errors
 
 import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"net/http"
 	"sort"
 )
 
 // ErrorResponse is the response that represents an error.
 type ErrorResponse struct {
-	Status  int         `json:"status"`
+	Status int `json:"status"`
+	// Code identifies the kind of error for clients that need to handle it specifically.
+	Code    string      `json:"code,omitempty"`
 	Message string      `json:"message"`
 	Details interface{} `json:"details,omitempty"`
 }
 
+// MediaTypeProblem is the media type of the error responses in the format of problem details (RFC 7807).
+const MediaTypeProblem = "application/problem+json"
+
+// Problem is the response that represents an error as problem details (RFC 7807).
+type Problem struct {
+	// Type is a URI identifying the kind of error.
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	// Status is the HTTP status of the response.
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the ID of the request that failed.
+	Instance string `json:"instance,omitempty"`
+	// Code identifies the kind of error the same as Type does, in the catalog of error codes.
+	Code   string      `json:"code"`
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// Problem returns the problem details representing the error response of the request with the given ID.
+// The type and title of the problem are taken from the catalog of error codes.
+func (e ErrorResponse) Problem(requestID string) Problem {
+	code := codeOf(e)
+	title, ok := catalog[code]
+	if !ok {
+		title = http.StatusText(e.Status)
+	}
+	typ := "about:blank"
+	if code != "" {
+		typ = ProblemTypeBase + code
+	}
+	return Problem{
+		Type:     typ,
+		Title:    title,
+		Status:   e.Status,
+		Detail:   e.Message,
+		Instance: requestID,
+		Code:     code,
+		Errors:   e.Details,
+	}
+}
+
 // Error is required by the error interface.
 func (e ErrorResponse) Error() string {
 	return e.Message
@@ -30,6 +74,7 @@ func InternalServerError(msg string) ErrorResponse {
 	}
 	return ErrorResponse{
 		Status:  http.StatusInternalServerError,
+		Code:    CodeInternalError,
 		Message: msg,
 	}
 }
@@ -41,6 +86,7 @@ func NotFound(msg string) ErrorResponse {
 	}
 	return ErrorResponse{
 		Status:  http.StatusNotFound,
+		Code:    CodeNotFound,
 		Message: msg,
 	}
 }
@@ -52,6 +98,7 @@ func Unauthorized(msg string) ErrorResponse {
 	}
 	return ErrorResponse{
 		Status:  http.StatusUnauthorized,
+		Code:    CodeUnauthorized,
 		Message: msg,
 	}
 }
@@ -63,6 +110,44 @@ func Forbidden(msg string) ErrorResponse {
 	}
 	return ErrorResponse{
 		Status:  http.StatusForbidden,
+		Code:    CodeForbidden,
+		Message: msg,
+	}
+}
+
+// QuotaExceeded creates a new error response representing a request exceeding the limits of a plan (HTTP 403)
+func QuotaExceeded(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request exceeds the limits of your plan."
+	}
+	return ErrorResponse{
+		Status:  http.StatusForbidden,
+		Code:    CodeQuotaExceeded,
+		Message: msg,
+	}
+}
+
+// PreconditionFailed creates a new error response representing a change of a resource that has been changed
+// since the client read it (HTTP 412)
+func PreconditionFailed(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource has been changed since you read it. Please read it again and retry."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionFailed,
+		Code:    CodeVersionConflict,
+		Message: msg,
+	}
+}
+
+// Conflict creates a new error response representing a request conflicting with the state of the server (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicts with the current state of the resource."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Code:    CodeConflict,
 		Message: msg,
 	}
 }
@@ -74,6 +159,94 @@ func BadRequest(msg string) ErrorResponse {
 	}
 	return ErrorResponse{
 		Status:  http.StatusBadRequest,
+		Code:    CodeBadRequest,
+		Message: msg,
+	}
+}
+
+// AlreadyExists creates a new error response representing a resource with the same unique values as an existing one (HTTP 409)
+func AlreadyExists(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "A resource with the same values already exists."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Code:    CodeAlreadyExists,
+		Message: msg,
+	}
+}
+
+// StillReferenced creates a new error response representing a change of a resource that other resources
+// still refer to (HTTP 409)
+func StillReferenced(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource is still referenced by other resources."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Code:    CodeStillReferenced,
+		Message: msg,
+	}
+}
+
+// InvalidReference creates a new error response representing a reference to a resource that does not exist (HTTP 422)
+func InvalidReference(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The data you submitted refers to a resource that does not exist."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeInvalidReference,
+		Message: msg,
+	}
+}
+
+// ConstraintViolation creates a new error response representing data violating a constraint of the database (HTTP 422)
+func ConstraintViolation(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The data you submitted violates a constraint."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeConstraintViolation,
+		Message: msg,
+	}
+}
+
+// TransactionConflict creates a new error response representing a request failing because of a concurrent
+// request (HTTP 503)
+func TransactionConflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicted with a concurrent request. Please retry."
+	}
+	return ErrorResponse{
+		Status:  http.StatusServiceUnavailable,
+		Code:    CodeTransactionConflict,
+		Message: msg,
+	}
+}
+
+// ServiceUnavailable creates a new error response representing a server that is temporarily unable to handle
+// requests (HTTP 503)
+func ServiceUnavailable(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The service is temporarily unavailable. Please retry later."
+	}
+	return ErrorResponse{
+		Status:  http.StatusServiceUnavailable,
+		Code:    CodeServiceUnavailable,
+		Message: msg,
+	}
+}
+
+// Timeout creates a new error response representing a request that took too long to process (HTTP 504)
+func Timeout(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request took too long to process."
+	}
+	return ErrorResponse{
+		Status:  http.StatusGatewayTimeout,
+		Code:    CodeTimeout,
 		Message: msg,
 	}
 }
@@ -100,7 +273,19 @@ func InvalidInput(errs validation.Errors) ErrorResponse {
 
 	return ErrorResponse{
 		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidInput,
 		Message: "There is some problem with the data you submitted.",
 		Details: details,
 	}
 }
+
+// InvalidRequest creates a new error response representing a request that does not match the API specification (HTTP 400).
+// The details list the invalid values with their JSON pointers.
+func InvalidRequest(violations openapi.ValidationError) ErrorResponse {
+	return ErrorResponse{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidRequest,
+		Message: "There is some problem with the data you submitted.",
+		Details: violations,
+	}
+}
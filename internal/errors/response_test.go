@@ -3,6 +3,8 @@ package errors
 import (
 	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/i18n"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
@@ -25,6 +27,7 @@ func TestErrorResponse_StatusCode(t *testing.T) {
 func TestInternalServerError(t *testing.T) {
 	res := InternalServerError("test")
 	assert.Equal(t, http.StatusInternalServerError, res.StatusCode())
+	assert.Equal(t, CodeInternalError, res.Code)
 	assert.Equal(t, "test", res.Error())
 	res = InternalServerError("")
 	assert.NotEmpty(t, res.Error())
@@ -33,6 +36,7 @@ func TestInternalServerError(t *testing.T) {
 func TestNotFound(t *testing.T) {
 	res := NotFound("test")
 	assert.Equal(t, http.StatusNotFound, res.StatusCode())
+	assert.Equal(t, CodeNotFound, res.Code)
 	assert.Equal(t, "test", res.Error())
 	res = NotFound("")
 	assert.NotEmpty(t, res.Error())
@@ -41,6 +45,7 @@ func TestNotFound(t *testing.T) {
 func TestUnauthorized(t *testing.T) {
 	res := Unauthorized("test")
 	assert.Equal(t, http.StatusUnauthorized, res.StatusCode())
+	assert.Equal(t, CodeUnauthorized, res.Code)
 	assert.Equal(t, "test", res.Error())
 	res = Unauthorized("")
 	assert.NotEmpty(t, res.Error())
@@ -49,19 +54,111 @@ func TestUnauthorized(t *testing.T) {
 func TestForbidden(t *testing.T) {
 	res := Forbidden("test")
 	assert.Equal(t, http.StatusForbidden, res.StatusCode())
+	assert.Equal(t, CodeForbidden, res.Code)
 	assert.Equal(t, "test", res.Error())
 	res = Forbidden("")
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestQuotaExceeded(t *testing.T) {
+	res := QuotaExceeded("test")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode())
+	assert.Equal(t, CodeQuotaExceeded, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = QuotaExceeded("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	res := PreconditionFailed("test")
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode())
+	assert.Equal(t, CodeVersionConflict, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = PreconditionFailed("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestConflict(t *testing.T) {
+	res := Conflict("test")
+	assert.Equal(t, http.StatusConflict, res.StatusCode())
+	assert.Equal(t, CodeConflict, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = Conflict("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestBadRequest(t *testing.T) {
 	res := BadRequest("test")
 	assert.Equal(t, http.StatusBadRequest, res.StatusCode())
+	assert.Equal(t, CodeBadRequest, res.Code)
 	assert.Equal(t, "test", res.Error())
 	res = BadRequest("")
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestAlreadyExists(t *testing.T) {
+	res := AlreadyExists("test")
+	assert.Equal(t, http.StatusConflict, res.StatusCode())
+	assert.Equal(t, CodeAlreadyExists, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = AlreadyExists("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestStillReferenced(t *testing.T) {
+	res := StillReferenced("test")
+	assert.Equal(t, http.StatusConflict, res.StatusCode())
+	assert.Equal(t, CodeStillReferenced, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = StillReferenced("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestInvalidReference(t *testing.T) {
+	res := InvalidReference("test")
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode())
+	assert.Equal(t, CodeInvalidReference, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = InvalidReference("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestConstraintViolation(t *testing.T) {
+	res := ConstraintViolation("test")
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode())
+	assert.Equal(t, CodeConstraintViolation, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = ConstraintViolation("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestTransactionConflict(t *testing.T) {
+	res := TransactionConflict("test")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+	assert.Equal(t, CodeTransactionConflict, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = TransactionConflict("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestServiceUnavailable(t *testing.T) {
+	res := ServiceUnavailable("test")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode())
+	assert.Equal(t, CodeServiceUnavailable, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = ServiceUnavailable("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestTimeout(t *testing.T) {
+	res := Timeout("test")
+	assert.Equal(t, http.StatusGatewayTimeout, res.StatusCode())
+	assert.Equal(t, CodeTimeout, res.Code)
+	assert.Equal(t, "test", res.Error())
+	res = Timeout("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
@@ -70,3 +167,49 @@ func TestInvalidInput(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, err.Status)
 	assert.Equal(t, []invalidField{{"abc", "1"}, {"xyz", "2"}}, err.Details)
 }
+
+func TestInvalidRequest(t *testing.T) {
+	violations := openapi.ValidationError{{In: "body", Pointer: "/name", Error: "must be of type string"}}
+	err := InvalidRequest(violations)
+	assert.Equal(t, http.StatusBadRequest, err.Status)
+	assert.Equal(t, violations, err.Details)
+}
+
+func TestErrorResponse_Problem(t *testing.T) {
+	details := []invalidField{{"name", "cannot be blank"}}
+	res := ErrorResponse{Status: http.StatusBadRequest, Code: CodeInvalidInput, Message: "test", Details: details}
+	assert.Equal(t, Problem{
+		Type:     "urn:problem-type:invalid_input",
+		Title:    "Invalid input",
+		Status:   http.StatusBadRequest,
+		Detail:   "test",
+		Instance: "abc",
+		Code:     CodeInvalidInput,
+		Errors:   details,
+	}, res.Problem("abc"))
+
+	problem := ErrorResponse{Status: http.StatusTeapot, Message: "test"}.Problem("")
+	assert.Equal(t, "about:blank", problem.Type)
+	assert.Equal(t, "I'm a teapot", problem.Title)
+	assert.Equal(t, "", problem.Code)
+}
+
+func Test_catalog(t *testing.T) {
+	// every code given to a status is in the catalog
+	for status, code := range statusCodes {
+		assert.Contains(t, catalog, code, "status %v", status)
+	}
+}
+
+func Test_defaultMessages(t *testing.T) {
+	// the default messages are in the English message catalog so that they are translated
+	en := i18n.Get(i18n.DefaultLanguage)
+	for _, res := range []ErrorResponse{
+		InternalServerError(""), NotFound(""), Unauthorized(""), Forbidden(""), QuotaExceeded(""),
+		PreconditionFailed(""), Conflict(""), BadRequest(""), InvalidInput(nil), InvalidRequest(nil),
+		AlreadyExists(""), StillReferenced(""), InvalidReference(""), ConstraintViolation(""),
+		TransactionConflict(""), ServiceUnavailable(""), Timeout(""),
+	} {
+		assert.Equal(t, res.Message, en.Message(res.Code), res.Code)
+	}
+}
@@ -0,0 +1,111 @@
+// Package event provides the transactional outbox of the changes of resources.
+//
+// Services publish an event for every change in the transaction of the change, so that an event is saved if and only
+// if the change is committed. The events are then delivered asynchronously to the webhooks subscribed to them.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Event types
+const (
+	AccountCreated = "account.created"
+	AccountUpdated = "account.updated"
+	AccountDeleted = "account.deleted"
+	AlbumCreated   = "album.created"
+	AlbumUpdated   = "album.updated"
+	AlbumDeleted   = "album.deleted"
+	DomainCreated  = "domain.created"
+	DomainUpdated  = "domain.updated"
+	DomainDeleted  = "domain.deleted"
+	// WebhookDisabled is published when a webhook is disabled because its deliveries keep failing.
+	WebhookDisabled = "webhook.disabled"
+	// WebhookTest is the type of the test events sent to webhooks on request. It is not delivered otherwise.
+	WebhookTest = "webhook.test"
+)
+
+// Types are the types of all events webhooks can subscribe to.
+var Types = []string{
+	AccountCreated, AccountUpdated, AccountDeleted,
+	AlbumCreated, AlbumUpdated, AlbumDeleted,
+	DomainCreated, DomainUpdated, DomainDeleted,
+	WebhookDisabled,
+}
+
+// Publisher saves the events about the changes of resources.
+type Publisher interface {
+	// Publish saves an event about a resource in the transaction of the context, if any.
+	// accountID is the ID of the account owning the resource, or 0 if it is not owned by an account.
+	// data is the resource after the change, or before it for deletions.
+	Publish(ctx context.Context, eventType string, accountID int, resourceID string, data interface{}) error
+}
+
+// New creates an event about a resource with the JSON encoding of data.
+func New(eventType string, accountID int, resourceID string, data interface{}) (entity.Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return entity.Event{}, err
+	}
+	event := entity.Event{
+		Type:       eventType,
+		ResourceID: resourceID,
+		Data:       encoded,
+		CreatedAt:  time.Now(),
+	}
+	if accountID != 0 {
+		event.AccountID = &accountID
+	}
+	return event, nil
+}
+
+// publisher saves events in the database.
+type publisher struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewPublisher creates a new Publisher saving events in the database.
+func NewPublisher(db *dbcontext.DB, logger log.Logger) Publisher {
+	return publisher{db, logger}
+}
+
+// Publish inserts an event record in the database, within the transaction of the context if any.
+func (p publisher) Publish(ctx context.Context, eventType string, accountID int, resourceID string, data interface{}) error {
+	event, err := New(eventType, accountID, resourceID, data)
+	if err != nil {
+		return err
+	}
+	return p.db.With(ctx).Model(&event).Insert()
+}
+
+// Recorder is a Publisher keeping the published events in memory, for testing purpose.
+type Recorder struct {
+	Events []entity.Event
+}
+
+// Publish appends an event to the recorded events.
+func (r *Recorder) Publish(ctx context.Context, eventType string, accountID int, resourceID string, data interface{}) error {
+	event, err := New(eventType, accountID, resourceID, data)
+	if err != nil {
+		return err
+	}
+	event.ID = int64(len(r.Events) + 1)
+	r.Events = append(r.Events, event)
+	return nil
+}
+
+// Types returns the types of the recorded events in order.
+func (r *Recorder) Types() []string {
+	types := []string{}
+	for _, event := range r.Events {
+		types = append(types, event.Type)
+	}
+	return types
+}
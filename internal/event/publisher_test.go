@@ -0,0 +1,69 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	event, err := New(DomainCreated, 12, "34", entity.Domain{ID: 34, AccountId: 12, Domain: "example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, DomainCreated, event.Type)
+	if assert.NotNil(t, event.AccountID) {
+		assert.Equal(t, 12, *event.AccountID)
+	}
+	assert.Equal(t, "34", event.ResourceID)
+	assert.Contains(t, string(event.Data), `"domain":"example.com"`)
+	assert.False(t, event.CreatedAt.IsZero())
+
+	event, err = New(AlbumDeleted, 0, "abc", map[string]string{"id": "abc"})
+	assert.Nil(t, err)
+	assert.Nil(t, event.AccountID)
+	assert.Equal(t, `{"id":"abc"}`, string(event.Data))
+
+	_, err = New(AlbumDeleted, 0, "abc", make(chan int))
+	assert.NotNil(t, err)
+}
+
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	assert.Nil(t, r.Publish(context.Background(), AccountCreated, 1, "1", entity.Account{ID: 1}))
+	assert.Nil(t, r.Publish(context.Background(), AccountDeleted, 1, "1", entity.Account{ID: 1}))
+	assert.Equal(t, []string{AccountCreated, AccountDeleted}, r.Types())
+	assert.Equal(t, int64(2), r.Events[1].ID)
+}
+
+func TestPublisher(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "event")
+	p := NewPublisher(db, logger)
+	ctx := context.Background()
+
+	// events are rolled back with the transaction they are published in
+	err := db.Transactional(ctx, func(ctx context.Context) error {
+		if err := p.Publish(ctx, AlbumCreated, 0, "a", map[string]string{"id": "a"}); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+	assert.Equal(t, assert.AnError, err)
+	var count int
+	assert.Nil(t, db.With(ctx).Select("COUNT(*)").From("event").Row(&count))
+	assert.Equal(t, 0, count)
+
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		return p.Publish(ctx, DomainCreated, 0, "1", map[string]string{"domain": "example.com"})
+	})
+	assert.Nil(t, err)
+	var event entity.Event
+	assert.Nil(t, db.With(ctx).Select().From("event").One(&event))
+	assert.Equal(t, DomainCreated, event.Type)
+	assert.Equal(t, `{"domain": "example.com"}`, string(event.Data))
+	assert.Nil(t, event.DispatchedAt)
+}
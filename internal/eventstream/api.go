@@ -0,0 +1,181 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+)
+
+// contentType is the media type of Server-Sent Events.
+const contentType = "text/event-stream"
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Get("/events/stream", res.stream)
+	r.Get("/accounts/<id>/events/stream", res.stream)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/events/stream", Summary: "Stream the events", Auth: true,
+		Description: "Operators receive the events of every account, and the users of an account the events of their account. " + streamDescription,
+		Params:      streamParams, Response: "", ResponseType: contentType, Errors: streamErrors},
+	{Method: "GET", Path: "/accounts/<id>/events/stream", Summary: "Stream the events of an account", Auth: true,
+		Description: "The users of other accounts are forbidden. " + streamDescription,
+		Params:      streamParams, Response: "", ResponseType: contentType, Errors: append(streamErrors, http.StatusForbidden)},
+}
+
+const streamDescription = "Every event is sent as a Server-Sent Event with its position in the order the events " +
+	"were committed as ID, the type of the event, and the event as JSON data. A comment is sent periodically to keep " +
+	"the connection open. A client reconnecting with the Last-Event-ID header is first sent the events it missed."
+
+var (
+	streamParams = []openapi.Parameter{
+		openapi.QueryParam("types", "The comma-separated types of the events to stream, e.g. domain.*,account.updated. All by default."),
+		openapi.HeaderParam("Last-Event-ID", "The Server-Sent Event ID of the last event received, to resume a stream."),
+	}
+	streamErrors = []int{http.StatusBadRequest, http.StatusServiceUnavailable}
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// stream writes the events of the account in the path as Server-Sent Events. Without an account in the path,
+// it writes the events of the account of the user, or of all accounts if the user is an operator.
+func (r resource) stream(c *routing.Context) error {
+	ctx := c.Request.Context()
+	filter, err := filterFromRequest(c)
+	if err != nil {
+		return err
+	}
+	var lastEventID int64
+	if value := c.Request.Header.Get("Last-Event-ID"); value != "" {
+		if lastEventID, err = strconv.ParseInt(value, 10, 64); err != nil || lastEventID < 0 {
+			return errors.BadRequest("Last-Event-ID must be the ID of an event received from a stream")
+		}
+	}
+
+	w := &writer{res: c.Response}
+	err = r.service.Stream(ctx, filter, lastEventID, w)
+	if err == ErrTooManyStreams {
+		return errors.ServiceUnavailable("Too many event streams are open. Please retry later.")
+	}
+	if !w.opened {
+		return err
+	}
+	// once the stream has started, the status code can no longer be changed, so errors are only logged
+	if err != nil && ctx.Err() == nil {
+		r.logger.With(ctx).Infof("event stream ended after %v events: %v", w.count, err)
+	}
+	return nil
+}
+
+// filterFromRequest returns the filter of the events of a stream from the path, the user and the "types"
+// query parameter. The users of an account are restricted to the events of their account.
+func filterFromRequest(c *routing.Context) (Filter, error) {
+	var filter Filter
+	if id := c.Param("id"); id != "" {
+		accountID, err := strconv.Atoi(id)
+		if err != nil {
+			return filter, errors.NotFound("")
+		}
+		filter.AccountID = accountID
+	}
+	user := auth.CurrentUser(c.Request.Context())
+	if user == nil {
+		return filter, errors.Unauthorized("")
+	}
+	if filter.AccountID == 0 {
+		filter.AccountID = user.GetAccountID()
+	} else if err := auth.CheckAccount(c.Request.Context(), filter.AccountID); err != nil {
+		return filter, err
+	}
+	if types := c.Query("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if !knownType(t) {
+				return filter, errors.BadRequest(fmt.Sprintf("%v is not a known event type or a wildcard like domain.*", t))
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	return filter, nil
+}
+
+// knownType returns whether a type is the type of an event or a wildcard matching one.
+func knownType(t string) bool {
+	for _, known := range event.Types {
+		if (entity.EventTypes{t}).Match(known) {
+			return true
+		}
+	}
+	return false
+}
+
+// writer writes a stream of Server-Sent Events to a response, flushing every write so that
+// the client receives every event as soon as it is written.
+type writer struct {
+	res    http.ResponseWriter
+	opened bool
+	// count is the number of events written.
+	count int
+}
+
+// Open writes the headers of the response.
+func (w *writer) Open() error {
+	header := w.res.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-cache")
+	// prevent reverse proxies like nginx from buffering the events
+	header.Set("X-Accel-Buffering", "no")
+	w.res.WriteHeader(http.StatusOK)
+	w.opened = true
+	w.flush()
+	return nil
+}
+
+// WriteEvent writes an event with its position as ID and its type, and the event as JSON data.
+func (w *writer) WriteEvent(e Event) error {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.res, "id: %v\nevent: %v\ndata: %s\n\n", e.Position, e.Type, data); err != nil {
+		return err
+	}
+	w.count++
+	w.flush()
+	return nil
+}
+
+// WriteHeartbeat writes a comment, which is ignored by clients.
+func (w *writer) WriteHeartbeat() error {
+	if _, err := io.WriteString(w.res, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	w.flush()
+	return nil
+}
+
+func (w *writer) flush() {
+	if f, ok := w.res.(http.Flusher); ok {
+		f.Flush()
+	}
+}
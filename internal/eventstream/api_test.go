@@ -0,0 +1,122 @@
+package eventstream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{}
+	repo.add(event.AccountCreated, 1)
+	repo.add(event.DomainCreated, 1)
+	repo.add(event.DomainCreated, 2)
+	repo.add(event.AlbumCreated, 0)
+	service := NewService(repo, time.Hour, 1, logger)
+	assert.Nil(t, service.Forward(context.Background()))
+	RegisterHandlers(router.Group(""), service, auth.MockAuthHandler, logger)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// the events of the account are streamed, following the last one received
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/accounts/1/events/stream?types=domain.*,account.updated", nil)
+	req = req.WithContext(ctx)
+	req.Header = auth.MockAuthHeader()
+	req.Header.Set("Last-Event-ID", "1")
+	res, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	r := bufio.NewReader(res.Body)
+	assert.Equal(t, []string{"id: 2", "event: domain.created", `data: {"id":2,"type":"domain.created","account_id":1,"resource_id":"1","data":{"id":1},"created_at":`}, readEvent(t, r))
+
+	repo.add(event.AccountUpdated, 1)
+	repo.add(event.AccountUpdated, 2)
+	repo.add(event.AlbumUpdated, 1)
+	repo.add(event.DomainDeleted, 1)
+	assert.Nil(t, service.Forward(ctx))
+	assert.Equal(t, "id: 5", readEvent(t, r)[0])
+	assert.Equal(t, "id: 8", readEvent(t, r)[0])
+
+	header := auth.MockAuthHeader()
+	header.Set("Last-Event-ID", "abc")
+	tests := []test.APITestCase{
+		{"stream unauthorized", "GET", "/events/stream", "", nil, http.StatusUnauthorized, ""},
+		{"stream invalid types", "GET", "/events/stream?types=domain.*,domain.renamed", "", auth.MockAuthHeader(), http.StatusBadRequest, `*domain.renamed is not a known event type*`},
+		{"stream invalid last event", "GET", "/events/stream", "", header, http.StatusBadRequest, ""},
+		{"stream invalid account", "GET", "/accounts/abc/events/stream", "", auth.MockAuthHeader(), http.StatusNotFound, ""},
+		{"stream other account", "GET", "/accounts/1/events/stream", "", auth.MockAccountAuthHeader(2), http.StatusForbidden, ""},
+		{"stream too many", "GET", "/events/stream", "", auth.MockAuthHeader(), http.StatusServiceUnavailable, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestAPI_accountUser(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{}
+	service := NewService(repo, time.Hour, 1, logger)
+	RegisterHandlers(router.Group(""), service, auth.MockAuthHandler, logger)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// the users of an account only receive the events of their account, even without the account in the path
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/events/stream", nil)
+	req = req.WithContext(ctx)
+	req.Header = auth.MockAccountAuthHeader(2)
+	res, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	r := bufio.NewReader(res.Body)
+	repo.add(event.DomainCreated, 1)
+	repo.add(event.DomainCreated, 2)
+	repo.add(event.AlbumCreated, 0)
+	repo.add(event.DomainDeleted, 2)
+	assert.Nil(t, service.Forward(ctx))
+	assert.Equal(t, []string{"id: 2", "event: domain.created", `data: {"id":2,"type":"domain.created","account_id":2,"resource_id":"1","data":{"id":1},"created_at":`}, readEvent(t, r))
+	assert.Equal(t, "id: 4", readEvent(t, r)[0])
+}
+
+// readEvent reads the lines of the next event of a stream, with the prefix of its data up to the creation time.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.Nil(t, err) {
+			return lines
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		if i := strings.Index(line, `"created_at":`); i >= 0 {
+			line = line[:i+len(`"created_at":`)]
+		}
+		lines = append(lines, line)
+	}
+}
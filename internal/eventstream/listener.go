@@ -0,0 +1,67 @@
+package eventstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// channel is the channel of the notifications of new events, with their IDs as payloads.
+	// The notifications are sent by a trigger of the event table when the transactions saving the events commit.
+	// Their payloads are not used, since the events are forwarded in the order of their positions.
+	channel = "event"
+	// pingInterval is the interval at which an idle connection to the database is checked.
+	pingInterval = 90 * time.Second
+	// minReconnectInterval and maxReconnectInterval bound the delays between attempts to reconnect to the database.
+	minReconnectInterval = 10 * time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// Listen forwards the events saved by every server instance to the streams of the service until the context is
+// canceled. It listens to the notifications of new events on a dedicated connection to the database, which is
+// reopened when it fails. The events saved while the connection was lost are forwarded once it is reopened.
+func Listen(ctx context.Context, dsn string, service Service, logger log.Logger) {
+	listener := pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.With(ctx).Errorf("event listener failed: %v", err)
+		}
+	})
+	defer func() {
+		if err := listener.Close(); err != nil {
+			logger.With(ctx).Error(err)
+		}
+	}()
+	if err := listener.Listen(channel); err != nil {
+		logger.With(ctx).Errorf("failed to listen to the notifications of events: %v", err)
+		return
+	}
+	// the events are forwarded from the last one positioned once the notifications are received
+	if err := service.Forward(ctx); err != nil && ctx.Err() == nil {
+		logger.With(ctx).Errorf("failed to forward events: %v", err)
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if err := handle(ctx, service, n); err != nil && ctx.Err() == nil {
+				logger.With(ctx).Errorf("failed to forward events: %v", err)
+			}
+		case <-ticker.C:
+			// a failed ping makes the listener reconnect, and the failure is logged by the event callback
+			go func() { _ = listener.Ping() }()
+		}
+	}
+}
+
+// handle forwards the events committed since the last notification. A nil notification signals that the connection
+// was reopened, and the events saved in the meantime are forwarded the same way.
+func handle(ctx context.Context, service Service, n *pq.Notification) error {
+	return service.Forward(ctx)
+}
@@ -0,0 +1,39 @@
+package eventstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_handle(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	repo.add(event.DomainCreated, 1)
+	repo.add(event.DomainUpdated, 1)
+	s := NewService(repo, time.Hour, 10, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := newMockWriter()
+	go func() {
+		_ = s.Stream(ctx, Filter{}, 0, w)
+	}()
+	for s.(*service).count() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a notification forwards the events committed since the last one
+	assert.Nil(t, handle(ctx, s, &pq.Notification{Channel: channel, Extra: "1"}))
+	assert.Equal(t, "event 1", w.next(t))
+	assert.Equal(t, "event 2", w.next(t))
+
+	// a reconnection forwards the events saved in the meantime
+	repo.add(event.DomainDeleted, 1)
+	assert.Nil(t, handle(ctx, s, nil))
+	assert.Equal(t, "event 3", w.next(t))
+}
@@ -0,0 +1,81 @@
+package eventstream
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Event is an event of the event log with its position in the streams.
+type Event struct {
+	entity.Event
+	// Position orders the events by the commits of the transactions saving them, unlike their IDs.
+	Position int64 `json:"-"`
+}
+
+// Repository encapsulates the logic to read the event log from the data source.
+type Repository interface {
+	// AssignPositions gives positions to the committed events without one. The positions follow those of every
+	// event positioned before, so that a stream resuming after a position misses none of the events committed later.
+	AssignPositions(ctx context.Context) error
+	// LastPosition returns the last position given to an event, or 0 if there is none.
+	LastPosition(ctx context.Context) (int64, error)
+	// QueryAfter returns at most limit events following the specified position, in the order of their positions.
+	// The events of all accounts are returned if accountID is 0.
+	QueryAfter(ctx context.Context, accountID int, position int64, limit int) ([]Event, error)
+}
+
+// repository reads the event log from the database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new event log repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// AssignPositions numbers the event records without positions in the order of their IDs. The records of the
+// transactions still in progress are not visible, and are numbered by a later call once committed. Concurrent calls
+// are serialized by an advisory lock held until their positions are committed, so that the positions given by a call
+// are both greater and committed later than those given by the calls before.
+func (r repository) AssignPositions(ctx context.Context) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := r.db.With(ctx).NewQuery(`SELECT pg_advisory_xact_lock(hashtext('event_position'))`).Execute(); err != nil {
+			return err
+		}
+		_, err := r.db.With(ctx).NewQuery(`UPDATE event SET position = p.position
+			FROM (SELECT id, nextval('event_position_seq') AS position
+				FROM (SELECT id FROM event WHERE position IS NULL ORDER BY id) AS e) AS p
+			WHERE event.id = p.id`).Execute()
+		return err
+	})
+}
+
+// LastPosition returns the greatest position of the event records in the database.
+func (r repository) LastPosition(ctx context.Context) (int64, error) {
+	var position int64
+	err := r.db.With(ctx).Select("COALESCE(MAX(position), 0)").From("event").Row(&position)
+	return position, err
+}
+
+// QueryAfter retrieves the event records following the specified position from the database.
+func (r repository) QueryAfter(ctx context.Context, accountID int, position int64, limit int) ([]Event, error) {
+	var exp dbx.Expression = dbx.NewExp("position > {:position}", dbx.Params{"position": position})
+	if accountID != 0 {
+		exp = dbx.And(exp, dbx.HashExp{"account_id": accountID})
+	}
+	var events []Event
+	err := r.db.With(ctx).
+		Select().
+		From("event").
+		Where(exp).
+		OrderBy("position").
+		Limit(int64(limit)).
+		All(&events)
+	return events, err
+}
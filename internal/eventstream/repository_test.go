@@ -0,0 +1,80 @@
+package eventstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "event")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	p := event.NewPublisher(db, logger)
+	for _, accountID := range []int{1, 2, 1, 0} {
+		assert.Nil(t, p.Publish(ctx, event.DomainCreated, accountID, "1", map[string]int{"id": 1}))
+	}
+
+	// the events are not queried before they are positioned
+	events, err := repo.QueryAfter(ctx, 0, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events))
+	last, err := repo.LastPosition(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), last)
+
+	// query after
+	assert.Nil(t, repo.AssignPositions(ctx))
+	events, err = repo.QueryAfter(ctx, 0, 0, 10)
+	assert.Nil(t, err)
+	if !assert.Equal(t, 4, len(events)) {
+		return
+	}
+	first := events[0]
+	events, err = repo.QueryAfter(ctx, 1, first.Position, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(events)) {
+		assert.Equal(t, first.ID+2, events[0].ID)
+		assert.Equal(t, first.Position+2, events[0].Position)
+	}
+	events, err = repo.QueryAfter(ctx, 0, first.Position, 2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(events)) {
+		assert.Equal(t, first.ID+1, events[0].ID)
+	}
+	last, err = repo.LastPosition(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Position+3, last)
+
+	// the events are positioned in the order their transactions commit, not in the order of their IDs
+	published, commit, done := make(chan error), make(chan struct{}), make(chan error)
+	go func() {
+		done <- db.Transactional(ctx, func(ctx context.Context) error {
+			published <- p.Publish(ctx, event.DomainUpdated, 1, "1", map[string]int{"id": 1})
+			<-commit
+			return nil
+		})
+	}()
+	assert.Nil(t, <-published)
+	assert.Nil(t, p.Publish(ctx, event.DomainDeleted, 1, "1", map[string]int{"id": 1}))
+	assert.Nil(t, repo.AssignPositions(ctx))
+	close(commit)
+	assert.Nil(t, <-done)
+	assert.Nil(t, repo.AssignPositions(ctx))
+	events, err = repo.QueryAfter(ctx, 0, last, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(events)) {
+		assert.Equal(t, event.DomainDeleted, events[0].Type)
+		assert.Equal(t, event.DomainUpdated, events[1].Type)
+		assert.True(t, events[0].ID > events[1].ID)
+		assert.Equal(t, last+1, events[0].Position)
+		assert.Equal(t, last+2, events[1].Position)
+	}
+}
@@ -0,0 +1,254 @@
+// Package eventstream streams the events of the outbox to clients with Server-Sent Events.
+//
+// Every event saved in the database is notified to all server instances (LISTEN/NOTIFY), and each instance
+// forwards the new events to the streams of its clients that they match. The events are given positions in the
+// order their transactions commit, which their IDs do not follow, and are streamed in the order of their positions.
+// A client resuming a stream with the position of the last event it received is first sent the events it missed
+// from the event log.
+package eventstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// bufferSize is the number of events a stream can fall behind before it is ended.
+	bufferSize = 100
+	// batchSize is the number of events read at a time from the event log.
+	batchSize = 100
+)
+
+// ErrTooManyStreams is returned by Stream when the maximum number of streams is open.
+var ErrTooManyStreams = errors.New("too many event streams are open")
+
+// errFellBehind is returned by Stream when a client does not read its events fast enough. The client can
+// resume the stream with the position of the last event it received.
+var errFellBehind = errors.New("the stream fell behind the events")
+
+// Service encapsulates the streaming of events.
+type Service interface {
+	// Stream writes the events matching a filter until the context is canceled or the service is closed.
+	// If lastPosition is not 0, the events following it in the event log are written first.
+	// It fails with ErrTooManyStreams without writing anything if the maximum number of streams is open.
+	Stream(ctx context.Context, filter Filter, lastPosition int64, w Writer) error
+	// Forward positions the events committed since the last call and sends the events following the last forwarded
+	// one to the streams they match. The events are forwarded once each, whichever server instance positioned them.
+	Forward(ctx context.Context) error
+	// Close ends every stream.
+	Close()
+}
+
+// Filter selects the events of a stream.
+type Filter struct {
+	// AccountID selects the events of an account. The events of all accounts are selected if it is 0.
+	AccountID int
+	// Types are the types of the events selected. Every event is selected if it is empty.
+	Types entity.EventTypes
+}
+
+// Match returns whether an event is selected by the filter. Test events sent to webhooks are never selected.
+func (f Filter) Match(e entity.Event) bool {
+	if e.Type == event.WebhookTest {
+		return false
+	}
+	if f.AccountID != 0 && (e.AccountID == nil || *e.AccountID != f.AccountID) {
+		return false
+	}
+	return f.Types.Match(e.Type)
+}
+
+// Writer writes a stream to a client.
+type Writer interface {
+	// Open starts the stream. Nothing is written before it is called.
+	Open() error
+	// WriteEvent writes an event.
+	WriteEvent(e Event) error
+	// WriteHeartbeat writes a comment keeping the connection open.
+	WriteHeartbeat() error
+}
+
+type service struct {
+	repo       Repository
+	heartbeat  time.Duration
+	maxStreams int
+	logger     log.Logger
+
+	mu      sync.Mutex
+	streams map[*stream]struct{}
+	closed  bool
+
+	// forwarding serializes the calls of Forward.
+	forwarding sync.Mutex
+	// lastPosition is the position of the last forwarded event, once started is true.
+	lastPosition int64
+	started      bool
+}
+
+// stream is an open stream of events.
+type stream struct {
+	filter Filter
+	events chan Event
+	// done is closed when the stream is ended by the service.
+	done chan struct{}
+	// err is why the stream was ended by the service, or nil if the service was closed.
+	err error
+}
+
+// NewService creates a new event stream service. A heartbeat is written to idle streams every heartbeat,
+// and at most maxStreams streams are open at the same time.
+func NewService(repo Repository, heartbeat time.Duration, maxStreams int, logger log.Logger) Service {
+	return &service{
+		repo:       repo,
+		heartbeat:  heartbeat,
+		maxStreams: maxStreams,
+		logger:     logger,
+		streams:    map[*stream]struct{}{},
+	}
+}
+
+// Stream writes the events matching a filter until the context is canceled or the service is closed.
+func (s *service) Stream(ctx context.Context, filter Filter, lastPosition int64, w Writer) error {
+	st, err := s.open(filter)
+	if err != nil {
+		return err
+	}
+	defer s.end(st, nil)
+	if err := w.Open(); err != nil {
+		return err
+	}
+
+	// the stream receives the new events while the missed ones are read, so none is lost in between.
+	// The events up to the last one read from the log are not written again when they are received.
+	for lastPosition != 0 {
+		events, err := s.repo.QueryAfter(ctx, filter.AccountID, lastPosition, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			lastPosition = e.Position
+			if !filter.Match(e.Event) {
+				continue
+			}
+			if err := w.WriteEvent(e); err != nil {
+				return err
+			}
+		}
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-st.done:
+			return st.err
+		case e := <-st.events:
+			if e.Position <= lastPosition {
+				continue
+			}
+			if err := w.WriteEvent(e); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := w.WriteHeartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// open registers a new stream. It fails if the maximum number of streams is open or the service is closed.
+func (s *service) open(filter Filter) (*stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.streams) >= s.maxStreams {
+		return nil, ErrTooManyStreams
+	}
+	st := &stream{filter: filter, events: make(chan Event, bufferSize), done: make(chan struct{})}
+	s.streams[st] = struct{}{}
+	return st, nil
+}
+
+// end unregisters a stream with the reason why it ended. It does nothing if the stream is already ended.
+func (s *service) end(st *stream, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endLocked(st, err)
+}
+
+func (s *service) endLocked(st *stream, err error) {
+	if _, ok := s.streams[st]; !ok {
+		return
+	}
+	delete(s.streams, st)
+	st.err = err
+	close(st.done)
+}
+
+// Forward positions the committed events without positions and sends the events following the last forwarded one
+// to the streams they match. The first call forwards the events positioned from then on.
+func (s *service) Forward(ctx context.Context) error {
+	s.forwarding.Lock()
+	defer s.forwarding.Unlock()
+	if !s.started {
+		position, err := s.repo.LastPosition(ctx)
+		if err != nil {
+			return err
+		}
+		s.lastPosition, s.started = position, true
+	}
+	if err := s.repo.AssignPositions(ctx); err != nil {
+		return err
+	}
+	for {
+		events, err := s.repo.QueryAfter(ctx, 0, s.lastPosition, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			s.publish(e)
+			s.lastPosition = e.Position
+		}
+		if len(events) < batchSize {
+			return nil
+		}
+	}
+}
+
+// publish sends an event to the streams it matches. A stream whose client does not keep up with the events is ended,
+// so that it never blocks the others.
+func (s *service) publish(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for st := range s.streams {
+		if !st.filter.Match(e.Event) {
+			continue
+		}
+		select {
+		case st.events <- e:
+		default:
+			s.endLocked(st, errFellBehind)
+		}
+	}
+}
+
+// Close ends every stream. No stream can be opened afterwards.
+func (s *service) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for st := range s.streams {
+		s.endLocked(st, nil)
+	}
+}
@@ -0,0 +1,293 @@
+package eventstream
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Match(t *testing.T) {
+	accountID := 1
+	domainUpdated := entity.Event{ID: 1, Type: event.DomainUpdated, AccountID: &accountID}
+	albumCreated := entity.Event{ID: 2, Type: event.AlbumCreated}
+	webhookTest := entity.Event{ID: 3, Type: event.WebhookTest, AccountID: &accountID}
+
+	assert.True(t, Filter{}.Match(domainUpdated))
+	assert.True(t, Filter{}.Match(albumCreated))
+	assert.False(t, Filter{}.Match(webhookTest))
+	assert.True(t, Filter{AccountID: 1}.Match(domainUpdated))
+	assert.False(t, Filter{AccountID: 2}.Match(domainUpdated))
+	assert.False(t, Filter{AccountID: 1}.Match(albumCreated))
+	assert.True(t, Filter{Types: entity.EventTypes{"domain.*"}}.Match(domainUpdated))
+	assert.False(t, Filter{Types: entity.EventTypes{"domain.*"}}.Match(albumCreated))
+	assert.False(t, Filter{Types: entity.EventTypes{event.WebhookTest}}.Match(webhookTest))
+}
+
+func Test_service_Stream(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, time.Hour, 10, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.Nil(t, s.Forward(ctx))
+	for i := 0; i < 4; i++ {
+		repo.add(event.DomainUpdated, i%2+1)
+	}
+	assert.Nil(t, repo.AssignPositions(ctx))
+
+	// the events of the account following the last received one are written first
+	w := newMockWriter()
+	done := make(chan error)
+	go func() {
+		done <- s.Stream(ctx, Filter{AccountID: 1}, 1, w)
+	}()
+	assert.Equal(t, "event 3", w.next(t))
+
+	// the new events of the account are written as they are forwarded, except the ones already written
+	repo.add(event.DomainUpdated, 1)
+	repo.add(event.DomainUpdated, 2)
+	assert.Nil(t, s.Forward(ctx))
+	assert.Equal(t, "event 5", w.next(t))
+
+	// the stream ends when the context is canceled
+	cancel()
+	assert.Nil(t, <-done)
+	assert.True(t, w.opened)
+}
+
+func Test_service_heartbeat(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{}, 10*time.Millisecond, 10, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newMockWriter()
+	go func() {
+		_ = s.Stream(ctx, Filter{}, 0, w)
+	}()
+	assert.Equal(t, "heartbeat", w.next(t))
+	assert.Equal(t, "heartbeat", w.next(t))
+}
+
+func Test_service_limits(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, time.Hour, 2, logger)
+	ctx := context.Background()
+
+	// at most 2 streams are open at the same time
+	slow, fast := newMockWriter(), newMockWriter()
+	slowDone, fastDone := make(chan error), make(chan error)
+	go func() {
+		slowDone <- s.Stream(ctx, Filter{}, 0, slow)
+	}()
+	go func() {
+		fastDone <- s.Stream(ctx, Filter{}, 0, fast)
+	}()
+	repo.add(event.AccountCreated, 1)
+	for s.(*service).count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	w := newMockWriter()
+	assert.Equal(t, ErrTooManyStreams, s.Stream(ctx, Filter{}, 0, w))
+	assert.False(t, w.opened)
+
+	// a stream falling behind the events is ended without blocking the others
+	assert.Nil(t, s.Forward(ctx))
+	assert.Equal(t, "event 1", fast.next(t))
+	assert.Equal(t, "event 1", slow.next(t))
+	slow.block()
+	for i := 0; i < bufferSize+2; i++ {
+		id := repo.add(event.AccountUpdated, 1)
+		assert.Nil(t, s.Forward(ctx))
+		assert.Equal(t, "event "+strconv.FormatInt(id, 10), fast.next(t))
+	}
+	slow.unblock()
+	assert.Equal(t, errFellBehind, <-slowDone)
+
+	// closing the service ends the streams and no stream can be opened anymore
+	s.Close()
+	assert.Nil(t, <-fastDone)
+	assert.Equal(t, ErrTooManyStreams, s.Stream(ctx, Filter{}, 0, w))
+}
+
+func Test_service_Forward(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, time.Hour, 10, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := newMockWriter()
+	go func() {
+		_ = s.Stream(ctx, Filter{Types: entity.EventTypes{"album.*"}}, 0, w)
+	}()
+	repo.add(event.AlbumCreated, 0)
+	assert.Nil(t, repo.AssignPositions(ctx))
+	for s.(*service).count() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the events positioned before the first call are not forwarded
+	assert.Nil(t, s.Forward(ctx))
+
+	// the events are forwarded in the order their transactions commit, not in the order of their IDs
+	id := repo.begin(event.AlbumUpdated, 0)
+	repo.add(event.AlbumDeleted, 0)
+	assert.Nil(t, s.Forward(ctx))
+	assert.Equal(t, "event 3", w.next(t))
+	repo.commit(id)
+	assert.Nil(t, s.Forward(ctx))
+	assert.Equal(t, "event 2", w.next(t))
+
+	// a client resuming after the event committed first receives the one committed later with a lower ID
+	resumed := newMockWriter()
+	go func() {
+		_ = s.Stream(ctx, Filter{Types: entity.EventTypes{"album.*"}}, 2, resumed)
+	}()
+	assert.Equal(t, "event 2", resumed.next(t))
+
+	// the events following the last forwarded one are forwarded in batches
+	for i := 0; i < batchSize+1; i++ {
+		repo.add(event.DomainUpdated, 1)
+	}
+	repo.add(event.AlbumCreated, 0)
+	assert.Nil(t, s.Forward(ctx))
+	assert.Equal(t, "event 105", w.next(t))
+	assert.Equal(t, "event 105", resumed.next(t))
+}
+
+// count returns the number of open streams.
+func (s *service) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+type mockWriter struct {
+	opened  bool
+	writes  chan string
+	blocked sync.Mutex
+}
+
+func newMockWriter() *mockWriter {
+	return &mockWriter{writes: make(chan string, 1000)}
+}
+
+func (w *mockWriter) Open() error {
+	w.opened = true
+	return nil
+}
+
+func (w *mockWriter) WriteEvent(e Event) error {
+	w.blocked.Lock()
+	defer w.blocked.Unlock()
+	w.writes <- "event " + strconv.FormatInt(e.ID, 10)
+	return nil
+}
+
+func (w *mockWriter) WriteHeartbeat() error {
+	w.writes <- "heartbeat"
+	return nil
+}
+
+// block makes the writes of events wait until unblock is called.
+func (w *mockWriter) block() {
+	w.blocked.Lock()
+}
+
+func (w *mockWriter) unblock() {
+	w.blocked.Unlock()
+}
+
+// next returns the next write, failing the test if nothing is written within a second.
+func (w *mockWriter) next(t *testing.T) string {
+	select {
+	case write := <-w.writes:
+		return write
+	case <-time.After(time.Second):
+		t.Error("no write")
+		return ""
+	}
+}
+
+type mockRepository struct {
+	mu     sync.Mutex
+	events []Event
+	// uncommitted are the IDs of the events whose transactions are not committed yet.
+	uncommitted  map[int64]bool
+	lastPosition int64
+}
+
+// add saves and commits an event of the given type and account with the next ID, and returns the ID.
+func (m *mockRepository) add(eventType string, accountID int) int64 {
+	id := m.begin(eventType, accountID)
+	m.commit(id)
+	return id
+}
+
+// begin saves an event of the given type and account with the next ID without committing it, and returns the ID.
+func (m *mockRepository) begin(eventType string, accountID int) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, _ := event.New(eventType, accountID, "1", map[string]int{"id": 1})
+	e.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, Event{Event: e})
+	if m.uncommitted == nil {
+		m.uncommitted = map[int64]bool{}
+	}
+	m.uncommitted[e.ID] = true
+	return e.ID
+}
+
+// commit commits an event saved by begin.
+func (m *mockRepository) commit(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uncommitted, id)
+}
+
+func (m *mockRepository) AssignPositions(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, e := range m.events {
+		if e.Position == 0 && !m.uncommitted[e.ID] {
+			m.lastPosition++
+			m.events[i].Position = m.lastPosition
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) LastPosition(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastPosition, nil
+}
+
+func (m *mockRepository) QueryAfter(ctx context.Context, accountID int, position int64, limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if position >= m.lastPosition {
+		return nil, nil
+	}
+	events := make([]Event, m.lastPosition)
+	for _, e := range m.events {
+		if e.Position != 0 {
+			events[e.Position-1] = e
+		}
+	}
+	var selected []Event
+	for _, e := range events[position:] {
+		if (accountID == 0 || e.AccountID != nil && *e.AccountID == accountID) && len(selected) < limit {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
@@ -1,12 +1,21 @@
 package healthcheck
 
-import routing "github.com/go-ozzo/ozzo-routing/v2"
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+)
 
 // RegisterHandlers registers the handlers that perform healthchecks.
 func RegisterHandlers(r *routing.Router, version string) {
 	r.To("GET,HEAD", "/healthcheck", healthcheck(version))
 }
 
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/healthcheck", Summary: "Check the health of the server", Response: ""},
+	{Method: "HEAD", Path: "/healthcheck", Summary: "Check the health of the server"},
+}
+
 // healthcheck responds to a healthcheck request.
 func healthcheck(version string) routing.Handler {
 	return func(c *routing.Context) error {
@@ -0,0 +1,45 @@
+//go:build ignore
+// +build ignore
+
+// This program generates locales.go from the message catalogs in the locales directory.
+// It is invoked by "go generate".
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	files, err := filepath.Glob(filepath.Join("locales", "*.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage i18n\n\n")
+	buf.WriteString("// locales contains the message catalogs in the locales directory indexed by language.\n")
+	buf.WriteString("var locales = map[string]string{\n")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		language := strings.TrimSuffix(filepath.Base(file), ".json")
+		fmt.Fprintf(&buf, "\t%q: %q,\n", language, data)
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("locales.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
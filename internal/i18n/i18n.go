@@ -0,0 +1,163 @@
+// Package i18n provides the message catalogs of the languages supported by the API and the selection
+// of the language of a request from its Accept-Language header.
+//
+// The catalogs are JSON files in the locales directory mapping message keys to messages. They are compiled
+// into locales.go by "go generate" and must all have the keys of the English catalog. A message is translated
+// only if it is the English message of its key, so that messages customized by the code are kept as they are.
+package i18n
+
+//go:generate go run gen.go
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// DefaultLanguage is the language of the messages when the client accepts none of the supported languages.
+const DefaultLanguage = "en"
+
+type contextKey int
+
+const localeKey contextKey = iota
+
+// Locale translates the English messages of the message catalogs into a language.
+type Locale struct {
+	// Language is the code of the language, e.g. "de".
+	Language string
+	messages map[string]string
+}
+
+// catalogs contains the message catalogs indexed by language.
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	for language, data := range locales {
+		messages := map[string]string{}
+		if err := json.Unmarshal([]byte(data), &messages); err != nil {
+			panic("invalid message catalog " + language + ": " + err.Error())
+		}
+		catalogs[language] = messages
+	}
+}
+
+// Languages returns the codes of the supported languages.
+func Languages() []string {
+	var languages []string
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Get returns the locale of a supported language, or the locale of the default language if it is not supported.
+func Get(language string) Locale {
+	language = strings.ToLower(language)
+	if messages, ok := catalogs[language]; ok {
+		return Locale{language, messages}
+	}
+	return Locale{DefaultLanguage, catalogs[DefaultLanguage]}
+}
+
+// Message returns the message with the given key, or an empty string if the catalog has no such message.
+func (l Locale) Message(key string) string {
+	return l.messages[key]
+}
+
+// Translate returns the translation of a message with the given key. The message is returned unchanged
+// if it is not the English message of the key, or if the key has no translation.
+func (l Locale) Translate(key, message string) string {
+	if message != catalogs[DefaultLanguage][key] {
+		return message
+	}
+	if translated, ok := l.messages[key]; ok {
+		return translated
+	}
+	return message
+}
+
+// TranslateErrors returns validation errors with their messages translated using the error codes as the keys.
+// Nested validation errors are translated as well.
+func (l Locale) TranslateErrors(errs validation.Errors) validation.Errors {
+	result := validation.Errors{}
+	for field, err := range errs {
+		switch e := err.(type) {
+		case validation.Errors:
+			result[field] = l.TranslateErrors(e)
+		case validation.Error:
+			result[field] = e.SetMessage(l.Translate(e.Code(), e.Message()))
+		default:
+			result[field] = err
+		}
+	}
+	return result
+}
+
+// Negotiate returns the locale of the supported language that is most preferred by an Accept-Language header
+// (RFC 7231). A language range matches the language it starts with, e.g. "de-AT" matches "de".
+// The locale of the default language is returned if no supported language is acceptable.
+func Negotiate(acceptLanguage string) Locale {
+	type languageRange struct {
+		language string
+		q        float64
+	}
+	var ranges []languageRange
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		parts := strings.Split(item, ";")
+		r := languageRange{strings.ToLower(strings.TrimSpace(parts[0])), 1}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		if r.language != "" && r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		if r.language == "*" {
+			break
+		}
+		language := strings.SplitN(r.language, "-", 2)[0]
+		if messages, ok := catalogs[language]; ok {
+			return Locale{language, messages}
+		}
+	}
+	return Get(DefaultLanguage)
+}
+
+// WithLocale returns a context that carries the given locale.
+func WithLocale(ctx context.Context, locale Locale) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+// FromContext returns the locale carried by a context, or the locale of the default language if there is none.
+func FromContext(ctx context.Context) Locale {
+	if locale, ok := ctx.Value(localeKey).(Locale); ok {
+		return locale
+	}
+	return Get(DefaultLanguage)
+}
+
+// Handler returns a middleware that selects the locale of a request from its Accept-Language header
+// and adds it to the request context. The language is reported in the Content-Language header of the response.
+func Handler() routing.Handler {
+	return func(c *routing.Context) error {
+		locale := Negotiate(c.Request.Header.Get("Accept-Language"))
+		c.Request = c.Request.WithContext(WithLocale(c.Request.Context(), locale))
+		c.Response.Header().Set("Content-Language", locale.Language)
+		c.Response.Header().Add("Vary", "Accept-Language")
+		return nil
+	}
+}
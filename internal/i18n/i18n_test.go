@@ -0,0 +1,121 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocales(t *testing.T) {
+	// locales.go is up to date with the catalogs in the locales directory
+	files, _ := filepath.Glob(filepath.Join("locales", "*.json"))
+	assert.Len(t, locales, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Equal(t, string(data), locales[strings.TrimSuffix(filepath.Base(file), ".json")], "run go generate")
+	}
+
+	// all catalogs translate all English messages
+	assert.Equal(t, []string{"de", "en", "es"}, Languages())
+	for _, language := range Languages() {
+		for key := range catalogs[DefaultLanguage] {
+			assert.NotEmpty(t, catalogs[language][key], "%v: %v", language, key)
+		}
+		assert.Len(t, catalogs[language], len(catalogs[DefaultLanguage]), language)
+	}
+
+	// the English messages of the validation errors are those of ozzo-validation
+	for _, err := range []validation.Error{
+		validation.ErrRequired, validation.ErrNilOrNotEmpty, validation.ErrNotNilRequired,
+		validation.ErrLengthOutOfRange, validation.ErrLengthTooLong, validation.ErrLengthTooShort,
+		validation.ErrInInvalid, validation.ErrNotInInvalid, validation.ErrMatchInvalid,
+		validation.ErrMinGreaterEqualThanRequired, validation.ErrMaxLessEqualThanRequired,
+		is.ErrEmail, is.ErrURL, is.ErrDNSName, is.ErrDomain, is.ErrIPv4, is.ErrIPv6,
+	} {
+		assert.Equal(t, err.Message(), catalogs[DefaultLanguage][err.Code()], err.Code())
+	}
+}
+
+func TestGet(t *testing.T) {
+	assert.Equal(t, "de", Get("DE").Language)
+	assert.Equal(t, DefaultLanguage, Get("fr").Language)
+	assert.Equal(t, "ist erforderlich", Get("de").Message("validation_not_nil_required"))
+	assert.Equal(t, "", Get("de").Message("unknown"))
+}
+
+func TestLocale_Translate(t *testing.T) {
+	de := Get("de")
+	assert.Equal(t, "Die angeforderte Ressource wurde nicht gefunden.", de.Translate("not_found", "The requested resource was not found."))
+	assert.Equal(t, "The album was not found.", de.Translate("not_found", "The album was not found."))
+	assert.Equal(t, "test", de.Translate("unknown", "test"))
+	assert.Equal(t, "The requested resource was not found.", Locale{}.Translate("not_found", "The requested resource was not found."))
+}
+
+func TestLocale_TranslateErrors(t *testing.T) {
+	errs := validation.Errors{
+		"name":   validation.ErrLengthOutOfRange.SetParams(map[string]interface{}{"min": 1, "max": 5}),
+		"code":   validation.ErrMatchInvalid.SetMessage("must be a valid code"),
+		"nested": validation.Errors{"0": validation.ErrRequired},
+		"other":  errors.New("is invalid"),
+	}
+	result := Get("es").TranslateErrors(errs)
+	assert.Equal(t, "la longitud debe estar entre 1 y 5", result["name"].Error())
+	assert.Equal(t, "must be a valid code", result["code"].Error())
+	assert.Equal(t, "no puede estar vacío", result["nested"].(validation.Errors)["0"].Error())
+	assert.Equal(t, "is invalid", result["other"].Error())
+	// the original errors are not changed
+	assert.Equal(t, "the length must be between 1 and 5", errs["name"].Error())
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT, en;q=0.5", "de"},
+		{"fr, es;q=0.8, de;q=0.7", "es"},
+		{"en;q=0.5, ES", "es"},
+		{"de;q=0, es;q=0.1", "es"},
+		{"*, de;q=0.5", "en"},
+		{"fr", "en"},
+		{"de;q=x", "de"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, Negotiate(tc.acceptLanguage).Language, tc.acceptLanguage)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, DefaultLanguage, FromContext(context.Background()).Language)
+	assert.Equal(t, "de", FromContext(WithLocale(context.Background(), Get("de"))).Language)
+}
+
+func TestHandler(t *testing.T) {
+	router := routing.New()
+	router.Use(Handler())
+	router.Get("/", func(c *routing.Context) error {
+		return c.Write(FromContext(c.Request.Context()).Language)
+	})
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "es-MX,es;q=0.9")
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "es", res.Body.String())
+	assert.Equal(t, "es", res.Header().Get("Content-Language"))
+	assert.Equal(t, "Accept-Language", res.Header().Get("Vary"))
+}
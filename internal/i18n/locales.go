@@ -0,0 +1,10 @@
+// Code generated by gen.go; DO NOT EDIT.
+
+package i18n
+
+// locales contains the message catalogs in the locales directory indexed by language.
+var locales = map[string]string{
+	"de": "{\n  \"already_exists\": \"Eine Ressource mit denselben Werten existiert bereits.\",\n  \"bad_request\": \"Ihre Anfrage hat ein ungültiges Format.\",\n  \"conflict\": \"Die Anfrage steht im Konflikt mit dem aktuellen Zustand der Ressource.\",\n  \"constraint_violation\": \"Die übermittelten Daten verletzen eine Einschränkung.\",\n  \"forbidden\": \"Sie sind nicht berechtigt, die angeforderte Aktion auszuführen.\",\n  \"internal_error\": \"Bei der Verarbeitung Ihrer Anfrage ist ein Fehler aufgetreten.\",\n  \"invalid_input\": \"Die übermittelten Daten sind fehlerhaft.\",\n  \"invalid_reference\": \"Die übermittelten Daten verweisen auf eine Ressource, die nicht existiert.\",\n  \"invalid_request\": \"Die übermittelten Daten sind fehlerhaft.\",\n  \"not_found\": \"Die angeforderte Ressource wurde nicht gefunden.\",\n  \"quota_exceeded\": \"Die Anfrage überschreitet die Grenzen Ihres Tarifs.\",\n  \"service_unavailable\": \"Der Dienst ist vorübergehend nicht verfügbar. Bitte versuchen Sie es später erneut.\",\n  \"still_referenced\": \"Die Ressource wird noch von anderen Ressourcen referenziert.\",\n  \"timeout\": \"Die Verarbeitung der Anfrage hat zu lange gedauert.\",\n  \"transaction_conflict\": \"Die Anfrage stand im Konflikt mit einer gleichzeitigen Anfrage. Bitte versuchen Sie es erneut.\",\n  \"unauthorized\": \"Sie müssen angemeldet sein, um die angeforderte Aktion auszuführen.\",\n  \"version_conflict\": \"Die Ressource wurde geändert, seit Sie sie gelesen haben. Bitte lesen Sie sie erneut und versuchen Sie es noch einmal.\",\n\n  \"validation_date_invalid\": \"muss ein gültiges Datum sein\",\n  \"validation_date_out_of_range\": \"das Datum liegt außerhalb des zulässigen Bereichs\",\n  \"validation_in_invalid\": \"muss ein gültiger Wert sein\",\n  \"validation_is_dns_name\": \"muss ein gültiger DNS-Name sein\",\n  \"validation_is_domain\": \"muss eine gültige Domain sein\",\n  \"validation_is_email\": \"muss eine gültige E-Mail-Adresse sein\",\n  \"validation_is_ipv4\": \"muss eine gültige IPv4-Adresse sein\",\n  \"validation_is_ipv6\": \"muss eine gültige IPv6-Adresse sein\",\n  \"validation_is_url\": \"muss eine gültige URL sein\",\n  \"validation_length_empty_required\": \"der Wert muss leer sein\",\n  \"validation_length_invalid\": \"die Länge muss genau {{.min}} betragen\",\n  \"validation_length_out_of_range\": \"die Länge muss zwischen {{.min}} und {{.max}} liegen\",\n  \"validation_length_too_long\": \"die Länge darf höchstens {{.max}} betragen\",\n  \"validation_length_too_short\": \"die Länge muss mindestens {{.min}} betragen\",\n  \"validation_match_invalid\": \"muss ein gültiges Format haben\",\n  \"validation_max_less_equal_than_required\": \"darf nicht größer als {{.threshold}} sein\",\n  \"validation_max_less_than_required\": \"muss kleiner als {{.threshold}} sein\",\n  \"validation_min_greater_equal_than_required\": \"darf nicht kleiner als {{.threshold}} sein\",\n  \"validation_min_greater_than_required\": \"muss größer als {{.threshold}} sein\",\n  \"validation_multiple_of_invalid\": \"muss ein Vielfaches von {{.base}} sein\",\n  \"validation_nil_or_not_empty_required\": \"darf nicht leer sein\",\n  \"validation_not_in_invalid\": \"darf keiner der ausgeschlossenen Werte sein\",\n  \"validation_not_nil_required\": \"ist erforderlich\",\n  \"validation_required\": \"darf nicht leer sein\",\n  \"validation_webhook_event_type\": \"muss ein bekannter Ereignistyp oder ein Platzhalter wie domain.* sein\",\n  \"validation_webhook_url\": \"muss eine http- oder https-URL sein\"\n}\n",
+	"en": "{\n  \"already_exists\": \"A resource with the same values already exists.\",\n  \"bad_request\": \"Your request is in a bad format.\",\n  \"conflict\": \"The request conflicts with the current state of the resource.\",\n  \"constraint_violation\": \"The data you submitted violates a constraint.\",\n  \"forbidden\": \"You are not authorized to perform the requested action.\",\n  \"internal_error\": \"We encountered an error while processing your request.\",\n  \"invalid_input\": \"There is some problem with the data you submitted.\",\n  \"invalid_reference\": \"The data you submitted refers to a resource that does not exist.\",\n  \"invalid_request\": \"There is some problem with the data you submitted.\",\n  \"not_found\": \"The requested resource was not found.\",\n  \"quota_exceeded\": \"The request exceeds the limits of your plan.\",\n  \"service_unavailable\": \"The service is temporarily unavailable. Please retry later.\",\n  \"still_referenced\": \"The resource is still referenced by other resources.\",\n  \"timeout\": \"The request took too long to process.\",\n  \"transaction_conflict\": \"The request conflicted with a concurrent request. Please retry.\",\n  \"unauthorized\": \"You are not authenticated to perform the requested action.\",\n  \"version_conflict\": \"The resource has been changed since you read it. Please read it again and retry.\",\n\n  \"validation_date_invalid\": \"must be a valid date\",\n  \"validation_date_out_of_range\": \"the date is out of range\",\n  \"validation_in_invalid\": \"must be a valid value\",\n  \"validation_is_dns_name\": \"must be a valid DNS name\",\n  \"validation_is_domain\": \"must be a valid domain\",\n  \"validation_is_email\": \"must be a valid email address\",\n  \"validation_is_ipv4\": \"must be a valid IPv4 address\",\n  \"validation_is_ipv6\": \"must be a valid IPv6 address\",\n  \"validation_is_url\": \"must be a valid URL\",\n  \"validation_length_empty_required\": \"the value must be empty\",\n  \"validation_length_invalid\": \"the length must be exactly {{.min}}\",\n  \"validation_length_out_of_range\": \"the length must be between {{.min}} and {{.max}}\",\n  \"validation_length_too_long\": \"the length must be no more than {{.max}}\",\n  \"validation_length_too_short\": \"the length must be no less than {{.min}}\",\n  \"validation_match_invalid\": \"must be in a valid format\",\n  \"validation_max_less_equal_than_required\": \"must be no greater than {{.threshold}}\",\n  \"validation_max_less_than_required\": \"must be less than {{.threshold}}\",\n  \"validation_min_greater_equal_than_required\": \"must be no less than {{.threshold}}\",\n  \"validation_min_greater_than_required\": \"must be greater than {{.threshold}}\",\n  \"validation_multiple_of_invalid\": \"must be multiple of {{.base}}\",\n  \"validation_nil_or_not_empty_required\": \"cannot be blank\",\n  \"validation_not_in_invalid\": \"must not be in list\",\n  \"validation_not_nil_required\": \"is required\",\n  \"validation_required\": \"cannot be blank\",\n  \"validation_webhook_event_type\": \"must be a known event type or a wildcard like domain.*\",\n  \"validation_webhook_url\": \"must be an http or https URL\"\n}\n",
+	"es": "{\n  \"already_exists\": \"Ya existe un recurso con los mismos valores.\",\n  \"bad_request\": \"Su solicitud tiene un formato incorrecto.\",\n  \"conflict\": \"La solicitud entra en conflicto con el estado actual del recurso.\",\n  \"constraint_violation\": \"Los datos que envió infringen una restricción.\",\n  \"forbidden\": \"No está autorizado para realizar la acción solicitada.\",\n  \"internal_error\": \"Se produjo un error al procesar su solicitud.\",\n  \"invalid_input\": \"Hay algún problema con los datos que envió.\",\n  \"invalid_reference\": \"Los datos que envió hacen referencia a un recurso que no existe.\",\n  \"invalid_request\": \"Hay algún problema con los datos que envió.\",\n  \"not_found\": \"No se encontró el recurso solicitado.\",\n  \"quota_exceeded\": \"La solicitud supera los límites de su plan.\",\n  \"service_unavailable\": \"El servicio no está disponible temporalmente. Vuelva a intentarlo más tarde.\",\n  \"still_referenced\": \"El recurso todavía está referenciado por otros recursos.\",\n  \"timeout\": \"El procesamiento de la solicitud tardó demasiado.\",\n  \"transaction_conflict\": \"La solicitud entró en conflicto con una solicitud simultánea. Vuelva a intentarlo.\",\n  \"unauthorized\": \"Debe autenticarse para realizar la acción solicitada.\",\n  \"version_conflict\": \"El recurso ha cambiado desde que lo leyó. Léalo de nuevo y vuelva a intentarlo.\",\n\n  \"validation_date_invalid\": \"debe ser una fecha válida\",\n  \"validation_date_out_of_range\": \"la fecha está fuera del rango permitido\",\n  \"validation_in_invalid\": \"debe ser un valor válido\",\n  \"validation_is_dns_name\": \"debe ser un nombre DNS válido\",\n  \"validation_is_domain\": \"debe ser un dominio válido\",\n  \"validation_is_email\": \"debe ser una dirección de correo electrónico válida\",\n  \"validation_is_ipv4\": \"debe ser una dirección IPv4 válida\",\n  \"validation_is_ipv6\": \"debe ser una dirección IPv6 válida\",\n  \"validation_is_url\": \"debe ser una URL válida\",\n  \"validation_length_empty_required\": \"el valor debe estar vacío\",\n  \"validation_length_invalid\": \"la longitud debe ser exactamente {{.min}}\",\n  \"validation_length_out_of_range\": \"la longitud debe estar entre {{.min}} y {{.max}}\",\n  \"validation_length_too_long\": \"la longitud no debe ser mayor que {{.max}}\",\n  \"validation_length_too_short\": \"la longitud no debe ser menor que {{.min}}\",\n  \"validation_match_invalid\": \"debe tener un formato válido\",\n  \"validation_max_less_equal_than_required\": \"no debe ser mayor que {{.threshold}}\",\n  \"validation_max_less_than_required\": \"debe ser menor que {{.threshold}}\",\n  \"validation_min_greater_equal_than_required\": \"no debe ser menor que {{.threshold}}\",\n  \"validation_min_greater_than_required\": \"debe ser mayor que {{.threshold}}\",\n  \"validation_multiple_of_invalid\": \"debe ser múltiplo de {{.base}}\",\n  \"validation_nil_or_not_empty_required\": \"no puede estar vacío\",\n  \"validation_not_in_invalid\": \"no debe ser uno de los valores excluidos\",\n  \"validation_not_nil_required\": \"es obligatorio\",\n  \"validation_required\": \"no puede estar vacío\",\n  \"validation_webhook_event_type\": \"debe ser un tipo de evento conocido o un comodín como domain.*\",\n  \"validation_webhook_url\": \"debe ser una URL http o https\"\n}\n",
+}
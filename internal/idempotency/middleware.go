@@ -0,0 +1,233 @@
+// Package idempotency provides a middleware that makes POST requests safe to retry with an Idempotency-Key header.
+//
+// The first request made with a key is processed normally and its response is saved. Retries of the request with
+// the same key get the saved response instead of being processed again, until the key expires.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is the response header that is set to "true" when a saved response is replayed.
+	HeaderReplayed = "Idempotent-Replayed"
+	// maxKeyLength is the maximum length of an idempotency key.
+	maxKeyLength = 255
+	// maxBodySize is the maximum size in bytes of the body of a request with an idempotency key,
+	// which is read in memory to be hashed. It allows the imports of zones and domains.
+	maxBodySize = 10 << 20
+)
+
+// Handler returns a middleware that saves the responses of the POST requests with an Idempotency-Key header
+// and replays them when the requests are retried. Keys are scoped to the authenticated user and expire after ttl,
+// so the middleware must be used after the authentication middleware.
+//
+// A key reused with another method, path or body, and a retry made while the original request is still in progress
+// fail with 409 (Conflict). The bodies of the requests with a key are limited to 10 MB. Requests failing with an error or a 5xx response do not save their response,
+// so that they can be retried with the same key.
+func Handler(repo Repository, ttl time.Duration, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		value := c.Request.Header.Get(HeaderKey)
+		if c.Request.Method != http.MethodPost || value == "" {
+			return c.Next()
+		}
+		user := auth.CurrentUser(c.Request.Context())
+		if user == nil {
+			return c.Next()
+		}
+		if len(value) > maxKeyLength {
+			return errors.BadRequest("The Idempotency-Key header must not be longer than 255 characters.")
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Response, c.Request.Body, maxBodySize))
+		if err != nil {
+			// the reader fails once the limit is read if the body is larger
+			if len(body) == maxBodySize {
+				return errors.BadRequest("The body of a request with an Idempotency-Key header must not be larger than 10 MB.")
+			}
+			return errors.BadRequest("")
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		now := time.Now()
+		key := entity.IdempotencyKey{
+			UserID:      user.GetID(),
+			Key:         value,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hashBody(body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		locked, err := repo.Lock(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			saved, err := repo.Get(ctx, key.UserID, key.Key)
+			if err != nil {
+				return err
+			}
+			if err := checkRetry(saved, key); err != nil {
+				return err
+			}
+			c.Abort()
+			return replay(c.Response, saved)
+		}
+
+		return process(c, repo, key, logger)
+	}
+}
+
+// process calls the pending handlers of a request locked with an idempotency key and saves the response.
+// The key is deleted if the request fails, so that it can be retried.
+func process(c *routing.Context, repo Repository, key entity.IdempotencyKey, logger log.Logger) (err error) {
+	// the response must be saved even if the client disconnects, as that is when the client retries
+	ctx := detachedContext{c.Request.Context()}
+	rw := &responseRecorder{ResponseWriter: c.Response}
+	c.Response = rw
+	completed := false
+	defer func() {
+		c.Response = rw.ResponseWriter
+		if !completed {
+			if e := repo.Delete(ctx, key.UserID, key.Key); e != nil {
+				logger.With(ctx).Errorf("failed to delete idempotency key: %v", e)
+			}
+		}
+	}()
+
+	if err = c.Next(); err != nil {
+		return err
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+		rw.header = rw.Header().Clone()
+	}
+	if rw.status >= http.StatusInternalServerError {
+		return nil
+	}
+	key.Status = rw.status
+	key.Body = rw.body.Bytes()
+	if key.Header, err = json.Marshal(rw.header); err != nil {
+		return err
+	}
+	if err = repo.Complete(ctx, key); err != nil {
+		return err
+	}
+	completed = true
+	return nil
+}
+
+// hashBody returns the hex-encoded SHA-256 hash of a request body.
+func hashBody(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// checkRetry returns an error if the request made with a saved idempotency key cannot be replayed for a retry.
+func checkRetry(saved, retry entity.IdempotencyKey) error {
+	if saved.Method != retry.Method || saved.Path != retry.Path || saved.RequestHash != retry.RequestHash {
+		res := errors.Conflict("The idempotency key has already been used for a different request.")
+		res.Code = errors.CodeIdempotencyKeyReused
+		return res
+	}
+	if saved.InProgress() {
+		res := errors.Conflict("The original request with the idempotency key is still in progress. Please retry later.")
+		res.Code = errors.CodeRequestInProgress
+		return res
+	}
+	return nil
+}
+
+// replay writes the saved response of an idempotency key.
+func replay(res http.ResponseWriter, saved entity.IdempotencyKey) error {
+	var header http.Header
+	if err := json.Unmarshal(saved.Header, &header); err != nil {
+		return err
+	}
+	for name, values := range header {
+		res.Header()[name] = values
+	}
+	res.Header().Set(HeaderReplayed, "true")
+	res.WriteHeader(saved.Status)
+	_, err := res.Write(saved.Body)
+	return err
+}
+
+// responseRecorder records the status, the header and the body of the response written through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status and the header of the response before sending them.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body of the response before sending it.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// detachedContext is a context that keeps the values of its parent but is never canceled.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline returns no deadline.
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns a nil channel as the context is never canceled.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil as the context is never canceled.
+func (detachedContext) Err() error {
+	return nil
+}
+
+// RunCleanup deletes expired idempotency keys every interval until the context is canceled.
+func RunCleanup(ctx context.Context, repo Repository, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := repo.DeleteExpired(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			logger.With(ctx).Errorf("idempotency key cleanup failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
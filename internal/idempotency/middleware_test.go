@@ -0,0 +1,122 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{keys: map[string]entity.IdempotencyKey{
+		"100/pending": {UserID: "100", Key: "pending", Method: "POST", Path: "/items", RequestHash: hashBody([]byte(`{"name":"a"}`)), ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	router.Use(auth.MockAuthHandler, Handler(repo, time.Hour, logger))
+	count := 0
+	router.Post("/items", func(c *routing.Context) error {
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := c.Read(&input); err != nil || input.Name == "" {
+			return errors.BadRequest("")
+		}
+		count++
+		c.Response.Header().Set("Location", "/items/"+strconv.Itoa(count))
+		return c.WriteWithStatus(map[string]interface{}{"id": count, "name": input.Name}, http.StatusCreated)
+	})
+	router.Put("/items", func(c *routing.Context) error {
+		count++
+		return c.Write(map[string]interface{}{"id": count})
+	})
+	withKey := func(key string) http.Header {
+		header := auth.MockAuthHeader()
+		header.Set(HeaderKey, key)
+		return header
+	}
+
+	tests := []test.APITestCase{
+		{"without key", "POST", "/items", `{"name":"a"}`, auth.MockAuthHeader(), http.StatusCreated, `{"id":1,"name":"a"}`},
+		{"first request", "POST", "/items", `{"name":"a"}`, withKey("k1"), http.StatusCreated, `{"id":2,"name":"a"}`},
+		{"retry", "POST", "/items", `{"name":"a"}`, withKey("k1"), http.StatusCreated, `{"id":2,"name":"a"}`},
+		{"other key", "POST", "/items", `{"name":"a"}`, withKey("k2"), http.StatusCreated, `{"id":3,"name":"a"}`},
+		{"different payload", "POST", "/items", `{"name":"b"}`, withKey("k1"), http.StatusConflict, `*"code":"idempotency_key_reused"*`},
+		{"in progress", "POST", "/items", `{"name":"a"}`, withKey("pending"), http.StatusConflict, `*"code":"request_in_progress"*`},
+		{"failed request", "POST", "/items", `{}`, withKey("k3"), http.StatusBadRequest, ""},
+		{"failed request retried", "POST", "/items", `{"name":"c"}`, withKey("k3"), http.StatusCreated, `{"id":4,"name":"c"}`},
+		{"not a POST", "PUT", "/items", ``, withKey("k1"), http.StatusOK, `{"id":5}`},
+		{"key too long", "POST", "/items", `{"name":"a"}`, withKey(string(bytes.Repeat([]byte("k"), 256))), http.StatusBadRequest, ""},
+		{"body too large", "POST", "/items", `{"name":"` + string(bytes.Repeat([]byte("a"), maxBodySize)) + `"}`, withKey("k4"), http.StatusBadRequest, `*must not be larger than 10 MB*`},
+		{"auth error", "POST", "/items", `{"name":"a"}`, http.Header{HeaderKey: {"k1"}}, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+
+	// replayed responses keep their headers
+	req, _ := http.NewRequest("POST", "/items", bytes.NewBufferString(`{"name":"a"}`))
+	req.Header = withKey("k1")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/items/2", res.Header().Get("Location"))
+	assert.Equal(t, "true", res.Header().Get(HeaderReplayed))
+	assert.Equal(t, 5, count)
+
+	// expired keys can be reused
+	key := repo.keys["100/k1"]
+	key.ExpiresAt = time.Now().Add(-time.Minute)
+	repo.keys["100/k1"] = key
+	test.Endpoint(t, router, test.APITestCase{"expired key", "POST", "/items", `{"name":"b"}`, withKey("k1"), http.StatusCreated, `{"id":6,"name":"b"}`})
+}
+
+type mockRepository struct {
+	keys map[string]entity.IdempotencyKey
+}
+
+func (m *mockRepository) Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error) {
+	if k, ok := m.keys[userID+"/"+key]; ok {
+		return k, nil
+	}
+	return entity.IdempotencyKey{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Lock(ctx context.Context, key entity.IdempotencyKey) (bool, error) {
+	if k, ok := m.keys[key.UserID+"/"+key.Key]; ok && k.ExpiresAt.After(key.CreatedAt) {
+		return false, nil
+	}
+	m.keys[key.UserID+"/"+key.Key] = key
+	return true, nil
+}
+
+func (m *mockRepository) Complete(ctx context.Context, key entity.IdempotencyKey) error {
+	m.keys[key.UserID+"/"+key.Key] = key
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, userID, key string) error {
+	delete(m.keys, userID+"/"+key)
+	return nil
+}
+
+func (m *mockRepository) DeleteExpired(ctx context.Context, t time.Time) error {
+	for id, key := range m.keys {
+		if key.ExpiresAt.Before(t) {
+			delete(m.keys, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access idempotency keys from the data source.
+type Repository interface {
+	// Get returns the idempotency key of a user.
+	Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error)
+	// Lock saves a new idempotency key whose request is in progress. An expired key with the same value is replaced.
+	// It returns false without saving the key if the user already has a key with the same value that has not expired.
+	Lock(ctx context.Context, key entity.IdempotencyKey) (bool, error)
+	// Complete saves the response of the request made with an idempotency key.
+	Complete(ctx context.Context, key entity.IdempotencyKey) error
+	// Delete removes an idempotency key of a user, so that the request can be made again with the key.
+	Delete(ctx context.Context, userID, key string) error
+	// DeleteExpired removes the idempotency keys that expired before the given time.
+	DeleteExpired(ctx context.Context, t time.Time) error
+}
+
+// repository persists idempotency keys in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new idempotency key repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the idempotency key of a user from the database.
+func (r repository) Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error) {
+	var k entity.IdempotencyKey
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"user_id": userID, "key": key}).One(&k)
+	return k, err
+}
+
+// Lock inserts a new idempotency key row in the database, or replaces the row of an expired key.
+// Concurrent requests with the same key are serialized by the primary key, so that only one of them gets the lock.
+func (r repository) Lock(ctx context.Context, key entity.IdempotencyKey) (bool, error) {
+	result, err := r.db.With(ctx).NewQuery(`INSERT INTO idempotency_key
+		(user_id, key, method, path, request_hash, status, created_at, expires_at)
+		VALUES ({:user_id}, {:key}, {:method}, {:path}, {:request_hash}, 0, {:created_at}, {:expires_at})
+		ON CONFLICT (user_id, key) DO UPDATE SET
+		method = EXCLUDED.method, path = EXCLUDED.path, request_hash = EXCLUDED.request_hash,
+		status = 0, header = NULL, body = NULL, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_key.expires_at <= EXCLUDED.created_at`).
+		Bind(dbx.Params{
+			"user_id":      key.UserID,
+			"key":          key.Key,
+			"method":       key.Method,
+			"path":         key.Path,
+			"request_hash": key.RequestHash,
+			"created_at":   key.CreatedAt,
+			"expires_at":   key.ExpiresAt,
+		}).
+		Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// Complete saves the response of an idempotency key row in the database.
+func (r repository) Complete(ctx context.Context, key entity.IdempotencyKey) error {
+	_, err := r.db.With(ctx).Update("idempotency_key", dbx.Params{
+		"status": key.Status,
+		"header": key.Header,
+		"body":   key.Body,
+	}, dbx.HashExp{"user_id": key.UserID, "key": key.Key}).Execute()
+	return err
+}
+
+// Delete deletes an idempotency key row of a user from the database.
+func (r repository) Delete(ctx context.Context, userID, key string) error {
+	_, err := r.db.With(ctx).Delete("idempotency_key", dbx.HashExp{"user_id": userID, "key": key}).Execute()
+	return err
+}
+
+// DeleteExpired deletes the idempotency key rows that expired before the given time from the database.
+func (r repository) DeleteExpired(ctx context.Context, t time.Time) error {
+	_, err := r.db.With(ctx).Delete("idempotency_key", dbx.NewExp("expires_at < {:t}", dbx.Params{"t": t})).Execute()
+	return err
+}
@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_key")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+	key := entity.IdempotencyKey{
+		UserID:      "100",
+		Key:         "k1",
+		Method:      "POST",
+		Path:        "/v1/accounts",
+		RequestHash: "abc",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+
+	// lock
+	locked, err := repo.Lock(ctx, key)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+	locked, err = repo.Lock(ctx, key)
+	assert.Nil(t, err)
+	assert.False(t, locked)
+	saved, err := repo.Get(ctx, "100", "k1")
+	assert.Nil(t, err)
+	assert.True(t, saved.InProgress())
+	assert.Equal(t, "abc", saved.RequestHash)
+	_, err = repo.Get(ctx, "101", "k1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// complete
+	key.Status = 201
+	key.Header = []byte(`{"Location":["/v1/accounts/1"]}`)
+	key.Body = []byte(`{"id":1}`)
+	assert.Nil(t, repo.Complete(ctx, key))
+	saved, _ = repo.Get(ctx, "100", "k1")
+	assert.Equal(t, 201, saved.Status)
+	assert.Equal(t, []byte(`{"id":1}`), saved.Body)
+
+	// expired keys are replaced
+	retry := key
+	retry.RequestHash = "def"
+	retry.CreatedAt = now.Add(2 * time.Hour)
+	retry.ExpiresAt = now.Add(3 * time.Hour)
+	locked, err = repo.Lock(ctx, retry)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+	saved, _ = repo.Get(ctx, "100", "k1")
+	assert.True(t, saved.InProgress())
+	assert.Equal(t, "def", saved.RequestHash)
+	assert.Nil(t, saved.Body)
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "100", "k1"))
+	_, err = repo.Get(ctx, "100", "k1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	locked, _ = repo.Lock(ctx, key)
+	assert.True(t, locked)
+	assert.Nil(t, repo.DeleteExpired(ctx, now.Add(2*time.Hour)))
+	_, err = repo.Get(ctx, "100", "k1")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
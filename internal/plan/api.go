@@ -0,0 +1,43 @@
+package plan
+
+import (
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Get("/accounts/<id>/usage", res.usage)
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []openapi.Route{
+	{Method: "GET", Path: "/accounts/<id>/usage", Summary: "Get the plan usage of an account", Auth: true, Response: Usage{}},
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) usage(c *routing.Context) error {
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errors.NotFound("")
+	}
+	usage, err := r.service.Usage(c.Request.Context(), accountID)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(usage)
+}
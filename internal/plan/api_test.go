@@ -0,0 +1,27 @@
+package plan
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	RegisterHandlers(router.Group(""), NewService(newMockRepository(), logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"usage", "GET", "/accounts/1/usage", "", header, http.StatusOK, `{"account_id":1,"plan":{"id":"free","name":"Free","max_domains":3,"max_api_keys":1,"requests_per_minute":60},"domains":{"used":2,"limit":3}}`},
+		{"usage unknown", "GET", "/accounts/3/usage", "", header, http.StatusNotFound, ""},
+		{"usage invalid", "GET", "/accounts/abc/usage", "", header, http.StatusNotFound, ""},
+		{"usage auth error", "GET", "/accounts/1/usage", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access plans and the resource usage of accounts from the data source.
+type Repository interface {
+	// GetByAccount returns the plan the specified account is subscribed to.
+	GetByAccount(ctx context.Context, accountID int) (entity.Plan, error)
+	// LockAccount locks the specified account until the end of the transaction of the context.
+	LockAccount(ctx context.Context, accountID int) error
+	// CountDomains returns the number of domains of the specified account.
+	CountDomains(ctx context.Context, accountID int) (int, error)
+}
+
+// repository reads plans and resource usage from database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new plan repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetByAccount reads the plan of the specified account from the database.
+func (r repository) GetByAccount(ctx context.Context, accountID int) (entity.Plan, error) {
+	var plan entity.Plan
+	err := r.db.With(ctx).
+		Select("plan.*").
+		From("plan").
+		InnerJoin("account", dbx.NewExp("account.plan_id = plan.id")).
+		Where(dbx.HashExp{"account.id": accountID}).
+		One(&plan)
+	return plan, err
+}
+
+// LockAccount locks the row of the specified account with SELECT ... FOR UPDATE.
+// sql.ErrNoRows is returned if the account does not exist.
+func (r repository) LockAccount(ctx context.Context, accountID int) error {
+	var id int
+	return r.db.With(ctx).
+		NewQuery("SELECT id FROM account WHERE id={:id} FOR UPDATE").
+		Bind(dbx.Params{"id": accountID}).
+		Row(&id)
+}
+
+// CountDomains returns the number of the domain records of the specified account in the database.
+func (r repository) CountDomains(ctx context.Context, accountID int) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("domain").Where(dbx.HashExp{"account_id": accountID}).Row(&count)
+	return count, err
+}
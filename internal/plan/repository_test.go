@@ -0,0 +1,58 @@
+package plan
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "domain", "account")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "test@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	_, err = db.DB().Insert("account", map[string]interface{}{"id": 2, "email": "pro@example.com", "plan_id": "pro", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	for i, name := range []string{"example.com", "example.org"} {
+		domain := entity.Domain{ID: i + 1, AccountId: 1, Domain: name, Health: entity.HealthUnknown, CreatedAt: now, UpdatedAt: now}
+		assert.Nil(t, db.DB().Model(&domain).Insert())
+	}
+
+	// get by account
+	plan, err := repo.GetByAccount(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.DefaultPlan, plan.ID)
+	assert.NotZero(t, plan.MaxDomains)
+	plan, err = repo.GetByAccount(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "pro", plan.ID)
+	_, err = repo.GetByAccount(ctx, 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// lock account
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		return repo.LockAccount(ctx, 1)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, sql.ErrNoRows, repo.LockAccount(ctx, 3))
+
+	// count domains
+	count, err := repo.CountDomains(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repo.CountDomains(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
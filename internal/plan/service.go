@@ -0,0 +1,101 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Quotas checks the resources of accounts against the limits of their plans.
+type Quotas interface {
+	// Check returns a quota exceeded error if the account cannot create n more resources of the given kind.
+	// It must be called in the transaction creating the resources: the account stays locked until the
+	// transaction ends, so that concurrent creations cannot exceed the limit together.
+	Check(ctx context.Context, accountID int, resource string, n int) error
+}
+
+// Service encapsulates usecase logic for plans.
+type Service interface {
+	Quotas
+	// Usage returns the plan of an account and how much of its limits the account uses.
+	Usage(ctx context.Context, accountID int) (Usage, error)
+}
+
+// Usage represents the plan of an account and how much of its limits the account uses.
+type Usage struct {
+	AccountID int         `json:"account_id"`
+	Plan      entity.Plan `json:"plan"`
+	Domains   Quota       `json:"domains"`
+}
+
+// Quota represents the usage of a limited resource. A limit of 0 means unlimited.
+type Quota struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+// Allows reports whether n more resources can be created without exceeding the limit.
+func (q Quota) Allows(n int) bool {
+	return q.Limit == 0 || q.Used+n <= q.Limit
+}
+
+// quotaExceeded represents the details of a quota exceeded error.
+type quotaExceeded struct {
+	Resource string `json:"resource"`
+	Used     int    `json:"used"`
+	Limit    int    `json:"limit"`
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new plan service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Usage returns the plan of an account and how much of its limits the account uses.
+func (s service) Usage(ctx context.Context, accountID int) (Usage, error) {
+	plan, err := s.repo.GetByAccount(ctx, accountID)
+	if err != nil {
+		return Usage{}, err
+	}
+	domains, err := s.repo.CountDomains(ctx, accountID)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		AccountID: accountID,
+		Plan:      plan,
+		Domains:   Quota{Used: domains, Limit: plan.MaxDomains},
+	}, nil
+}
+
+// Check locks the account and returns a quota exceeded error if it cannot create n more resources of the given kind.
+func (s service) Check(ctx context.Context, accountID int, resource string, n int) error {
+	if err := s.repo.LockAccount(ctx, accountID); err != nil {
+		return err
+	}
+	usage, err := s.Usage(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	var quota Quota
+	switch resource {
+	case entity.ResourceDomains:
+		quota = usage.Domains
+	default:
+		return fmt.Errorf("no quota for the resource %v", resource)
+	}
+	if quota.Allows(n) {
+		return nil
+	}
+	res := errors.QuotaExceeded(fmt.Sprintf("The %v plan allows at most %d %v.", usage.Plan.Name, quota.Limit, resource))
+	res.Details = quotaExceeded{resource, quota.Used, quota.Limit}
+	return res
+}
@@ -0,0 +1,109 @@
+package plan
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota_Allows(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota Quota
+		n     int
+		want  bool
+	}{
+		{"below", Quota{Used: 1, Limit: 3}, 1, true},
+		{"up to", Quota{Used: 1, Limit: 3}, 2, true},
+		{"above", Quota{Used: 1, Limit: 3}, 3, false},
+		{"full", Quota{Used: 3, Limit: 3}, 1, false},
+		{"unlimited", Quota{Used: 1000}, 1000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.quota.Allows(tt.n))
+		})
+	}
+}
+
+func Test_service_Usage(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(newMockRepository(), logger)
+	ctx := context.Background()
+
+	usage, err := s.Usage(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, usage.AccountID)
+	assert.Equal(t, "free", usage.Plan.ID)
+	assert.Equal(t, Quota{Used: 2, Limit: 3}, usage.Domains)
+
+	_, err = s.Usage(ctx, 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Check(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, logger)
+	ctx := context.Background()
+
+	assert.Nil(t, s.Check(ctx, 1, entity.ResourceDomains, 1))
+	assert.Equal(t, []int{1}, repo.locked)
+
+	err := s.Check(ctx, 1, entity.ResourceDomains, 2)
+	if assert.IsType(t, errors.ErrorResponse{}, err) {
+		res := err.(errors.ErrorResponse)
+		assert.Equal(t, errors.CodeQuotaExceeded, res.Code)
+		assert.Equal(t, "The Free plan allows at most 3 domains.", res.Message)
+		assert.Equal(t, quotaExceeded{entity.ResourceDomains, 2, 3}, res.Details)
+	}
+
+	// unlimited plan
+	assert.Nil(t, s.Check(ctx, 2, entity.ResourceDomains, 1000))
+
+	// unknown account
+	assert.Equal(t, sql.ErrNoRows, s.Check(ctx, 3, entity.ResourceDomains, 1))
+
+	// unknown resource
+	assert.NotNil(t, s.Check(ctx, 1, "albums", 1))
+}
+
+type mockRepository struct {
+	plans   map[int]entity.Plan
+	domains map[int]int
+	locked  []int
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		plans: map[int]entity.Plan{
+			1: {ID: "free", Name: "Free", MaxDomains: 3, MaxAPIKeys: 1, RequestsPerMinute: 60},
+			2: {ID: "enterprise", Name: "Enterprise", RequestsPerMinute: 6000},
+		},
+		domains: map[int]int{1: 2, 2: 50},
+	}
+}
+
+func (m *mockRepository) GetByAccount(ctx context.Context, accountID int) (entity.Plan, error) {
+	if plan, ok := m.plans[accountID]; ok {
+		return plan, nil
+	}
+	return entity.Plan{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) LockAccount(ctx context.Context, accountID int) error {
+	if _, ok := m.plans[accountID]; !ok {
+		return sql.ErrNoRows
+	}
+	m.locked = append(m.locked, accountID)
+	return nil
+}
+
+func (m *mockRepository) CountDomains(ctx context.Context, accountID int) (int, error) {
+	return m.domains[accountID], nil
+}
@@ -36,9 +36,10 @@ func DB(t *testing.T) *dbcontext.DB {
 }
 
 // ResetTables truncates all data in the specified tables.
+// Tables referencing the specified ones by foreign keys are truncated as well.
 func ResetTables(t *testing.T, db *dbcontext.DB, tables ...string) {
 	for _, table := range tables {
-		_, err := db.DB().TruncateTable(table).Execute()
+		_, err := db.DB().NewQuery("TRUNCATE TABLE " + db.DB().QuoteTableName(table) + " CASCADE").Execute()
 		if err != nil {
 			t.Error(err)
 			t.FailNow()
@@ -1,12 +1,14 @@
 package test
 
 import (
+	"context"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/accesslog"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
 	"net/http"
 	"net/http/httptest"
 )
@@ -29,7 +31,14 @@ func MockRouter(logger log.Logger) *routing.Router {
 		accesslog.Handler(logger),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
+		pagination.Handler(true),
 		cors.Handler(cors.AllowAll),
 	)
 	return router
 }
+
+// MockTransactional is a dbcontext.TransactionFunc for testing purpose.
+// It calls the given function directly without starting a transaction.
+func MockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
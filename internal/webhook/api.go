@@ -0,0 +1,344 @@
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/etag"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/openapi"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+// The webhooks of all accounts are managed under /webhooks, and the webhooks of an account under
+// /accounts/<id>/webhooks, where webhooks of other accounts are not found.
+const (
+	allPath         = "/webhooks"
+	allItemPath     = `/webhooks/<id:\d+>`
+	accountPath     = "/accounts/<id>/webhooks"
+	accountItemPath = `/accounts/<id>/webhooks/<webhook_id:\d+>`
+	// deliveryPath is the path of a delivery relative to the path of its webhook.
+	deliveryPath = `/deliveries/<delivery_id:\d+>`
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	for _, paths := range [][2]string{{allPath, allItemPath}, {accountPath, accountItemPath}} {
+		collection, item := paths[0], paths[1]
+		r.Get(collection, res.query)
+		r.Post(collection, res.create)
+		r.Get(item, res.get)
+		r.Patch(item, res.update)
+		r.Delete(item, res.delete)
+		r.Post(item+":rotateSecret", res.rotateSecret)
+		r.Post(item+":test", res.test)
+		r.Get(item+"/deliveries", res.queryDeliveries)
+		r.Get(item+deliveryPath, res.getDelivery)
+		r.Post(item+deliveryPath+":replay", res.replay)
+		r.Get(item+deliveryPath+"/attempts", res.queryAttempts)
+	}
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = append(routes(allPath, allItemPath, ""), routes(accountPath, accountItemPath, " of an account")...)
+
+// routes describes the routes of the webhooks under the given collection and item paths.
+// The suffix qualifies the webhooks in the summaries.
+func routes(collection, item, suffix string) []openapi.Route {
+	routes := []openapi.Route{
+		{Method: "GET", Path: collection, Summary: "List the webhooks" + suffix, Auth: true, Params: openapi.PageParams,
+			Response: openapi.Page(Webhook{})},
+		{Method: "POST", Path: collection, Summary: "Register a webhook" + suffix, Auth: true, Params: []openapi.Parameter{openapi.IdempotencyKeyParam},
+			Description: "The signing secret of the webhook is only returned in the response.",
+			Request:     CreateWebhookRequest{}, Status: http.StatusCreated, Response: WebhookWithSecret{}},
+		{Method: "GET", Path: item, Summary: "Get a webhook" + suffix, Auth: true, Params: []openapi.Parameter{openapi.IfNoneMatchParam},
+			Response: Webhook{}, Errors: []int{http.StatusNotModified}},
+		{Method: "PATCH", Path: item, Summary: "Update a webhook" + suffix, Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+			Request: UpdateWebhookRequest{}, Response: Webhook{}, Errors: []int{http.StatusPreconditionFailed}},
+		{Method: "DELETE", Path: item, Summary: "Delete a webhook" + suffix, Auth: true, Params: []openapi.Parameter{openapi.IfMatchParam},
+			Response: Webhook{}, Errors: []int{http.StatusBadRequest, http.StatusPreconditionFailed}},
+		{Method: "POST", Path: item + ":rotateSecret", Summary: "Rotate the signing secret of a webhook" + suffix, Auth: true,
+			Description: "Deliveries are signed with both the new and the previous secret for 24 hours.",
+			Params:      []openapi.Parameter{openapi.IdempotencyKeyParam}, Response: WebhookWithSecret{}},
+		{Method: "POST", Path: item + ":test", Summary: "Send a test event to a webhook" + suffix, Auth: true,
+			Params: []openapi.Parameter{openapi.IdempotencyKeyParam}, Response: Attempt{}},
+		{Method: "GET", Path: item + "/deliveries", Summary: "List the deliveries of a webhook" + suffix, Auth: true,
+			Params: openapi.Params(openapi.PageParams, []openapi.Parameter{statusParam}), Response: openapi.Page(Delivery{}),
+			Errors: []int{http.StatusBadRequest}},
+		{Method: "GET", Path: item + deliveryPath, Summary: "Get a delivery of a webhook" + suffix, Auth: true, Response: Delivery{}},
+		{Method: "POST", Path: item + deliveryPath + ":replay", Summary: "Replay a delivery of a webhook" + suffix, Auth: true,
+			Params: []openapi.Parameter{openapi.IdempotencyKeyParam}, Response: Delivery{}},
+		{Method: "GET", Path: item + deliveryPath + "/attempts", Summary: "List the attempts of a delivery of a webhook" + suffix, Auth: true,
+			Params: openapi.PageParams, Response: openapi.Page(Attempt{})},
+	}
+	// the users of an account are forbidden the webhooks of other accounts
+	for i := range routes {
+		routes[i].Errors = append(routes[i].Errors, http.StatusForbidden)
+	}
+	return routes
+}
+
+// statusParam selects the deliveries with a status.
+var statusParam = openapi.QueryParam("status", "The status of the deliveries: pending, delivered or dead.")
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	webhook, err := r.service.Get(c.Request.Context(), accountID, id)
+	if err != nil {
+		return err
+	}
+	if etag.NotModified(c.Response, c.Request, webhook.Version) {
+		return nil
+	}
+	return c.Write(webhook)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	accountID, err := accountParam(c)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	webhooks, err := r.service.Query(ctx, accountID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = webhooks
+	return c.Write(pages)
+}
+
+// create registers a webhook. The webhooks registered under the path of an account are restricted to the account.
+func (r resource) create(c *routing.Context) error {
+	accountID, err := accountParam(c)
+	if err != nil {
+		return err
+	}
+	var input CreateWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	if accountID != 0 {
+		input.AccountID = &accountID
+	}
+	webhook, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	etag.Set(c.Response, webhook.Version)
+	return c.WriteWithStatus(webhook, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	var input UpdateWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	webhook, err := r.service.Update(c.Request.Context(), accountID, id, version, input)
+	if err != nil {
+		return err
+	}
+	etag.Set(c.Response, webhook.Version)
+	return c.Write(webhook)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	version, err := etag.IfMatch(c.Request)
+	if err != nil {
+		return errors.BadRequest(err.Error())
+	}
+	webhook, err := r.service.Delete(c.Request.Context(), accountID, id, version)
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+func (r resource) rotateSecret(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	webhook, err := r.service.RotateSecret(c.Request.Context(), accountID, id)
+	if err != nil {
+		return err
+	}
+	etag.Set(c.Response, webhook.Version)
+	return c.Write(webhook)
+}
+
+// test sends a test event to a webhook and writes the attempt. A failed attempt is not an error of the request.
+func (r resource) test(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	attempt, err := r.service.Test(c.Request.Context(), accountID, id)
+	if err != nil {
+		return err
+	}
+	return c.Write(attempt)
+}
+
+// queryDeliveries writes a page of the deliveries of a webhook, newest first, optionally filtered by status.
+func (r resource) queryDeliveries(c *routing.Context) error {
+	ctx := c.Request.Context()
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	filter := DeliveryFilter{WebhookID: id, Status: c.Query("status")}
+	switch filter.Status {
+	case "", entity.DeliveryPending, entity.DeliveryDelivered, entity.DeliveryDead:
+	default:
+		return errors.BadRequest("status must be pending, delivered or dead")
+	}
+	if _, err := r.service.Get(ctx, accountID, id); err != nil {
+		return err
+	}
+	count, err := r.service.CountDeliveries(ctx, filter)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	deliveries, err := r.service.QueryDeliveries(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = deliveries
+	return c.Write(pages)
+}
+
+func (r resource) getDelivery(c *routing.Context) error {
+	delivery, err := r.delivery(c)
+	if err != nil {
+		return err
+	}
+	return c.Write(delivery)
+}
+
+// replay schedules a new series of attempts of a delivery. The delivery is attempted by the next dispatch.
+func (r resource) replay(c *routing.Context) error {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return err
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		return errors.NotFound("")
+	}
+	delivery, err := r.service.Replay(c.Request.Context(), accountID, id, deliveryID)
+	if err != nil {
+		return err
+	}
+	return c.Write(delivery)
+}
+
+// queryAttempts writes a page of the attempts of a delivery, newest first, with snippets of their requests and responses.
+func (r resource) queryAttempts(c *routing.Context) error {
+	ctx := c.Request.Context()
+	delivery, err := r.delivery(c)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.CountAttempts(ctx, delivery.ID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	attempts, err := r.service.QueryAttempts(ctx, delivery.ID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = attempts
+	return c.Write(pages)
+}
+
+// delivery returns the delivery identified by the path of a request.
+func (r resource) delivery(c *routing.Context) (Delivery, error) {
+	accountID, id, err := webhookParams(c)
+	if err != nil {
+		return Delivery{}, err
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		return Delivery{}, errors.NotFound("")
+	}
+	return r.service.GetDelivery(c.Request.Context(), accountID, id, deliveryID)
+}
+
+// accountParam returns the ID of the account in the path of a request, or 0 if the path is not under an account.
+// The users of an account are forbidden the paths of other accounts and those not under an account.
+func accountParam(c *routing.Context) (int, error) {
+	accountID := 0
+	if c.Param("id") != "" {
+		var err error
+		if accountID, err = intParam(c, "id"); err != nil {
+			return 0, err
+		}
+	}
+	return accountID, auth.CheckAccount(c.Request.Context(), accountID)
+}
+
+// webhookParams returns the IDs of the account and of the webhook in the path of a request.
+// The account ID is 0 if the path is not under an account. The users of an account are forbidden
+// the paths of other accounts and those not under an account.
+func webhookParams(c *routing.Context) (accountID, id int, err error) {
+	if c.Param("webhook_id") == "" {
+		if id, err = intParam(c, "id"); err != nil {
+			return 0, 0, err
+		}
+		return 0, id, auth.CheckAccount(c.Request.Context(), 0)
+	}
+	if accountID, err = intParam(c, "id"); err != nil {
+		return 0, 0, err
+	}
+	if id, err = intParam(c, "webhook_id"); err != nil {
+		return 0, 0, err
+	}
+	return accountID, id, auth.CheckAccount(c.Request.Context(), accountID)
+}
+
+// intParam returns the integer value of a path parameter. It fails with a 404 error if the value is not an integer.
+func intParam(c *routing.Context, name string) (int, error) {
+	value, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, errors.NotFound("")
+	}
+	return value, nil
+}
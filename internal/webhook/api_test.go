@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	now := time.Now()
+	accountID := 1
+	repo := &mockRepository{
+		webhooks: []entity.Webhook{
+			{ID: 1, URL: "https://example.com/hook", Secret: "whsec_123", EventTypes: entity.EventTypes{"domain.*"}, Enabled: true, CreatedAt: now, UpdatedAt: now, Version: 1},
+			{ID: 2, AccountID: &accountID, URL: receiver.URL, Secret: "whsec_456", Enabled: true, CreatedAt: now, UpdatedAt: now, Version: 1},
+		},
+		deliveries: []entity.WebhookDelivery{
+			{ID: 1, WebhookID: 1, EventID: 1, Status: entity.DeliveryDelivered, Attempts: 1, ResponseStatus: 200, NextAttemptAt: now, CreatedAt: now, UpdatedAt: now},
+			{ID: 2, WebhookID: 1, EventID: 2, Status: entity.DeliveryDead, Attempts: 10, ResponseStatus: 500, Error: "the webhook responded with status 500", NextAttemptAt: now, CreatedAt: now, UpdatedAt: now},
+		},
+	}
+	RegisterHandlers(router.Group(""), NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 10, 50, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+	ifNoneMatch := auth.MockAuthHeader()
+	ifNoneMatch.Set("If-None-Match", `"1"`)
+	ifMatch := func(tag string) http.Header {
+		h := auth.MockAuthHeader()
+		h.Set("If-Match", tag)
+		return h
+	}
+
+	tests := []test.APITestCase{
+		{"get unauthorized", "GET", "/webhooks/1", "", nil, http.StatusUnauthorized, ""},
+		{"get", "GET", "/webhooks/1", "", header, http.StatusOK, `*"url":"https://example.com/hook"*`},
+		{"get not modified", "GET", "/webhooks/1", "", ifNoneMatch, http.StatusNotModified, ""},
+		{"get unknown", "GET", "/webhooks/1234", "", header, http.StatusNotFound, ""},
+		{"get invalid", "GET", "/webhooks/abc", "", header, http.StatusNotFound, ""},
+		{"get all", "GET", "/webhooks", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create ok", "POST", "/webhooks", `{"url":"https://example.com/other","event_types":["album.created"]}`, header, http.StatusCreated, `*"secret":"whsec_*`},
+		{"create ok count", "GET", "/webhooks", "", header, http.StatusOK, `*"total_count":3*`},
+		{"create secret hidden", "GET", "/webhooks/3", "", header, http.StatusOK, `*"event_types":["album.created"],"enabled":true*`},
+		{"create input error", "POST", "/webhooks", `"url"`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/webhooks", `{"url":"https://example.com/other","event_types":["album.renamed"]}`, header, http.StatusBadRequest, ""},
+		{"update conflict", "PATCH", "/webhooks/3", `{"enabled":false}`, ifMatch(`"2"`), http.StatusPreconditionFailed, `*"code":"version_conflict"*`},
+		{"update if-match error", "PATCH", "/webhooks/3", `{"enabled":false}`, ifMatch(`"1", "2"`), http.StatusBadRequest, ""},
+		{"update ok", "PATCH", "/webhooks/3", `{"event_types":["album.*"],"enabled":false}`, ifMatch(`"1"`), http.StatusOK, `*"event_types":["album.*"],"enabled":false*`},
+		{"update validation error", "PATCH", "/webhooks/3", `{"url":"ftp://example.com"}`, header, http.StatusBadRequest, ""},
+		{"update unknown", "PATCH", "/webhooks/1234", `{"enabled":true}`, header, http.StatusNotFound, ""},
+		{"rotate secret", "POST", "/webhooks/3:rotateSecret", "", header, http.StatusOK, `*"previous_secret_expires_at":*`},
+		{"rotate secret unknown", "POST", "/webhooks/1234:rotateSecret", "", header, http.StatusNotFound, ""},
+		{"deliveries", "GET", "/webhooks/1/deliveries", "", header, http.StatusOK, `*"total_count":2*`},
+		{"deliveries newest first", "GET", "/webhooks/1/deliveries", "", header, http.StatusOK, `*"items":[{"id":2,*`},
+		{"deliveries by status", "GET", "/webhooks/1/deliveries?status=dead", "", header, http.StatusOK, `*"total_count":1*`},
+		{"deliveries invalid status", "GET", "/webhooks/1/deliveries?status=lost", "", header, http.StatusBadRequest, ""},
+		{"deliveries unknown", "GET", "/webhooks/1234/deliveries", "", header, http.StatusNotFound, ""},
+		{"delivery", "GET", "/webhooks/1/deliveries/2", "", header, http.StatusOK, `*"status":"dead"*`},
+		{"delivery other webhook", "GET", "/webhooks/3/deliveries/2", "", header, http.StatusNotFound, ""},
+		{"replay", "POST", "/webhooks/1/deliveries/2:replay", "", header, http.StatusOK, `*"status":"pending","attempts":0*`},
+		{"replay unknown", "POST", "/webhooks/1/deliveries/3:replay", "", header, http.StatusNotFound, ""},
+		{"replay other webhook", "POST", "/webhooks/3/deliveries/1:replay", "", header, http.StatusNotFound, ""},
+		{"delete conflict", "DELETE", "/webhooks/3", "", ifMatch(`"2"`), http.StatusPreconditionFailed, ""},
+		{"delete ok", "DELETE", "/webhooks/3", "", ifMatch(`"3"`), http.StatusOK, `*"id":3*`},
+		{"delete verify", "DELETE", "/webhooks/3", "", header, http.StatusNotFound, ""},
+
+		{"account get all", "GET", "/accounts/1/webhooks", "", header, http.StatusOK, `*"total_count":1,"items":[{"id":2,*`},
+		{"account get all other", "GET", "/accounts/2/webhooks", "", header, http.StatusOK, `*"total_count":0*`},
+		{"account get", "GET", "/accounts/1/webhooks/2", "", header, http.StatusOK, `*"account_id":1*`},
+		{"account get global", "GET", "/accounts/1/webhooks/1", "", header, http.StatusNotFound, ""},
+		{"account get other", "GET", "/accounts/2/webhooks/2", "", header, http.StatusNotFound, ""},
+		{"account create", "POST", "/accounts/2/webhooks", `{"url":"https://example.com/account","account_id":1}`, header, http.StatusCreated, `*"account_id":2*`},
+		{"account create count", "GET", "/accounts/2/webhooks", "", header, http.StatusOK, `*"total_count":1*`},
+		{"account update other", "PATCH", "/accounts/1/webhooks/3", `{"enabled":false}`, header, http.StatusNotFound, ""},
+		{"account rotate secret", "POST", "/accounts/2/webhooks/3:rotateSecret", "", header, http.StatusOK, `*"secret":"whsec_*`},
+		{"account test", "POST", "/accounts/1/webhooks/2:test", "", header, http.StatusOK, `*"delivery_id":3,*`},
+		{"account test other", "POST", "/accounts/2/webhooks/2:test", "", header, http.StatusNotFound, ""},
+		{"account deliveries", "GET", "/accounts/1/webhooks/2/deliveries", "", header, http.StatusOK, `*"total_count":1,"items":[{"id":3,"webhook_id":2,"event_id":1,"status":"delivered"*`},
+		{"account attempts", "GET", "/accounts/1/webhooks/2/deliveries/3/attempts", "", header, http.StatusOK, `*"X-Webhook-Event":"webhook.test"*`},
+		{"account attempts other", "GET", "/accounts/2/webhooks/2/deliveries/3/attempts", "", header, http.StatusNotFound, ""},
+		{"account attempts other webhook", "GET", "/accounts/1/webhooks/2/deliveries/1/attempts", "", header, http.StatusNotFound, ""},
+		{"account delete other", "DELETE", "/accounts/1/webhooks/3", "", header, http.StatusNotFound, ""},
+		{"account delete", "DELETE", "/accounts/2/webhooks/3", "", header, http.StatusOK, `*"id":3*`},
+		{"account user get all", "GET", "/accounts/1/webhooks", "", auth.MockAccountAuthHeader(1), http.StatusOK, `*"total_count":1*`},
+		{"account user get all other", "GET", "/accounts/2/webhooks", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user create other", "POST", "/accounts/2/webhooks", `{"url":"https://example.com/other"}`, auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user get other", "GET", "/accounts/2/webhooks/2", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user deliveries other", "GET", "/accounts/2/webhooks/2/deliveries", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user replay other", "POST", "/accounts/2/webhooks/2/deliveries/3:replay", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user get all accounts", "GET", "/webhooks", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user create all accounts", "POST", "/webhooks", `{"url":"https://example.com/all"}`, auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+		{"account user get all accounts item", "GET", "/webhooks/2", "", auth.MockAccountAuthHeader(1), http.StatusForbidden, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
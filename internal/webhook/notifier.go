@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Notifier notifies the owners of webhooks about their webhooks.
+type Notifier interface {
+	// NotifyDisabled notifies the owner of a webhook at the given email address that the webhook has been disabled.
+	NotifyDisabled(ctx context.Context, email string, webhook entity.Webhook) error
+}
+
+// SMTPNotifier sends the notifications by email through an SMTP server.
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	// send sends an email. It is smtp.SendMail, except in tests.
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPNotifier creates a notifier sending emails from the given address through the SMTP server at addr ("host:port").
+// The server is authenticated to with PLAIN authentication if username is not empty.
+func NewSMTPNotifier(addr, username, password, from string) SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return SMTPNotifier{addr, auth, from, smtp.SendMail}
+}
+
+// NotifyDisabled emails the owner of a webhook that the webhook has been disabled and why.
+func (n SMTPNotifier) NotifyDisabled(ctx context.Context, email string, webhook entity.Webhook) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %v\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %v\r\n", email)
+	fmt.Fprintf(&msg, "Subject: Your webhook %v has been disabled\r\n", webhook.ID)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Your webhook %v for %v has been disabled: %v.\r\n\r\n", webhook.ID, webhook.URL, webhook.DisabledReason)
+	msg.WriteString("No events are delivered to it until it is enabled again. Check the recent delivery attempts of the webhook, " +
+		"fix the endpoint, send a test event, then enable the webhook.\r\n")
+	return n.send(n.addr, n.auth, n.from, []string{email}, []byte(msg.String()))
+}
+
+type logNotifier struct {
+	logger log.Logger
+}
+
+// NewLogNotifier creates a notifier that only logs the notifications. It is used when no SMTP server is configured.
+func NewLogNotifier(logger log.Logger) Notifier {
+	return logNotifier{logger}
+}
+
+// NotifyDisabled logs that a webhook has been disabled.
+func (n logNotifier) NotifyDisabled(ctx context.Context, email string, webhook entity.Webhook) error {
+	n.logger.With(ctx, "webhook", webhook.ID, "email", email).Infof("webhook disabled, notification not sent: %v", webhook.DisabledReason)
+	return nil
+}
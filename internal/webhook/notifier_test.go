@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	var to []string
+	var msg string
+	n := NewSMTPNotifier("smtp.example.com:587", "user", "password", "noreply@example.com")
+	n.send = func(addr string, a smtp.Auth, from string, recipients []string, data []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, "noreply@example.com", from)
+		to, msg = recipients, string(data)
+		return nil
+	}
+	now := time.Now()
+	webhook := entity.Webhook{ID: 12, URL: "https://example.com/hook", DisabledAt: &now, DisabledReason: "50 consecutive delivery attempts failed"}
+	assert.Nil(t, n.NotifyDisabled(context.Background(), "owner@example.com", webhook))
+	assert.Equal(t, []string{"owner@example.com"}, to)
+	assert.Contains(t, msg, "To: owner@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Your webhook 12 has been disabled\r\n")
+	assert.Contains(t, msg, "https://example.com/hook has been disabled: 50 consecutive delivery attempts failed.")
+
+	assert.Nil(t, NewSMTPNotifier("localhost:25", "", "", "noreply@example.com").auth)
+}
+
+func TestLogNotifier(t *testing.T) {
+	logger, entries := log.NewForTest()
+	n := NewLogNotifier(logger)
+	assert.Nil(t, n.NotifyDisabled(context.Background(), "owner@example.com", entity.Webhook{ID: 12}))
+	assert.Equal(t, 1, entries.Len())
+}
@@ -0,0 +1,429 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+)
+
+// Repository encapsulates the logic to access webhooks, their deliveries and the events they deliver from the data source.
+type Repository interface {
+	// Get returns the webhook with the specified ID.
+	Get(ctx context.Context, id int) (entity.Webhook, error)
+	// Count returns the number of webhooks of an account, or of all webhooks if accountID is 0.
+	Count(ctx context.Context, accountID int) (int, error)
+	// Query returns the webhooks of an account, or all webhooks if accountID is 0, with the given offset and limit,
+	// ordered by ID.
+	Query(ctx context.Context, accountID int, offset, limit int) ([]entity.Webhook, error)
+	// QueryEnabled returns all enabled webhooks.
+	QueryEnabled(ctx context.Context) ([]entity.Webhook, error)
+	// EncryptSecrets encrypts the secrets of the webhooks saved before secrets were encrypted
+	// and returns the number of those webhooks.
+	EncryptSecrets(ctx context.Context) (int, error)
+	// Create saves a new webhook in the storage.
+	Create(ctx context.Context, webhook entity.Webhook) (entity.Webhook, error)
+	// Update saves the changes to a webhook in the storage if the webhook is still at its version.
+	// It returns dbcontext.ErrConflict otherwise.
+	Update(ctx context.Context, webhook entity.Webhook) error
+	// Delete removes the webhook with the specified ID and version and its deliveries from the storage.
+	// It returns dbcontext.ErrConflict if the webhook is at another version.
+	Delete(ctx context.Context, id int, version int) error
+	// IncrementFailures increments the number of consecutive failed attempts of a webhook and returns it.
+	// Like the following methods changing a webhook, it increments the version of the webhook.
+	IncrementFailures(ctx context.Context, id int) (int, error)
+	// ResetFailures resets the number of consecutive failed attempts of a webhook.
+	ResetFailures(ctx context.Context, id int) error
+	// Disable disables an enabled webhook for the given reason. It returns false if the webhook was already disabled.
+	Disable(ctx context.Context, id int, reason string, t time.Time) (bool, error)
+	// GetAccountEmail returns the email address of an account.
+	GetAccountEmail(ctx context.Context, accountID int) (string, error)
+
+	// ClaimEvents returns the oldest events without deliveries, up to limit, and locks them until the transaction
+	// of the context ends. Events locked by other transactions are skipped.
+	ClaimEvents(ctx context.Context, limit int) ([]entity.Event, error)
+	// MarkDispatched records that the deliveries of the specified events have been created.
+	MarkDispatched(ctx context.Context, ids []int64, t time.Time) error
+	// GetEvent returns the event with the specified ID.
+	GetEvent(ctx context.Context, id int64) (entity.Event, error)
+	// CreateEvent saves a new event in the storage and returns it with its ID.
+	CreateEvent(ctx context.Context, event entity.Event) (entity.Event, error)
+
+	// GetDelivery returns the delivery with the specified ID.
+	GetDelivery(ctx context.Context, id int64) (entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries selected by the filter.
+	CountDeliveries(ctx context.Context, filter DeliveryFilter) (int, error)
+	// QueryDeliveries returns the deliveries selected by the filter with the given offset and limit, newest first.
+	QueryDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CreateDelivery saves a new delivery in the storage and returns it with its ID.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (entity.WebhookDelivery, error)
+	// ClaimDeliveries returns the pending deliveries due at now, up to limit, and postpones their next attempt
+	// until the given time, so that they are not attempted by other dispatchers meanwhile.
+	ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) ([]entity.WebhookDelivery, error)
+	// UpdateDelivery saves the changes to a delivery in the storage.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+
+	// CountAttempts returns the number of attempts of a delivery.
+	CountAttempts(ctx context.Context, deliveryID int64) (int, error)
+	// QueryAttempts returns the attempts of a delivery with the given offset and limit, newest first.
+	QueryAttempts(ctx context.Context, deliveryID int64, offset, limit int) ([]entity.WebhookAttempt, error)
+	// CreateAttempt saves a new attempt of a delivery in the storage and returns it with its ID.
+	CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) (entity.WebhookAttempt, error)
+}
+
+// DeliveryFilter represents the conditions selecting deliveries.
+type DeliveryFilter struct {
+	// WebhookID selects the deliveries to a webhook.
+	WebhookID int
+	// Status selects the deliveries with a status. The deliveries of any status are selected if it is empty.
+	Status string
+}
+
+func (f DeliveryFilter) expression() dbx.Expression {
+	exp := dbx.HashExp{"webhook_id": f.WebhookID}
+	if f.Status != "" {
+		exp["status"] = f.Status
+	}
+	return exp
+}
+
+// repository persists webhooks and their deliveries in database.
+// The secrets of webhooks are encrypted with the box, so that they cannot be read from the database to sign deliveries.
+type repository struct {
+	db     *dbcontext.DB
+	box    *secretbox.Box
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository(db *dbcontext.DB, box *secretbox.Box, logger log.Logger) Repository {
+	return repository{db, box, logger}
+}
+
+// Get reads the webhook with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id int) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	if err := r.db.With(ctx).Select().Model(id, &webhook); err != nil {
+		return webhook, err
+	}
+	return webhook, r.open(&webhook)
+}
+
+// Count returns the number of the webhook records of an account in the database.
+func (r repository) Count(ctx context.Context, accountID int) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook").Where(accountExpression(accountID)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the webhook records of an account with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, accountID int, offset, limit int) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).
+		Select().
+		Where(accountExpression(accountID)).
+		OrderBy("id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, r.openAll(webhooks)
+}
+
+// QueryEnabled retrieves the enabled webhook records from the database.
+func (r repository) QueryEnabled(ctx context.Context) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"enabled": true}).
+		OrderBy("id").
+		All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, r.openAll(webhooks)
+}
+
+// EncryptSecrets moves the plaintext secrets of the webhook records saved before secrets were encrypted
+// into the encrypted columns.
+func (r repository) EncryptSecrets(ctx context.Context) (int, error) {
+	var webhooks []struct {
+		ID             int
+		Secret         string
+		PreviousSecret string
+	}
+	err := r.db.With(ctx).Select("id", "secret", "previous_secret").From("webhook").
+		Where(dbx.NewExp("secret <> ''")).
+		All(&webhooks)
+	if err != nil {
+		return 0, err
+	}
+	for _, w := range webhooks {
+		webhook := entity.Webhook{Secret: w.Secret, PreviousSecret: w.PreviousSecret}
+		if err := r.seal(&webhook); err != nil {
+			return 0, err
+		}
+		_, err := r.db.With(ctx).Update("webhook", dbx.Params{
+			"secret":                    "",
+			"secret_encrypted":          webhook.SecretEncrypted,
+			"previous_secret":           "",
+			"previous_secret_encrypted": webhook.PreviousSecretEncrypted,
+		}, dbx.HashExp{"id": w.ID}).Execute()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(webhooks), nil
+}
+
+// Create saves a new webhook record in the database.
+// It returns the webhook with the ID of the newly inserted record.
+func (r repository) Create(ctx context.Context, webhook entity.Webhook) (entity.Webhook, error) {
+	if err := r.seal(&webhook); err != nil {
+		return webhook, err
+	}
+	webhook.Version = 1
+	err := r.db.With(ctx).Model(&webhook).Insert()
+	return webhook, err
+}
+
+// Update saves the changes to a webhook in the database if the webhook has not been changed since it was read.
+func (r repository) Update(ctx context.Context, webhook entity.Webhook) error {
+	if err := r.seal(&webhook); err != nil {
+		return err
+	}
+	return r.db.UpdateVersion(ctx, "webhook", dbx.Params{
+		"url":                        webhook.URL,
+		"secret_encrypted":           webhook.SecretEncrypted,
+		"previous_secret_encrypted":  webhook.PreviousSecretEncrypted,
+		"previous_secret_expires_at": webhook.PreviousSecretExpiresAt,
+		"event_types":                webhook.EventTypes,
+		"enabled":                    webhook.Enabled,
+		"failure_count":              webhook.FailureCount,
+		"disabled_at":                webhook.DisabledAt,
+		"disabled_reason":            webhook.DisabledReason,
+		"updated_at":                 webhook.UpdatedAt,
+	}, dbx.HashExp{"id": webhook.ID}, webhook.Version)
+}
+
+// seal encrypts the secrets of a webhook before it is saved. An empty previous secret is saved as NULL.
+func (r repository) seal(webhook *entity.Webhook) error {
+	var err error
+	if webhook.SecretEncrypted, err = r.box.Seal([]byte(webhook.Secret)); err != nil {
+		return err
+	}
+	webhook.PreviousSecretEncrypted = nil
+	if webhook.PreviousSecret != "" {
+		webhook.PreviousSecretEncrypted, err = r.box.Seal([]byte(webhook.PreviousSecret))
+	}
+	return err
+}
+
+// open decrypts the secrets of a webhook read from the database.
+func (r repository) open(webhook *entity.Webhook) error {
+	secret, err := r.box.Open(webhook.SecretEncrypted)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the secret of webhook %v: %w", webhook.ID, err)
+	}
+	webhook.Secret = string(secret)
+	if len(webhook.PreviousSecretEncrypted) > 0 {
+		secret, err = r.box.Open(webhook.PreviousSecretEncrypted)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt the previous secret of webhook %v: %w", webhook.ID, err)
+		}
+		webhook.PreviousSecret = string(secret)
+	}
+	return nil
+}
+
+func (r repository) openAll(webhooks []entity.Webhook) error {
+	for i := range webhooks {
+		if err := r.open(&webhooks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the webhook with the specified ID and version from the database.
+// Its deliveries are deleted by cascade.
+func (r repository) Delete(ctx context.Context, id int, version int) error {
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	return r.db.DeleteVersion(ctx, "webhook", dbx.HashExp{"id": id}, version)
+}
+
+// IncrementFailures increments the failure count of a webhook record in one statement, so that concurrent
+// attempts are all counted.
+func (r repository) IncrementFailures(ctx context.Context, id int) (int, error) {
+	var count int
+	err := r.db.With(ctx).NewQuery(`UPDATE webhook SET failure_count = failure_count + 1, version = version + 1
+		WHERE id = {:id} RETURNING failure_count`).
+		Bind(dbx.Params{"id": id}).
+		Row(&count)
+	return count, err
+}
+
+// ResetFailures sets the failure count of a webhook record to 0. The record is left unchanged if it is already 0.
+func (r repository) ResetFailures(ctx context.Context, id int) error {
+	_, err := r.db.With(ctx).Update("webhook",
+		dbx.Params{"failure_count": 0, "version": dbx.NewExp("version+1")},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("failure_count <> 0")),
+	).Execute()
+	return err
+}
+
+// Disable disables a webhook record if it is enabled.
+func (r repository) Disable(ctx context.Context, id int, reason string, t time.Time) (bool, error) {
+	result, err := r.db.With(ctx).Update("webhook",
+		dbx.Params{"enabled": false, "disabled_at": t, "disabled_reason": reason, "updated_at": t, "version": dbx.NewExp("version+1")},
+		dbx.HashExp{"id": id, "enabled": true},
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetAccountEmail reads the email address of an account from the database.
+func (r repository) GetAccountEmail(ctx context.Context, accountID int) (string, error) {
+	var email string
+	err := r.db.With(ctx).Select("email").From("account").Where(dbx.HashExp{"id": accountID}).Row(&email)
+	return email, err
+}
+
+// accountExpression selects the records of an account, or all records if accountID is 0.
+func accountExpression(accountID int) dbx.Expression {
+	if accountID == 0 {
+		return nil
+	}
+	return dbx.HashExp{"account_id": accountID}
+}
+
+// ClaimEvents reads the undispatched event records and locks them with SELECT ... FOR UPDATE SKIP LOCKED,
+// so that concurrent dispatchers claim different events. It must be called within a transaction.
+func (r repository) ClaimEvents(ctx context.Context, limit int) ([]entity.Event, error) {
+	var events []entity.Event
+	err := r.db.With(ctx).NewQuery(`SELECT * FROM event WHERE dispatched_at IS NULL
+		ORDER BY id LIMIT {:limit} FOR UPDATE SKIP LOCKED`).
+		Bind(dbx.Params{"limit": limit}).
+		All(&events)
+	return events, err
+}
+
+// MarkDispatched sets the dispatch time of the specified event records in the database.
+func (r repository) MarkDispatched(ctx context.Context, ids []int64, t time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	_, err := r.db.With(ctx).Update("event", dbx.Params{"dispatched_at": t}, dbx.In("id", values...)).Execute()
+	return err
+}
+
+// GetEvent reads the event with the specified ID from the database.
+func (r repository) GetEvent(ctx context.Context, id int64) (entity.Event, error) {
+	var event entity.Event
+	err := r.db.With(ctx).Select().Model(id, &event)
+	return event, err
+}
+
+// CreateEvent saves a new event record in the database.
+// It returns the event with the ID of the newly inserted record.
+func (r repository) CreateEvent(ctx context.Context, event entity.Event) (entity.Event, error) {
+	err := r.db.With(ctx).Model(&event).Insert()
+	return event, err
+}
+
+// GetDelivery reads the delivery with the specified ID from the database.
+func (r repository) GetDelivery(ctx context.Context, id int64) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.db.With(ctx).Select().Model(id, &delivery)
+	return delivery, err
+}
+
+// CountDeliveries returns the number of the delivery records selected by the filter in the database.
+func (r repository) CountDeliveries(ctx context.Context, filter DeliveryFilter) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_delivery").Where(filter.expression()).Row(&count)
+	return count, err
+}
+
+// QueryDeliveries retrieves the delivery records selected by the filter with the specified offset and limit
+// from the database, newest first.
+func (r repository) QueryDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		Select().
+		Where(filter.expression()).
+		OrderBy("id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// CreateDelivery saves a new delivery record in the database.
+// It returns the delivery with the ID of the newly inserted record.
+func (r repository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	err := r.db.With(ctx).Model(&delivery).Insert()
+	return delivery, err
+}
+
+// ClaimDeliveries postpones the next attempt of the due pending delivery records in one statement and returns them.
+// Rows locked by the claims of other dispatchers are skipped.
+func (r repository) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).NewQuery(`UPDATE webhook_delivery SET next_attempt_at = {:until}
+		WHERE id IN (SELECT id FROM webhook_delivery WHERE status = {:status} AND next_attempt_at <= {:now}
+			ORDER BY next_attempt_at LIMIT {:limit} FOR UPDATE SKIP LOCKED)
+		RETURNING *`).
+		Bind(dbx.Params{"until": until, "status": entity.DeliveryPending, "now": now, "limit": limit}).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// UpdateDelivery saves the changes to a delivery in the database.
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Update()
+}
+
+// CountAttempts returns the number of the attempt records of a delivery in the database.
+func (r repository) CountAttempts(ctx context.Context, deliveryID int64) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_attempt").Where(dbx.HashExp{"delivery_id": deliveryID}).Row(&count)
+	return count, err
+}
+
+// QueryAttempts retrieves the attempt records of a delivery with the specified offset and limit from the database,
+// newest first.
+func (r repository) QueryAttempts(ctx context.Context, deliveryID int64, offset, limit int) ([]entity.WebhookAttempt, error) {
+	var attempts []entity.WebhookAttempt
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"delivery_id": deliveryID}).
+		OrderBy("id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&attempts)
+	return attempts, err
+}
+
+// CreateAttempt saves a new attempt record in the database.
+// It returns the attempt with the ID of the newly inserted record.
+func (r repository) CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) (entity.WebhookAttempt, error) {
+	err := r.db.With(ctx).Model(&attempt).Insert()
+	return attempt, err
+}
@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/secretbox"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "webhook_attempt", "webhook_delivery", "webhook", "event", "account")
+	box, _ := secretbox.New(bytes.Repeat([]byte("k"), secretbox.KeySize))
+	repo := NewRepository(db, box, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+	_, err := db.DB().Insert("account", map[string]interface{}{"id": 1, "email": "account1@example.com", "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+
+	// create
+	webhook, err := repo.Create(ctx, entity.Webhook{URL: "https://example.com/hook", Secret: "whsec_1",
+		EventTypes: entity.EventTypes{"domain.*"}, Enabled: true, CreatedAt: now, UpdatedAt: now})
+	assert.Nil(t, err)
+	assert.NotZero(t, webhook.ID)
+	accountID := 1
+	disabled, err := repo.Create(ctx, entity.Webhook{AccountID: &accountID, URL: "https://example.com/disabled", Secret: "whsec_2", CreatedAt: now, UpdatedAt: now})
+	assert.Nil(t, err)
+	email, err := repo.GetAccountEmail(ctx, accountID)
+	assert.Nil(t, err)
+	assert.Equal(t, "account1@example.com", email)
+	_, err = repo.GetAccountEmail(ctx, 2)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// get
+	fetched, err := repo.Get(ctx, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.EventTypes{"domain.*"}, fetched.EventTypes)
+	assert.Equal(t, "whsec_1", fetched.Secret)
+	assert.Empty(t, fetched.PreviousSecret)
+	assert.Nil(t, fetched.AccountID)
+	var secret string
+	var secretEncrypted []byte
+	assert.Nil(t, db.DB().Select("secret", "secret_encrypted").From("webhook").Where(dbx.HashExp{"id": webhook.ID}).Row(&secret, &secretEncrypted))
+	assert.Empty(t, secret)
+	assert.NotContains(t, string(secretEncrypted), "whsec_1")
+	_, err = repo.Get(ctx, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	count, err := repo.Count(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, _ = repo.Count(ctx, accountID)
+	assert.Equal(t, 1, count)
+	webhooks, err := repo.Query(ctx, 0, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(webhooks))
+	webhooks, err = repo.Query(ctx, accountID, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(webhooks)) {
+		assert.Equal(t, disabled.ID, webhooks[0].ID)
+	}
+	webhooks, err = repo.QueryEnabled(ctx)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(webhooks)) {
+		assert.Equal(t, webhook.ID, webhooks[0].ID)
+	}
+
+	// update
+	expires := now.Add(time.Hour)
+	webhook.PreviousSecret, webhook.PreviousSecretExpiresAt = "whsec_0", &expires
+	assert.Nil(t, repo.Update(ctx, webhook))
+	fetched, _ = repo.Get(ctx, webhook.ID)
+	assert.Equal(t, "whsec_0", fetched.PreviousSecret)
+	assert.NotNil(t, fetched.PreviousSecretExpiresAt)
+	assert.Equal(t, 2, fetched.Version)
+	assert.Equal(t, dbcontext.ErrConflict, repo.Update(ctx, webhook))
+
+	// encrypt the secrets saved in plaintext
+	_, err = db.DB().Insert("webhook", dbx.Params{"url": "https://example.com/legacy", "secret": "whsec_3", "previous_secret": "whsec_4",
+		"enabled": false, "created_at": now, "updated_at": now}).Execute()
+	assert.Nil(t, err)
+	count, err = repo.EncryptSecrets(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = repo.EncryptSecrets(ctx)
+	assert.Zero(t, count)
+	var legacy entity.Webhook
+	assert.Nil(t, db.DB().Select("id").From("webhook").Where(dbx.HashExp{"url": "https://example.com/legacy"}).One(&legacy))
+	legacy, err = repo.Get(ctx, legacy.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "whsec_3", legacy.Secret)
+	assert.Equal(t, "whsec_4", legacy.PreviousSecret)
+	assert.Nil(t, repo.Delete(ctx, legacy.ID, legacy.Version))
+
+	// failures
+	failures, err := repo.IncrementFailures(ctx, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, failures)
+	failures, _ = repo.IncrementFailures(ctx, webhook.ID)
+	assert.Equal(t, 2, failures)
+	assert.Nil(t, repo.ResetFailures(ctx, webhook.ID))
+	assert.Nil(t, repo.ResetFailures(ctx, webhook.ID))
+	fetched, _ = repo.Get(ctx, webhook.ID)
+	assert.Equal(t, 0, fetched.FailureCount)
+	assert.Equal(t, 5, fetched.Version)
+
+	// disable
+	ok, err := repo.Disable(ctx, disabled.ID, "too many failures", now)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = repo.Disable(ctx, webhook.ID, "too many failures", now)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	fetched, _ = repo.Get(ctx, webhook.ID)
+	assert.False(t, fetched.Enabled)
+	assert.Equal(t, "too many failures", fetched.DisabledReason)
+	assert.NotNil(t, fetched.DisabledAt)
+	assert.Equal(t, 6, fetched.Version)
+	fetched.Enabled = true
+	assert.Nil(t, repo.Update(ctx, fetched))
+
+	// claim events
+	created, err := repo.CreateEvent(ctx, entity.Event{Type: event.WebhookTest, Data: []byte(`{}`), DispatchedAt: &now, CreatedAt: now})
+	assert.Nil(t, err)
+	assert.NotZero(t, created.ID)
+	p := event.NewPublisher(db, logger)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, p.Publish(ctx, event.DomainCreated, 0, "1", map[string]int{"id": 1}))
+	}
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		events, err := repo.ClaimEvents(ctx, 2)
+		assert.Nil(t, err)
+		if assert.Equal(t, 2, len(events)) {
+			assert.True(t, events[0].ID < events[1].ID)
+			assert.Nil(t, repo.MarkDispatched(ctx, []int64{events[0].ID, events[1].ID}, now))
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		events, err := repo.ClaimEvents(ctx, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(events))
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// deliveries
+	var e entity.Event
+	assert.Nil(t, db.DB().Select().From("event").Where(dbx.HashExp{"type": event.DomainCreated}).OrderBy("id").One(&e))
+	fetchedEvent, err := repo.GetEvent(ctx, e.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, event.DomainCreated, fetchedEvent.Type)
+	for _, d := range []entity.WebhookDelivery{
+		{WebhookID: webhook.ID, EventID: e.ID, Status: entity.DeliveryPending, NextAttemptAt: now.Add(-time.Minute), CreatedAt: now, UpdatedAt: now},
+		{WebhookID: webhook.ID, EventID: e.ID, Status: entity.DeliveryPending, NextAttemptAt: now.Add(time.Hour), CreatedAt: now, UpdatedAt: now},
+		{WebhookID: webhook.ID, EventID: e.ID, Status: entity.DeliveryDead, NextAttemptAt: now.Add(-time.Minute), CreatedAt: now, UpdatedAt: now},
+		{WebhookID: disabled.ID, EventID: e.ID, Status: entity.DeliveryPending, NextAttemptAt: now.Add(-time.Minute), CreatedAt: now, UpdatedAt: now},
+	} {
+		created, err := repo.CreateDelivery(ctx, d)
+		assert.Nil(t, err)
+		assert.NotZero(t, created.ID)
+	}
+	count, err = repo.CountDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	count, _ = repo.CountDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID, Status: entity.DeliveryDead})
+	assert.Equal(t, 1, count)
+	deliveries, err := repo.QueryDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID}, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(deliveries)) {
+		assert.Equal(t, entity.DeliveryDead, deliveries[0].Status)
+	}
+
+	// claim deliveries
+	claimed, err := repo.ClaimDeliveries(ctx, now, now.Add(claimLease), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(claimed))
+	claimed, err = repo.ClaimDeliveries(ctx, now, now.Add(claimLease), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(claimed))
+
+	// update
+	delivery, err := repo.GetDelivery(ctx, deliveries[2].ID)
+	assert.Nil(t, err)
+	delivery.Status = entity.DeliveryDelivered
+	delivery.Attempts = 1
+	delivery.ResponseStatus = 204
+	assert.Nil(t, repo.UpdateDelivery(ctx, delivery))
+	delivery, _ = repo.GetDelivery(ctx, delivery.ID)
+	assert.Equal(t, entity.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 204, delivery.ResponseStatus)
+
+	// attempts
+	for _, status := range []int{500, 204} {
+		attempt, err := repo.CreateAttempt(ctx, entity.WebhookAttempt{DeliveryID: delivery.ID, RequestHeaders: entity.Headers{"Content-Type": "application/json"},
+			RequestBody: `{}`, ResponseStatus: status, Duration: 12, CreatedAt: now})
+		assert.Nil(t, err)
+		assert.NotZero(t, attempt.ID)
+	}
+	count, err = repo.CountAttempts(ctx, delivery.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	attempts, err := repo.QueryAttempts(ctx, delivery.ID, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(attempts)) {
+		assert.Equal(t, 204, attempts[0].ResponseStatus)
+		assert.Equal(t, entity.Headers{"Content-Type": "application/json"}, attempts[0].RequestHeaders)
+	}
+
+	// delete
+	assert.Equal(t, dbcontext.ErrConflict, repo.Delete(ctx, webhook.ID, 6))
+	assert.Nil(t, repo.Delete(ctx, webhook.ID, 7))
+	_, err = repo.Get(ctx, webhook.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ = repo.CountDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID})
+	assert.Equal(t, 0, count)
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(ctx, webhook.ID, 7))
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+)
+
+const (
+	// maxResponseBody is the number of bytes of a response body that are read before the connection is reused.
+	maxResponseBody = 64 << 10
+	// maxSnippet is the maximum length of the request and response bodies saved with an attempt.
+	maxSnippet = 4 << 10
+)
+
+// nonPublicNetworks are the networks of the loopback, private, link-local, shared, reserved and multicast addresses.
+// Webhooks cannot be delivered to them, so that webhooks cannot be used to reach internal services.
+var nonPublicNetworks = mustParseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24",
+	"192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "64:ff9b::/96", "100::/64", "2001:db8::/32", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// Sender sends the deliveries of events to webhooks over HTTP.
+type Sender struct {
+	client  *http.Client
+	allowed []*net.IPNet
+}
+
+// NewSender creates a sender whose requests time out after the given duration.
+// Redirects are not followed, so that a webhook cannot redirect deliveries to another endpoint.
+// Deliveries are only sent to public addresses, or to the addresses in the allowed networks. The addresses are checked
+// when connecting, after host names are resolved, so that a host name cannot be rebound to a non-public address.
+func NewSender(timeout time.Duration, allowed []*net.IPNet) Sender {
+	s := Sender{allowed: allowed}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !s.allowedIP(ip) {
+				return fmt.Errorf("%v is not a public address", host)
+			}
+			return nil
+		},
+	}
+	s.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// ParseNetworks parses networks in CIDR notation, such as "10.0.0.0/8".
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks[i] = network
+	}
+	return networks, nil
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks, err := ParseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+// CheckURL checks that the host of a webhook URL is not a non-public IP address, unless it is allowed.
+// Host names are only checked when deliveries are sent.
+func (s Sender) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !s.allowedIP(ip) {
+		return errNonPublicURL
+	}
+	return nil
+}
+
+// allowedIP returns whether deliveries can be sent to an IP address.
+func (s Sender) allowedIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range s.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Send posts an event signed with the secrets of a webhook to the webhook, and returns the attempt with snippets of
+// the request and of the response. It fails if the webhook cannot be reached or does not respond with a 2xx status.
+func (s Sender) Send(ctx context.Context, webhook entity.Webhook, deliveryID int64, event entity.Event) (entity.WebhookAttempt, error) {
+	now := time.Now()
+	attempt := entity.WebhookAttempt{DeliveryID: deliveryID, CreatedAt: now}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return attempt, err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return attempt, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(SignatureHeader, Sign(now, body, webhook.Secrets(now)...))
+	attempt.RequestHeaders = headers(req.Header)
+	attempt.RequestBody = snippet(body)
+
+	res, err := s.client.Do(req)
+	attempt.Duration = int(time.Since(now) / time.Millisecond)
+	if err != nil {
+		return attempt, err
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	attempt.ResponseStatus = res.StatusCode
+	attempt.ResponseHeaders = headers(res.Header)
+	attempt.ResponseBody = snippet(data)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return attempt, fmt.Errorf("the webhook responded with status %v", res.StatusCode)
+	}
+	return attempt, nil
+}
+
+// headers returns the first value of each HTTP header.
+func headers(header http.Header) entity.Headers {
+	result := entity.Headers{}
+	for name, values := range header {
+		if len(values) > 0 {
+			result[name] = values[0]
+		}
+	}
+	return result
+}
+
+// snippet returns the beginning of a body, up to maxSnippet bytes and without splitting a UTF-8 character.
+func snippet(body []byte) string {
+	if len(body) <= maxSnippet {
+		return string(body)
+	}
+	n := maxSnippet
+	for n > 0 && !utf8.RuneStart(body[n]) {
+		n--
+	}
+	return string(body[:n])
+}
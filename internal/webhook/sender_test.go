@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// loopback allows the deliveries to the test servers.
+var loopback = mustParseNetworks("127.0.0.0/8", "::1/128")
+
+func TestSender_Send(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/error":
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(strings.Repeat("é", maxSnippet)))
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	s := NewSender(50*time.Millisecond, loopback)
+	ctx := context.Background()
+	webhook := entity.Webhook{ID: 1, URL: server.URL, Secret: "secret", Enabled: true}
+	event := entity.Event{ID: 12, Type: "domain.created", ResourceID: "3", Data: entity.EventData(`{"id":3}`), CreatedAt: time.Now()}
+
+	attempt, err := s.Send(ctx, webhook, 34, event)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, attempt.ResponseStatus)
+	assert.Equal(t, int64(34), attempt.DeliveryID)
+	assert.Equal(t, string(body), attempt.RequestBody)
+	assert.Equal(t, "domain.created", attempt.RequestHeaders[EventHeader])
+	assert.Equal(t, "0", attempt.ResponseHeaders["Content-Length"])
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "domain.created", header.Get(EventHeader))
+	assert.Equal(t, "34", header.Get(DeliveryHeader))
+	assert.Nil(t, Verify("secret", header.Get(SignatureHeader), body, time.Now(), time.Minute))
+	var received entity.Event
+	assert.Nil(t, json.Unmarshal(body, &received))
+	assert.Equal(t, int64(12), received.ID)
+	assert.Equal(t, `{"id":3}`, string(received.Data))
+
+	// deliveries are signed with the previous secret until it expires
+	expiresAt := time.Now().Add(time.Hour)
+	webhook.PreviousSecret, webhook.PreviousSecretExpiresAt = "old", &expiresAt
+	_, err = s.Send(ctx, webhook, 34, event)
+	assert.Nil(t, err)
+	assert.Nil(t, Verify("secret", header.Get(SignatureHeader), body, time.Now(), time.Minute))
+	assert.Nil(t, Verify("old", header.Get(SignatureHeader), body, time.Now(), time.Minute))
+	expiresAt = time.Now()
+	_, _ = s.Send(ctx, webhook, 34, event)
+	assert.NotNil(t, Verify("old", header.Get(SignatureHeader), body, time.Now(), time.Minute))
+
+	// error responses are failures, and their bodies are truncated to valid UTF-8
+	webhook.URL = server.URL + "/error"
+	attempt, err = s.Send(ctx, webhook, 34, event)
+	assert.Equal(t, "the webhook responded with status 500", err.Error())
+	assert.Equal(t, http.StatusInternalServerError, attempt.ResponseStatus)
+	assert.Equal(t, "text/plain", attempt.ResponseHeaders["Content-Type"])
+	assert.Equal(t, maxSnippet, len(attempt.ResponseBody))
+	assert.True(t, utf8.ValidString(attempt.ResponseBody))
+
+	// redirects are failures
+	webhook.URL = server.URL + "/redirect"
+	attempt, err = s.Send(ctx, webhook, 34, event)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusFound, attempt.ResponseStatus)
+
+	// timeouts
+	webhook.URL = server.URL + "/slow"
+	attempt, err = s.Send(ctx, webhook, 34, event)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, attempt.ResponseStatus)
+	assert.NotEmpty(t, attempt.RequestBody)
+}
+
+func TestSender_nonPublic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	event := entity.Event{ID: 12, Type: "domain.created", ResourceID: "3", Data: entity.EventData(`{"id":3}`), CreatedAt: time.Now()}
+
+	// the address is checked after the host name is resolved
+	s := NewSender(time.Second, nil)
+	for _, url := range []string{server.URL, "http://localhost" + port} {
+		attempt, err := s.Send(context.Background(), entity.Webhook{ID: 1, URL: url, Secret: "secret"}, 34, event)
+		if assert.NotNil(t, err, url) {
+			assert.Contains(t, err.Error(), "is not a public address")
+		}
+		assert.Equal(t, 0, attempt.ResponseStatus)
+	}
+	_, err := NewSender(time.Second, loopback).Send(context.Background(), entity.Webhook{ID: 1, URL: "http://localhost" + port, Secret: "secret"}, 34, event)
+	assert.Nil(t, err)
+}
+
+func TestSender_CheckURL(t *testing.T) {
+	s := NewSender(time.Second, mustParseNetworks("10.1.0.0/16"))
+	tests := []struct {
+		url       string
+		wantError bool
+	}{
+		{"https://example.com/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"https://93.184.216.34/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://10.2.0.1/hook", true},
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://192.168.1.1/", true},
+		{"http://0.0.0.0/", true},
+		{"http://[::1]/", true},
+		{"http://[::ffff:127.0.0.1]/", true},
+		{"http://[fd00::1]/", true},
+		{"http://[fe80::1]/", true},
+		{"http://[2606:4700::1111]/", false},
+	}
+	for _, tc := range tests {
+		err := s.CheckURL(tc.url)
+		assert.Equal(t, tc.wantError, err != nil, tc.url)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "::1/128"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(networks))
+	_, err = ParseNetworks([]string{"10.0.0.0"})
+	assert.NotNil(t, err)
+}
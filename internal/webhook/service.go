@@ -0,0 +1,699 @@
+// Package webhook delivers the events of the transactional outbox to the webhooks subscribed to them.
+//
+// The dispatcher creates a delivery for every event and every enabled webhook accepting it, then posts the due
+// deliveries to their webhooks with an HMAC-SHA256 signature. Failed attempts are retried with exponential backoff
+// until the delivery is dead, and dead deliveries can be replayed. Deliveries are at least once: a webhook may
+// receive an event more than once and should deduplicate the events by ID. Webhooks whose attempts keep failing
+// are disabled, and their owners notified.
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+const (
+	// batchSize is the maximum number of events or deliveries claimed at once by a dispatcher.
+	batchSize = 100
+	// concurrency is the maximum number of deliveries attempted at the same time by a dispatcher.
+	concurrency = 10
+	// claimLease is how long a claimed delivery is reserved for the dispatcher attempting it.
+	// It must be longer than the timeout of the sender.
+	claimLease = 5 * time.Minute
+	// retryBase is the delay before the second attempt of a delivery. It doubles with every attempt.
+	retryBase = 30 * time.Second
+	// retryMax is the maximum delay between two attempts of a delivery.
+	retryMax = 6 * time.Hour
+	// maxErrorLength is the maximum length of the error message saved for a failed attempt.
+	maxErrorLength = 500
+	// rotationGrace is how long deliveries are still signed with the previous secret after a rotation.
+	rotationGrace = 24 * time.Hour
+)
+
+// errDisabled is the error of the attempts of deliveries to disabled webhooks.
+var errDisabled = errors.New("the webhook is disabled")
+
+// Service encapsulates usecase logic for webhooks.
+// The webhooks are those of an account, or of all accounts if accountID is 0. Webhooks of other accounts are not found.
+type Service interface {
+	Get(ctx context.Context, accountID, id int) (Webhook, error)
+	Query(ctx context.Context, accountID int, offset, limit int) ([]Webhook, error)
+	Count(ctx context.Context, accountID int) (int, error)
+	// Create registers a webhook with a new signing secret.
+	Create(ctx context.Context, input CreateWebhookRequest) (WebhookWithSecret, error)
+	// Update updates a webhook. If version is not 0, the webhook is only updated if it is at that version.
+	Update(ctx context.Context, accountID, id int, version int, input UpdateWebhookRequest) (Webhook, error)
+	// Delete deletes a webhook. If version is not 0, the webhook is only deleted if it is at that version.
+	Delete(ctx context.Context, accountID, id int, version int) (Webhook, error)
+	// RotateSecret replaces the signing secret of a webhook. Deliveries are signed with the previous secret as well
+	// for a grace period.
+	RotateSecret(ctx context.Context, accountID, id int) (WebhookWithSecret, error)
+	// Test sends a test event to a webhook, even if it is disabled or not subscribed to test events,
+	// and returns the attempt.
+	Test(ctx context.Context, accountID, id int) (Attempt, error)
+	// GetDelivery returns a delivery of a webhook.
+	GetDelivery(ctx context.Context, accountID, webhookID int, id int64) (Delivery, error)
+	// QueryDeliveries returns the deliveries selected by the filter with the given offset and limit, newest first.
+	QueryDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]Delivery, error)
+	// CountDeliveries returns the number of deliveries selected by the filter.
+	CountDeliveries(ctx context.Context, filter DeliveryFilter) (int, error)
+	// Replay schedules a new series of attempts of a delivery of a webhook, usually a dead one.
+	Replay(ctx context.Context, accountID, webhookID int, id int64) (Delivery, error)
+	// QueryAttempts returns the attempts of a delivery with the given offset and limit, newest first.
+	QueryAttempts(ctx context.Context, deliveryID int64, offset, limit int) ([]Attempt, error)
+	// CountAttempts returns the number of attempts of a delivery.
+	CountAttempts(ctx context.Context, deliveryID int64) (int, error)
+	// Dispatch creates the deliveries of the new events and attempts the due deliveries.
+	Dispatch(ctx context.Context) error
+}
+
+// Webhook represents the data about a webhook.
+type Webhook struct {
+	entity.Webhook
+}
+
+// WebhookWithSecret represents a webhook together with its signing secret,
+// which is only returned when the webhook is registered and when its secret is rotated.
+type WebhookWithSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Delivery represents the data about the delivery of an event to a webhook.
+type Delivery struct {
+	entity.WebhookDelivery
+}
+
+// Attempt represents the data about an attempt of a delivery.
+type Attempt struct {
+	entity.WebhookAttempt
+}
+
+// CreateWebhookRequest represents a webhook registration request.
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// AccountID restricts the webhook to the events of an account. The events of all accounts are delivered if it is nil.
+	AccountID  *int     `json:"account_id"`
+	EventTypes []string `json:"event_types"`
+}
+
+// Validate validates the CreateWebhookRequest fields.
+func (m CreateWebhookRequest) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the CreateWebhookRequest fields.
+func (m *CreateWebhookRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), is.URL, validation.By(validateScheme)),
+		validation.Field(&m.EventTypes, validation.Each(validation.By(validateEventType))),
+	}
+}
+
+// UpdateWebhookRequest represents a webhook update request. Only the fields that are not nil are updated,
+// so an empty list of event types subscribes the webhook to all events while a missing one keeps its event types.
+// Enabling a webhook resets its failures.
+type UpdateWebhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// Validate validates the UpdateWebhookRequest fields.
+func (m UpdateWebhookRequest) Validate() error {
+	return validation.ValidateStruct(&m, m.FieldRules()...)
+}
+
+// FieldRules returns the validation rules of the UpdateWebhookRequest fields.
+func (m *UpdateWebhookRequest) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.URL, validation.NilOrNotEmpty, validation.Length(0, 2048), is.URL, validation.By(validateScheme)),
+		validation.Field(&m.EventTypes, validation.Each(validation.By(validateEventType))),
+	}
+}
+
+// validateScheme checks that a webhook URL is an absolute HTTP or HTTPS URL.
+func validateScheme(value interface{}) error {
+	s, _ := value.(string)
+	if p, ok := value.(*string); ok {
+		if p == nil {
+			return nil
+		}
+		s = *p
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_webhook_url", "must be an http or https URL")
+	}
+	return nil
+}
+
+// errNonPublicURL is the validation error of a webhook URL whose host is a non-public IP address.
+var errNonPublicURL = validation.NewError("validation_webhook_url_public", "must not be a private or reserved address")
+
+// validateEventType checks that an event type is the type of an event or a wildcard like "domain.*".
+func validateEventType(value interface{}) error {
+	eventType, _ := value.(string)
+	for _, t := range event.Types {
+		if eventType == t || strings.HasSuffix(eventType, ".*") && strings.HasPrefix(t, eventType[:len(eventType)-1]) {
+			return nil
+		}
+	}
+	return validation.NewError("validation_webhook_event_type", "must be a known event type or a wildcard like domain.*")
+}
+
+type service struct {
+	repo          Repository
+	sender        Sender
+	events        event.Publisher
+	notifier      Notifier
+	transactional dbcontext.TransactionFunc
+	maxAttempts   int
+	failureLimit  int
+	logger        log.Logger
+}
+
+// NewService creates a new webhook service.
+// A delivery is dead after maxAttempts failed attempts, and a webhook is disabled after failureLimit consecutive
+// failed attempts of any of its deliveries.
+func NewService(repo Repository, sender Sender, events event.Publisher, notifier Notifier, transactional dbcontext.TransactionFunc,
+	maxAttempts, failureLimit int, logger log.Logger) Service {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if failureLimit < 1 {
+		failureLimit = 1
+	}
+	return service{repo, sender, events, notifier, transactional, maxAttempts, failureLimit, logger}
+}
+
+// Get returns the webhook with the specified ID.
+func (s service) Get(ctx context.Context, accountID, id int) (Webhook, error) {
+	webhook, err := s.get(ctx, accountID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{webhook}, nil
+}
+
+// get returns the webhook with the specified ID if it belongs to the account, or to any account if accountID is 0.
+func (s service) get(ctx context.Context, accountID, id int) (entity.Webhook, error) {
+	webhook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	if accountID != 0 && (webhook.AccountID == nil || *webhook.AccountID != accountID) {
+		return entity.Webhook{}, sql.ErrNoRows
+	}
+	return webhook, nil
+}
+
+// Count returns the number of webhooks.
+func (s service) Count(ctx context.Context, accountID int) (int, error) {
+	return s.repo.Count(ctx, accountID)
+}
+
+// Query returns the webhooks with the specified offset and limit.
+func (s service) Query(ctx context.Context, accountID int, offset, limit int) ([]Webhook, error) {
+	items, err := s.repo.Query(ctx, accountID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Webhook{}
+	for _, item := range items {
+		result = append(result, Webhook{item})
+	}
+	return result, nil
+}
+
+// Create registers a new webhook with a new signing secret.
+func (s service) Create(ctx context.Context, req CreateWebhookRequest) (WebhookWithSecret, error) {
+	if err := req.Validate(); err != nil {
+		return WebhookWithSecret{}, err
+	}
+	if err := s.sender.CheckURL(req.URL); err != nil {
+		return WebhookWithSecret{}, validation.Errors{"url": err}
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return WebhookWithSecret{}, err
+	}
+	now := time.Now()
+	webhook, err := s.repo.Create(ctx, entity.Webhook{
+		AccountID:  req.AccountID,
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+		Enabled:    true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	if err != nil {
+		return WebhookWithSecret{}, err
+	}
+	return WebhookWithSecret{Webhook{webhook}, secret}, nil
+}
+
+// Update updates the webhook with the specified ID.
+// If version is not 0, the webhook is only updated if it is at that version.
+func (s service) Update(ctx context.Context, accountID, id int, version int, req UpdateWebhookRequest) (Webhook, error) {
+	if err := req.Validate(); err != nil {
+		return Webhook{}, err
+	}
+	if req.URL != nil {
+		if err := s.sender.CheckURL(*req.URL); err != nil {
+			return Webhook{}, validation.Errors{"url": err}
+		}
+	}
+	webhook, err := s.get(ctx, accountID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := dbcontext.CheckVersion(webhook.Version, version); err != nil {
+		return Webhook{}, err
+	}
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		webhook.EventTypes = req.EventTypes
+	}
+	if req.Enabled != nil {
+		if *req.Enabled && !webhook.Enabled {
+			webhook.FailureCount = 0
+			webhook.DisabledAt = nil
+			webhook.DisabledReason = ""
+		}
+		webhook.Enabled = *req.Enabled
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return Webhook{}, err
+	}
+	webhook.Version++
+	return Webhook{webhook}, nil
+}
+
+// Delete deletes the webhook with the specified ID together with its deliveries.
+// If version is not 0, the webhook is only deleted if it is at that version.
+func (s service) Delete(ctx context.Context, accountID, id int, version int) (Webhook, error) {
+	webhook, err := s.Get(ctx, accountID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := dbcontext.CheckVersion(webhook.Version, version); err != nil {
+		return Webhook{}, err
+	}
+	if err = s.repo.Delete(ctx, id, webhook.Version); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// RotateSecret generates a new signing secret for a webhook. The previous secret expires after rotationGrace,
+// or immediately if it is rotated again.
+func (s service) RotateSecret(ctx context.Context, accountID, id int) (WebhookWithSecret, error) {
+	webhook, err := s.get(ctx, accountID, id)
+	if err != nil {
+		return WebhookWithSecret{}, err
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return WebhookWithSecret{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(rotationGrace)
+	webhook.PreviousSecret = webhook.Secret
+	webhook.PreviousSecretExpiresAt = &expiresAt
+	webhook.Secret = secret
+	webhook.UpdatedAt = now
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return WebhookWithSecret{}, err
+	}
+	webhook.Version++
+	return WebhookWithSecret{Webhook{webhook}, secret}, nil
+}
+
+// Test saves a test event and a delivery of it to a webhook, attempts the delivery once, and returns the attempt.
+// The event is saved as dispatched, so that it is not delivered to other webhooks, and the delivery is not retried.
+// Test attempts do not count as failures of the webhook.
+func (s service) Test(ctx context.Context, accountID, id int) (Attempt, error) {
+	webhook, err := s.get(ctx, accountID, id)
+	if err != nil {
+		return Attempt{}, err
+	}
+	e, err := event.New(event.WebhookTest, accountOf(webhook), strconv.Itoa(webhook.ID), map[string]interface{}{
+		"webhook_id": webhook.ID,
+		"message":    "This is a test event.",
+	})
+	if err != nil {
+		return Attempt{}, err
+	}
+	now := time.Now()
+	e.DispatchedAt = &now
+	var delivery entity.WebhookDelivery
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if e, err = s.repo.CreateEvent(ctx, e); err != nil {
+			return err
+		}
+		// the delivery is created as claimed, so that it is not attempted by a dispatcher meanwhile
+		delivery, err = s.repo.CreateDelivery(ctx, entity.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       e.ID,
+			Status:        entity.DeliveryPending,
+			NextAttemptAt: now.Add(claimLease),
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		return err
+	})
+	if err != nil {
+		return Attempt{}, err
+	}
+
+	attempt, err := s.sender.Send(ctx, webhook, delivery.ID, e)
+	delivery.Status = entity.DeliveryDelivered
+	if err != nil {
+		delivery.Status = entity.DeliveryDead
+	}
+	attempt, err = s.record(ctx, delivery, attempt, err)
+	if err != nil {
+		return Attempt{}, err
+	}
+	return Attempt{attempt}, nil
+}
+
+// accountOf returns the ID of the account of a webhook, or 0 if it is not restricted to an account.
+func accountOf(webhook entity.Webhook) int {
+	if webhook.AccountID == nil {
+		return 0
+	}
+	return *webhook.AccountID
+}
+
+// GetDelivery returns the delivery with the specified ID if it is a delivery of the webhook.
+func (s service) GetDelivery(ctx context.Context, accountID, webhookID int, id int64) (Delivery, error) {
+	if _, err := s.get(ctx, accountID, webhookID); err != nil {
+		return Delivery{}, err
+	}
+	delivery, err := s.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if delivery.WebhookID != webhookID {
+		return Delivery{}, sql.ErrNoRows
+	}
+	return Delivery{delivery}, nil
+}
+
+// QueryDeliveries returns the deliveries selected by the filter with the specified offset and limit.
+func (s service) QueryDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]Delivery, error) {
+	items, err := s.repo.QueryDeliveries(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Delivery{}
+	for _, item := range items {
+		result = append(result, Delivery{item})
+	}
+	return result, nil
+}
+
+// CountDeliveries returns the number of deliveries selected by the filter.
+func (s service) CountDeliveries(ctx context.Context, filter DeliveryFilter) (int, error) {
+	return s.repo.CountDeliveries(ctx, filter)
+}
+
+// Replay resets the attempts of a delivery of a webhook and makes it due immediately.
+func (s service) Replay(ctx context.Context, accountID, webhookID int, id int64) (Delivery, error) {
+	delivery, err := s.GetDelivery(ctx, accountID, webhookID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	now := time.Now()
+	delivery.Status = entity.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	delivery.Error = ""
+	delivery.UpdatedAt = now
+	if err := s.repo.UpdateDelivery(ctx, delivery.WebhookDelivery); err != nil {
+		return Delivery{}, err
+	}
+	return delivery, nil
+}
+
+// QueryAttempts returns the attempts of a delivery with the specified offset and limit.
+func (s service) QueryAttempts(ctx context.Context, deliveryID int64, offset, limit int) ([]Attempt, error) {
+	items, err := s.repo.QueryAttempts(ctx, deliveryID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Attempt{}
+	for _, item := range items {
+		result = append(result, Attempt{item})
+	}
+	return result, nil
+}
+
+// CountAttempts returns the number of attempts of a delivery.
+func (s service) CountAttempts(ctx context.Context, deliveryID int64) (int, error) {
+	return s.repo.CountAttempts(ctx, deliveryID)
+}
+
+// Dispatch creates the deliveries of all new events, then attempts the due deliveries until none is due.
+func (s service) Dispatch(ctx context.Context) error {
+	for {
+		n, err := s.fanOut(ctx)
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			break
+		}
+	}
+	for {
+		n, err := s.deliverDue(ctx)
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// fanOut claims a batch of new events and creates their deliveries to the enabled webhooks accepting them,
+// in one transaction. It returns the number of events claimed.
+func (s service) fanOut(ctx context.Context) (int, error) {
+	var n int
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		events, err := s.repo.ClaimEvents(ctx, batchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		n = len(events)
+		webhooks, err := s.repo.QueryEnabled(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		ids := make([]int64, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+			for _, webhook := range webhooks {
+				if !webhook.Accepts(e) {
+					continue
+				}
+				_, err := s.repo.CreateDelivery(ctx, entity.WebhookDelivery{
+					WebhookID:     webhook.ID,
+					EventID:       e.ID,
+					Status:        entity.DeliveryPending,
+					NextAttemptAt: now,
+					CreatedAt:     now,
+					UpdatedAt:     now,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return s.repo.MarkDispatched(ctx, ids, now)
+	})
+	return n, err
+}
+
+// deliverDue claims a batch of due deliveries and attempts them concurrently. It returns the number of deliveries claimed.
+func (s service) deliverDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	deliveries, err := s.repo.ClaimDeliveries(ctx, now, now.Add(claimLease), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery entity.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := s.attempt(ctx, delivery); err != nil && ctx.Err() == nil {
+				s.logger.With(ctx, "delivery", delivery.ID).Errorf("failed to save webhook delivery attempt: %v", err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), ctx.Err()
+}
+
+// attempt sends a delivery to its webhook and saves the attempt and its outcome: the delivery is delivered if the
+// webhook accepted it, and is otherwise retried later with exponential backoff until it is dead. The webhook is
+// disabled when its consecutive failed attempts reach the failure limit.
+func (s service) attempt(ctx context.Context, delivery entity.WebhookDelivery) error {
+	webhook, err := s.repo.Get(ctx, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+	if !webhook.Enabled {
+		delivery.Status = entity.DeliveryDead
+		delivery.Error = errDisabled.Error()
+		delivery.UpdatedAt = time.Now()
+		return s.repo.UpdateDelivery(ctx, delivery)
+	}
+	e, err := s.repo.GetEvent(ctx, delivery.EventID)
+	if err != nil {
+		return err
+	}
+
+	attempt, err := s.sender.Send(ctx, webhook, delivery.ID, e)
+	if ctx.Err() != nil {
+		// the dispatcher is stopping: the claim expires and the delivery is attempted again later
+		return nil
+	}
+	switch {
+	case err == nil:
+		delivery.Status = entity.DeliveryDelivered
+	case delivery.Attempts+1 >= s.maxAttempts:
+		delivery.Status = entity.DeliveryDead
+	default:
+		delivery.NextAttemptAt = time.Now().Add(retryDelay(delivery.Attempts + 1))
+	}
+	if _, err := s.record(ctx, delivery, attempt, err); err != nil {
+		return err
+	}
+
+	if err == nil {
+		if webhook.FailureCount == 0 {
+			return nil
+		}
+		return s.repo.ResetFailures(ctx, webhook.ID)
+	}
+	failures, err := s.repo.IncrementFailures(ctx, webhook.ID)
+	if err != nil || failures < s.failureLimit {
+		return err
+	}
+	return s.disable(ctx, webhook, fmt.Sprintf("%v consecutive delivery attempts failed", failures))
+}
+
+// record saves an attempt of a delivery that failed with sendErr, if not nil, and the delivery with its new status.
+func (s service) record(ctx context.Context, delivery entity.WebhookDelivery, attempt entity.WebhookAttempt, sendErr error) (entity.WebhookAttempt, error) {
+	delivery.Attempts++
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.Error = ""
+	if sendErr != nil {
+		delivery.Error = truncate(sendErr.Error(), maxErrorLength)
+	}
+	delivery.UpdatedAt = time.Now()
+	attempt.Error = delivery.Error
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if attempt, err = s.repo.CreateAttempt(ctx, attempt); err != nil {
+			return err
+		}
+		return s.repo.UpdateDelivery(ctx, delivery)
+	})
+	return attempt, err
+}
+
+// disable disables a webhook whose attempts keep failing, publishes a webhook.disabled event,
+// and notifies the owner of the webhook. Nothing is done if the webhook is already disabled.
+func (s service) disable(ctx context.Context, webhook entity.Webhook, reason string) error {
+	now := time.Now()
+	var disabled bool
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if disabled, err = s.repo.Disable(ctx, webhook.ID, reason, now); err != nil || !disabled {
+			return err
+		}
+		if webhook, err = s.repo.Get(ctx, webhook.ID); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.WebhookDisabled, accountOf(webhook), strconv.Itoa(webhook.ID), webhook)
+	})
+	if err != nil || !disabled {
+		return err
+	}
+	s.logger.With(ctx, "webhook", webhook.ID).Infof("webhook disabled: %v", reason)
+	if webhook.AccountID == nil {
+		return nil
+	}
+	email, err := s.repo.GetAccountEmail(ctx, *webhook.AccountID)
+	if err != nil {
+		return err
+	}
+	return s.notifier.NotifyDisabled(ctx, email, webhook)
+}
+
+// retryDelay returns the delay before the next attempt of a delivery that failed the given number of times.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		return retryMax
+	}
+	return delay
+}
+
+// truncate returns s truncated to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// RunDispatcher dispatches the events every interval until the context is canceled.
+func RunDispatcher(ctx context.Context, service Service, interval time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := service.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			logger.With(ctx).Errorf("webhook dispatch failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,698 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/test"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a webhook endpoint recording the deliveries whose signature is valid.
+type receiver struct {
+	secret string
+	status int
+
+	mu         sync.Mutex
+	deliveries []string
+	events     []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := Verify(r.secret, req.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, req.Header.Get(DeliveryHeader))
+	r.events = append(r.events, req.Header.Get(EventHeader))
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func TestCreateWebhookRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateWebhookRequest
+		wantError bool
+	}{
+		{"success", CreateWebhookRequest{URL: "https://example.com/hook", EventTypes: []string{event.DomainCreated, "album.*"}}, false},
+		{"all events", CreateWebhookRequest{URL: "http://example.com/hook"}, false},
+		{"required", CreateWebhookRequest{}, true},
+		{"scheme", CreateWebhookRequest{URL: "ftp://example.com/hook"}, true},
+		{"event type", CreateWebhookRequest{URL: "https://example.com/hook", EventTypes: []string{"domain.renamed"}}, true},
+		{"wildcard", CreateWebhookRequest{URL: "https://example.com/hook", EventTypes: []string{"*"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.model.Validate()
+			assert.Equal(t, tc.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{}, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 100, logger)
+	ctx := context.Background()
+
+	_, err := s.Create(ctx, CreateWebhookRequest{URL: "invalid"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, CreateWebhookRequest{URL: "http://169.254.169.254/latest/meta-data/"})
+	assert.Equal(t, "url: must not be a private or reserved address.", err.Error())
+
+	webhook, err := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/hook", AccountID: intPtr(1), EventTypes: []string{"domain.*"}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, webhook.ID)
+	assert.True(t, webhook.Enabled)
+	assert.Contains(t, webhook.Secret, secretPrefix)
+	global, _ := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/global"})
+	count, _ := s.Count(ctx, 0)
+	assert.Equal(t, 2, count)
+	count, _ = s.Count(ctx, 1)
+	assert.Equal(t, 1, count)
+
+	// the webhooks of other accounts are not found
+	fetched, err := s.Get(ctx, 1, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/hook", fetched.URL)
+	_, err = s.Get(ctx, 2, webhook.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Get(ctx, 1, global.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Get(ctx, 0, global.ID)
+	assert.Nil(t, err)
+	webhooks, _ := s.Query(ctx, 1, 0, 10)
+	assert.Equal(t, 1, len(webhooks))
+
+	// update
+	url := "https://example.com/other"
+	_, err = s.Update(ctx, 1, webhook.ID, 0, UpdateWebhookRequest{URL: strPtr("ftp://example.com")})
+	assert.NotNil(t, err)
+	_, err = s.Update(ctx, 1, webhook.ID, 0, UpdateWebhookRequest{URL: strPtr("http://10.0.0.1/hook")})
+	assert.NotNil(t, err)
+	_, err = s.Update(ctx, 2, webhook.ID, 0, UpdateWebhookRequest{URL: &url})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Update(ctx, 1, webhook.ID, 2, UpdateWebhookRequest{URL: &url})
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	updated, err := s.Update(ctx, 1, webhook.ID, 1, UpdateWebhookRequest{URL: &url, Enabled: boolPtr(false)})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, url, updated.URL)
+	assert.Equal(t, entity.EventTypes{"domain.*"}, updated.EventTypes)
+	assert.False(t, updated.Enabled)
+	updated, err = s.Update(ctx, 1, webhook.ID, 0, UpdateWebhookRequest{EventTypes: []string{}, Enabled: boolPtr(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, url, updated.URL)
+	assert.Empty(t, updated.EventTypes)
+	assert.True(t, updated.Enabled)
+
+	// rotate secret
+	rotated, err := s.RotateSecret(ctx, 1, webhook.ID)
+	assert.Nil(t, err)
+	assert.NotEqual(t, webhook.Secret, rotated.Secret)
+	assert.Equal(t, []string{rotated.Secret, webhook.Secret}, rotated.Secrets(time.Now()))
+	assert.Equal(t, []string{rotated.Secret}, rotated.Secrets(time.Now().Add(rotationGrace)))
+	assert.Equal(t, 4, rotated.Version)
+	_, err = s.RotateSecret(ctx, 2, webhook.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// delete
+	_, err = s.Delete(ctx, 2, webhook.ID, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(ctx, 1, webhook.ID, 3)
+	assert.Equal(t, dbcontext.ErrConflict, err)
+	_, err = s.Delete(ctx, 1, webhook.ID, 4)
+	assert.Nil(t, err)
+	_, err = s.Get(ctx, 0, webhook.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(ctx, 0, webhook.ID, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Dispatch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusNoContent}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{}
+	s := NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 100, logger)
+	ctx := context.Background()
+	domains, err := s.Create(ctx, CreateWebhookRequest{URL: server.URL, EventTypes: []string{"domain.*"}})
+	assert.Nil(t, err)
+	r.secret = domains.Secret
+	all, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL})
+	other, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL, AccountID: intPtr(2)})
+
+	repo.publish(t, event.DomainCreated, 1)
+	repo.publish(t, event.AlbumCreated, 0)
+	assert.Nil(t, s.Dispatch(ctx))
+
+	// the domain event is delivered to the domain webhook and the webhook of all events, but not to the
+	// webhook of another account; the album event is only delivered to the webhook of all events, whose
+	// deliveries fail because they are not signed with the secret expected by the receiver
+	assert.Equal(t, []string{event.DomainCreated}, r.events)
+	deliveries, _ := s.QueryDeliveries(ctx, DeliveryFilter{WebhookID: domains.ID}, 0, 10)
+	if assert.Equal(t, 1, len(deliveries)) {
+		assert.Equal(t, entity.DeliveryDelivered, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+	}
+	count, _ := s.CountDeliveries(ctx, DeliveryFilter{WebhookID: all.ID, Status: entity.DeliveryPending})
+	assert.Equal(t, 2, count)
+	count, _ = s.CountDeliveries(ctx, DeliveryFilter{WebhookID: other.ID})
+	assert.Equal(t, 0, count)
+	for _, e := range repo.events {
+		assert.NotNil(t, e.DispatchedAt)
+	}
+
+	// events are only dispatched once
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 1, r.count())
+}
+
+func Test_service_retries(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{}
+	s := NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 100, logger)
+	ctx := context.Background()
+	webhook, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL})
+	r.secret = webhook.Secret
+	repo.publish(t, event.AccountUpdated, 1)
+
+	// failed attempts are retried with exponential backoff
+	start := time.Now()
+	assert.Nil(t, s.Dispatch(ctx))
+	delivery := repo.deliveries[0]
+	assert.Equal(t, entity.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.ResponseStatus)
+	assert.Equal(t, "the webhook responded with status 503", delivery.Error)
+	assert.True(t, delivery.NextAttemptAt.Sub(start) >= retryBase)
+
+	// deliveries are not attempted before they are due
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 1, r.count())
+
+	repo.deliveries[0].NextAttemptAt = start
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 2, repo.deliveries[0].Attempts)
+	assert.True(t, repo.deliveries[0].NextAttemptAt.Sub(start) >= 2*retryBase)
+
+	// deliveries are dead after the maximum number of attempts
+	repo.deliveries[0].NextAttemptAt = start
+	assert.Nil(t, s.Dispatch(ctx))
+	delivery = repo.deliveries[0]
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	repo.deliveries[0].NextAttemptAt = start
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 3, r.count())
+
+	// dead deliveries can be replayed, with the same delivery ID
+	r.status = http.StatusOK
+	_, err := s.Replay(ctx, 0, webhook.ID+1, delivery.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Replay(ctx, 0, webhook.ID, delivery.ID+1)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Replay(ctx, 1, webhook.ID, delivery.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	replayed, err := s.Replay(ctx, 0, webhook.ID, delivery.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.DeliveryPending, replayed.Status)
+	assert.Equal(t, 0, replayed.Attempts)
+	assert.Empty(t, replayed.Error)
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, entity.DeliveryDelivered, repo.deliveries[0].Status)
+	assert.Equal(t, 1, repo.deliveries[0].Attempts)
+	assert.Equal(t, []string{"1", "1", "1", "1"}, r.deliveries)
+
+	// every attempt is recorded
+	count, _ := s.CountAttempts(ctx, delivery.ID)
+	assert.Equal(t, 4, count)
+	attempts, err := s.QueryAttempts(ctx, delivery.ID, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 4, len(attempts)) {
+		assert.Equal(t, http.StatusOK, attempts[0].ResponseStatus)
+		assert.Empty(t, attempts[0].Error)
+		assert.Equal(t, http.StatusServiceUnavailable, attempts[3].ResponseStatus)
+		assert.Equal(t, "the webhook responded with status 503", attempts[3].Error)
+		assert.Contains(t, attempts[3].RequestBody, `"type":"account.updated"`)
+	}
+	// and the failures of the webhook are reset by a success
+	fetched, _ := s.Get(ctx, 0, webhook.ID)
+	assert.Equal(t, 0, fetched.FailureCount)
+}
+
+func Test_service_disabled(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{}
+	s := NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 100, logger)
+	ctx := context.Background()
+	webhook, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL})
+	repo.publish(t, event.AccountUpdated, 1)
+	_, err := s.(service).fanOut(ctx)
+	assert.Nil(t, err)
+
+	// the pending deliveries of a webhook are dead once it is disabled
+	repo.webhooks[0].Enabled = false
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 0, r.count())
+	deliveries, _ := s.QueryDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID}, 0, 10)
+	if assert.Equal(t, 1, len(deliveries)) {
+		assert.Equal(t, entity.DeliveryDead, deliveries[0].Status)
+		assert.Equal(t, errDisabled.Error(), deliveries[0].Error)
+	}
+}
+
+func Test_service_autoDisable(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{emails: map[int]string{1: "owner@example.com"}}
+	events := &event.Recorder{}
+	notifier := &mockNotifier{}
+	s := NewService(repo, NewSender(time.Second, loopback), events, notifier, test.MockTransactional, 10, 3, logger)
+	ctx := context.Background()
+	webhook, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL, AccountID: intPtr(1)})
+	r.secret = webhook.Secret
+	repo.publish(t, event.AccountUpdated, 1)
+
+	// the webhook is disabled once its consecutive failed attempts reach the limit
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, s.Dispatch(ctx))
+		assert.Equal(t, i, r.count())
+		repo.deliveries[0].NextAttemptAt = time.Now()
+		if i < 3 {
+			fetched, _ := s.Get(ctx, 1, webhook.ID)
+			assert.True(t, fetched.Enabled)
+			assert.Equal(t, i, fetched.FailureCount)
+			assert.Empty(t, events.Events)
+		}
+	}
+	fetched, _ := s.Get(ctx, 1, webhook.ID)
+	assert.False(t, fetched.Enabled)
+	assert.NotNil(t, fetched.DisabledAt)
+	assert.Equal(t, "3 consecutive delivery attempts failed", fetched.DisabledReason)
+
+	// the pending deliveries of a disabled webhook are dead without being attempted
+	assert.Nil(t, s.Dispatch(ctx))
+	assert.Equal(t, 3, r.count())
+	count, _ := s.CountDeliveries(ctx, DeliveryFilter{WebhookID: webhook.ID, Status: entity.DeliveryDead})
+	assert.Equal(t, 1, count)
+
+	// a webhook.disabled event is published and the owner of the account is notified
+	assert.Equal(t, []string{event.WebhookDisabled}, events.Types())
+	assert.Equal(t, 1, *events.Events[0].AccountID)
+	assert.Equal(t, []string{"owner@example.com"}, notifier.emails)
+
+	// enabling the webhook resets its failures
+	enabled, err := s.Update(ctx, 1, webhook.ID, 0, UpdateWebhookRequest{Enabled: boolPtr(true)})
+	assert.Nil(t, err)
+	assert.True(t, enabled.Enabled)
+	assert.Equal(t, 0, enabled.FailureCount)
+	assert.Nil(t, enabled.DisabledAt)
+	assert.Empty(t, enabled.DisabledReason)
+}
+
+func Test_service_Test(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusAccepted}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{}
+	s := NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 1, logger)
+	ctx := context.Background()
+	webhook, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL, AccountID: intPtr(1), EventTypes: []string{"domain.*"}})
+	r.secret = webhook.Secret
+
+	// test events are sent to disabled webhooks not subscribed to them
+	_, err := s.Update(ctx, 1, webhook.ID, 0, UpdateWebhookRequest{Enabled: boolPtr(false)})
+	assert.Nil(t, err)
+	_, err = s.Test(ctx, 2, webhook.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	attempt, err := s.Test(ctx, 1, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusAccepted, attempt.ResponseStatus)
+	assert.Contains(t, attempt.RequestBody, `"type":"webhook.test"`)
+	assert.Equal(t, []string{event.WebhookTest}, r.events)
+	delivery, err := s.GetDelivery(ctx, 1, webhook.ID, attempt.DeliveryID)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	_, err = s.GetDelivery(ctx, 2, webhook.ID, attempt.DeliveryID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// failed test deliveries are dead, and are not failures of the webhook
+	r.status = http.StatusBadRequest
+	attempt, err = s.Test(ctx, 1, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, attempt.ResponseStatus)
+	assert.Equal(t, "the webhook responded with status 400", attempt.Error)
+	delivery, _ = s.GetDelivery(ctx, 1, webhook.ID, attempt.DeliveryID)
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+	fetched, _ := s.Get(ctx, 1, webhook.ID)
+	assert.Equal(t, 0, fetched.FailureCount)
+
+	// test events are not dispatched to other webhooks
+	other, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL})
+	assert.Nil(t, s.Dispatch(ctx))
+	count, _ := s.CountDeliveries(ctx, DeliveryFilter{WebhookID: other.ID})
+	assert.Equal(t, 0, count)
+}
+
+func TestRunDispatcher(t *testing.T) {
+	logger, _ := log.NewForTest()
+	r := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	repo := &mockRepository{}
+	s := NewService(repo, NewSender(time.Second, loopback), &event.Recorder{}, &mockNotifier{}, test.MockTransactional, 3, 100, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	webhook, _ := s.Create(ctx, CreateWebhookRequest{URL: server.URL})
+	r.secret = webhook.Secret
+	repo.publish(t, event.AlbumDeleted, 0)
+
+	done := make(chan struct{})
+	go func() {
+		RunDispatcher(ctx, s, time.Hour, logger)
+		close(done)
+	}()
+	for i := 0; i < 100 && r.count() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	assert.Equal(t, []string{event.AlbumDeleted}, r.events)
+}
+
+func Test_retryDelay(t *testing.T) {
+	assert.Equal(t, retryBase, retryDelay(1))
+	assert.Equal(t, 2*retryBase, retryDelay(2))
+	assert.Equal(t, 8*retryBase, retryDelay(4))
+	assert.Equal(t, retryMax, retryDelay(20))
+	assert.Equal(t, retryMax, retryDelay(1000))
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+type mockNotifier struct {
+	emails []string
+}
+
+func (m *mockNotifier) NotifyDisabled(ctx context.Context, email string, webhook entity.Webhook) error {
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+type mockRepository struct {
+	mu         sync.Mutex
+	webhooks   []entity.Webhook
+	emails     map[int]string
+	events     []entity.Event
+	deliveries []entity.WebhookDelivery
+	attempts   []entity.WebhookAttempt
+}
+
+// publish adds an event to the outbox.
+func (m *mockRepository) publish(t *testing.T, eventType string, accountID int) {
+	e, err := event.New(eventType, accountID, "1", map[string]int{"id": 1})
+	assert.Nil(t, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, e)
+}
+
+func (m *mockRepository) Get(ctx context.Context, id int) (entity.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return entity.Webhook{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Count(ctx context.Context, accountID int) (int, error) {
+	webhooks, _ := m.Query(ctx, accountID, 0, 0)
+	return len(webhooks), nil
+}
+
+func (m *mockRepository) Query(ctx context.Context, accountID int, offset, limit int) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	for _, webhook := range m.webhooks {
+		if accountID == 0 || webhook.AccountID != nil && *webhook.AccountID == accountID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) QueryEnabled(ctx context.Context) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.Enabled {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) EncryptSecrets(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, webhook entity.Webhook) (entity.Webhook, error) {
+	webhook.ID = len(m.webhooks) + 1
+	webhook.Version = 1
+	m.webhooks = append(m.webhooks, webhook)
+	return webhook, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, webhook entity.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == webhook.ID {
+			if m.webhooks[i].Version != webhook.Version {
+				return dbcontext.ErrConflict
+			}
+			webhook.Version++
+			m.webhooks[i] = webhook
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) IncrementFailures(ctx context.Context, id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == id {
+			m.webhooks[i].FailureCount++
+			m.webhooks[i].Version++
+			return m.webhooks[i].FailureCount, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (m *mockRepository) ResetFailures(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == id && m.webhooks[i].FailureCount != 0 {
+			m.webhooks[i].FailureCount = 0
+			m.webhooks[i].Version++
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Disable(ctx context.Context, id int, reason string, t time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == id && m.webhooks[i].Enabled {
+			m.webhooks[i].Enabled = false
+			m.webhooks[i].DisabledAt = &t
+			m.webhooks[i].DisabledReason = reason
+			m.webhooks[i].Version++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) GetAccountEmail(ctx context.Context, accountID int) (string, error) {
+	if email, ok := m.emails[accountID]; ok {
+		return email, nil
+	}
+	return "", sql.ErrNoRows
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id int, version int) error {
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id {
+			if webhook.Version != version {
+				return dbcontext.ErrConflict
+			}
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) ClaimEvents(ctx context.Context, limit int) ([]entity.Event, error) {
+	var events []entity.Event
+	for _, e := range m.events {
+		if e.DispatchedAt == nil && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockRepository) MarkDispatched(ctx context.Context, ids []int64, t time.Time) error {
+	for _, id := range ids {
+		m.events[id-1].DispatchedAt = &t
+	}
+	return nil
+}
+
+func (m *mockRepository) GetEvent(ctx context.Context, id int64) (entity.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || int(id) > len(m.events) {
+		return entity.Event{}, sql.ErrNoRows
+	}
+	return m.events[id-1], nil
+}
+
+func (m *mockRepository) CreateEvent(ctx context.Context, e entity.Event) (entity.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, e)
+	return e, nil
+}
+
+func (m *mockRepository) GetDelivery(ctx context.Context, id int64) (entity.WebhookDelivery, error) {
+	if id < 1 || int(id) > len(m.deliveries) {
+		return entity.WebhookDelivery{}, sql.ErrNoRows
+	}
+	return m.deliveries[id-1], nil
+}
+
+func (m *mockRepository) CountDeliveries(ctx context.Context, filter DeliveryFilter) (int, error) {
+	deliveries, _ := m.QueryDeliveries(ctx, filter, 0, 0)
+	return len(deliveries), nil
+}
+
+func (m *mockRepository) QueryDeliveries(ctx context.Context, filter DeliveryFilter, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookID == filter.WebhookID && (filter.Status == "" || delivery.Status == filter.Status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	return deliveries, nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, delivery)
+	return delivery, nil
+}
+
+func (m *mockRepository) ClaimDeliveries(ctx context.Context, now, until time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for i, delivery := range m.deliveries {
+		if delivery.Status == entity.DeliveryPending && !delivery.NextAttemptAt.After(now) && len(deliveries) < limit {
+			m.deliveries[i].NextAttemptAt = until
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if delivery.ID < 1 || int(delivery.ID) > len(m.deliveries) {
+		return sql.ErrNoRows
+	}
+	m.deliveries[delivery.ID-1] = delivery
+	return nil
+}
+
+func (m *mockRepository) CountAttempts(ctx context.Context, deliveryID int64) (int, error) {
+	attempts, _ := m.QueryAttempts(ctx, deliveryID, 0, 0)
+	return len(attempts), nil
+}
+
+func (m *mockRepository) QueryAttempts(ctx context.Context, deliveryID int64, offset, limit int) ([]entity.WebhookAttempt, error) {
+	var attempts []entity.WebhookAttempt
+	for i := len(m.attempts) - 1; i >= 0; i-- {
+		if m.attempts[i].DeliveryID == deliveryID {
+			attempts = append(attempts, m.attempts[i])
+		}
+	}
+	return attempts, nil
+}
+
+func (m *mockRepository) CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) (entity.WebhookAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt.ID = int64(len(m.attempts) + 1)
+	m.attempts = append(m.attempts, attempt)
+	return attempt, nil
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of the deliveries
+const (
+	// SignatureHeader carries the signature of a delivery, e.g. "t=1600000000,v1=5257a869...".
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader carries the type of the delivered event.
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader carries the ID of the delivery, which is the same for all its attempts.
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// secretPrefix is the prefix of signing secrets, making them recognizable.
+const secretPrefix = "whsec_"
+
+var (
+	errMalformedSignature = errors.New("the signature header is malformed")
+	errSignatureMismatch  = errors.New("the signature does not match the body")
+	errSignatureExpired   = errors.New("the signature timestamp is outside the tolerance")
+)
+
+// Sign returns the signature header of a delivery body sent at the given time. The signature is the hex-encoded
+// HMAC-SHA256 of the Unix timestamp, a dot and the body, keyed with the secret of the webhook, so that receivers
+// can reject both forged and replayed deliveries. The header has a signature for each secret, so that deliveries
+// are signed with both the current and the previous secret of a webhook while its secret is rotated.
+func Sign(t time.Time, body []byte, secrets ...string) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	header := "t=" + timestamp
+	for _, secret := range secrets {
+		header += ",v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+	}
+	return header
+}
+
+// Verify checks the signature header of a delivery body received at the given time. The signature must have been
+// made with the secret no longer than tolerance before or after now. Any of several v1 signatures may match,
+// so that receivers keep accepting deliveries while a secret is rotated.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return errMalformedSignature
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signature, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return errMalformedSignature
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errMalformedSignature
+	}
+	if d := now.Sub(time.Unix(seconds, 0)); d > tolerance || d < -tolerance {
+		return errSignatureExpired
+	}
+	expected := mac(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errSignatureMismatch
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// NewSecret generates a random signing secret.
+func NewSecret() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(key), nil
+}
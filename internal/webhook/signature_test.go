@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"id":1}`)
+	header := Sign(now, body, "secret")
+	assert.True(t, strings.HasPrefix(header, "t=1600000000,v1="))
+	assert.Equal(t, header, Sign(now, body, "secret"))
+	assert.NotEqual(t, header, Sign(now, body, "other"))
+	assert.NotEqual(t, header, Sign(now.Add(time.Second), body, "secret"))
+
+	// one signature per secret
+	rotated := Sign(now, body, "secret", "old")
+	assert.True(t, strings.HasPrefix(rotated, header+",v1="))
+	assert.Nil(t, Verify("old", rotated, body, now, time.Minute))
+	assert.Equal(t, "t=1600000000", Sign(now, body))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"id":1}`)
+	header := Sign(now, body, "secret")
+	old := strings.SplitN(Sign(now, body, "old"), ",", 2)[1]
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    string
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", "secret", header, `{"id":1}`, now, nil},
+		{"within tolerance", "secret", header, `{"id":1}`, now.Add(4 * time.Minute), nil},
+		{"rotated", "secret", header + "," + old, `{"id":1}`, now, nil},
+		{"rotated first", "secret", strings.Replace(header, "v1=", old+",v1=", 1), `{"id":1}`, now, nil},
+		{"wrong secret", "other", header, `{"id":1}`, now, errSignatureMismatch},
+		{"tampered body", "secret", header, `{"id":2}`, now, errSignatureMismatch},
+		{"expired", "secret", header, `{"id":1}`, now.Add(6 * time.Minute), errSignatureExpired},
+		{"future", "secret", header, `{"id":1}`, now.Add(-6 * time.Minute), errSignatureExpired},
+		{"empty", "secret", "", `{"id":1}`, now, errMalformedSignature},
+		{"no signature", "secret", "t=1600000000", `{"id":1}`, now, errMalformedSignature},
+		{"no timestamp", "secret", strings.SplitN(header, ",", 2)[1], `{"id":1}`, now, errMalformedSignature},
+		{"not hex", "secret", "t=1600000000,v1=xyz", `{"id":1}`, now, errMalformedSignature},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, Verify(tc.secret, tc.header, []byte(tc.body), tc.now, 5*time.Minute))
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	s1, err := NewSecret()
+	assert.Nil(t, err)
+	s2, _ := NewSecret()
+	assert.True(t, strings.HasPrefix(s1, secretPrefix))
+	assert.Equal(t, len(secretPrefix)+48, len(s1))
+	assert.NotEqual(t, s1, s2)
+}
@@ -0,0 +1,2 @@
+-- the account and domain tables are created only if they do not exist yet, so they may hold data that predates this
+-- migration and are left in place. The certificate tables are dropped by the down migration of the certificates.
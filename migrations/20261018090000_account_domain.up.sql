@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS account
+(
+    id          SERIAL PRIMARY KEY,
+    email       VARCHAR NOT NULL UNIQUE,
+    firebase_id VARCHAR NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS domain
+(
+    id         SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    domain     VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
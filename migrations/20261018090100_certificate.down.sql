@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS certificate;
+DROP TABLE IF EXISTS acme_challenge;
+DROP TABLE IF EXISTS acme_account;
+ALTER TABLE domain DROP COLUMN IF EXISTS verified_at;
@@ -0,0 +1,31 @@
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+
+CREATE TABLE acme_account
+(
+    directory_url VARCHAR PRIMARY KEY,
+    uri           VARCHAR NOT NULL,
+    key_encrypted BYTEA NOT NULL,
+    created_at    TIMESTAMP NOT NULL
+);
+
+CREATE TABLE acme_challenge
+(
+    token             VARCHAR PRIMARY KEY,
+    key_authorization VARCHAR NOT NULL,
+    created_at        TIMESTAMP NOT NULL
+);
+
+CREATE TABLE certificate
+(
+    domain_id      INTEGER PRIMARY KEY REFERENCES domain (id) ON DELETE CASCADE,
+    status         VARCHAR NOT NULL,
+    serial_number  VARCHAR NOT NULL DEFAULT '',
+    not_before     TIMESTAMP,
+    not_after      TIMESTAMP,
+    cert_encrypted BYTEA,
+    key_encrypted  BYTEA,
+    last_error     VARCHAR NOT NULL DEFAULT '',
+    retry_after    TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL,
+    updated_at     TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS domain_check;
+ALTER TABLE domain DROP COLUMN IF EXISTS health;
@@ -0,0 +1,17 @@
+ALTER TABLE domain ADD COLUMN health VARCHAR NOT NULL DEFAULT 'unknown';
+
+CREATE TABLE domain_check
+(
+    id          SERIAL PRIMARY KEY,
+    domain_id   INTEGER NOT NULL REFERENCES domain (id) ON DELETE CASCADE,
+    healthy     BOOLEAN NOT NULL,
+    dns_ok      BOOLEAN NOT NULL,
+    records     VARCHAR NOT NULL DEFAULT '',
+    http_ok     BOOLEAN NOT NULL,
+    http_status INTEGER NOT NULL DEFAULT 0,
+    error       VARCHAR NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL,
+    checked_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX domain_check_domain_id_checked_at_idx ON domain_check (domain_id, checked_at);
@@ -0,0 +1,8 @@
+CREATE TABLE domain_config
+(
+    domain_id  INTEGER NOT NULL REFERENCES domain (id) ON DELETE CASCADE,
+    version    INTEGER NOT NULL,
+    rules      JSONB   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (domain_id, version)
+);
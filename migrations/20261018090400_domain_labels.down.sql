@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS domain_labels_idx;
+ALTER TABLE domain DROP COLUMN IF EXISTS labels;
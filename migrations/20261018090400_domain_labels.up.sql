@@ -0,0 +1,3 @@
+ALTER TABLE domain ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX domain_labels_idx ON domain USING GIN (labels);
@@ -0,0 +1,14 @@
+CREATE TABLE dns_record
+(
+    id         SERIAL PRIMARY KEY,
+    domain_id  INTEGER NOT NULL REFERENCES domain (id) ON DELETE CASCADE,
+    name       VARCHAR NOT NULL,
+    type       VARCHAR NOT NULL,
+    ttl        INTEGER NOT NULL,
+    priority   INTEGER NOT NULL DEFAULT 0,
+    value      VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX dns_record_domain_id_name_idx ON dns_record (domain_id, name);
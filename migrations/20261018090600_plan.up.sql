@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS plan
+(
+    id                  VARCHAR PRIMARY KEY,
+    name                VARCHAR NOT NULL,
+    max_domains         INTEGER NOT NULL,
+    max_api_keys        INTEGER NOT NULL,
+    requests_per_minute INTEGER NOT NULL
+);
+
+INSERT INTO plan (id, name, max_domains, max_api_keys, requests_per_minute)
+VALUES ('free', 'Free', 3, 1, 60),
+       ('pro', 'Pro', 100, 10, 600),
+       ('enterprise', 'Enterprise', 0, 0, 6000)
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE account ADD COLUMN plan_id VARCHAR NOT NULL DEFAULT 'free' REFERENCES plan (id);
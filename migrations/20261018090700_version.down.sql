@@ -0,0 +1,4 @@
+ALTER TABLE dns_record DROP COLUMN IF EXISTS version;
+ALTER TABLE domain DROP COLUMN IF EXISTS version;
+ALTER TABLE account DROP COLUMN IF EXISTS version;
+ALTER TABLE album DROP COLUMN IF EXISTS version;
@@ -0,0 +1,4 @@
+ALTER TABLE album ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE account ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE domain ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE dns_record ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
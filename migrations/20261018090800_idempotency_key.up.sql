@@ -0,0 +1,16 @@
+CREATE TABLE idempotency_key
+(
+    user_id      VARCHAR   NOT NULL,
+    key          VARCHAR   NOT NULL,
+    method       VARCHAR   NOT NULL,
+    path         VARCHAR   NOT NULL,
+    request_hash VARCHAR   NOT NULL,
+    status       INTEGER   NOT NULL DEFAULT 0,
+    header       BYTEA,
+    body         BYTEA,
+    created_at   TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
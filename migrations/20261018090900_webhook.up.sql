@@ -0,0 +1,41 @@
+CREATE TABLE event
+(
+    id            BIGSERIAL PRIMARY KEY,
+    type          VARCHAR   NOT NULL,
+    account_id    INTEGER,
+    resource_id   VARCHAR   NOT NULL,
+    data          JSONB     NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX event_undispatched_idx ON event (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE webhook
+(
+    id          SERIAL PRIMARY KEY,
+    account_id  INTEGER REFERENCES account (id) ON DELETE CASCADE,
+    url         VARCHAR   NOT NULL,
+    secret      VARCHAR   NOT NULL,
+    event_types JSONB     NOT NULL DEFAULT '[]',
+    enabled     BOOLEAN   NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_delivery
+(
+    id              BIGSERIAL PRIMARY KEY,
+    webhook_id      INTEGER   NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event_id        BIGINT    NOT NULL REFERENCES event (id) ON DELETE CASCADE,
+    status          VARCHAR   NOT NULL,
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    response_status INTEGER   NOT NULL DEFAULT 0,
+    error           VARCHAR   NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS webhook_attempt;
+DROP INDEX IF EXISTS webhook_account_id_idx;
+
+ALTER TABLE webhook
+    DROP COLUMN IF EXISTS previous_secret,
+    DROP COLUMN IF EXISTS previous_secret_expires_at,
+    DROP COLUMN IF EXISTS failure_count,
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS disabled_reason;
@@ -0,0 +1,24 @@
+ALTER TABLE webhook
+    ADD COLUMN previous_secret            VARCHAR   NOT NULL DEFAULT '',
+    ADD COLUMN previous_secret_expires_at TIMESTAMP,
+    ADD COLUMN failure_count              INTEGER   NOT NULL DEFAULT 0,
+    ADD COLUMN disabled_at                TIMESTAMP,
+    ADD COLUMN disabled_reason            VARCHAR   NOT NULL DEFAULT '';
+
+CREATE INDEX webhook_account_id_idx ON webhook (account_id, id);
+
+CREATE TABLE webhook_attempt
+(
+    id               BIGSERIAL PRIMARY KEY,
+    delivery_id      BIGINT    NOT NULL REFERENCES webhook_delivery (id) ON DELETE CASCADE,
+    request_headers  JSONB     NOT NULL DEFAULT '{}',
+    request_body     TEXT      NOT NULL DEFAULT '',
+    response_status  INTEGER   NOT NULL DEFAULT 0,
+    response_headers JSONB     NOT NULL DEFAULT '{}',
+    response_body    TEXT      NOT NULL DEFAULT '',
+    error            VARCHAR   NOT NULL DEFAULT '',
+    duration         INTEGER   NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_attempt_delivery_id_idx ON webhook_attempt (delivery_id, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS event_account_id_idx;
+DROP TRIGGER IF EXISTS event_notify ON event;
+DROP FUNCTION IF EXISTS notify_event();
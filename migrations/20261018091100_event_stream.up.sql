@@ -0,0 +1,16 @@
+-- notify the servers streaming events of every new event, with its ID as payload
+CREATE OR REPLACE FUNCTION notify_event() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('event', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER event_notify
+    AFTER INSERT
+    ON event
+    FOR EACH ROW
+EXECUTE PROCEDURE notify_event();
+
+CREATE INDEX event_account_id_idx ON event (account_id, id);
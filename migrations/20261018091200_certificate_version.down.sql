@@ -0,0 +1 @@
+ALTER TABLE certificate DROP COLUMN IF EXISTS version;
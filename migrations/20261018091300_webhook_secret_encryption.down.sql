@@ -0,0 +1,4 @@
+ALTER TABLE webhook
+    DROP COLUMN secret_encrypted,
+    DROP COLUMN previous_secret_encrypted,
+    ALTER COLUMN secret DROP DEFAULT;
@@ -0,0 +1,5 @@
+-- the secrets are encrypted by the application, which moves the secrets saved before into the new columns
+ALTER TABLE webhook
+    ADD COLUMN secret_encrypted          BYTEA,
+    ADD COLUMN previous_secret_encrypted BYTEA,
+    ALTER COLUMN secret SET DEFAULT '';
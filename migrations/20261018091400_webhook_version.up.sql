@@ -0,0 +1 @@
+ALTER TABLE webhook ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS event_account_id_idx;
+CREATE INDEX event_account_id_idx ON event (account_id, id);
+ALTER TABLE event DROP COLUMN IF EXISTS position;
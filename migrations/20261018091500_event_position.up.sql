@@ -0,0 +1,12 @@
+-- the position of an event in the streams is given once the transaction saving the event has committed, in the order
+-- of the commits, whereas its ID is taken from a sequence when it is saved, in no particular order of the commits.
+-- The events saved before keep their IDs as positions, so that the streams resuming from them are not affected.
+ALTER TABLE event ADD COLUMN position BIGINT;
+UPDATE event SET position = id;
+CREATE SEQUENCE event_position_seq OWNED BY event.position;
+SELECT setval('event_position_seq', (SELECT COALESCE(MAX(id), 0) + 1 FROM event), false);
+
+CREATE UNIQUE INDEX event_position_idx ON event (position);
+CREATE INDEX event_unpositioned_idx ON event (id) WHERE position IS NULL;
+DROP INDEX IF EXISTS event_account_id_idx;
+CREATE INDEX event_account_id_idx ON event (account_id, position);
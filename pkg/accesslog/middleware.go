@@ -15,7 +15,7 @@ func Handler(logger log.Logger) routing.Handler {
 		start := time.Now()
 
 		rw := &access.LogResponseWriter{ResponseWriter: c.Response, Status: http.StatusOK}
-		c.Response = rw
+		c.Response = flushWriter{rw}
 
 		// associate request ID and session ID with the request context
 		// so that they can be added to the log messages
@@ -32,3 +32,15 @@ func Handler(logger log.Logger) routing.Handler {
 		return err
 	}
 }
+
+// flushWriter wraps access.LogResponseWriter so that handlers streaming a response can still flush it.
+type flushWriter struct {
+	*access.LogResponseWriter
+}
+
+// Flush sends any buffered data to the client if the underlying response writer supports flushing.
+func (w flushWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
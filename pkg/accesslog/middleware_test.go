@@ -22,3 +22,21 @@ func TestHandler(t *testing.T) {
 	assert.Equal(t, 1, entries.Len())
 	assert.Equal(t, "GET /users HTTP/1.1 200 0", entries.All()[0].Message)
 }
+
+func TestHandler_Flush(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://127.0.0.1/users", nil)
+	logger, _ := log.NewForTest()
+	ctx := routing.NewContext(res, req, Handler(logger), func(c *routing.Context) error {
+		flusher, ok := c.Response.(http.Flusher)
+		if assert.True(t, ok) {
+			_, _ = c.Response.Write([]byte("test"))
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	assert.Nil(t, ctx.Next())
+	assert.True(t, res.Flushed)
+	assert.Equal(t, "test", res.Body.String())
+}
@@ -0,0 +1,89 @@
+// Package codec provides the data writers and readers of the media types other than JSON that the API can
+// respond with and read request bodies in. The data is encoded the same as encoding/json encodes it, so that
+// the field names and values are the same in all media types.
+//
+// Paginated lists (pagination.Pages and pagination.CursorPages) are written as their items in the media types
+// that represent lists of records (CSV and NDJSON). The pagination information is still available in the
+// Link and X-Total-Count headers.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+// MIME types
+const (
+	CSV     = "text/csv"
+	NDJSON  = "application/x-ndjson"
+	MsgPack = "application/msgpack"
+	// MsgPack2 is the unregistered MIME type of MessagePack used by some clients.
+	MsgPack2 = "application/x-msgpack"
+)
+
+// Register adds the data writers and readers of the package to those used by content.TypeNegotiator
+// and routing.Context.Read. It must be called before content.TypeNegotiator.
+//
+// CSV request bodies are not supported, as the API reads structured objects rather than records.
+func Register() {
+	content.DataWriters[CSV] = &CSVDataWriter{}
+	content.DataWriters[NDJSON] = &NDJSONDataWriter{}
+	content.DataWriters[MsgPack] = &MsgPackDataWriter{}
+	routing.DataReaders[NDJSON] = &NDJSONDataReader{}
+	routing.DataReaders[MsgPack] = &MsgPackDataReader{}
+	routing.DataReaders[MsgPack2] = &MsgPackDataReader{}
+}
+
+// MediaType returns the media type of a Content-Type header without its parameters.
+func MediaType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+// records returns the data as a list of records: the items of a page, the elements of a slice,
+// or the data itself as the only record.
+func records(data interface{}) []interface{} {
+	switch p := data.(type) {
+	case *pagination.Pages:
+		data = p.Items
+	case *pagination.CursorPages:
+		data = p.Items
+	}
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Type().Elem().Kind() == reflect.Uint8 {
+		return []interface{}{data}
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result
+}
+
+// marshalJSON returns the JSON encoding of data without escaping HTML characters, the same as content.JSONDataWriter.
+func marshalJSON(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// writeHeader sets the Content-Type header of a response.
+func writeHeader(res http.ResponseWriter, contentType string) {
+	res.Header().Set("Content-Type", contentType)
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+type plan struct {
+	Name string `json:"name"`
+}
+
+type account struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Plan   *plan             `json:"plan"`
+	Tags   []string          `json:"tags,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Secret string            `json:"-"`
+}
+
+var accounts = []account{
+	{ID: 1, Name: "a, \"b\"", Plan: &plan{"pro"}, Tags: []string{"x"}},
+	{ID: 2, Name: "<c>", Labels: map[string]string{"env": "prod"}},
+}
+
+func TestRegister(t *testing.T) {
+	Register()
+	for _, mediaType := range []string{CSV, NDJSON, MsgPack} {
+		assert.Contains(t, content.DataWriters, mediaType)
+	}
+	for _, mediaType := range []string{NDJSON, MsgPack, MsgPack2} {
+		assert.Contains(t, routing.DataReaders, mediaType)
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	assert.Equal(t, "text/csv", MediaType("text/csv; charset=utf-8"))
+	assert.Equal(t, "application/x-ndjson", MediaType("application/x-ndjson"))
+	assert.Equal(t, "", MediaType(""))
+}
+
+func Test_records(t *testing.T) {
+	assert.Equal(t, []interface{}{accounts[0], accounts[1]}, records(accounts))
+	assert.Equal(t, []interface{}{accounts[0], accounts[1]}, records(&accounts))
+	assert.Equal(t, []interface{}{accounts[0], accounts[1]}, records(&pagination.Pages{Items: accounts}))
+	assert.Equal(t, []interface{}{accounts[0]}, records(&pagination.CursorPages{Items: accounts[:1]}))
+	assert.Equal(t, []interface{}{accounts[0]}, records(accounts[0]))
+	assert.Equal(t, []interface{}{[]byte("abc")}, records([]byte("abc")))
+	assert.Equal(t, []interface{}{}, records([]account{}))
+}
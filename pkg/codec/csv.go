@@ -0,0 +1,170 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// formulaPrefixes are the first characters of the cells that spreadsheet applications evaluate as formulas.
+const formulaPrefixes = "=+-@\t\r"
+
+// CSVDataWriter writes data as CSV (RFC 4180) with a header row. Each record is a row whose columns are
+// the properties of its JSON encoding. Nested objects are flattened into columns named with their paths,
+// e.g. "plan.name", and arrays are written as JSON. Cells are escaped with EscapeFormula.
+type CSVDataWriter struct{}
+
+// SetHeader sets the Content-Type response header.
+func (w *CSVDataWriter) SetHeader(res http.ResponseWriter) {
+	writeHeader(res, CSV+"; charset=utf-8")
+}
+
+func (w *CSVDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	var columns []string
+	seen := map[string]bool{}
+	var rows []map[string]string
+	for _, record := range records(data) {
+		row, names, err := flattenRecord(record)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	columns = dropFlattened(columns)
+
+	cw := csv.NewWriter(res)
+	if err := cw.Write(EscapeFormulas(columns)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = EscapeFormula(row[column])
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// EscapeFormula prefixes a CSV cell with a single quote if spreadsheet applications would evaluate it as
+// a formula, so that values entered by users, such as names or emails, cannot inject formulas into the
+// spreadsheets opened from CSV files (CSV injection). Numbers, including negative ones, are kept as they are.
+func EscapeFormula(value string) string {
+	if value == "" || !strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
+
+// EscapeFormulas returns the cells of a CSV record escaped with EscapeFormula.
+func EscapeFormulas(record []string) []string {
+	escaped := make([]string, len(record))
+	for i, value := range record {
+		escaped[i] = EscapeFormula(value)
+	}
+	return escaped
+}
+
+// dropFlattened removes the columns of null objects that are flattened into other columns in other records.
+func dropFlattened(columns []string) []string {
+	var result []string
+	for _, column := range columns {
+		flattened := false
+		for _, other := range columns {
+			flattened = flattened || strings.HasPrefix(other, column+".")
+		}
+		if !flattened {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// flattenRecord returns the columns of the JSON encoding of a record in the order they are encoded.
+// A record that is not encoded as an object is a single column named "value".
+func flattenRecord(record interface{}) (map[string]string, []string, error) {
+	data, err := marshalJSON(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	row := map[string]string{}
+	var names []string
+	if bytes.HasPrefix(data, []byte("{")) {
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, err
+		}
+		err = flattenObject(dec, "", row, &names)
+	} else {
+		names = append(names, "value")
+		row["value"], err = cell(data)
+	}
+	return row, names, err
+}
+
+// flattenObject reads the properties of a JSON object whose opening brace has been read, adding them to a row.
+func flattenObject(dec *json.Decoder, prefix string, row map[string]string, names *[]string) error {
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := prefix + token.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if bytes.HasPrefix(value, []byte("{")) {
+			nested := json.NewDecoder(bytes.NewReader(value))
+			nested.UseNumber()
+			if _, err := nested.Token(); err != nil {
+				return err
+			}
+			if err := flattenObject(nested, name+".", row, names); err != nil {
+				return err
+			}
+			continue
+		}
+		*names = append(*names, name)
+		if row[name], err = cell(value); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// cell returns the CSV cell of a JSON value that is not an object. Strings are unquoted, null is empty,
+// and arrays are kept as JSON.
+func cell(value json.RawMessage) (string, error) {
+	switch {
+	case bytes.Equal(value, []byte("null")):
+		return "", nil
+	case bytes.HasPrefix(value, []byte(`"`)):
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	}
+	return string(value), nil
+}
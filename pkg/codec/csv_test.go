@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVDataWriter(t *testing.T) {
+	w := &CSVDataWriter{}
+	tests := []struct {
+		name string
+		data interface{}
+		want string
+	}{
+		{"page", &pagination.Pages{Page: 1, Items: accounts}, "id,name,plan.name,tags,labels.env\n" +
+			"1,\"a, \"\"b\"\"\",pro,\"[\"\"x\"\"]\",\n" +
+			"2,<c>,,,prod\n"},
+		{"object", accounts[1], "id,name,plan,labels.env\n2,<c>,,prod\n"},
+		{"values", []int{1, 2}, "value\n1\n2\n"},
+		{"empty", []account{}, "\n"},
+		{"formulas", []account{{ID: -1, Name: "=HYPERLINK(\"http://x\")", Labels: map[string]string{"@env": "+1+cmd"}}},
+			"id,name,plan,labels.@env\n-1,\"'=HYPERLINK(\"\"http://x\"\")\",,'+1+cmd\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			w.SetHeader(res)
+			assert.Nil(t, w.Write(res, tc.data))
+			assert.Equal(t, "text/csv; charset=utf-8", res.Header().Get("Content-Type"))
+			assert.Equal(t, tc.want, res.Body.String())
+		})
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"name", "name"},
+		{"a=b", "a=b"},
+		{"=1+2", "'=1+2"},
+		{"+1", "+1"},
+		{"+1+cmd|' /C calc'!A0", "'+1+cmd|' /C calc'!A0"},
+		{"-12.5", "-12.5"},
+		{"-x", "'-x"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, EscapeFormula(tc.value), tc.value)
+	}
+	assert.Equal(t, []string{"1", "'=x"}, EscapeFormulas([]string{"1", "=x"}))
+}
@@ -0,0 +1,81 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// MsgPackDataWriter writes data as MessagePack. The data is encoded as the MessagePack equivalent of its
+// JSON encoding, with integers encoded as integers.
+type MsgPackDataWriter struct{}
+
+// SetHeader sets the Content-Type response header.
+func (w *MsgPackDataWriter) SetHeader(res http.ResponseWriter) {
+	writeHeader(res, MsgPack)
+}
+
+func (w *MsgPackDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	value, err := jsonValue(data)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(res).Encode(value)
+}
+
+// MsgPackDataReader reads a MessagePack request body into data the same as the equivalent JSON body would be read.
+type MsgPackDataReader struct{}
+
+func (r *MsgPackDataReader) Read(req *http.Request, data interface{}) error {
+	var value interface{}
+	if err := msgpack.NewDecoder(req.Body).Decode(&value); err != nil {
+		return err
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, data)
+}
+
+// jsonValue returns the generic value of the JSON encoding of data, with numbers converted to
+// int64, uint64 or float64.
+func jsonValue(data interface{}) (interface{}, error) {
+	body, err := marshalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	}
+	return value
+}
@@ -0,0 +1,43 @@
+package codec
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func TestMsgPackDataWriter(t *testing.T) {
+	w := &MsgPackDataWriter{}
+	res := httptest.NewRecorder()
+	w.SetHeader(res)
+	assert.Nil(t, w.Write(res, accounts))
+	assert.Equal(t, MsgPack, res.Header().Get("Content-Type"))
+
+	var value []map[string]interface{}
+	assert.Nil(t, msgpack.Unmarshal(res.Body.Bytes(), &value))
+	if assert.Len(t, value, 2) {
+		assert.Equal(t, int64(1), value[0]["id"])
+		assert.Equal(t, map[string]interface{}{"name": "pro"}, value[0]["plan"])
+		assert.Nil(t, value[1]["plan"])
+		assert.NotContains(t, value[1], "tags")
+	}
+}
+
+func TestMsgPackDataReader(t *testing.T) {
+	r := &MsgPackDataReader{}
+	body, _ := msgpack.Marshal(map[string]interface{}{"id": 3, "name": "a", "plan": map[string]interface{}{"name": "pro"}, "tags": []string{"x"}})
+	var a account
+	assert.Nil(t, r.Read(httptest.NewRequest("POST", "/", bytes.NewReader(body)), &a))
+	assert.Equal(t, account{ID: 3, Name: "a", Plan: &plan{"pro"}, Tags: []string{"x"}}, a)
+
+	assert.NotNil(t, r.Read(httptest.NewRequest("POST", "/", bytes.NewReader([]byte{0xc1})), &a))
+}
+
+func Test_jsonValue(t *testing.T) {
+	value, err := jsonValue(map[string]interface{}{"int": 1, "uint": uint64(1 << 63), "float": 1.5, "list": []int{-2}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"int": int64(1), "uint": uint64(1 << 63), "float": 1.5, "list": []interface{}{int64(-2)}}, value)
+}
@@ -0,0 +1,72 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// NDJSONDataWriter writes data as newline-delimited JSON, one record per line.
+type NDJSONDataWriter struct{}
+
+// SetHeader sets the Content-Type response header.
+func (w *NDJSONDataWriter) SetHeader(res http.ResponseWriter) {
+	writeHeader(res, NDJSON)
+}
+
+func (w *NDJSONDataWriter) Write(res http.ResponseWriter, data interface{}) error {
+	bw := bufio.NewWriter(res)
+	for _, record := range records(data) {
+		line, err := marshalJSON(record)
+		if err != nil {
+			return err
+		}
+		bw.Write(line)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// NDJSONDataReader reads a request body of newline-delimited JSON. If the data is a pointer to a slice,
+// each line is read as an element of the slice. Otherwise, the body must contain a single line.
+// Empty lines are ignored.
+type NDJSONDataReader struct{}
+
+func (r *NDJSONDataReader) Read(req *http.Request, data interface{}) error {
+	v := reflect.ValueOf(data)
+	isSlice := v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice
+	scanner := bufio.NewScanner(req.Body)
+	scanner.Buffer(nil, 1<<20)
+	lines := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		if !isSlice {
+			if lines > 1 {
+				return errors.New("the NDJSON data must contain a single line")
+			}
+			if err := json.Unmarshal(line, data); err != nil {
+				return err
+			}
+			continue
+		}
+		elem := reflect.New(v.Elem().Type().Elem())
+		if err := json.Unmarshal(line, elem.Interface()); err != nil {
+			return err
+		}
+		v.Elem().Set(reflect.Append(v.Elem(), elem.Elem()))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if lines == 0 && !isSlice {
+		return errors.New("the NDJSON data is empty")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package codec
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONDataWriter(t *testing.T) {
+	w := &NDJSONDataWriter{}
+	res := httptest.NewRecorder()
+	w.SetHeader(res)
+	assert.Nil(t, w.Write(res, &pagination.CursorPages{Items: accounts}))
+	assert.Equal(t, NDJSON, res.Header().Get("Content-Type"))
+	assert.Equal(t, `{"id":1,"name":"a, \"b\"","plan":{"name":"pro"},"tags":["x"]}`+"\n"+
+		`{"id":2,"name":"<c>","plan":null,"labels":{"env":"prod"}}`+"\n", res.Body.String())
+
+	res = httptest.NewRecorder()
+	assert.Nil(t, w.Write(res, plan{"pro"}))
+	assert.Equal(t, `{"name":"pro"}`+"\n", res.Body.String())
+}
+
+func TestNDJSONDataReader(t *testing.T) {
+	r := &NDJSONDataReader{}
+
+	var list []plan
+	req := httptest.NewRequest("POST", "/", strings.NewReader("{\"name\":\"a\"}\n\n{\"name\":\"b\"}\n"))
+	assert.Nil(t, r.Read(req, &list))
+	assert.Equal(t, []plan{{"a"}, {"b"}}, list)
+
+	var p plan
+	req = httptest.NewRequest("POST", "/", strings.NewReader("{\"name\":\"a\"}\n"))
+	assert.Nil(t, r.Read(req, &p))
+	assert.Equal(t, plan{"a"}, p)
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("{\"name\":\"a\"}\n{\"name\":\"b\"}"))
+	assert.NotNil(t, r.Read(req, &p))
+	req = httptest.NewRequest("POST", "/", strings.NewReader(""))
+	assert.NotNil(t, r.Read(req, &p))
+	req = httptest.NewRequest("POST", "/", strings.NewReader("{\"name\":"))
+	assert.NotNil(t, r.Read(req, &list))
+}
@@ -4,6 +4,9 @@ package dbcontext
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -17,10 +20,19 @@ type DB struct {
 // TransactionFunc represents a function that will start a transaction and run the given function.
 type TransactionFunc func(ctx context.Context, f func(ctx context.Context) error) error
 
+// ErrConflict is returned when a versioned row cannot be changed because it is not at the expected version,
+// typically because it has been changed or deleted since it was read.
+var ErrConflict = errors.New("the row has been changed or deleted concurrently")
+
+// VersionColumn is the name of the column holding the version of the versioned rows.
+// The version starts at 1 and is incremented by every update.
+const VersionColumn = "version"
+
 type contextKey int
 
 const (
 	txKey contextKey = iota
+	savepointKey
 )
 
 // New returns a new DB connection that wraps the given dbx.DB instance.
@@ -45,12 +57,42 @@ func (db *DB) With(ctx context.Context) dbx.Builder {
 
 // Transactional starts a transaction and calls the given function with a context storing the transaction.
 // The transaction associated with the context can be accesse via With().
+// If the given context already stores a transaction, the function is called within a savepoint of that
+// transaction: if it fails, only its changes are rolled back and the outer transaction can go on.
 func (db *DB) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey).(*dbx.Tx); ok {
+		return savepoint(ctx, tx, f)
+	}
 	return db.db.TransactionalContext(ctx, nil, func(tx *dbx.Tx) error {
 		return f(context.WithValue(ctx, txKey, tx))
 	})
 }
 
+// savepoint calls the given function within a new savepoint of a transaction. The savepoint is released if
+// the function succeeds, and rolled back to if it fails or panics.
+func savepoint(ctx context.Context, tx *dbx.Tx, f func(ctx context.Context) error) (err error) {
+	depth, _ := ctx.Value(savepointKey).(int)
+	depth++
+	name := fmt.Sprintf("sp%v", depth)
+	if _, err := tx.NewQuery("SAVEPOINT " + name).WithContext(ctx).Execute(); err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			_, _ = tx.NewQuery("ROLLBACK TO SAVEPOINT " + name).WithContext(ctx).Execute()
+			panic(e)
+		}
+		if err != nil {
+			if _, e := tx.NewQuery("ROLLBACK TO SAVEPOINT " + name).WithContext(ctx).Execute(); e != nil {
+				err = e
+			}
+			return
+		}
+		_, err = tx.NewQuery("RELEASE SAVEPOINT " + name).WithContext(ctx).Execute()
+	}()
+	return f(context.WithValue(ctx, savepointKey, depth))
+}
+
 // TransactionHandler returns a middleware that starts a transaction.
 // The transaction started is kept in the context and can be accessed via With().
 func (db *DB) TransactionHandler() routing.Handler {
@@ -62,3 +104,57 @@ func (db *DB) TransactionHandler() routing.Handler {
 		})
 	}
 }
+
+// CheckVersion returns ErrConflict if expected is not 0 and differs from the current version of a row.
+// It is used to check the version a client expects before the row is changed.
+func CheckVersion(current, expected int) error {
+	if expected != 0 && expected != current {
+		return ErrConflict
+	}
+	return nil
+}
+
+// UpdateVersion updates the row of the table with the given primary key if it is at the given version,
+// and increments the version. It returns ErrConflict if no such row exists.
+func (db *DB) UpdateVersion(ctx context.Context, table string, cols dbx.Params, pk dbx.HashExp, version int) error {
+	params := dbx.Params{VersionColumn: dbx.NewExp(VersionColumn + "+1")}
+	for name, value := range cols {
+		params[name] = value
+	}
+	result, err := db.With(ctx).Update(table, params, versionExp(pk, version)).Execute()
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// DeleteVersion deletes the row of the table with the given primary key if it is at the given version.
+// It returns ErrConflict if no such row exists.
+func (db *DB) DeleteVersion(ctx context.Context, table string, pk dbx.HashExp, version int) error {
+	result, err := db.With(ctx).Delete(table, versionExp(pk, version)).Execute()
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// versionExp returns the condition selecting the row with the given primary key at the given version.
+func versionExp(pk dbx.HashExp, version int) dbx.HashExp {
+	exp := dbx.HashExp{VersionColumn: version}
+	for name, value := range pk {
+		exp[name] = value
+	}
+	return exp
+}
+
+// checkAffected returns ErrConflict if the query did not affect any row.
+func checkAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
@@ -60,6 +60,42 @@ func TestDB_Transactional(t *testing.T) {
 		})
 		assert.Equal(t, sql.ErrNoRows, err)
 		assert.Equal(t, 4, runCountQuery(t, db))
+
+		// nested transaction joining the outer one
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			err := dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "5", "name": "name1"}).Execute()
+				return err
+			})
+			assert.Nil(t, err)
+			return sql.ErrNoRows
+		})
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, 4, runCountQuery(t, db))
+
+		// failed nested transaction rolled back without failing the outer one
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "5", "name": "name1"}).Execute()
+			assert.Nil(t, err)
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "6", "name": "name1"}).Execute()
+				assert.Nil(t, err)
+				// duplicate primary key, which aborts the statements of the transaction until it is rolled back
+				_, err = dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "1", "name": "name1"}).Execute()
+				return err
+			})
+			assert.NotNil(t, err)
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "7", "name": "name1"}).Execute()
+				return err
+			})
+			assert.Nil(t, err)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 6, runCountQuery(t, db))
+		var id string
+		assert.Equal(t, sql.ErrNoRows, db.NewQuery("SELECT id FROM dbcontexttest WHERE id='6'").Row(&id))
 	})
 }
 
@@ -103,6 +139,40 @@ func TestDB_TransactionHandler(t *testing.T) {
 	})
 }
 
+func TestCheckVersion(t *testing.T) {
+	assert.Nil(t, CheckVersion(2, 0))
+	assert.Nil(t, CheckVersion(2, 2))
+	assert.Equal(t, ErrConflict, CheckVersion(2, 1))
+	assert.Equal(t, ErrConflict, CheckVersion(2, -1))
+}
+
+func TestDB_UpdateVersion(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		dbc := New(db)
+		ctx := context.Background()
+		_, err := db.Insert("dbcontexttest", dbx.Params{"id": "1", "name": "name1"}).Execute()
+		assert.Nil(t, err)
+
+		err = dbc.UpdateVersion(ctx, "dbcontexttest", dbx.Params{"name": "name2"}, dbx.HashExp{"id": "1"}, 1)
+		assert.Nil(t, err)
+		var version int
+		assert.Nil(t, db.NewQuery("SELECT version FROM dbcontexttest WHERE id='1'").Row(&version))
+		assert.Equal(t, 2, version)
+
+		// stale version
+		err = dbc.UpdateVersion(ctx, "dbcontexttest", dbx.Params{"name": "name3"}, dbx.HashExp{"id": "1"}, 1)
+		assert.Equal(t, ErrConflict, err)
+		err = dbc.DeleteVersion(ctx, "dbcontexttest", dbx.HashExp{"id": "1"}, 1)
+		assert.Equal(t, ErrConflict, err)
+
+		err = dbc.DeleteVersion(ctx, "dbcontexttest", dbx.HashExp{"id": "1"}, 2)
+		assert.Nil(t, err)
+		assert.Zero(t, runCountQuery(t, db))
+		err = dbc.UpdateVersion(ctx, "dbcontexttest", dbx.Params{"name": "name3"}, dbx.HashExp{"id": "1"}, 2)
+		assert.Equal(t, ErrConflict, err)
+	})
+}
+
 func runDBTest(t *testing.T, f func(db *dbx.DB)) {
 	dsn, ok := os.LookupEnv("APP_DSN")
 	if !ok {
@@ -119,6 +189,7 @@ func runDBTest(t *testing.T, f func(db *dbx.DB)) {
 
 	sqls := []string{
 		"CREATE TABLE IF NOT EXISTS dbcontexttest (id VARCHAR PRIMARY KEY, name VARCHAR)",
+		"ALTER TABLE dbcontexttest ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1",
 		"TRUNCATE dbcontexttest",
 	}
 	for _, s := range sqls {
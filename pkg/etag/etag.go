@@ -0,0 +1,97 @@
+// Package etag provides support for entity tags and conditional requests (RFC 7232) based on the versions of resources.
+//
+// The entity tag of a resource is its version as a strong tag, e.g. "3". GET handlers call NotModified to set the
+// ETag header and answer If-None-Match, and the handlers changing a resource call IfMatch to get the version
+// the change is conditional on.
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AnyVersion is the version returned by IfMatch when any version of the resource is accepted.
+const AnyVersion = 0
+
+// NoVersion is the version returned by IfMatch when the entity tags of the request cannot match any version.
+const NoVersion = -1
+
+var errMultipleTags = errors.New("If-Match must contain a single entity tag or *")
+
+// Format returns the entity tag of the given version.
+func Format(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Set sets the ETag header of the response to the entity tag of the given version.
+func Set(res http.ResponseWriter, version int) {
+	res.Header().Set("ETag", Format(version))
+}
+
+// NotModified sets the ETag header of the response to the entity tag of the given version, and returns whether
+// the If-None-Match header of the request matches it. In that case the response is sent with status 304,
+// and the handler must not write a body.
+func NotModified(res http.ResponseWriter, req *http.Request, version int) bool {
+	Set(res, version)
+	header := req.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tag := Format(version)
+	for _, t := range parseList(header) {
+		// If-None-Match uses the weak comparison
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			res.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns the version required by the If-Match header of the request. It returns AnyVersion if there
+// is no such header or if it is "*", and NoVersion if the entity tag is not the tag of a version.
+// It returns an error if the header contains several entity tags.
+func IfMatch(req *http.Request) (int, error) {
+	header := req.Header.Get("If-Match")
+	if header == "" {
+		return AnyVersion, nil
+	}
+	tags := parseList(header)
+	if len(tags) != 1 {
+		return NoVersion, errMultipleTags
+	}
+	if tags[0] == "*" {
+		return AnyVersion, nil
+	}
+	// If-Match uses the strong comparison, so weak tags never match
+	if !strings.HasPrefix(tags[0], `"`) {
+		return NoVersion, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(tags[0], `"`))
+	if err != nil || version <= 0 {
+		return NoVersion, nil
+	}
+	return version, nil
+}
+
+// parseList parses a comma-separated list of entity tags. Commas within quoted tags are kept.
+func parseList(header string) []string {
+	var tags []string
+	quoted := false
+	start := 0
+	for i := 0; i <= len(header); i++ {
+		if i < len(header) && (header[i] != ',' || quoted) {
+			if header[i] == '"' {
+				quoted = !quoted
+			}
+			continue
+		}
+		if tag := strings.TrimSpace(header[start:i]); tag != "" {
+			tags = append(tags, tag)
+		}
+		start = i + 1
+	}
+	return tags
+}
@@ -0,0 +1,72 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, `"3"`, Format(3))
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		tag         string
+		ifNoneMatch string
+		notModified bool
+	}{
+		{"no header", "", false},
+		{"match", `"3"`, true},
+		{"weak match", `W/"3"`, true},
+		{"list match", `"1", "a,b", "3"`, true},
+		{"any", `*`, true},
+		{"no match", `"2"`, false},
+		{"no match in list", `"2", "a,3"`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tag, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/albums/1", nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			assert.Equal(t, tc.notModified, NotModified(res, req, 3))
+			assert.Equal(t, `"3"`, res.Header().Get("ETag"))
+			if tc.notModified {
+				assert.Equal(t, http.StatusNotModified, res.Code)
+			}
+		})
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		tag     string
+		ifMatch string
+		version int
+		err     bool
+	}{
+		{"no header", "", AnyVersion, false},
+		{"any", "*", AnyVersion, false},
+		{"version", `"3"`, 3, false},
+		{"weak", `W/"3"`, NoVersion, false},
+		{"unquoted", `3`, NoVersion, false},
+		{"not a version", `"abc"`, NoVersion, false},
+		{"zero", `"0"`, NoVersion, false},
+		{"multiple", `"3", "4"`, NoVersion, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tag, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/albums/1", nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			version, err := IfMatch(req)
+			assert.Equal(t, tc.version, version)
+			assert.Equal(t, tc.err, err != nil)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package export provides support for streaming exports of resources as NDJSON or CSV.
+//
+// Export handlers read the records one at a time from a database cursor and write each of them to the response
+// with a Writer as soon as it is read, so that the memory used by an export does not grow with the number of records.
+// The response is flushed periodically so that clients receive large exports progressively, and the export
+// stops as soon as the client disconnects.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/qiangxue/go-rest-api/pkg/codec"
+)
+
+// Export formats
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// FormatVar specifies the query parameter name for the export format
+var FormatVar = "format"
+
+// FlushInterval is the number of records after which the response is flushed to the client.
+var FlushInterval = 100
+
+var errFormat = errors.New(FormatVar + " must be either " + CSV + " or " + NDJSON)
+
+// Record is a record that can be exported as CSV.
+type Record interface {
+	// CSVRecord returns the columns of the record in the order of the CSV header.
+	CSVRecord() []string
+}
+
+// FormatFromRequest returns the format of an export, requested either by the "format" query parameter
+// or by the Accept header. NDJSON is used by default.
+func FormatFromRequest(req *http.Request) (string, error) {
+	switch format := req.URL.Query().Get(FormatVar); format {
+	case CSV, NDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", errFormat
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == codec.CSV {
+			return CSV, nil
+		}
+	}
+	return NDJSON, nil
+}
+
+// Writer writes exported records to a response in either CSV or NDJSON format.
+type Writer struct {
+	ctx     context.Context
+	res     *response
+	csv     *csv.Writer
+	json    *json.Encoder
+	flusher http.Flusher
+	count   int
+}
+
+// response is the response of an export. Its content type is only set when the first bytes are sent, so that
+// an export failing before that, e.g. because the database cannot be queried, can still respond with an error.
+type response struct {
+	http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (r *response) Write(p []byte) (int, error) {
+	r.start()
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *response) start() {
+	if !r.started {
+		r.started = true
+		r.Header().Set("Content-Type", r.contentType)
+	}
+}
+
+// NewWriter returns a writer of the given format to the response.
+// The header is the header row of CSV exports. It is not written for NDJSON exports.
+// Writing fails once the context is done, which for the context of a request is when the client disconnects.
+func NewWriter(ctx context.Context, w http.ResponseWriter, format string, header []string) (*Writer, error) {
+	ew := &Writer{ctx: ctx}
+	ew.flusher, _ = w.(http.Flusher)
+	if format == CSV {
+		ew.res = &response{ResponseWriter: w, contentType: codec.CSV + "; charset=utf-8"}
+		ew.csv = csv.NewWriter(ew.res)
+		return ew, ew.csv.Write(codec.EscapeFormulas(header))
+	}
+	ew.res = &response{ResponseWriter: w, contentType: codec.NDJSON}
+	ew.json = json.NewEncoder(ew.res)
+	ew.json.SetEscapeHTML(false)
+	return ew, nil
+}
+
+// Write writes a record and periodically flushes the response.
+// It returns the error of the context if the context is done.
+func (w *Writer) Write(record Record) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	if w.csv != nil {
+		err = w.csv.Write(codec.EscapeFormulas(record.CSVRecord()))
+	} else {
+		err = w.json.Encode(record)
+	}
+	if err != nil {
+		return err
+	}
+	if w.count++; w.count%FlushInterval == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Count returns the number of records written.
+func (w *Writer) Count() int {
+	return w.count
+}
+
+// Started returns whether anything has been sent to the client. Until then, the status code of the response
+// can still be changed, so an export failing can respond with an error instead.
+func (w *Writer) Started() bool {
+	return w.res.started
+}
+
+// Flush flushes any buffered data to the client. It sends the response even if nothing was written.
+func (w *Writer) Flush() error {
+	w.res.start()
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r record) CSVRecord() []string {
+	return []string{strconv.Itoa(r.ID), r.Name}
+}
+
+func TestFormatFromRequest(t *testing.T) {
+	tests := []struct {
+		tag    string
+		url    string
+		accept string
+		format string
+		err    bool
+	}{
+		{"default", "/export", "", NDJSON, false},
+		{"json accepted", "/export", "application/json", NDJSON, false},
+		{"csv accepted", "/export", "application/json;q=0.5, text/csv", CSV, false},
+		{"csv parameter", "/export?format=csv", "", CSV, false},
+		{"ndjson parameter", "/export?format=ndjson", "text/csv", NDJSON, false},
+		{"invalid parameter", "/export?format=xml", "", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tag, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			req.Header.Set("Accept", tc.accept)
+			format, err := FormatFromRequest(req)
+			assert.Equal(t, tc.format, format)
+			assert.Equal(t, tc.err, err != nil)
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("ndjson", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		w, err := NewWriter(context.Background(), res, NDJSON, []string{"id", "name"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.Write(record{1, "a<b"}))
+		assert.Nil(t, w.Write(record{2, "c"}))
+		assert.Nil(t, w.Flush())
+		assert.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+		assert.Equal(t, "{\"id\":1,\"name\":\"a<b\"}\n{\"id\":2,\"name\":\"c\"}\n", res.Body.String())
+		assert.Equal(t, 2, w.Count())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		w, err := NewWriter(context.Background(), res, CSV, []string{"id", "name"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.Write(record{1, "a,b"}))
+		assert.Nil(t, w.Write(record{-2, "=cmd|' /C calc'!A0"}))
+		assert.Nil(t, w.Flush())
+		assert.Equal(t, "text/csv; charset=utf-8", res.Header().Get("Content-Type"))
+		assert.Equal(t, "id,name\n1,\"a,b\"\n-2,'=cmd|' /C calc'!A0\n", res.Body.String())
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		w, err := NewWriter(context.Background(), res, CSV, []string{"id", "name"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.Write(record{1, "a"}))
+		assert.False(t, w.Started())
+		assert.Empty(t, res.Header().Get("Content-Type"))
+		assert.Empty(t, res.Body.String())
+
+		// an empty export is sent when it is flushed
+		res = httptest.NewRecorder()
+		w, _ = NewWriter(context.Background(), res, NDJSON, nil)
+		assert.Nil(t, w.Flush())
+		assert.True(t, w.Started())
+		assert.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+	})
+
+	t.Run("periodic flush", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		w, _ := NewWriter(context.Background(), res, CSV, []string{"id", "name"})
+		for i := 1; i < FlushInterval; i++ {
+			assert.Nil(t, w.Write(record{i, "a"}))
+		}
+		assert.False(t, res.Flushed)
+		assert.Nil(t, w.Write(record{FlushInterval, "a"}))
+		assert.True(t, res.Flushed)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		res := httptest.NewRecorder()
+		w, _ := NewWriter(ctx, res, NDJSON, nil)
+		assert.Nil(t, w.Write(record{1, "a"}))
+		cancel()
+		assert.Equal(t, context.Canceled, w.Write(record{2, "b"}))
+		assert.Equal(t, 1, w.Count())
+	})
+}
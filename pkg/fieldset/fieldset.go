@@ -0,0 +1,167 @@
+// Package fieldset provides support for sparse fieldsets and embedded relations in responses.
+//
+// The fields of the returned resources are selected with a comma-separated list of field names, and the related
+// resources to embed with a comma-separated list of relation names, for example:
+//
+//	?fields=id,email&include=domains
+//
+// Only the fields and relations declared in the Schema of a resource are accepted. Embedded relations are
+// always returned, even if they are not listed in the fields.
+package fieldset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// FieldsVar specifies the query parameter name for the selected fields
+	FieldsVar = "fields"
+	// IncludeVar specifies the query parameter name for the embedded relations
+	IncludeVar = "include"
+)
+
+// Schema declares the fields and relations of a resource that can be selected.
+type Schema struct {
+	// Fields are the JSON names of the fields of the resource.
+	Fields []string
+	// Relations are the names of the related resources that can be embedded.
+	Relations []string
+}
+
+// NewSchema creates a Schema with the JSON fields of the given struct and the given relations.
+func NewSchema(resource interface{}, relations ...string) Schema {
+	t := reflect.TypeOf(resource)
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("fieldset: %T is not a struct", resource))
+	}
+	names := jsonFields(t, nil)
+	sort.Strings(names)
+	return Schema{Fields: names, Relations: relations}
+}
+
+// jsonFields appends the names of the fields of a struct type in its JSON representation, including those
+// of the embedded structs, to names.
+func jsonFields(t reflect.Type, names []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" && tag == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			names = jsonFields(field.Type, names)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Selection represents the fields and relations selected by a request.
+type Selection struct {
+	// Fields are the selected fields. All fields are selected if it is empty.
+	Fields []string
+	// Relations are the relations to embed.
+	Relations []string
+}
+
+// Resource is the JSON representation of a resource with only the selected fields and the embedded relations.
+type Resource map[string]interface{}
+
+// NewFromRequest creates a Selection from the fields and include query parameters of the request.
+// It returns an error describing the first field or relation not declared in the schema.
+func NewFromRequest(req *http.Request, schema Schema) (Selection, error) {
+	params := req.URL.Query()
+	fields, err := parseList(params.Get(FieldsVar), schema.Fields, "field")
+	if err != nil {
+		return Selection{}, err
+	}
+	relations, err := parseList(params.Get(IncludeVar), schema.Relations, "relation")
+	if err != nil {
+		return Selection{}, err
+	}
+	return Selection{Fields: fields, Relations: relations}, nil
+}
+
+// parseList parses a comma-separated list of names, each of which must be one of the allowed names.
+func parseList(value string, allowed []string, kind string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !contains(allowed, name) {
+			if len(allowed) == 0 {
+				return nil, fmt.Errorf("unknown %v %q, this resource has no %vs", kind, name, kind)
+			}
+			return nil, fmt.Errorf("unknown %v %q, must be one of: %v", kind, name, strings.Join(allowed, ", "))
+		}
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// IsEmpty returns whether the selection neither restricts the fields nor embeds relations,
+// in which case resources can be returned as they are.
+func (s Selection) IsEmpty() bool {
+	return len(s.Fields) == 0 && len(s.Relations) == 0
+}
+
+// Includes returns whether the given relation is to be embedded.
+func (s Selection) Includes(relation string) bool {
+	return contains(s.Relations, relation)
+}
+
+// Render returns the JSON representation of the resource with only the selected fields.
+func (s Selection) Render(resource interface{}) (Resource, error) {
+	return Render(resource, s.Fields)
+}
+
+// Render returns the JSON representation of the resource with only the given fields, or all of them if fields is empty.
+func Render(resource interface{}, fields []string) (Resource, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var r Resource
+	if err := decoder.Decode(&r); err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		for name := range r {
+			if !contains(fields, name) {
+				delete(r, name)
+			}
+		}
+	}
+	return r, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package fieldset
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Tags []int  `json:"tags"`
+}
+
+type embedded struct {
+	item
+	Extra string `json:"extra,omitempty"`
+}
+
+func TestNewSchema(t *testing.T) {
+	schema := NewSchema(embedded{}, "owner")
+	assert.Equal(t, []string{"extra", "id", "name", "tags"}, schema.Fields)
+	assert.Equal(t, []string{"owner"}, schema.Relations)
+	assert.Panics(t, func() { NewSchema(1) })
+}
+
+func TestNewFromRequest(t *testing.T) {
+	schema := Schema{Fields: []string{"id", "name", "tags"}, Relations: []string{"owner"}}
+	tests := []struct {
+		tag       string
+		url       string
+		schema    Schema
+		selection Selection
+		err       string
+	}{
+		{"empty", "/items", schema, Selection{}, ""},
+		{"fields", "/items?fields=id,%20name,id", schema, Selection{Fields: []string{"id", "name"}}, ""},
+		{"include", "/items?include=owner", schema, Selection{Relations: []string{"owner"}}, ""},
+		{"unknown field", "/items?fields=id,foo", schema, Selection{}, `unknown field "foo", must be one of: id, name, tags`},
+		{"empty field", "/items?fields=id,", schema, Selection{}, `unknown field "", must be one of: id, name, tags`},
+		{"unknown relation", "/items?include=foo", schema, Selection{}, `unknown relation "foo", must be one of: owner`},
+		{"no relations", "/items?include=owner", Schema{Fields: schema.Fields}, Selection{}, `unknown relation "owner", this resource has no relations`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tag, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			selection, err := NewFromRequest(req, tc.schema)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.selection, selection)
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	assert.True(t, Selection{}.IsEmpty())
+	assert.False(t, Selection{Fields: []string{"id"}}.IsEmpty())
+	assert.False(t, Selection{Relations: []string{"owner"}}.IsEmpty())
+	assert.True(t, Selection{Relations: []string{"owner"}}.Includes("owner"))
+	assert.False(t, Selection{}.Includes("owner"))
+}
+
+func TestSelection_Render(t *testing.T) {
+	r, err := Selection{Fields: []string{"id", "tags"}}.Render(embedded{item: item{ID: 1, Name: "a", Tags: []int{2}}})
+	assert.Nil(t, err)
+	data, _ := json.Marshal(r)
+	assert.JSONEq(t, `{"id":1,"tags":[2]}`, string(data))
+
+	r, err = Selection{}.Render(item{ID: 1, Name: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, Resource{"id": json.Number("1"), "name": "a", "tags": nil}, r)
+
+	_, err = Selection{}.Render([]int{1})
+	assert.NotNil(t, err)
+}
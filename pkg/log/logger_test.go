@@ -32,6 +32,12 @@ func TestWithRequest(t *testing.T) {
 	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
 }
 
+func TestRequestID(t *testing.T) {
+	ctx := WithRequest(context.Background(), buildRequest("abc", "123"))
+	assert.Equal(t, "abc", RequestID(ctx))
+	assert.Equal(t, "", RequestID(context.Background()))
+}
+
 func Test_getCorrelationID(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", bytes.NewBufferString(""))
 	assert.Empty(t, getCorrelationID(req))
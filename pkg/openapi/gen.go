@@ -0,0 +1,41 @@
+//go:build ignore
+// +build ignore
+
+// This program generates assets.go from the files of the API reference page in the assets directory.
+// It is invoked by "go generate".
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+)
+
+// files are the files of the assets directory that are served.
+var files = []string{"swagger-initializer.js", "swagger-ui-bundle.js", "swagger-ui.css"}
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage openapi\n\n")
+	buf.WriteString("// assets contains the files of the API reference page in the assets directory indexed by name.\n")
+	buf.WriteString("var assets = map[string]string{\n")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join("assets", file))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&buf, "\t%q: %q,\n", file, data)
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("assets.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+package openapi
+
+//go:generate go run gen.go
+
+import (
+	"net/http"
+	"path"
+	"sync"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// docsPage is the HTML page rendering the document with Swagger UI. The scripts and the style sheet of
+// Swagger UI are served from the binary, so the page works offline and with a strict Content-Security-Policy.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1"/>
+<title>API Reference</title>
+<link rel="stylesheet" href="/docs/swagger-ui.css"/>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="/docs/swagger-ui-bundle.js"></script>
+<script src="/docs/swagger-initializer.js"></script>
+</body>
+</html>
+`
+
+// assetTypes maps the extensions of the assets to their content types.
+var assetTypes = map[string]string{
+	".js":  "text/javascript; charset=utf-8",
+	".css": "text/css; charset=utf-8",
+}
+
+// Routes describes the routes registered by RegisterHandlers.
+var Routes = []Route{
+	{Method: "GET", Path: "/openapi.json", Summary: "Get the OpenAPI document of the API", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", Summary: "Get the API reference page", Response: "", ResponseType: "text/html"},
+	{Method: "GET", Path: "/docs/swagger-ui.css", Summary: "Get the style sheet of the API reference page", Response: "", ResponseType: "text/css"},
+	{Method: "GET", Path: "/docs/swagger-ui-bundle.js", Summary: "Get the script of the API reference page", Response: "", ResponseType: "text/javascript"},
+	{Method: "GET", Path: "/docs/swagger-initializer.js", Summary: "Get the script loading the document in the API reference page", Response: "", ResponseType: "text/javascript"},
+}
+
+// RegisterHandlers registers the handlers serving the document as JSON at /openapi.json and as
+// an HTML reference page at /docs, with the files of the page under /docs.
+func RegisterHandlers(r *routing.Router, doc *Document) {
+	r.Get("/openapi.json", spec(doc))
+	r.Get("/docs", docs)
+	for name := range assets {
+		r.Get("/docs/"+name, asset(name))
+	}
+}
+
+// spec returns a handler that responds with the JSON encoding of the document.
+// The document is encoded once, when it is first requested.
+func spec(doc *Document) routing.Handler {
+	var (
+		once sync.Once
+		data []byte
+		err  error
+	)
+	return func(c *routing.Context) error {
+		once.Do(func() {
+			data, err = doc.MarshalJSON()
+		})
+		if err != nil {
+			return err
+		}
+		c.Response.Header().Set("Content-Type", MediaTypeJSON)
+		_, err := c.Response.Write(data)
+		return err
+	}
+}
+
+// docs responds with the HTML reference page.
+func docs(c *routing.Context) error {
+	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response.WriteHeader(http.StatusOK)
+	_, err := c.Response.Write([]byte(docsPage))
+	return err
+}
+
+// asset returns a handler that responds with the file of the reference page with the given name.
+func asset(name string) routing.Handler {
+	contentType := assetTypes[path.Ext(name)]
+	return func(c *routing.Context) error {
+		c.Response.Header().Set("Content-Type", contentType)
+		c.Response.Header().Set("Cache-Control", "public, max-age=86400")
+		c.Response.WriteHeader(http.StatusOK)
+		_, err := c.Response.Write([]byte(assets[name]))
+		return err
+	}
+}
@@ -0,0 +1,352 @@
+// Package openapi builds an OpenAPI 3.1 document describing the API from route descriptions.
+// The schemas of the request and response bodies are derived from Go types and their validation rules.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qiangxue/go-rest-api/pkg/fieldset"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"github.com/qiangxue/go-rest-api/pkg/query"
+)
+
+// Version is the version of the OpenAPI specification the documents conform to.
+const Version = "3.1.0"
+
+// MediaTypeJSON is the default media type of the request and response bodies.
+const MediaTypeJSON = "application/json"
+
+// Route describes an API operation.
+type Route struct {
+	// Method is the HTTP method, e.g. GET.
+	Method string
+	// Path is the path of the route as registered with the router, e.g. /albums/<id>.
+	Path string
+	// Summary is a short summary of what the operation does.
+	Summary string
+	// Description is a longer description of the operation.
+	Description string
+	// Auth indicates whether the operation requires a bearer token.
+	Auth bool
+	// Deprecated indicates whether the operation is deprecated.
+	Deprecated bool
+	// Params are the query and header parameters of the operation. Path parameters are derived from the path.
+	Params []Parameter
+	// Request is a value of the type of the request body, or nil if the operation has no request body.
+	Request interface{}
+	// RequestType is the media type of the request body, or a comma-separated list of the accepted media types.
+	// Defaults to MediaTypeJSON.
+	RequestType string
+	// Status is the status of a successful response. Defaults to 200.
+	Status int
+	// Response is a value of the type of the response body, or nil if a successful response has no body.
+	Response interface{}
+	// ResponseType is the media type of the response body, or a comma-separated list of the media types
+	// the response can be negotiated in. Defaults to MediaTypeJSON.
+	ResponseType string
+	// Errors are the statuses of the other responses besides the ones implied by the route:
+	// 400 for a request body, 401 for authentication, 404 for path parameters, and 500.
+	// Responses with a status of 400 or above have the error response as body, others have no body.
+	Errors []int
+}
+
+// Parameter describes a query or header parameter.
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// Type is the JSON schema type of the value of the parameter. Defaults to string.
+	Type string
+	// Object indicates whether the parameter is a set of bracketed parameters, e.g. filter[name]=foo.
+	Object bool
+}
+
+// QueryParam returns the description of a query parameter.
+func QueryParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description}
+}
+
+// HeaderParam returns the description of a header parameter.
+func HeaderParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "header", Description: description}
+}
+
+var (
+	// PageParams are the parameters of list endpoints supporting pagination.
+	PageParams = []Parameter{
+		{Name: pagination.PageVar, In: "query", Description: "The page number, starting from 1.", Type: "integer"},
+		{Name: pagination.PageSizeVar, In: "query", Description: "The number of items per page.", Type: "integer"},
+	}
+	// CursorParams are the parameters of list endpoints also supporting cursor-based pagination.
+	CursorParams = []Parameter{
+		QueryParam(pagination.CursorVar, "The cursor of the page in cursor mode. Empty for the first page."),
+		{Name: pagination.IncludeTotalVar, In: "query", Description: "Whether to include the total count in cursor mode.", Type: "boolean"},
+	}
+	// QueryParams are the parameters of list endpoints supporting filters and sort orders.
+	QueryParams = []Parameter{
+		{Name: query.FilterVar, In: "query", Description: "Filters like filter[field]=value or filter[field][operator]=value.", Object: true},
+		QueryParam(query.SortVar, "Comma-separated fields to sort by, prefixed with - for descending order."),
+	}
+	// FieldsetParams are the parameters of endpoints supporting sparse fieldsets and embedded relations.
+	FieldsetParams = []Parameter{
+		QueryParam(fieldset.FieldsVar, "Comma-separated fields to return."),
+		QueryParam(fieldset.IncludeVar, "Comma-separated relations to embed."),
+	}
+	// IfMatchParam is the header making an update or a deletion conditional on the version of a resource.
+	IfMatchParam = HeaderParam("If-Match", "The ETag of the version of the resource the change applies to.")
+	// IfNoneMatchParam is the header making a read conditional on the version of a resource.
+	IfNoneMatchParam = HeaderParam("If-None-Match", "The ETag of the version of the resource the client has.")
+	// IdempotencyKeyParam is the header making a POST request safe to retry.
+	IdempotencyKeyParam = HeaderParam("Idempotency-Key", "A unique key identifying the request so that it can be retried safely.")
+)
+
+// Params concatenates parameter lists.
+func Params(params ...[]Parameter) []Parameter {
+	var result []Parameter
+	for _, p := range params {
+		result = append(result, p...)
+	}
+	return result
+}
+
+// pathParam matches the parameters of ozzo-routing paths, e.g. <id> or <id:\d+>.
+var pathParam = regexp.MustCompile(`<([^>:]+)(:[^>]*)?>`)
+
+// Document represents an OpenAPI document.
+type Document struct {
+	title         string
+	version       string
+	errorResponse interface{}
+	errorBodies   map[string]interface{}
+	operations    map[string]map[string]operation
+}
+
+type operation struct {
+	route Route
+	tag   string
+}
+
+// NewDocument creates a document describing an API with the given title and version.
+// The error response is a value of the type of the bodies of error responses.
+func NewDocument(title, version string, errorResponse interface{}) *Document {
+	return &Document{
+		title:         title,
+		version:       version,
+		errorResponse: errorResponse,
+		errorBodies:   map[string]interface{}{},
+		operations:    map[string]map[string]operation{},
+	}
+}
+
+// AddErrorBody describes the bodies of error responses in a media type other than JSON.
+// The error response is a value of the type of the bodies.
+func (d *Document) AddErrorBody(mediaType string, errorResponse interface{}) {
+	d.errorBodies[mediaType] = errorResponse
+}
+
+// Add adds routes registered under the given path prefix to the document. The routes are grouped under the tag.
+func (d *Document) Add(prefix, tag string, routes []Route) {
+	for _, route := range routes {
+		path := prefix + route.Path
+		if d.operations[path] == nil {
+			d.operations[path] = map[string]operation{}
+		}
+		d.operations[path][route.Method] = operation{route, tag}
+	}
+}
+
+// Has returns whether the document describes the operation with the given method and router path.
+func (d *Document) Has(method, path string) bool {
+	_, ok := d.operations[path][method]
+	return ok
+}
+
+// Operations returns the methods and paths of the operations described by the document.
+func (d *Document) Operations() [][2]string {
+	var result [][2]string
+	for path, operations := range d.operations {
+		for method := range operations {
+			result = append(result, [2]string{method, path})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i][1] != result[j][1] {
+			return result[i][1] < result[j][1]
+		}
+		return result[i][0] < result[j][0]
+	})
+	return result
+}
+
+// MarshalJSON returns the JSON encoding of the document.
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.build())
+}
+
+// build returns the OpenAPI object of the document.
+func (d *Document) build() map[string]interface{} {
+	g := newGenerator()
+	errorContent := map[string]interface{}{MediaTypeJSON: map[string]interface{}{"schema": g.schemaOf(d.errorResponse)}}
+	for mediaType, body := range d.errorBodies {
+		errorContent[mediaType] = map[string]interface{}{"schema": g.schemaOf(body)}
+	}
+	errorResponses := map[string]interface{}{}
+	paths := map[string]interface{}{}
+	var tags []string
+	seenTags := map[string]bool{}
+
+	for _, op := range d.Operations() {
+		method, routePath := op[0], op[1]
+		o := d.operations[routePath][method]
+		if o.tag != "" && !seenTags[o.tag] {
+			seenTags[o.tag] = true
+			tags = append(tags, o.tag)
+		}
+		path := pathParam.ReplaceAllString(routePath, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		statuses := d.errorStatuses(routePath, o.route)
+		for _, status := range statuses {
+			response := map[string]interface{}{"description": http.StatusText(status)}
+			if status >= http.StatusBadRequest {
+				response["content"] = errorContent
+			}
+			errorResponses[strconv.Itoa(status)] = response
+		}
+		paths[path].(map[string]interface{})[strings.ToLower(method)] = d.operation(g, routePath, o, statuses)
+	}
+
+	var tagObjects []map[string]string
+	for _, tag := range tags {
+		tagObjects = append(tagObjects, map[string]string{"name": tag})
+	}
+	return map[string]interface{}{
+		"openapi": Version,
+		"info":    map[string]string{"title": d.title, "version": d.version},
+		"tags":    tagObjects,
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas":   g.schemas,
+			"responses": errorResponses,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// errorStatuses returns the statuses of the error responses of a route.
+func (d *Document) errorStatuses(path string, route Route) []int {
+	statuses := map[int]bool{http.StatusInternalServerError: true}
+	if route.Request != nil {
+		statuses[http.StatusBadRequest] = true
+	}
+	if route.Auth {
+		statuses[http.StatusUnauthorized] = true
+	}
+	if pathParam.MatchString(path) {
+		statuses[http.StatusNotFound] = true
+	}
+	for _, status := range route.Errors {
+		statuses[status] = true
+	}
+	var result []int
+	for status := range statuses {
+		result = append(result, status)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// operation returns the OpenAPI operation object of a route.
+func (d *Document) operation(g *generator, path string, o operation, errorStatuses []int) map[string]interface{} {
+	route := o.route
+	result := map[string]interface{}{"summary": route.Summary}
+	if route.Description != "" {
+		result["description"] = route.Description
+	}
+	if o.tag != "" {
+		result["tags"] = []string{o.tag}
+	}
+	if route.Deprecated {
+		result["deprecated"] = true
+	}
+	if route.Auth {
+		result["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+
+	var params []map[string]interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": Schema{"type": "string"},
+		})
+	}
+	for _, p := range route.Params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": Schema{"type": typ}}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.Required {
+			param["required"] = true
+		}
+		if p.Object {
+			param["style"] = "deepObject"
+			param["schema"] = Schema{"type": "object", "additionalProperties": Schema{}}
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+
+	if route.Request != nil {
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content(g, route.Request, route.RequestType),
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if route.Response != nil {
+		success["content"] = content(g, route.Response, route.ResponseType)
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	for _, status := range errorStatuses {
+		responses[strconv.Itoa(status)] = map[string]string{"$ref": "#/components/responses/" + strconv.Itoa(status)}
+	}
+	result["responses"] = responses
+	return result
+}
+
+// content returns the content object of a body in the given media types.
+// Bodies of media types other than JSON are described as strings.
+func content(g *generator, body interface{}, mediaTypes string) map[string]interface{} {
+	if mediaTypes == "" {
+		mediaTypes = MediaTypeJSON
+	}
+	result := map[string]interface{}{}
+	for _, mediaType := range strings.Split(mediaTypes, ",") {
+		mediaType = strings.TrimSpace(mediaType)
+		schema := Schema{"type": "string"}
+		if mediaType == MediaTypeJSON {
+			schema = g.schemaOf(body)
+		}
+		result[mediaType] = map[string]interface{}{"schema": schema}
+	}
+	return result
+}
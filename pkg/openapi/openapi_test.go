@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type errorResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Status int    `json:"status"`
+}
+
+var testRoutes = []Route{
+	{Method: "GET", Path: "/items/<id>", Summary: "Get an item", Params: []Parameter{IfNoneMatchParam},
+		Response: item{}, Errors: []int{http.StatusNotModified}},
+	{Method: "GET", Path: "/items", Summary: "List items", Params: Params(PageParams, QueryParams), Response: Page(item{})},
+	{Method: "POST", Path: "/items", Summary: "Create an item", Auth: true, Request: item{}, Status: http.StatusCreated, Response: item{}},
+	{Method: "POST", Path: "/items:import", Summary: "Import items", Deprecated: true, Request: "", RequestType: "text/csv, application/x-ndjson"},
+}
+
+func TestDocument(t *testing.T) {
+	doc := NewDocument("test", "1.0.0", errorResponse{})
+	doc.Add("/v1", "items", testRoutes)
+	doc.Add("", "", []Route{{Method: "HEAD", Path: "/healthcheck", Summary: "Check health"}})
+	doc.AddErrorBody("application/problem+json", problem{})
+
+	assert.True(t, doc.Has("GET", "/v1/items/<id>"))
+	assert.True(t, doc.Has("HEAD", "/healthcheck"))
+	assert.False(t, doc.Has("GET", "/items/<id>"))
+	assert.False(t, doc.Has("DELETE", "/v1/items/<id>"))
+	assert.Equal(t, [][2]string{
+		{"HEAD", "/healthcheck"},
+		{"GET", "/v1/items"},
+		{"POST", "/v1/items"},
+		{"GET", "/v1/items/<id>"},
+		{"POST", "/v1/items:import"},
+	}, doc.Operations())
+
+	data, err := doc.MarshalJSON()
+	assert.Nil(t, err)
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Info       map[string]string                            `json:"info"`
+		Tags       []map[string]string                          `json:"tags"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components map[string]map[string]interface{}            `json:"components"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &spec))
+	assert.Equal(t, Version, spec.OpenAPI)
+	assert.Equal(t, map[string]string{"title": "test", "version": "1.0.0"}, spec.Info)
+	assert.Equal(t, []map[string]string{{"name": "items"}}, spec.Tags)
+	assert.Len(t, spec.Paths, 4)
+	assert.Contains(t, spec.Components["schemas"], "Item")
+	assert.Contains(t, spec.Components["schemas"], "ErrorResponse")
+	assert.Contains(t, spec.Components["securitySchemes"], "bearerAuth")
+
+	get := marshal(t, spec.Paths["/v1/items/{id}"]["get"])
+	assert.JSONEq(t, `{
+		"summary": "Get an item",
+		"tags": ["items"],
+		"parameters": [
+			{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}},
+			{"name": "If-None-Match", "in": "header", "description": "The ETag of the version of the resource the client has.", "schema": {"type": "string"}}
+		],
+		"responses": {
+			"200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+			"304": {"$ref": "#/components/responses/304"},
+			"404": {"$ref": "#/components/responses/404"},
+			"500": {"$ref": "#/components/responses/500"}
+		}
+	}`, get)
+
+	post := marshal(t, spec.Paths["/v1/items"]["post"])
+	assert.JSONEq(t, `{
+		"summary": "Create an item",
+		"tags": ["items"],
+		"security": [{"bearerAuth": []}],
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+		"responses": {
+			"201": {"description": "Created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+			"400": {"$ref": "#/components/responses/400"},
+			"401": {"$ref": "#/components/responses/401"},
+			"500": {"$ref": "#/components/responses/500"}
+		}
+	}`, post)
+
+	list := marshal(t, spec.Paths["/v1/items"]["get"]["parameters"])
+	assert.True(t, strings.Contains(list, `"name":"filter","schema":{"additionalProperties":{},"type":"object"},"style":"deepObject"`), list)
+	assert.True(t, strings.Contains(list, `"name":"page","schema":{"type":"integer"}`), list)
+
+	imports := marshal(t, spec.Paths["/v1/items:import"]["post"])
+	assert.True(t, strings.Contains(imports, `"deprecated":true`), imports)
+	assert.True(t, strings.Contains(imports, `"content":{"application/x-ndjson":{"schema":{"type":"string"}},"text/csv":{"schema":{"type":"string"}}}`), imports)
+	assert.True(t, strings.Contains(imports, `"200":{"description":"OK"}`), imports)
+
+	responses := marshal(t, spec.Components["responses"])
+	assert.True(t, strings.Contains(responses, `"304":{"description":"Not Modified"}`), responses)
+	assert.True(t, strings.Contains(responses, `"404":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/ErrorResponse"}},"application/problem+json":{"schema":{"$ref":"#/components/schemas/Problem"}}},"description":"Not Found"}`), responses)
+}
+
+func TestRegisterHandlers(t *testing.T) {
+	doc := NewDocument("test", "1.0.0", errorResponse{})
+	doc.Add("/v1", "items", testRoutes)
+	router := routing.New()
+	RegisterHandlers(router, doc)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, MediaTypeJSON, res.Header().Get("Content-Type"))
+	expected, _ := doc.MarshalJSON()
+	assert.JSONEq(t, string(expected), res.Body.String())
+
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), `<script src="/docs/swagger-ui-bundle.js"></script>`)
+	assert.NotContains(t, res.Body.String(), "https://")
+
+	// the files of the page are served from the binary
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/docs/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/javascript; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), "SwaggerUIBundle")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/docs/swagger-initializer.js", nil))
+	assert.Contains(t, res.Body.String(), `url: "/openapi.json"`)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/docs/swagger-ui.css", nil))
+	assert.Equal(t, "text/css; charset=utf-8", res.Header().Get("Content-Type"))
+
+	// the routes of the handlers are described
+	for _, route := range router.Routes() {
+		found := false
+		for _, r := range Routes {
+			found = found || r.Method == route.Method() && r.Path == route.Path()
+		}
+		assert.True(t, found, "%v %v", route.Method(), route.Path())
+	}
+}
+
+func marshal(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	assert.Nil(t, err)
+	return string(data)
+}
@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"unsafe"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Validatable is implemented by request types that expose the validation rules of their fields so that the rules
+// can be described in the document. The rules are usually the ones passed to validation.ValidateStruct by
+// the Validate method of the type.
+type Validatable interface {
+	FieldRules() []*validation.FieldRules
+}
+
+// formats maps the error codes of the string rules of ozzo-validation's is package to JSON schema formats.
+var formats = map[string]string{
+	"validation_is_email":    "email",
+	"validation_is_url":      "uri",
+	"validation_is_ipv4":     "ipv4",
+	"validation_is_ipv6":     "ipv6",
+	"validation_is_uuid":     "uuid",
+	"validation_is_dns_name": "hostname",
+	"validation_is_domain":   "hostname",
+}
+
+// the operators of validation.ThresholdRule
+const (
+	greaterThan = iota
+	greaterEqualThan
+	lessThan
+	lessEqualThan
+)
+
+// fieldRules returns the validation rules of the fields of a struct pointer, indexed by the addresses of the fields.
+func fieldRules(v reflect.Value) map[uintptr][]validation.Rule {
+	validatable, ok := v.Interface().(Validatable)
+	if !ok {
+		return nil
+	}
+	rules := map[uintptr][]validation.Rule{}
+	for _, fr := range validatable.FieldRules() {
+		frv := reflect.ValueOf(fr).Elem()
+		fieldPtr, ok := unexportedField(frv, "fieldPtr", reflect.Interface)
+		if !ok {
+			continue
+		}
+		ptr := reflect.ValueOf(fieldPtr.Interface())
+		if ptr.Kind() != reflect.Ptr {
+			continue
+		}
+		rules[ptr.Pointer()] = append(rules[ptr.Pointer()], ruleList(frv)...)
+	}
+	return rules
+}
+
+// applyRules adds the constraints of validation rules to the schema of a value and returns whether
+// the value is required. Rules that cannot be described, such as validation.By or validation.When, are ignored,
+// and so are the rules whose fields are not the ones expected.
+func applyRules(s Schema, rules []validation.Rule) bool {
+	required := false
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		rv := reflect.ValueOf(rule)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				continue
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			continue
+		}
+		// read the fields of a copy as the fields of values stored in interfaces are not addressable
+		copied := reflect.New(rv.Type()).Elem()
+		copied.Set(rv)
+		rv = copied
+
+		switch rule.(type) {
+		case validation.LengthRule, *validation.LengthRule:
+			minField, okMin := unexportedField(rv, "min", reflect.Int)
+			maxField, okMax := unexportedField(rv, "max", reflect.Int)
+			if !okMin || !okMax {
+				continue
+			}
+			min, max := int(minField.Int()), int(maxField.Int())
+			minKey, maxKey := "minLength", "maxLength"
+			if isType(s, "array") {
+				minKey, maxKey = "minItems", "maxItems"
+			} else if isType(s, "object") {
+				minKey, maxKey = "minProperties", "maxProperties"
+			}
+			if min > 0 {
+				s[minKey] = min
+			}
+			if max > 0 {
+				s[maxKey] = max
+			}
+		case validation.ThresholdRule, *validation.ThresholdRule:
+			thresholdField, okThreshold := unexportedField(rv, "threshold", reflect.Interface)
+			operator, okOperator := unexportedField(rv, "operator", reflect.Int)
+			if !okThreshold || !okOperator {
+				continue
+			}
+			threshold, ok := number(thresholdField.Interface())
+			if !ok {
+				continue
+			}
+			switch operator.Int() {
+			case greaterThan:
+				s["exclusiveMinimum"] = threshold
+			case greaterEqualThan:
+				s["minimum"] = threshold
+			case lessThan:
+				s["exclusiveMaximum"] = threshold
+			case lessEqualThan:
+				s["maximum"] = threshold
+			}
+		case validation.InRule, *validation.InRule:
+			if elements, ok := unexportedField(rv, "elements", reflect.Slice); ok {
+				s["enum"] = elements.Interface()
+			}
+		case validation.MatchRule, *validation.MatchRule:
+			if re, ok := unexportedField(rv, "re", reflect.Ptr); ok {
+				if re, ok := re.Interface().(*regexp.Regexp); ok && re != nil {
+					s["pattern"] = re.String()
+				}
+			}
+		case validation.StringRule, *validation.StringRule:
+			if err, ok := unexportedField(rv, "err", reflect.Interface); ok {
+				if err, ok := err.Interface().(validation.Error); ok && err != nil {
+					if format, ok := formats[err.Code()]; ok {
+						s["format"] = format
+					}
+				}
+			}
+		case validation.EachRule, *validation.EachRule:
+			key := "items"
+			if isType(s, "object") {
+				key = "additionalProperties"
+			}
+			if items, ok := s[key].(Schema); ok {
+				applyRules(items, ruleList(rv))
+			}
+		default:
+			// validation.Required and validation.NotNil are values of an unexported type
+			if rv.Type().Name() == "requiredRule" {
+				condition, okCondition := unexportedField(rv, "condition", reflect.Bool)
+				skipNil, okSkipNil := unexportedField(rv, "skipNil", reflect.Bool)
+				if okCondition && okSkipNil && condition.Bool() && !skipNil.Bool() {
+					required = true
+				}
+			}
+		}
+	}
+	return required
+}
+
+// ruleList returns the rules held by the "rules" field of a struct value, such as validation.FieldRules
+// or validation.EachRule.
+func ruleList(v reflect.Value) []validation.Rule {
+	f, ok := unexportedField(v, "rules", reflect.Slice)
+	if !ok {
+		return nil
+	}
+	rules, _ := f.Interface().([]validation.Rule)
+	return rules
+}
+
+// unexportedField returns a field of an addressable struct value, even if the field is unexported.
+// The fields read are private fields of ozzo-validation, so it returns false if the struct has no field
+// with the given name and kind, e.g. after the field is renamed, instead of failing.
+func unexportedField(v reflect.Value, name string, kind reflect.Kind) (reflect.Value, bool) {
+	if v.Kind() != reflect.Struct || !v.CanAddr() {
+		return reflect.Value{}, false
+	}
+	f := v.FieldByName(name)
+	if !f.IsValid() || f.Kind() != kind {
+		return reflect.Value{}, false
+	}
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem(), true
+}
+
+// isType returns whether the type of a schema is the given type or includes it.
+func isType(s Schema, typ string) bool {
+	switch t := s["type"].(type) {
+	case string:
+		return t == typ
+	case []string:
+		for _, t := range t {
+			if t == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// number returns a numeric threshold as a float64. It returns false for other thresholds, such as time.Time.
+func number(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
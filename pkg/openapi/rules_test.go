@@ -0,0 +1,35 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_unexportedField(t *testing.T) {
+	type rule struct {
+		min   int
+		rules []validation.Rule
+	}
+	v := reflect.New(reflect.TypeOf(rule{})).Elem()
+	v.Set(reflect.ValueOf(rule{min: 2, rules: []validation.Rule{validation.Required}}))
+
+	f, ok := unexportedField(v, "min", reflect.Int)
+	if assert.True(t, ok) {
+		assert.Equal(t, int64(2), f.Int())
+	}
+	assert.Len(t, ruleList(v), 1)
+
+	// unknown fields, fields of another kind and values that are not addressable structs are skipped
+	_, ok = unexportedField(v, "max", reflect.Int)
+	assert.False(t, ok)
+	_, ok = unexportedField(v, "min", reflect.Bool)
+	assert.False(t, ok)
+	_, ok = unexportedField(reflect.ValueOf(rule{}), "min", reflect.Int)
+	assert.False(t, ok)
+	_, ok = unexportedField(reflect.ValueOf(2), "min", reflect.Int)
+	assert.False(t, ok)
+	assert.Nil(t, ruleList(reflect.New(reflect.TypeOf(struct{ rules []int }{})).Elem()))
+}
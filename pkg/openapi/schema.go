@@ -0,0 +1,300 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+)
+
+// Schema represents a JSON schema.
+type Schema map[string]interface{}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// page describes the response of a list endpoint with page-based pagination.
+type page struct {
+	item interface{}
+}
+
+// cursorPage describes the response of a list endpoint with cursor-based pagination.
+type cursorPage struct {
+	item interface{}
+}
+
+// oneOf describes a response that is one of several types.
+type oneOf struct {
+	values []interface{}
+}
+
+// Page describes a page of items as written by the handlers responding with pagination.Pages.
+// The item is a value of the type of the items.
+func Page(item interface{}) interface{} {
+	return page{item}
+}
+
+// CursorPage describes a page of items as written by the handlers responding with pagination.CursorPages.
+// The item is a value of the type of the items.
+func CursorPage(item interface{}) interface{} {
+	return cursorPage{item}
+}
+
+// OneOf describes a response or request body that is a value of one of the types of the given values.
+func OneOf(values ...interface{}) interface{} {
+	return oneOf{values}
+}
+
+// generator generates the schemas of Go types. Named struct types are added to the components of the document
+// and referenced.
+type generator struct {
+	schemas map[string]Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]Schema{}, names: map[reflect.Type]string{}}
+}
+
+// schemaOf returns the schema of the type of the given value.
+func (g *generator) schemaOf(value interface{}) Schema {
+	switch v := value.(type) {
+	case page:
+		return g.pageSchema(reflect.TypeOf(pagination.Pages{}), v.item)
+	case cursorPage:
+		return g.pageSchema(reflect.TypeOf(pagination.CursorPages{}), v.item)
+	case oneOf:
+		var schemas []Schema
+		for _, value := range v.values {
+			schemas = append(schemas, g.schemaOf(value))
+		}
+		return Schema{"oneOf": schemas}
+	}
+	return g.schema(reflect.TypeOf(value))
+}
+
+// pageSchema returns the schema of a page type whose items are of the type of the given item.
+func (g *generator) pageSchema(t reflect.Type, item interface{}) Schema {
+	s := g.structSchema(t)
+	s["properties"].(map[string]Schema)["items"] = Schema{"type": "array", "items": g.schemaOf(item)}
+	return s
+}
+
+// schema returns the schema of a type as it is encoded by encoding/json.
+func (g *generator) schema(t reflect.Type) Schema {
+	if t == nil {
+		return Schema{}
+	}
+	if t.Kind() == reflect.Ptr {
+		return nullable(g.schema(t.Elem()))
+	}
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.ref(t)
+	}
+	return Schema{}
+}
+
+// ref returns a reference to the schema of a named struct type, adding the schema to the components if needed.
+// Types of different packages with the same name are prefixed with the package name.
+func (g *generator) ref(t reflect.Type) Schema {
+	name, ok := g.names[t]
+	if !ok {
+		name = exported(t.Name())
+		if _, taken := g.schemas[name]; taken {
+			name = exported(path.Base(t.PkgPath())) + name
+		}
+		g.names[t] = name
+		// reserve the name before generating the schema so that recursive types end
+		g.schemas[name] = Schema{}
+		g.schemas[name] = g.structSchema(t)
+	}
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+// structSchema returns the schema of the JSON object encoding a struct type. Properties that are not fields
+// of the struct are not allowed. If the type exposes the validation rules of its fields, the rules are added
+// to the schemas of the properties.
+func (g *generator) structSchema(t reflect.Type) Schema {
+	v := reflect.New(t)
+	rules := fieldRules(v)
+	properties := map[string]Schema{}
+	var required []string
+	for _, f := range jsonFields(t) {
+		s := g.schema(f.typ)
+		if addr, ok := fieldAddr(v.Elem(), f.index); ok {
+			if rs, ok := rules[addr]; ok {
+				if applyRules(s, rs) {
+					required = append(required, f.name)
+				}
+			}
+		}
+		properties[f.name] = s
+	}
+	s := Schema{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// nullable returns a schema that also accepts null.
+func nullable(s Schema) Schema {
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+		return s
+	}
+	if len(s) == 0 {
+		return s
+	}
+	return Schema{"oneOf": []Schema{s, {"type": "null"}}}
+}
+
+// jsonField represents a field of a struct encoded by encoding/json.
+type jsonField struct {
+	name   string
+	index  []int
+	typ    reflect.Type
+	depth  int
+	tagged bool
+}
+
+// jsonFields returns the fields of a struct type that are encoded by encoding/json, following its rules
+// for embedded structs and conflicting names.
+func jsonFields(t reflect.Type) []jsonField {
+	var all []jsonField
+	collectFields(t, nil, 0, &all)
+
+	byName := map[string][]jsonField{}
+	var names []string
+	for _, f := range all {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []jsonField
+	for _, name := range names {
+		if f, ok := dominantField(byName[name]); ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, depth int, fields *[]jsonField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := sf.Type
+		if sf.Anonymous {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if name == "" && ft.Kind() == reflect.Struct {
+				collectFields(ft, append(append([]int{}, index...), i), depth+1, fields)
+				continue
+			}
+			if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+				continue
+			}
+		} else if sf.PkgPath != "" {
+			continue
+		}
+		f := jsonField{name: name, index: append(append([]int{}, index...), i), typ: sf.Type, depth: depth, tagged: name != ""}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		*fields = append(*fields, f)
+	}
+}
+
+// dominantField returns the field that is encoded among the fields with the same name.
+// No field is encoded if there are several fields at the shallowest depth and not exactly one of them is tagged.
+func dominantField(fields []jsonField) (jsonField, bool) {
+	depth := fields[0].depth
+	for _, f := range fields {
+		if f.depth < depth {
+			depth = f.depth
+		}
+	}
+	var candidates, tagged []jsonField
+	for _, f := range fields {
+		if f.depth == depth {
+			candidates = append(candidates, f)
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return jsonField{}, false
+}
+
+// fieldAddr returns the address of the field with the given index in an addressable struct value.
+// It returns false if the field is in an embedded struct pointer.
+func fieldAddr(v reflect.Value, index []int) (uintptr, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			return 0, false
+		}
+		v = v.Field(i)
+	}
+	return v.UnsafeAddr(), true
+}
+
+// exported returns the name with its first letter in upper case.
+func exported(name string) string {
+	for i, r := range name {
+		return string(unicode.ToUpper(r)) + name[i+len(string(r)):]
+	}
+	return name
+}
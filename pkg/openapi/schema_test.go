@@ -0,0 +1,101 @@
+package openapi
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Note      string
+}
+
+type other struct {
+	Note  string
+	Extra string `json:"extra"`
+}
+
+type item struct {
+	base
+	other
+	Name     string            `json:"name"`
+	Email    string            `json:"email,omitempty"`
+	Score    *float64          `json:"score"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Parent   *item             `json:"parent"`
+	Data     []byte            `json:"data"`
+	Raw      json.RawMessage   `json:"raw"`
+	Ignored  string            `json:"-"`
+	internal string
+	Untagged bool
+}
+
+func (m *item) FieldRules() []*validation.FieldRules {
+	return []*validation.FieldRules{
+		validation.Field(&m.ID, validation.Min(1)),
+		validation.Field(&m.Name, validation.Required, validation.Length(2, 64), validation.Match(regexp.MustCompile(`^[a-z]+$`))),
+		validation.Field(&m.Email, is.Email, validation.By(func(interface{}) error { return nil })),
+		validation.Field(&m.Score, validation.NilOrNotEmpty, validation.Max(10.0).Exclusive()),
+		validation.Field(&m.Tags, validation.Length(0, 5), validation.Each(validation.In("a", "b"))),
+		validation.Field(&m.Untagged, validation.When(true, validation.Required)),
+	}
+}
+
+func Test_generator_schemaOf(t *testing.T) {
+	g := newGenerator()
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/Item"}, g.schemaOf(item{}))
+	assert.Equal(t, Schema{"type": "array", "items": Schema{"$ref": "#/components/schemas/Item"}}, g.schemaOf([]item{}))
+	assert.Equal(t, Schema{"type": "string"}, g.schemaOf(""))
+
+	s := g.schemas["Item"]
+	data, err := json.Marshal(s)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"created_at": {"type": "string", "format": "date-time"},
+			"extra": {"type": "string"},
+			"name": {"type": "string", "minLength": 2, "maxLength": 64, "pattern": "^[a-z]+$"},
+			"email": {"type": "string", "format": "email"},
+			"score": {"type": ["number", "null"], "exclusiveMaximum": 10},
+			"tags": {"type": "array", "items": {"type": "string", "enum": ["a", "b"]}, "maxItems": 5},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"parent": {"oneOf": [{"$ref": "#/components/schemas/Item"}, {"type": "null"}]},
+			"data": {"type": "string", "contentEncoding": "base64"},
+			"raw": {},
+			"Untagged": {"type": "boolean"}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`, string(data))
+}
+
+func Test_generator_pageSchema(t *testing.T) {
+	g := newGenerator()
+	s := g.schemaOf(OneOf(Page(item{}), CursorPage(item{})))
+	schemas := s["oneOf"].([]Schema)
+	if assert.Len(t, schemas, 2) {
+		pages := schemas[0]["properties"].(map[string]Schema)
+		assert.Equal(t, Schema{"type": "array", "items": Schema{"$ref": "#/components/schemas/Item"}}, pages["items"])
+		assert.Equal(t, Schema{"type": "integer"}, pages["page_count"])
+		cursorPages := schemas[1]["properties"].(map[string]Schema)
+		assert.Equal(t, Schema{"type": "string"}, cursorPages["next_cursor"])
+	}
+}
+
+func Test_generator_ref(t *testing.T) {
+	g := newGenerator()
+	type Item struct{}
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/Item"}, g.schemaOf(item{}))
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/OpenapiItem"}, g.schemaOf(Item{}))
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/Item"}, g.schemaOf(item{}))
+}
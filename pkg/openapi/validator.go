@@ -0,0 +1,580 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// Violation represents a part of a request that does not match the document.
+type Violation struct {
+	// In is the location of the invalid value: body, path, query or header.
+	In string `json:"in"`
+	// Pointer is the JSON pointer (RFC 6901) of the invalid value in the body, e.g. /operations/0/method,
+	// or of the invalid parameter, e.g. /per_page.
+	Pointer string `json:"pointer"`
+	Error   string `json:"error"`
+}
+
+// ValidationError represents the violations of a request that does not match the document.
+type ValidationError []Violation
+
+// Error returns the error message listing the violations.
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = fmt.Sprintf("%v %v: %v", v.In, v.Pointer, v.Error)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator validates requests against the operations of an OpenAPI document.
+// It supports the parts of JSON schema used by the generated documents and commonly found in checked-in ones.
+type Validator struct {
+	spec     map[string]interface{}
+	matchers []matcher
+	patterns sync.Map
+}
+
+// matcher matches the requests of an operation.
+type matcher struct {
+	method    string
+	path      *regexp.Regexp
+	names     []string
+	operation map[string]interface{}
+	// params are the parameters shared by the operations of the path
+	params []interface{}
+}
+
+// templateParam matches the parameters of OpenAPI path templates, e.g. {id}.
+var templateParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// NewValidator creates a validator of the requests to the operations of the JSON-encoded OpenAPI document.
+func NewValidator(data []byte) (*Validator, error) {
+	v := &Validator{}
+	if err := json.Unmarshal(data, &v.spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	paths, _ := v.spec["paths"].(map[string]interface{})
+	for path, item := range paths {
+		item, _ := v.resolve(item).(map[string]interface{})
+		var names []string
+		pattern := "^"
+		last := 0
+		for _, loc := range templateParam.FindAllStringSubmatchIndex(path, -1) {
+			pattern += regexp.QuoteMeta(path[last:loc[0]]) + "([^/]+)"
+			names = append(names, path[loc[2]:loc[3]])
+			last = loc[1]
+		}
+		re, err := regexp.Compile(pattern + regexp.QuoteMeta(path[last:]) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %v: %v", path, err)
+		}
+		params, _ := item["parameters"].([]interface{})
+		for method, operation := range item {
+			if operation, ok := operation.(map[string]interface{}); ok && method != "parameters" {
+				v.matchers = append(v.matchers, matcher{strings.ToUpper(method), re, names, operation, params})
+			}
+		}
+	}
+	// prefer the paths with the fewest parameters, e.g. /items/text over /items/{id}
+	sort.SliceStable(v.matchers, func(i, j int) bool {
+		return len(v.matchers[i].names) < len(v.matchers[j].names)
+	})
+	return v, nil
+}
+
+// Validator returns a validator of the requests to the operations of the document.
+func (d *Document) Validator() (*Validator, error) {
+	data, err := d.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return NewValidator(data)
+}
+
+// Handler returns a middleware that validates the requests to the operations of the document before they are handled.
+// A ValidationError is returned if a request does not match its operation. Requests to other paths are not validated.
+func (v *Validator) Handler() routing.Handler {
+	return func(c *routing.Context) error {
+		return v.Validate(c.Request)
+	}
+}
+
+// Validate validates the path, query and header parameters and the JSON body of a request against its operation.
+// The body of the request is restored so that it can be read again.
+func (v *Validator) Validate(req *http.Request) error {
+	m, values := v.match(req)
+	if m == nil {
+		return nil
+	}
+	var violations ValidationError
+	params := append(append([]interface{}{}, m.params...), listOf(m.operation["parameters"])...)
+	for _, param := range params {
+		param, _ := v.resolve(param).(map[string]interface{})
+		v.validateParam(req, param, values, &violations)
+	}
+	if body, ok := v.resolve(m.operation["requestBody"]).(map[string]interface{}); ok {
+		if err := v.validateBody(req, body, &violations); err != nil {
+			return err
+		}
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// match returns the matcher of the operation of a request and the values of its path parameters.
+func (v *Validator) match(req *http.Request) (*matcher, map[string]string) {
+	for i, m := range v.matchers {
+		if m.method != req.Method {
+			continue
+		}
+		if matches := m.path.FindStringSubmatch(req.URL.Path); matches != nil {
+			values := map[string]string{}
+			for j, name := range m.names {
+				values[name], _ = url.PathUnescape(matches[j+1])
+			}
+			return &v.matchers[i], values
+		}
+	}
+	return nil, nil
+}
+
+// validateParam validates a path, query or header parameter.
+func (v *Validator) validateParam(req *http.Request, param map[string]interface{}, values map[string]string, violations *ValidationError) {
+	name, _ := param["name"].(string)
+	in, _ := param["in"].(string)
+	var value string
+	present := false
+	switch in {
+	case "path":
+		value, present = values[name]
+	case "query":
+		if style, _ := param["style"].(string); style == "deepObject" {
+			return
+		}
+		var list []string
+		list, present = req.URL.Query()[name]
+		if present {
+			value = list[0]
+		}
+	case "header":
+		value = req.Header.Get(name)
+		present = value != ""
+	default:
+		return
+	}
+	pointer := "/" + escapePointer(name)
+	if !present {
+		if required, _ := param["required"].(bool); required {
+			*violations = append(*violations, Violation{in, pointer, "is required"})
+		}
+		return
+	}
+	schema, _ := v.resolve(param["schema"]).(map[string]interface{})
+	converted, err := convertParam(value, schema)
+	if err != nil {
+		*violations = append(*violations, Violation{in, pointer, err.Error()})
+		return
+	}
+	v.validate(schema, converted, in, pointer, violations)
+}
+
+// convertParam converts the string value of a parameter to the type of its schema.
+func convertParam(value string, schema map[string]interface{}) (interface{}, error) {
+	switch {
+	case hasType(schema, "integer"):
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return float64(i), nil
+	case hasType(schema, "number"):
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case hasType(schema, "boolean"):
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// validateBody validates a JSON request body. Bodies of other media types are left to the handlers.
+func (v *Validator) validateBody(req *http.Request, body map[string]interface{}, violations *ValidationError) error {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = MediaTypeJSON
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !isJSON(mediaType) {
+		return nil
+	}
+	content, _ := body["content"].(map[string]interface{})
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if required, _ := body["required"].(bool); required {
+			*violations = append(*violations, Violation{"body", "", "is required"})
+		}
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		*violations = append(*violations, Violation{"body", "", "must be valid JSON"})
+		return nil
+	}
+	schema, _ := v.resolve(media["schema"]).(map[string]interface{})
+	v.validate(schema, value, "body", "", violations)
+	return nil
+}
+
+// validate validates a JSON value against a schema and adds the violations found.
+func (v *Validator) validate(schema map[string]interface{}, value interface{}, in, pointer string, violations *ValidationError) {
+	if schema == nil {
+		return
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, _ := v.resolveRef(ref).(map[string]interface{})
+		v.validate(resolved, value, in, pointer, violations)
+	}
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{in, pointer, fmt.Sprintf(format, args...)})
+	}
+
+	if schemas := listOf(schema["oneOf"]); len(schemas) > 0 {
+		matched := 0
+		for _, s := range schemas {
+			s, _ := v.resolve(s).(map[string]interface{})
+			if v.valid(s, value) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			// report the violations of the only alternative that is not null, if any
+			if s := nonNull(schemas, v); s != nil && value != nil {
+				v.validate(s, value, in, pointer, violations)
+			} else {
+				add("must match exactly one of the allowed schemas")
+			}
+		}
+	}
+	for _, s := range listOf(schema["allOf"]) {
+		s, _ := v.resolve(s).(map[string]interface{})
+		v.validate(s, value, in, pointer, violations)
+	}
+	if schemas := listOf(schema["anyOf"]); len(schemas) > 0 {
+		matched := false
+		for _, s := range schemas {
+			s, _ := v.resolve(s).(map[string]interface{})
+			matched = matched || v.valid(s, value)
+		}
+		if !matched {
+			add("must match at least one of the allowed schemas")
+		}
+	}
+
+	if types := typesOf(schema); len(types) > 0 && !matchesType(types, value) {
+		add("must be of type %v", strings.Join(types, " or "))
+		return
+	}
+	if enum := listOf(schema["enum"]); len(enum) > 0 {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, value)
+		}
+		if !found {
+			var values []string
+			for _, e := range enum {
+				values = append(values, fmt.Sprint(e))
+			}
+			add("must be one of: %v", strings.Join(values, ", "))
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			add("the length must be no less than %v", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			add("the length must be no more than %v", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := v.pattern(pattern); re != nil && !re.MatchString(value) {
+				add("must be in a valid format")
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !validFormat(format, value) {
+			add("must be a valid %v", format)
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && value < min {
+			add("must be no less than %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && value > max {
+			add("must be no greater than %v", max)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && value <= min {
+			add("must be greater than %v", min)
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && value >= max {
+			add("must be less than %v", max)
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(value)) < min {
+			add("must contain at least %v items", min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(value)) > max {
+			add("must contain no more than %v items", max)
+		}
+		if items, ok := v.resolve(schema["items"]).(map[string]interface{}); ok {
+			for i, item := range value {
+				v.validate(items, item, in, pointer+"/"+strconv.Itoa(i), violations)
+			}
+		}
+	case map[string]interface{}:
+		if min, ok := schema["minProperties"].(float64); ok && float64(len(value)) < min {
+			add("must contain at least %v properties", min)
+		}
+		if max, ok := schema["maxProperties"].(float64); ok && float64(len(value)) > max {
+			add("must contain no more than %v properties", max)
+		}
+		for _, name := range listOf(schema["required"]) {
+			if name, ok := name.(string); ok {
+				if _, present := value[name]; !present {
+					*violations = append(*violations, Violation{in, pointer + "/" + escapePointer(name), "is required"})
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		var names []string
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := pointer + "/" + escapePointer(name)
+			if property, ok := properties[name]; ok {
+				property, _ := v.resolve(property).(map[string]interface{})
+				v.validate(property, value[name], in, p, violations)
+				continue
+			}
+			switch additional := v.resolve(schema["additionalProperties"]).(type) {
+			case bool:
+				if !additional {
+					*violations = append(*violations, Violation{in, p, "is not allowed"})
+				}
+			case map[string]interface{}:
+				v.validate(additional, value[name], in, p, violations)
+			}
+		}
+	}
+}
+
+// valid returns whether a value matches a schema.
+func (v *Validator) valid(schema map[string]interface{}, value interface{}) bool {
+	var violations ValidationError
+	v.validate(schema, value, "", "", &violations)
+	return len(violations) == 0
+}
+
+// nonNull returns the only schema in a list that does not only accept null, or nil if there are several.
+func nonNull(schemas []interface{}, v *Validator) map[string]interface{} {
+	var result map[string]interface{}
+	for _, s := range schemas {
+		s, _ := v.resolve(s).(map[string]interface{})
+		if typ, _ := s["type"].(string); typ == "null" {
+			continue
+		}
+		if result != nil {
+			return nil
+		}
+		result = s
+	}
+	return result
+}
+
+// resolve returns the value referenced by a reference object, or the given value if it is not a reference.
+func (v *Validator) resolve(value interface{}) interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		if ref, ok := m["$ref"].(string); ok && len(m) == 1 {
+			return v.resolveRef(ref)
+		}
+	}
+	return value
+}
+
+// resolveRef returns the value referenced by a JSON pointer into the document, e.g. #/components/schemas/Album.
+func (v *Validator) resolveRef(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var value interface{} = v.spec
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[token]
+	}
+	return v.resolve(value)
+}
+
+// pattern returns the compiled regular expression of a pattern, or nil if it is invalid.
+func (v *Validator) pattern(pattern string) *regexp.Regexp {
+	if re, ok := v.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	v.patterns.Store(pattern, re)
+	return re
+}
+
+// typesOf returns the types allowed by a schema.
+func typesOf(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, t := range t {
+			if t, ok := t.(string); ok {
+				types = append(types, t)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType returns whether a schema allows the given type.
+func hasType(schema map[string]interface{}, typ string) bool {
+	for _, t := range typesOf(schema) {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesType returns whether a JSON value is of one of the given types.
+func matchesType(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch value := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || t == "integer" && value == math.Trunc(value) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uuidPattern matches UUIDs.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// hostnamePattern matches host names.
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?\.?$`)
+
+// validFormat returns whether a string is in the given format. Unknown formats are not checked.
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		_, err := mail.ParseAddress(value)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "hostname":
+		return len(value) <= 255 && hostnamePattern.MatchString(value)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	}
+	return true
+}
+
+// isJSON returns whether a media type is JSON, e.g. application/json or application/merge-patch+json.
+func isJSON(mediaType string) bool {
+	return mediaType == MediaTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// listOf returns a JSON array, or nil if the value is not an array.
+func listOf(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
+
+// escapePointer escapes a reference token of a JSON pointer.
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
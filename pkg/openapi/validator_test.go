@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type child struct {
+	Name string `json:"name"`
+}
+
+type order struct {
+	Kind     string            `json:"kind"`
+	Quantity int               `json:"quantity"`
+	Email    string            `json:"email"`
+	Children []child           `json:"children"`
+	Parent   *child            `json:"parent"`
+	Labels   map[string]string `json:"labels"`
+}
+
+var validatorRoutes = []Route{
+	{Method: "GET", Path: "/orders", Summary: "List orders", Params: Params(PageParams, QueryParams, []Parameter{
+		{Name: "active", In: "query", Type: "boolean"},
+		{Name: "X-Tenant", In: "header", Required: true},
+	})},
+	{Method: "GET", Path: "/orders/<id>", Summary: "Get an order"},
+	{Method: "GET", Path: "/orders/recent", Summary: "Get the recent orders"},
+	{Method: "POST", Path: "/orders", Summary: "Create an order", Request: order{}},
+	{Method: "POST", Path: "/orders:import", Summary: "Import orders", Request: "", RequestType: "text/csv"},
+}
+
+func newTestValidator(t *testing.T) *Validator {
+	doc := NewDocument("test", "1.0.0", errorResponse{})
+	doc.Add("/v1", "orders", validatorRoutes)
+	v, err := doc.Validator()
+	assert.Nil(t, err)
+	return v
+}
+
+func TestValidator_Validate(t *testing.T) {
+	v := newTestValidator(t)
+	tenant := http.Header{"X-Tenant": {"a"}}
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		header http.Header
+		want   ValidationError
+	}{
+		{"valid query", "GET", "/v1/orders?page=2&per_page=10&active=true&filter[kind]=a", "", tenant, nil},
+		{"invalid query", "GET", "/v1/orders?page=x&active=yes", "", tenant, ValidationError{
+			{"query", "/page", "must be an integer"},
+			{"query", "/active", "must be a boolean"},
+		}},
+		{"missing header", "GET", "/v1/orders", "", nil, ValidationError{{"header", "/X-Tenant", "is required"}}},
+		{"literal path", "GET", "/v1/orders/recent", "", nil, nil},
+		{"path parameter", "GET", "/v1/orders/1", "", nil, nil},
+		{"unknown path", "GET", "/v1/customers?page=x", "", nil, nil},
+		{"unknown method", "DELETE", "/v1/orders", "", nil, nil},
+		{"valid body", "POST", "/v1/orders", `{"kind":"a","quantity":2,"children":[{"name":"c"}],"parent":null,"labels":{"x":"y"}}`, nil, nil},
+		{"invalid body", "POST", "/v1/orders", `{"kind":1,"quantity":1.5,"children":[{"name":"c","age":3},{"name":2}],"parent":{"x":1},"labels":{"x":1},"extra":true}`, nil, ValidationError{
+			{"body", "/children/0/age", "is not allowed"},
+			{"body", "/children/1/name", "must be of type string"},
+			{"body", "/extra", "is not allowed"},
+			{"body", "/kind", "must be of type string"},
+			{"body", "/labels/x", "must be of type string"},
+			{"body", "/parent/x", "is not allowed"},
+			{"body", "/quantity", "must be of type integer"},
+		}},
+		{"malformed body", "POST", "/v1/orders", `{"kind":`, nil, ValidationError{{"body", "", "must be valid JSON"}}},
+		{"empty body", "POST", "/v1/orders", ``, nil, ValidationError{{"body", "", "is required"}}},
+		{"other media type", "POST", "/v1/orders:import", `a,b`, http.Header{"Content-Type": {"text/csv"}}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			err := v.Validate(req)
+			if tc.want == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.Equal(t, tc.want, err)
+			}
+			// the body can be read again
+			body, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, tc.body, string(body))
+		})
+	}
+}
+
+func TestValidator_validate(t *testing.T) {
+	v, err := NewValidator([]byte(`{
+		"components": {"schemas": {"Name": {"type": "string", "minLength": 2, "maxLength": 4, "pattern": "^[a-z]+$"}}},
+		"paths": {}
+	}`))
+	assert.Nil(t, err)
+	tests := []struct {
+		name   string
+		schema string
+		value  interface{}
+		want   []string
+	}{
+		{"ref", `{"$ref": "#/components/schemas/Name"}`, "abc", nil},
+		{"length", `{"$ref": "#/components/schemas/Name"}`, "abcde", []string{"the length must be no more than 4"}},
+		{"pattern", `{"$ref": "#/components/schemas/Name"}`, "A1", []string{"must be in a valid format"}},
+		{"enum", `{"enum": ["A", "MX"]}`, "B", []string{"must be one of: A, MX"}},
+		{"bounds", `{"type": "integer", "minimum": 1, "exclusiveMaximum": 10}`, float64(10), []string{"must be less than 10"}},
+		{"items", `{"type": "array", "minItems": 1, "maxItems": 2}`, []interface{}{1.0, 2.0, 3.0}, []string{"must contain no more than 2 items"}},
+		{"required", `{"type": "object", "required": ["name"]}`, map[string]interface{}{}, []string{"is required"}},
+		{"nullable", `{"type": ["string", "null"]}`, nil, nil},
+		{"one of", `{"oneOf": [{"$ref": "#/components/schemas/Name"}, {"type": "null"}]}`, "a", []string{"the length must be no less than 2"}},
+		{"email", `{"type": "string", "format": "email"}`, "foo", []string{"must be a valid email"}},
+		{"uri", `{"type": "string", "format": "uri"}`, "https://example.com", nil},
+		{"ipv4", `{"type": "string", "format": "ipv4"}`, "::1", []string{"must be a valid ipv4"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := NewValidator([]byte(`{"schema": ` + tc.schema + `}`))
+			assert.Nil(t, err)
+			var violations ValidationError
+			v.validate(schema.spec["schema"].(map[string]interface{}), tc.value, "body", "", &violations)
+			var got []string
+			for _, violation := range violations {
+				got = append(got, violation.Error)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidator_Handler(t *testing.T) {
+	v := newTestValidator(t)
+	router := routing.New()
+	router.Use(v.Handler())
+	router.Post("/v1/orders", func(c *routing.Context) error {
+		var input order
+		if err := c.Read(&input); err != nil {
+			return err
+		}
+		return c.Write(input.Kind)
+	})
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/orders", strings.NewReader(`{"kind":"a"}`))
+	req.Header.Set("Content-Type", MediaTypeJSON)
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "a", res.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/orders", strings.NewReader(`{"kind":1}`))
+	c := routing.NewContext(httptest.NewRecorder(), req, v.Handler())
+	assert.Equal(t, ValidationError{{"body", "/kind", "must be of type string"}}, c.Next())
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := ValidationError{{"body", "/kind", "must be of type string"}, {"query", "/page", "must be an integer"}}
+	assert.Equal(t, "body /kind: must be of type string; query /page: must be an integer", err.Error())
+}
@@ -0,0 +1,242 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/qiangxue/go-rest-api/pkg/query"
+)
+
+var (
+	// CursorVar specifies the query parameter name for cursors. A request is in cursor mode if it has this parameter,
+	// and an empty cursor requests the first page.
+	CursorVar = "cursor"
+	// IncludeTotalVar specifies the query parameter name for including the total count in cursor mode
+	IncludeTotalVar = "include_total"
+	// CursorKey is the key signing the cursors so that clients cannot forge them. It should be set to a secret at startup.
+	CursorKey []byte
+)
+
+// errInvalidCursor is returned for cursors that are malformed, not signed with CursorKey, or issued for another sort order.
+var errInvalidCursor = errors.New("the cursor is invalid or expired")
+
+// CursorPages represents a page of data items in cursor mode, which uses keyset pagination instead of OFFSET.
+// The page after or before the current one is requested with NextCursor or PrevCursor.
+type CursorPages struct {
+	PerPage int `json:"per_page"`
+	// TotalCount is only set if the request asks for it, since counting all items is expensive.
+	TotalCount   *int        `json:"total_count,omitempty"`
+	NextCursor   string      `json:"next_cursor,omitempty"`
+	PrevCursor   string      `json:"prev_cursor,omitempty"`
+	Links        *Links      `json:"links,omitempty"`
+	Items        interface{} `json:"items"`
+	IncludeTotal bool        `json:"-"`
+
+	query query.Query
+}
+
+// cursor is the signed content of a cursor.
+type cursor struct {
+	// Keys are the names of the sort fields the cursor is valid for.
+	Keys     []string      `json:"k"`
+	Values   []interface{} `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+}
+
+// IsCursorRequest reports whether the HTTP request asks for cursor mode.
+func IsCursorRequest(req *http.Request) bool {
+	_, ok := req.URL.Query()[CursorVar]
+	return ok
+}
+
+// NewCursorFromRequest creates a CursorPages object using the query parameters found in the given HTTP request,
+// for the items selected and sorted by q. It fails if the cursor is invalid or was issued for another sort order.
+func NewCursorFromRequest(req *http.Request, q query.Query) (*CursorPages, error) {
+	params := req.URL.Query()
+	perPage := parseInt(params.Get(PageSizeVar), DefaultPageSize)
+	if perPage <= 0 {
+		perPage = DefaultPageSize
+	}
+	if perPage > MaxPageSize {
+		perPage = MaxPageSize
+	}
+	p := &CursorPages{
+		PerPage:      perPage,
+		IncludeTotal: params.Get(IncludeTotalVar) == "true",
+		query:        q,
+	}
+	if token := params.Get(CursorVar); token != "" {
+		c, err := decodeCursor(token)
+		if err != nil || !equalKeys(c.Keys, q.Keys()) {
+			return nil, errInvalidCursor
+		}
+		p.query.Position = &query.Position{Values: c.Values, Backward: c.Backward}
+	}
+	return p, nil
+}
+
+// Query returns the query selecting the items of the page, positioned at the cursor of the request.
+func (p *CursorPages) Query() query.Query {
+	return p.query
+}
+
+// Limit returns the LIMIT value that can be used in a SQL statement.
+// It is one more than the page size so that SetItems can tell whether there are more items.
+func (p *CursorPages) Limit() int {
+	return p.PerPage + 1
+}
+
+// SetItems sets the items of the page from the slice of items queried with Query and Limit,
+// and sets the cursors to the pages before and after them.
+// The values of the sort fields are read from the JSON representation of the items.
+func (p *CursorPages) SetItems(items interface{}) error {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("the items must be a slice, got %T", items)
+	}
+	more := v.Len() > p.PerPage
+	if more {
+		v = v.Slice(0, p.PerPage)
+	}
+	backward := p.query.Position != nil && p.query.Position.Backward
+	if backward {
+		// the items were queried in reverse order, starting from the nearest to the cursor
+		swap := reflect.Swapper(v.Interface())
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	p.Items = v.Interface()
+	p.NextCursor, p.PrevCursor = "", ""
+	if v.Len() == 0 {
+		return nil
+	}
+	keys := p.query.Keys()
+	// paginating forward, there are later items if more were found, and earlier ones if the page is not the first;
+	// paginating backward, it is the other way around.
+	if more || backward {
+		values, err := keyValues(v.Index(v.Len()-1).Interface(), keys)
+		if err != nil {
+			return err
+		}
+		p.NextCursor = encodeCursor(cursor{keys, values, false})
+	}
+	if backward && more || !backward && p.query.Position != nil {
+		values, err := keyValues(v.Index(0).Interface(), keys)
+		if err != nil {
+			return err
+		}
+		p.PrevCursor = encodeCursor(cursor{keys, values, true})
+	}
+	return nil
+}
+
+// BuildLinkHeader returns an HTTP header containing the links to the next and previous pages.
+// The links keep the query parameters of the given request URL except the cursor.
+func (p *CursorPages) BuildLinkHeader(u *url.URL) string {
+	var links []string
+	for _, link := range []struct{ cursor, rel string }{{p.PrevCursor, "prev"}, {p.NextCursor, "next"}} {
+		if link.cursor != "" {
+			links = append(links, fmt.Sprintf("<%v>; rel=\"%v\"", p.link(u, link.cursor), link.rel))
+		}
+	}
+	return strings.Join(links, ", ")
+}
+
+// link returns the given URL with the cursor query parameter set to the given cursor, or "" if the cursor is empty.
+func (p *CursorPages) link(u *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	params := u.Query()
+	params.Set(CursorVar, cursor)
+	ref := *u
+	ref.RawQuery = params.Encode()
+	return ref.String()
+}
+
+// keyValues returns the values of the given fields in the JSON representation of an item.
+func keyValues(item interface{}, keys []string) ([]interface{}, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("the items have no %q field", key)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// encodeCursor returns the signed token of a cursor: its JSON representation and HMAC in base64.
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(sign(data))
+}
+
+// decodeCursor verifies the signature of a cursor token and returns the cursor.
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return c, errInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, sign(data)) {
+		return c, errInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return c, errInvalidCursor
+	}
+	for i, value := range c.Values {
+		// the DB driver takes strings rather than json.Number
+		if n, ok := value.(json.Number); ok {
+			c.Values[i] = n.String()
+		}
+	}
+	return c, nil
+}
+
+// sign returns the HMAC-SHA256 of the data with CursorKey.
+func sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, CursorKey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
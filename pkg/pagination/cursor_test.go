@@ -0,0 +1,129 @@
+package pagination
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/qiangxue/go-rest-api/pkg/query"
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// fetch simulates a query of the items sorted by ID with keyset pagination.
+func fetch(items []item, q query.Query, limit int) []item {
+	result := []item{}
+	for _, it := range items {
+		if q.Position != nil {
+			id, _ := strconv.Atoi(q.Position.Values[0].(string))
+			if !q.Position.Backward && it.ID <= id || q.Position.Backward && it.ID >= id {
+				continue
+			}
+		}
+		result = append(result, it)
+	}
+	if q.Position != nil && q.Position.Backward {
+		sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	}
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func cursorPage(t *testing.T, items []item, cursor string) *CursorPages {
+	req, _ := http.NewRequest("GET", "http://example.com/items?per_page=2&cursor="+url.QueryEscape(cursor), nil)
+	p, err := NewCursorFromRequest(req, query.Query{})
+	if assert.Nil(t, err) {
+		assert.Nil(t, p.SetItems(fetch(items, p.Query(), p.Limit())))
+	}
+	return p
+}
+
+func TestCursorPages(t *testing.T) {
+	items := []item{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}, {5, "e"}}
+
+	// first page
+	p := cursorPage(t, items, "")
+	assert.Equal(t, []item{{1, "a"}, {2, "b"}}, p.Items)
+	assert.Empty(t, p.PrevCursor)
+	assert.NotEmpty(t, p.NextCursor)
+
+	// forward
+	p = cursorPage(t, items, p.NextCursor)
+	assert.Equal(t, []item{{3, "c"}, {4, "d"}}, p.Items)
+	assert.NotEmpty(t, p.PrevCursor)
+	assert.NotEmpty(t, p.NextCursor)
+	p = cursorPage(t, items, p.NextCursor)
+	assert.Equal(t, []item{{5, "e"}}, p.Items)
+	assert.NotEmpty(t, p.PrevCursor)
+	assert.Empty(t, p.NextCursor)
+
+	// backward
+	p = cursorPage(t, items, p.PrevCursor)
+	assert.Equal(t, []item{{3, "c"}, {4, "d"}}, p.Items)
+	assert.NotEmpty(t, p.PrevCursor)
+	assert.NotEmpty(t, p.NextCursor)
+	p = cursorPage(t, items, p.PrevCursor)
+	assert.Equal(t, []item{{1, "a"}, {2, "b"}}, p.Items)
+	assert.Empty(t, p.PrevCursor)
+	assert.NotEmpty(t, p.NextCursor)
+
+	// empty
+	p = cursorPage(t, nil, "")
+	assert.Equal(t, []item{}, p.Items)
+	assert.Empty(t, p.PrevCursor)
+	assert.Empty(t, p.NextCursor)
+
+	assert.NotNil(t, p.SetItems(item{}))
+}
+
+func TestNewCursorFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/items", nil)
+	assert.False(t, IsCursorRequest(req))
+
+	req, _ = http.NewRequest("GET", "http://example.com/items?cursor=&per_page=5000&include_total=true", nil)
+	assert.True(t, IsCursorRequest(req))
+	p, err := NewCursorFromRequest(req, query.Query{})
+	assert.Nil(t, err)
+	assert.Equal(t, MaxPageSize, p.PerPage)
+	assert.Equal(t, MaxPageSize+1, p.Limit())
+	assert.True(t, p.IncludeTotal)
+	assert.Nil(t, p.Query().Position)
+
+	// cursor with position
+	token := encodeCursor(cursor{[]string{"name", "id"}, []interface{}{"b", 2}, true})
+	byName := query.Query{Orders: []query.Order{{Field: "name", Column: "name"}}}
+	req, _ = http.NewRequest("GET", "http://example.com/items?cursor="+token, nil)
+	p, err = NewCursorFromRequest(req, byName)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPageSize, p.PerPage)
+	assert.False(t, p.IncludeTotal)
+	assert.Equal(t, &query.Position{Values: []interface{}{"b", "2"}, Backward: true}, p.Query().Position)
+
+	// cursor of another sort order
+	_, err = NewCursorFromRequest(req, query.Query{})
+	assert.Equal(t, errInvalidCursor, err)
+
+	// forged cursor
+	for _, forged := range []string{"abc", token + "x", "e30." + token[len(token)-43:], "x.y.z"} {
+		req, _ = http.NewRequest("GET", "http://example.com/items?cursor="+forged, nil)
+		_, err = NewCursorFromRequest(req, byName)
+		assert.Equal(t, errInvalidCursor, err, forged)
+	}
+}
+
+func TestCursorPages_BuildLinkHeader(t *testing.T) {
+	u, _ := url.Parse("http://example.com/items?cursor=abc&sort=name")
+	p := &CursorPages{NextCursor: "n"}
+	assert.Equal(t, `<http://example.com/items?cursor=n&sort=name>; rel="next"`, p.BuildLinkHeader(u))
+	p.PrevCursor = "p"
+	assert.Equal(t, `<http://example.com/items?cursor=p&sort=name>; rel="prev", <http://example.com/items?cursor=n&sort=name>; rel="next"`, p.BuildLinkHeader(u))
+	assert.Equal(t, "", (&CursorPages{}).BuildLinkHeader(u))
+}
@@ -0,0 +1,84 @@
+package pagination
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+)
+
+// Links represents the links to the other pages of a paginated list. A link is empty if there is no such page.
+type Links struct {
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Handler returns a middleware that adds the Link (RFC 8288) and X-Total-Count headers to the responses
+// whose data is *Pages or *CursorPages. The links keep the query parameters of the request except the page
+// and the cursor. If withLinks is true, the links are also added to the response body.
+//
+// The middleware must be used after content.TypeNegotiator, as it wraps the data writer chosen by the negotiator.
+func Handler(withLinks bool) routing.Handler {
+	return func(c *routing.Context) error {
+		mediaType, _, _ := mime.ParseMediaType(c.Response.Header().Get("Content-Type"))
+		writer, ok := content.DataWriters[mediaType]
+		if !ok {
+			writer = routing.DefaultDataWriter
+		}
+		c.SetDataWriter(&linkWriter{writer, c.Request.URL, withLinks})
+		return nil
+	}
+}
+
+// linkWriter is a routing.DataWriter that adds the links of paginated data before writing it.
+type linkWriter struct {
+	routing.DataWriter
+	url       *url.URL
+	withLinks bool
+}
+
+// Write sets the links of the paginated data and writes it with the wrapped data writer.
+func (w *linkWriter) Write(res http.ResponseWriter, data interface{}) error {
+	switch p := data.(type) {
+	case *Pages:
+		baseURL := *w.url
+		params := baseURL.Query()
+		params.Del(PageVar)
+		params.Del(PageSizeVar)
+		baseURL.RawQuery = params.Encode()
+		if header := p.BuildLinkHeader(baseURL.String(), DefaultPageSize); header != "" {
+			res.Header().Set("Link", header)
+		}
+		if p.TotalCount >= 0 {
+			res.Header().Set("X-Total-Count", strconv.Itoa(p.TotalCount))
+		}
+		if w.withLinks {
+			links := p.BuildLinks(baseURL.String(), DefaultPageSize)
+			p.Links = newLinks(Links{links[0], links[1], links[2], links[3]})
+		}
+	case *CursorPages:
+		if header := p.BuildLinkHeader(w.url); header != "" {
+			res.Header().Set("Link", header)
+		}
+		if p.TotalCount != nil {
+			res.Header().Set("X-Total-Count", strconv.Itoa(*p.TotalCount))
+		}
+		if w.withLinks {
+			p.Links = newLinks(Links{Prev: p.link(w.url, p.PrevCursor), Next: p.link(w.url, p.NextCursor)})
+		}
+	}
+	return w.DataWriter.Write(res, data)
+}
+
+// newLinks returns the given links, or nil if all of them are empty so that they are omitted from the response.
+func newLinks(links Links) *Links {
+	if links == (Links{}) {
+		return nil
+	}
+	return &links
+}
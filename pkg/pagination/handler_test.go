@@ -0,0 +1,52 @@
+package pagination
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		tag       string
+		url       string
+		withLinks bool
+		data      interface{}
+		link      string
+		total     string
+		body      string
+	}{
+		{"not paginated", "/albums", true, "ok", "", "", `"ok"`},
+		{"pages", "/albums?page=2&sort=name", false, New(2, 0, 300),
+			`</albums?sort=name&page=1>; rel="first", </albums?sort=name&page=1>; rel="prev", </albums?sort=name&page=3>; rel="next", </albums?sort=name&page=3>; rel="last"`,
+			"300", `{"page":2,"per_page":100,"page_count":3,"total_count":300,"items":null}`},
+		{"pages with links", "/albums?per_page=20&sort=name", true, New(1, 20, 30),
+			`</albums?sort=name&page=2&per_page=20>; rel="next", </albums?sort=name&page=2&per_page=20>; rel="last"`,
+			"30", `{"page":1,"per_page":20,"page_count":2,"total_count":30,"links":{"next":"/albums?sort=name&page=2&per_page=20","last":"/albums?sort=name&page=2&per_page=20"},"items":null}`},
+		{"single page", "/albums", true, New(1, 0, 3), "", "3",
+			`{"page":1,"per_page":100,"page_count":1,"total_count":3,"items":null}`},
+		{"unknown total", "/albums", true, New(1, 0, -1), `</albums?page=2>; rel="next"`, "",
+			`{"page":1,"per_page":100,"page_count":-1,"total_count":-1,"links":{"next":"/albums?page=2"},"items":null}`},
+		{"cursor pages", "/albums?cursor=abc&sort=name", true, &CursorPages{PerPage: 10, NextCursor: "def"},
+			`</albums?cursor=def&sort=name>; rel="next"`, "",
+			`{"per_page":10,"next_cursor":"def","links":{"next":"/albums?cursor=def&sort=name"},"items":null}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.tag, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			ctx := routing.NewContext(res, req, content.TypeNegotiator(content.JSON), Handler(tc.withLinks), func(c *routing.Context) error {
+				return c.Write(tc.data)
+			})
+
+			assert.Nil(t, ctx.Next())
+			assert.Equal(t, tc.link, res.Header().Get("Link"))
+			assert.Equal(t, tc.total, res.Header().Get("X-Total-Count"))
+			assert.JSONEq(t, tc.body, res.Body.String())
+		})
+	}
+}
@@ -25,6 +25,7 @@ type Pages struct {
 	PerPage    int         `json:"per_page"`
 	PageCount  int         `json:"page_count"`
 	TotalCount int         `json:"total_count"`
+	Links      *Links      `json:"links,omitempty"`
 	Items      interface{} `json:"items"`
 }
 
@@ -0,0 +1,375 @@
+// Package query provides support for filtering and sorting list requests.
+//
+// Filters and sort orders are given as query parameters, for example:
+//
+//	?filter[name][contains]=x&filter[created_at][gte]=2020-01-01T00:00:00Z&sort=-created_at,name
+//
+// A filter without an operator, like filter[name]=x, tests for equality. A sort field prefixed with "-" sorts
+// in descending order. Only the fields and operators declared in the Schema of a resource are accepted.
+package query
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+var (
+	// FilterVar specifies the prefix of the query parameters of filters
+	FilterVar = "filter"
+	// SortVar specifies the query parameter name for sort orders
+	SortVar = "sort"
+	// KeyField specifies the unique field that ends every sort order so that the order is total.
+	// Its name is also the name of its DB column.
+	KeyField = "id"
+)
+
+// Operators supported by filters.
+const (
+	Eq       = "eq"
+	Ne       = "ne"
+	Lt       = "lt"
+	Lte      = "lte"
+	Gt       = "gt"
+	Gte      = "gte"
+	Contains = "contains"
+	Prefix   = "prefix"
+	In       = "in"
+)
+
+var (
+	// StringOperators are the operators usually supported by string fields.
+	StringOperators = []string{Eq, Ne, Contains, Prefix, In}
+	// OrderedOperators are the operators usually supported by numeric and time fields.
+	OrderedOperators = []string{Eq, Ne, Lt, Lte, Gt, Gte, In}
+)
+
+// Type is the type of the values of a field.
+type Type int
+
+const (
+	// String fields take the values as they are.
+	String Type = iota
+	// Int fields take integer values.
+	Int
+	// Time fields take time values in RFC 3339 format.
+	Time
+	// Bool fields take boolean values.
+	Bool
+)
+
+// Field describes how a field of a resource can be filtered and sorted.
+type Field struct {
+	// Column is the name of the DB column of the field. The name of the field is used if it is empty.
+	Column string
+	Type   Type
+	// Operators are the operators the field can be filtered with. The field cannot be filtered if it is empty.
+	Operators []string
+	Sortable  bool
+}
+
+// Schema declares the fields of a resource that can be filtered or sorted, indexed by their names.
+type Schema map[string]Field
+
+// Condition represents a filter condition on a field.
+type Condition struct {
+	Field    string
+	Column   string
+	Operator string
+	// Value is the parsed value, or the slice of parsed values for the In operator.
+	Value interface{}
+}
+
+// Order represents a sort order on a field.
+type Order struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Position represents the position of a page in keyset pagination: the page starts after the item with the
+// given values of the sort fields (see Query.Keys), or ends before it if Backward is true.
+type Position struct {
+	Values   []interface{}
+	Backward bool
+}
+
+// Query represents the filter conditions and the sort orders of a list request.
+type Query struct {
+	Conditions []Condition
+	Orders     []Order
+	// Position restricts the query to the items after or before a position, for keyset pagination.
+	Position *Position
+}
+
+// filterParam matches the filter query parameters, e.g. filter[name] and filter[name][contains].
+var filterParam = regexp.MustCompile(`^\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// NewFromRequest creates a Query using the query parameters of the given HTTP request.
+func NewFromRequest(req *http.Request, schema Schema) (Query, error) {
+	return Parse(req.URL.Query(), schema)
+}
+
+// Parse creates a Query from the filter and sort query parameters.
+// It fails with a descriptive error if a parameter refers to a field or an operator not declared in the schema,
+// or if a filter value is not valid for the type of its field.
+func Parse(values url.Values, schema Schema) (Query, error) {
+	var q Query
+	var params []string
+	for param := range values {
+		if strings.HasPrefix(param, FilterVar+"[") {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		matches := filterParam.FindStringSubmatch(strings.TrimPrefix(param, FilterVar))
+		if matches == nil {
+			return Query{}, fmt.Errorf("invalid filter parameter %q, must be like %s[field] or %s[field][operator]", param, FilterVar, FilterVar)
+		}
+		name, op := matches[1], matches[2]
+		if op == "" {
+			op = Eq
+		}
+		field, ok := schema[name]
+		if !ok || len(field.Operators) == 0 {
+			return Query{}, fmt.Errorf("unknown filter field %q, must be one of: %s", name, strings.Join(schema.filterable(), ", "))
+		}
+		if !contains(field.Operators, op) {
+			return Query{}, fmt.Errorf("unsupported operator %q for the filter field %q, must be one of: %s", op, name, strings.Join(field.Operators, ", "))
+		}
+		for _, raw := range values[param] {
+			value, err := field.parse(op, raw)
+			if err != nil {
+				return Query{}, fmt.Errorf("invalid value %q of the parameter %s: %v", raw, param, err)
+			}
+			q.Conditions = append(q.Conditions, Condition{name, field.column(name), op, value})
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, s := range values[SortVar] {
+		for _, name := range strings.Split(s, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+			field, ok := schema[name]
+			if !ok || !field.Sortable {
+				return Query{}, fmt.Errorf("unknown sort field %q, must be one of: %s", name, strings.Join(schema.sortable(), ", "))
+			}
+			if seen[name] {
+				return Query{}, fmt.Errorf("duplicate sort field %q", name)
+			}
+			seen[name] = true
+			q.Orders = append(q.Orders, Order{name, field.column(name), desc})
+		}
+	}
+	return q, nil
+}
+
+// Expression returns the SQL condition equivalent to the filter conditions and the position,
+// or nil if there are none.
+func (q Query) Expression() dbx.Expression {
+	var exps []dbx.Expression
+	for _, c := range q.Conditions {
+		exps = append(exps, c.expression())
+	}
+	if q.Position != nil {
+		exps = append(exps, q.positionExpression())
+	}
+	if len(exps) == 0 {
+		return nil
+	}
+	return dbx.And(exps...)
+}
+
+// OrderBy returns the ORDER BY columns of the sort orders, ending with the key field.
+// The order is reversed if the position is backward, so that the items nearest to the position come first.
+func (q Query) OrderBy() []string {
+	var cols []string
+	for _, o := range q.orders() {
+		if o.Desc != (q.Position != nil && q.Position.Backward) {
+			cols = append(cols, o.Column+" DESC")
+		} else {
+			cols = append(cols, o.Column)
+		}
+	}
+	return cols
+}
+
+// Keys returns the names of the fields of the sort orders, ending with the key field.
+// They are the fields whose values make a Position.
+func (q Query) Keys() []string {
+	var keys []string
+	for _, o := range q.orders() {
+		keys = append(keys, o.Field)
+	}
+	return keys
+}
+
+// orders returns the sort orders, ending with the key field.
+func (q Query) orders() []Order {
+	for _, o := range q.Orders {
+		if o.Field == KeyField {
+			return q.Orders
+		}
+	}
+	return append(q.Orders[:len(q.Orders):len(q.Orders)], Order{KeyField, KeyField, false})
+}
+
+// positionExpression returns the SQL condition selecting the items after the position in the sort order,
+// or before it if the position is backward. For the orders (a, b DESC, id) it is like:
+//
+//	a > {a} OR (a = {a} AND b < {b}) OR (a = {a} AND b = {b} AND id > {id})
+func (q Query) positionExpression() dbx.Expression {
+	orders := q.orders()
+	if len(q.Position.Values) != len(orders) {
+		// an invalid position selects nothing rather than everything
+		return dbx.NewExp("1=0")
+	}
+	var alternatives []dbx.Expression
+	for i, o := range orders {
+		op := ">"
+		if o.Desc != q.Position.Backward {
+			op = "<"
+		}
+		exps := []dbx.Expression{}
+		for j := 0; j < i; j++ {
+			exps = append(exps, dbx.HashExp{orders[j].Column: q.Position.Values[j]})
+		}
+		exps = append(exps, compareExp{o.Column, op, q.Position.Values[i]})
+		alternatives = append(alternatives, dbx.And(exps...))
+	}
+	return dbx.Or(alternatives...)
+}
+
+// expression returns the SQL condition equivalent to the filter condition.
+func (c Condition) expression() dbx.Expression {
+	switch c.Operator {
+	case Ne:
+		return dbx.Not(dbx.HashExp{c.Column: c.Value})
+	case Lt:
+		return compareExp{c.Column, "<", c.Value}
+	case Lte:
+		return compareExp{c.Column, "<=", c.Value}
+	case Gt:
+		return compareExp{c.Column, ">", c.Value}
+	case Gte:
+		return compareExp{c.Column, ">=", c.Value}
+	case Contains:
+		exp := dbx.Like(c.Column, c.Value.(string))
+		exp.Like = "ILIKE"
+		return exp
+	case Prefix:
+		return dbx.Like(c.Column, c.Value.(string)).Match(false, true)
+	case In:
+		return dbx.In(c.Column, c.Value.([]interface{})...)
+	}
+	return dbx.HashExp{c.Column: c.Value}
+}
+
+// compareExp represents a comparison of a column with a value.
+type compareExp struct {
+	col   string
+	op    string
+	value interface{}
+}
+
+// Build converts the comparison into a SQL fragment.
+func (e compareExp) Build(db *dbx.DB, params dbx.Params) string {
+	name := fmt.Sprintf("p%v", len(params))
+	params[name] = e.value
+	return fmt.Sprintf("%v%v{:%v}", db.QuoteColumnName(e.col), e.op, name)
+}
+
+// column returns the DB column of the field with the given name.
+func (f Field) column(name string) string {
+	if f.Column != "" {
+		return f.Column
+	}
+	return name
+}
+
+// parse parses the raw value of a filter with the given operator.
+func (f Field) parse(op, raw string) (interface{}, error) {
+	if op != In {
+		return f.parseValue(raw)
+	}
+	var values []interface{}
+	for _, s := range strings.Split(raw, ",") {
+		value, err := f.parseValue(s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseValue parses a single raw value according to the type of the field.
+func (f Field) parseValue(raw string) (interface{}, error) {
+	switch f.Type {
+	case Int:
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return value, nil
+	case Time:
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a time in RFC 3339 format")
+		}
+		return value, nil
+	case Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+// filterable returns the sorted names of the fields that can be filtered.
+func (s Schema) filterable() []string {
+	var names []string
+	for name, field := range s {
+		if len(field.Operators) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortable returns the sorted names of the fields that can be sorted.
+func (s Schema) sortable() []string {
+	var names []string
+	for name, field := range s {
+		if field.Sortable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package query
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchema = Schema{
+	"id":         {Type: Int, Operators: OrderedOperators, Sortable: true},
+	"name":       {Type: String, Operators: StringOperators, Sortable: true},
+	"domain":     {Column: "domain_name", Type: String, Operators: []string{Eq}},
+	"verified":   {Type: Bool, Operators: []string{Eq, Ne}},
+	"created_at": {Type: Time, Operators: OrderedOperators, Sortable: true},
+}
+
+func TestParse(t *testing.T) {
+	created, _ := time.Parse(time.RFC3339, "2020-01-02T03:04:05Z")
+	tests := []struct {
+		tag   string
+		query string
+		want  Query
+		err   string
+	}{
+		{"empty", "", Query{}, ""},
+		{"other params", "page=2&per_page=10", Query{}, ""},
+		{"eq", "filter[name]=x", Query{Conditions: []Condition{{"name", "name", Eq, "x"}}}, ""},
+		{"column", "filter[domain][eq]=example.com", Query{Conditions: []Condition{{"domain", "domain_name", Eq, "example.com"}}}, ""},
+		{"int", "filter[id][gt]=10", Query{Conditions: []Condition{{"id", "id", Gt, 10}}}, ""},
+		{"time", "filter[created_at][lte]=2020-01-02T03:04:05Z", Query{Conditions: []Condition{{"created_at", "created_at", Lte, created}}}, ""},
+		{"bool", "filter[verified][ne]=true", Query{Conditions: []Condition{{"verified", "verified", Ne, true}}}, ""},
+		{"in", "filter[id][in]=1,2", Query{Conditions: []Condition{{"id", "id", In, []interface{}{1, 2}}}}, ""},
+		{"repeated", "filter[name][contains]=a&filter[name][contains]=b", Query{Conditions: []Condition{{"name", "name", Contains, "a"}, {"name", "name", Contains, "b"}}}, ""},
+		{"sort", "sort=-created_at,name", Query{Orders: []Order{{"created_at", "created_at", true}, {"name", "name", false}}}, ""},
+		{"sort empty", "sort=", Query{}, ""},
+		{"unknown field", "filter[foo]=x", Query{}, `unknown filter field "foo", must be one of: created_at, domain, id, name, verified`},
+		{"unknown operator", "filter[domain][contains]=x", Query{}, `unsupported operator "contains" for the filter field "domain", must be one of: eq`},
+		{"invalid param", "filter[name]x=1", Query{}, `invalid filter parameter "filter[name]x", must be like filter[field] or filter[field][operator]`},
+		{"invalid int", "filter[id]=abc", Query{}, `invalid value "abc" of the parameter filter[id]: must be an integer`},
+		{"invalid time", "filter[created_at][gt]=yesterday", Query{}, `invalid value "yesterday" of the parameter filter[created_at][gt]: must be a time in RFC 3339 format`},
+		{"invalid in", "filter[id][in]=1,a", Query{}, `invalid value "1,a" of the parameter filter[id][in]: must be an integer`},
+		{"unknown sort", "sort=verified", Query{}, `unknown sort field "verified", must be one of: created_at, id, name`},
+		{"duplicate sort", "sort=name,-name", Query{}, `duplicate sort field "name"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := Parse(values, testSchema)
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, q)
+		})
+	}
+}
+
+func TestNewFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com?filter[name][prefix]=a&sort=-id", nil)
+	q, err := NewFromRequest(req, testSchema)
+	assert.Nil(t, err)
+	assert.Equal(t, Query{
+		Conditions: []Condition{{"name", "name", Prefix, "a"}},
+		Orders:     []Order{{"id", "id", true}},
+	}, q)
+}
+
+func TestQuery_Expression(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	assert.Nil(t, Query{}.Expression())
+
+	q := Query{Conditions: []Condition{
+		{"name", "name", Eq, "x"},
+		{"name", "name", Ne, "y"},
+		{"id", "id", Gte, 10},
+		{"id", "id", In, []interface{}{1, 2}},
+		{"name", "name", Contains, "a%"},
+		{"name", "name", Prefix, "b"},
+	}}
+	params := dbx.Params{}
+	sql := q.Expression().Build(db, params)
+	assert.Equal(t, `("name"={:p0}) AND (NOT ("name"={:p1})) AND ("id">={:p2}) AND ("id" IN ({:p3}, {:p4})) AND ("name" ILIKE {:p5}) AND ("name" LIKE {:p6})`, sql)
+	assert.Equal(t, dbx.Params{"p0": "x", "p1": "y", "p2": 10, "p3": 1, "p4": 2, "p5": `%a\%%`, "p6": "b%"}, params)
+}
+
+func TestQuery_OrderBy(t *testing.T) {
+	assert.Equal(t, []string{"id"}, Query{}.OrderBy())
+	q := Query{Orders: []Order{{"created_at", "created_at", true}, {"id", "id", false}}}
+	assert.Equal(t, []string{"created_at DESC", "id"}, q.OrderBy())
+	q = Query{Orders: []Order{{"domain", "domain_name", false}}}
+	assert.Equal(t, []string{"domain_name", "id"}, q.OrderBy())
+	q.Position = &Position{Values: []interface{}{"a", 1}, Backward: true}
+	assert.Equal(t, []string{"domain_name DESC", "id DESC"}, q.OrderBy())
+}
+
+func TestQuery_Keys(t *testing.T) {
+	assert.Equal(t, []string{"id"}, Query{}.Keys())
+	q := Query{Orders: []Order{{"domain", "domain_name", false}}}
+	assert.Equal(t, []string{"domain", "id"}, q.Keys())
+	q = Query{Orders: []Order{{"id", "id", true}, {"name", "name", false}}}
+	assert.Equal(t, []string{"id", "name"}, q.Keys())
+}
+
+func TestQuery_Position(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	q := Query{
+		Conditions: []Condition{{"name", "name", Eq, "x"}},
+		Orders:     []Order{{"created_at", "created_at", false}, {"domain", "domain_name", true}},
+		Position:   &Position{Values: []interface{}{"2020-01-01T00:00:00Z", "b", 3}},
+	}
+	params := dbx.Params{}
+	sql := q.Expression().Build(db, params)
+	assert.Equal(t, `("name"={:p0}) AND (("created_at">{:p1}) OR (("created_at"={:p2}) AND ("domain_name"<{:p3})) OR (("created_at"={:p4}) AND ("domain_name"={:p5}) AND ("id">{:p6})))`, sql)
+	assert.Equal(t, dbx.Params{"p0": "x", "p1": "2020-01-01T00:00:00Z", "p2": "2020-01-01T00:00:00Z", "p3": "b", "p4": "2020-01-01T00:00:00Z", "p5": "b", "p6": 3}, params)
+
+	// backward
+	q.Position.Backward = true
+	params = dbx.Params{}
+	sql = q.Expression().Build(db, params)
+	assert.Equal(t, `("name"={:p0}) AND (("created_at"<{:p1}) OR (("created_at"={:p2}) AND ("domain_name">{:p3})) OR (("created_at"={:p4}) AND ("domain_name"={:p5}) AND ("id"<{:p6})))`, sql)
+
+	// invalid
+	q.Position.Values = []interface{}{1}
+	sql = q.Expression().Build(db, dbx.Params{})
+	assert.Equal(t, `("name"={:p0}) AND (1=0)`, sql)
+}
@@ -0,0 +1,71 @@
+// Package secretbox provides authenticated encryption of small secrets, such as private keys, before they are stored.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize specifies the size of the encryption key in bytes.
+const KeySize = 32
+
+// ErrInvalidCiphertext is returned when a ciphertext is malformed or fails authentication.
+var ErrInvalidCiphertext = errors.New("secretbox: invalid ciphertext")
+
+// Box encrypts and decrypts data with AES-256-GCM.
+// The random nonce used for each encryption is prepended to the ciphertext.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a Box using the given key which must be KeySize bytes long.
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secretbox: key must be %v bytes, got %v", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead}, nil
+}
+
+// NewFromString creates a Box using a base64-encoded key.
+func NewFromString(key string) (*Box, error) {
+	bytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: key is not valid base64: %v", err)
+	}
+	return New(bytes)
+}
+
+// Seal encrypts and authenticates the given plaintext.
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open authenticates and decrypts a ciphertext produced by Seal.
+func (b *Box) Open(ciphertext []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := b.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
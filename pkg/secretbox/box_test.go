@@ -0,0 +1,51 @@
+package secretbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New([]byte("short"))
+	assert.NotNil(t, err)
+	box, err := New(bytes.Repeat([]byte("k"), KeySize))
+	assert.Nil(t, err)
+	assert.NotNil(t, box)
+}
+
+func TestNewFromString(t *testing.T) {
+	_, err := NewFromString("not base64!")
+	assert.NotNil(t, err)
+	_, err = NewFromString(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.NotNil(t, err)
+	box, err := NewFromString(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), KeySize)))
+	assert.Nil(t, err)
+	assert.NotNil(t, box)
+}
+
+func TestBox_SealOpen(t *testing.T) {
+	box, _ := New(bytes.Repeat([]byte("k"), KeySize))
+
+	sealed, err := box.Seal([]byte("secret"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+	sealed2, _ := box.Seal([]byte("secret"))
+	assert.NotEqual(t, sealed, sealed2)
+
+	opened, err := box.Open(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", string(opened))
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = box.Open(sealed)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+	_, err = box.Open([]byte("x"))
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	other, _ := New(bytes.Repeat([]byte("o"), KeySize))
+	_, err = other.Open(sealed2)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+}